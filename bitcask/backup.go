@@ -0,0 +1,515 @@
+package bitcask
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"bitcask.go/data"
+	"bitcask.go/index"
+)
+
+const (
+	// BackupManifestFileName 备份目录中的清单
+	BackupManifestFileName = "backup-manifest"
+
+	// backupTailSuffix 只拷贝了文件尾部的数据时，备份文件名称的后缀
+	backupTailSuffix = ".tail"
+)
+
+// BackupPiece 一次备份中实际拷贝的一段数据
+type BackupPiece struct {
+	Name     string `json:"name"`               // 对应的文件
+	Offset   int64  `json:"offset"`             // 从文件的哪个位置开始拷贝，0 表示拷贝了整个文件
+	Size     int64  `json:"size"`               // 拷贝的数据量
+	Checksum string `json:"checksum,omitempty"` // 拷贝的数据的 sha256 校验值
+}
+
+// objectName 这段数据在备份中保存的名称
+func (piece *BackupPiece) objectName() string {
+	if piece.Offset > 0 {
+		return piece.Name + backupTailSuffix
+	}
+	return piece.Name
+}
+
+// RestoreTarget 恢复到哪一个时间点
+type RestoreTarget struct {
+	// 恢复到这个事务提交之后，为 0 时不按照事务序列号截断
+	// 数据文件按照写入返回成功的顺序追加，事务完成标识之前的记录（包括非事务的 Put、Delete）都会保留，之后的都会被丢弃
+	// 事务的数据已经被 merge 重写时找不到完成标识，返回 ErrRestorePointNotFound
+	SeqNum uint64
+
+	// 恢复到这个时间之前的状态，为零值时使用备份链中最后一次备份
+	// 备份时开启了 Options.RestorePointInterval 的，使用 Time 之后的第一次备份，按照数据文件中的时间点标记截断，
+	// 只保留 Time 之前写入的数据（Time 所在的 RestorePointInterval 时间段内写入的数据也会被丢弃）；
+	// 否则精度只到备份的粒度，恢复到 Time 之前最后一次备份时的状态
+	Time time.Time
+}
+
+// backupFile 备份时数据库中的一个文件
+type backupFile struct {
+	name   string
+	size   int64 // 需要备份的数据量（活跃文件只备份到当前写入的位置）
+	fileID uint32
+	isData bool
+}
+
+// BackUpIncremental 增量备份，只拷贝自上一次备份（since）之后新增或者改变的文件，以及活跃文件新追加的数据
+// since 为 nil 时进行全量备份，since 必须是上一次 BackUpIncremental 返回的清单
+// 注意 B+ 树的索引文件不会被备份，恢复之后需要重新构建
+func (db *DB) BackUpIncremental(dir string, since *Manifest) (*Manifest, error) {
+	if db.option.InMemory {
+		return nil, ErrNotSupportedInMemory
+	}
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, ErrDirIsNotEmpty
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return db.backUpTo(NewLocalBackupTarget(dir), "", since)
+}
+
+// backUpTo 将备份的数据写入 target 中，所有对象的名称都以 prefix 开头
+func (db *DB) backUpTo(target BackupTarget, prefix string, since *Manifest) (*Manifest, error) {
+	// 短暂地持有读锁，拿到当前所有文件的大小，之后只拷贝这个范围之内的数据（数据文件只会追加写入）
+	db.rwmu.RLock()
+	db.waitPendingWrites()
+	manifest := &Manifest{
+		CreatedAt:            time.Now(),
+		SeqNum:               db.seqNum,
+		RestorePointInterval: db.option.RestorePointInterval,
+	}
+	var files []*backupFile
+	for fileID, dataFile := range db.oldFiles {
+		size, err := dataFile.IOManager.Size()
+		if err != nil {
+			db.rwmu.RUnlock()
+			return nil, err
+		}
+		files = append(files, &backupFile{fileID: fileID, size: size, isData: true})
+	}
+	if db.activeFile != nil {
+		manifest.ActiveFileID = db.activeFile.FileID
+		size := db.activeFile.Offsetnow
+		// 无法填充的空洞之后的写入都没有提交，只拷贝空洞之前的数据
+		if hole := db.writeHole.Load(); hole != nil && hole.fileID == db.activeFile.FileID {
+			size = hole.offset
+		}
+		files = append(files, &backupFile{fileID: db.activeFile.FileID, size: size, isData: true})
+	}
+	db.rwmu.RUnlock()
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].fileID < files[j].fileID
+	})
+	for _, file := range files {
+		file.name = filepath.Base(data.GetDataFileName(db.option.DirPath, file.fileID))
+	}
+	// merge 之后生成的文件在数据库打开期间不会再被修改，NAMESPACES 文件每次修改都会被替换，修改时间会改变
+	for _, name := range []string{data.HintFilename, data.MergeFinishedFilename, NamespacesFileName} {
+		if info, err := os.Stat(filepath.Join(db.option.DirPath, name)); err == nil {
+			files = append(files, &backupFile{name: name, size: info.Size()})
+		}
+	}
+
+	prevFiles := make(map[string]ManifestFile)
+	if since != nil {
+		manifest.Since = since.CreatedAt
+		for _, file := range since.Files {
+			prevFiles[file.Name] = file
+		}
+	}
+
+	for _, file := range files {
+		srcPath := filepath.Join(db.option.DirPath, file.name)
+		info, err := os.Stat(srcPath)
+		if err != nil {
+			return nil, err
+		}
+
+		mf := ManifestFile{Name: file.name, Size: file.size, ModTime: info.ModTime()}
+		prev, ok := prevFiles[file.name]
+		piece := &BackupPiece{Name: file.name, Offset: 0, Size: file.size}
+
+		switch {
+		// 上一次备份时的活跃文件，如果前面的数据没有改变，只需要拷贝新追加的数据
+		case ok && file.isData && file.fileID == since.ActiveFileID && file.size >= prev.Size:
+			prefixCRC, err := fileCRC(srcPath, prev.Size)
+			if err != nil {
+				return nil, err
+			}
+			if prefixCRC == prev.CRC {
+				piece.Offset, piece.Size = prev.Size, file.size-prev.Size
+				mf.CRC = prev.CRC
+			}
+
+		// 大小和修改时间都没有变化的封存文件，沿用上一次备份的数据
+		case ok && file.size == prev.Size && info.ModTime().Equal(prev.ModTime) && !file.isActive(manifest):
+			mf.CRC = prev.CRC
+			piece = nil
+		}
+
+		// 新的文件，或者已经改变的文件（例如 merge 之后被替换了），拷贝整个文件，否则只拷贝尾部追加的数据
+		if piece != nil && (piece.Offset == 0 || piece.Size > 0) {
+			mf.CRC, err = putFileRange(target, prefix, srcPath, piece, mf.CRC)
+			if err != nil {
+				return nil, err
+			}
+			manifest.Pieces = append(manifest.Pieces, *piece)
+		}
+		manifest.Files = append(manifest.Files, mf)
+	}
+
+	// 最后写入清单，清单存在说明备份是完整的
+	if err := putManifest(target, prefix+BackupManifestFileName, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// isActive 是否是备份时的活跃文件（还在被写入，修改时间一直在变）
+func (file *backupFile) isActive(manifest *Manifest) bool {
+	return file.isData && file.fileID == manifest.ActiveFileID
+}
+
+// ReadBackupManifest 读取备份目录中的清单
+func ReadBackupManifest(dir string) (*Manifest, error) {
+	return readManifest(filepath.Join(dir, BackupManifestFileName))
+}
+
+// Restore 按顺序应用备份链（第一个为全量备份，后面为依次的增量备份），将数据恢复到 destDir 中
+// 可以恢复到某个时间之前，或者某一个事务提交之后的状态（见 RestoreTarget），失败时删除已经写入 destDir 的数据
+func Restore(backupChain []string, target RestoreTarget, destDir string) error {
+	var manifests []*Manifest
+	for _, dir := range backupChain {
+		manifest, err := ReadBackupManifest(dir)
+		if err != nil {
+			return err
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	return restore(manifests, func(i int, name string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(backupChain[i], name))
+	}, target, destDir)
+}
+
+// restore 依次应用备份链中的数据，open 用于读取第 i 个备份中的对象
+func restore(manifests []*Manifest, open func(i int, name string) (io.ReadCloser, error),
+	target RestoreTarget, destDir string) error {
+	if len(manifests) == 0 {
+		return ErrInvalidBackupChain
+	}
+	entries, err := os.ReadDir(destDir)
+	if err == nil && len(entries) > 0 {
+		return ErrDirIsNotEmpty
+	}
+	destExists := err == nil
+
+	if err := restoreTo(manifests, open, target, destDir); err != nil {
+		// 删除写了一半的数据，destDir 是 Restore 创建的时候连目录一起删除
+		if destExists {
+			_ = removeDirContents(destDir)
+		} else {
+			_ = os.RemoveAll(destDir)
+		}
+		return err
+	}
+	return nil
+}
+
+// restoreTo 校验备份链，将数据恢复到空的 destDir 中
+func restoreTo(manifests []*Manifest, open func(i int, name string) (io.ReadCloser, error),
+	target RestoreTarget, destDir string) error {
+
+	// 校验备份链，每一个增量备份都需要基于前一个备份
+	for i, manifest := range manifests {
+		if i == 0 && !manifest.Since.IsZero() {
+			return ErrInvalidBackupChain
+		}
+		if i > 0 && !manifest.Since.Equal(manifests[i-1].CreatedAt) {
+			return ErrInvalidBackupChain
+		}
+	}
+
+	// 找到需要恢复到的最后一次备份：Time 之后的第一次备份带有时间点标记时，恢复它之后再截断，否则使用 Time 之前的最后一次备份
+	last, truncateTime := len(manifests)-1, false
+	if !target.Time.IsZero() {
+		for last >= 0 && manifests[last].CreatedAt.After(target.Time) {
+			if manifests[last].RestorePointInterval > 0 && (last == 0 || !manifests[last-1].CreatedAt.After(target.Time)) {
+				truncateTime = true
+				break
+			}
+			last--
+		}
+		if last < 0 {
+			return ErrRestorePointNotFound
+		}
+	}
+
+	if err := os.MkdirAll(destDir, os.ModePerm); err != nil {
+		return err
+	}
+	for i := 0; i <= last; i++ {
+		for _, piece := range manifests[i].Pieces {
+			src, err := open(i, piece.objectName())
+			if err != nil {
+				return err
+			}
+			err = applyBackupPiece(src, destDir, piece)
+			_ = src.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// 删除最后一次备份时已经不存在的文件，并校验所有文件的内容
+	files := make(map[string]ManifestFile)
+	for _, file := range manifests[last].Files {
+		files[file.Name] = file
+	}
+	entries, err := os.ReadDir(destDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, ok := files[entry.Name()]; !ok {
+			if err := os.Remove(filepath.Join(destDir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	for _, file := range files {
+		crc, err := fileCRC(filepath.Join(destDir, file.Name), -1)
+		if err != nil {
+			return err
+		}
+		if crc != file.CRC {
+			return ErrBackupCorrupted
+		}
+	}
+
+	if target.SeqNum > 0 {
+		if err := truncateToSeqNum(destDir, target.SeqNum); err != nil {
+			return err
+		}
+	}
+	if truncateTime {
+		return truncateToTime(destDir, target.Time)
+	}
+	return nil
+}
+
+// removeDirContents 删除目录中的所有文件，保留目录本身
+func removeDirContents(dirPath string) error {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dirPath, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyBackupPiece 将备份中的一段数据写入恢复的目录中
+func applyBackupPiece(src io.Reader, destDir string, piece BackupPiece) error {
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if piece.Offset > 0 {
+		flag = os.O_WRONLY
+	}
+
+	dest, err := os.OpenFile(filepath.Join(destDir, piece.Name), flag, 0644)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	// 尾部的数据从对应的位置开始覆盖
+	if piece.Offset > 0 {
+		if err := dest.Truncate(piece.Offset); err != nil {
+			return err
+		}
+		if _, err := dest.Seek(piece.Offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	checksum := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(dest, checksum), src, piece.Size); err != nil {
+		if err == io.EOF {
+			return ErrBackupCorrupted
+		}
+		return err
+	}
+	if piece.Checksum != "" && piece.Checksum != hex.EncodeToString(checksum.Sum(nil)) {
+		return ErrBackupCorrupted
+	}
+	return dest.Sync()
+}
+
+// truncateToSeqNum 截断数据文件，只保留到事务 seqNum 的完成标识为止
+func truncateToSeqNum(dirPath string, seqNum uint64) error {
+	found, err := truncateDataFiles(dirPath, func(record *DumpRecord) (int64, bool) {
+		if record.Type == data.LogRecordTxnFinished && record.SeqNum == seqNum {
+			return record.Offset + record.Size, true
+		}
+		return 0, false
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrRestorePointNotFound
+	}
+	return nil
+}
+
+// truncateDataFiles 按照写入的顺序遍历数据文件中的记录，找到第一条 cut 返回 true 的记录，
+// 将它所在的文件截断到 cut 返回的位置，并删除之后所有的数据文件；没有找到时不做任何修改
+func truncateDataFiles(dirPath string, cut func(record *DumpRecord) (int64, bool)) (bool, error) {
+	fileIDs, err := getDataFileIDs(dirPath)
+	if err != nil {
+		return false, err
+	}
+
+	for i, fid := range fileIDs {
+		end := int64(-1)
+		err := DumpFile(data.GetDataFileName(dirPath, uint32(fid)), func(record *DumpRecord) bool {
+			if record.Err != nil {
+				return true
+			}
+			offset, ok := cut(record)
+			if ok {
+				end = offset
+			}
+			return !ok
+		})
+		if err != nil {
+			return false, err
+		}
+		if end < 0 {
+			continue
+		}
+
+		if err := os.Truncate(data.GetDataFileName(dirPath, uint32(fid)), end); err != nil {
+			return false, err
+		}
+		for _, laterID := range fileIDs[i+1:] {
+			if err := os.Remove(data.GetDataFileName(dirPath, uint32(laterID))); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// backUpAll 将数据目录中的所有文件（文件锁和可以重建的 hybrid 索引除外）写入 target，最后写入清单
+// 注意！！！使用这个 DB 方法的时候必须持有读锁，并且已经等待并发的写入完成
+func (db *DB) backUpAll(target BackupTarget) error {
+	manifest := &Manifest{
+		CreatedAt:            time.Now(),
+		SeqNum:               db.seqNum,
+		RestorePointInterval: db.option.RestorePointInterval,
+	}
+	var activeFileName string
+	var activeSize int64
+	if db.activeFile != nil {
+		manifest.ActiveFileID = db.activeFile.FileID
+		activeFileName = data.GetDataFileName(db.option.DirPath, db.activeFile.FileID)
+		activeSize = db.activeFile.Offsetnow
+		// 无法填充的空洞之后的写入都没有提交，只拷贝空洞之前的数据
+		if hole := db.writeHole.Load(); hole != nil && hole.fileID == db.activeFile.FileID {
+			activeSize = hole.offset
+		}
+	}
+
+	err := filepath.Walk(db.option.DirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() == fileLockName || info.Name() == index.HybridIndexFileName {
+			return nil
+		}
+		name, err := filepath.Rel(db.option.DirPath, path)
+		if err != nil {
+			return err
+		}
+		size := info.Size()
+		if path == activeFileName {
+			size = activeSize
+		}
+		return putFile(target, "", manifest, path, filepath.ToSlash(name), size, info.ModTime())
+	})
+	if err != nil {
+		return err
+	}
+
+	// 最后写入清单，清单存在说明备份是完整的
+	return putManifest(target, BackupManifestFileName, manifest)
+}
+
+// putFileRange 将文件中 piece 对应范围的数据写入 target，同时计算这段数据的 sha256 校验值
+// 返回从 crc 开始继续计算到这段数据末尾的 crc 校验值
+func putFileRange(target BackupTarget, prefix, srcPath string, piece *BackupPiece, crc uint32) (uint32, error) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	return putPiece(target, prefix, piece, io.NewSectionReader(src, piece.Offset, piece.Size), crc)
+}
+
+// putPiece 将 r 中 piece.Size 字节的数据写入 target，同时计算这段数据的 sha256 校验值
+// 返回从 crc 开始继续计算到这段数据末尾的 crc 校验值
+func putPiece(target BackupTarget, prefix string, piece *BackupPiece, r io.Reader, crc uint32) (uint32, error) {
+	crcHash := &crcWriter{crc: crc}
+	checksum := sha256.New()
+	reader := io.TeeReader(r, io.MultiWriter(crcHash, checksum))
+	if err := target.PutObject(prefix+piece.objectName(), reader, piece.Size); err != nil {
+		return 0, err
+	}
+	piece.Checksum = hex.EncodeToString(checksum.Sum(nil))
+	return crcHash.crc, nil
+}
+
+// fileCRC 计算文件前 size 个字节的 crc 校验值，size 为 -1 时计算整个文件
+func fileCRC(fileName string, size int64) (uint32, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if size >= 0 {
+		reader = io.LimitReader(file, size)
+	}
+	hash := &crcWriter{}
+	if _, err := io.Copy(hash, reader); err != nil {
+		return 0, err
+	}
+	return hash.crc, nil
+}
+
+// crcWriter 在写入的同时累计计算 crc 校验值
+type crcWriter struct {
+	crc uint32
+}
+
+func (w *crcWriter) Write(p []byte) (int, error) {
+	w.crc = crc32.Update(w.crc, crc32.IEEETable, p)
+	return len(p), nil
+}
@@ -0,0 +1,201 @@
+package bitcask
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3BackupTarget 使用兼容 S3 协议的对象存储保存备份（AWS S3、MinIO 等），使用 path-style 的访问方式
+type S3BackupTarget struct {
+	Endpoint  string // 例如 https://s3.us-east-1.amazonaws.com 或 http://127.0.0.1:9000
+	Bucket    string
+	Region    string
+	AccessKey string // 为空时不对请求进行签名
+	SecretKey string
+
+	Client *http.Client // 为 nil 时使用 http.DefaultClient
+}
+
+// s3ListResult ListObjectsV2 的响应
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (st *S3BackupTarget) PutObject(name string, r io.Reader, size int64) error {
+	req, err := st.newRequest(http.MethodPut, name, nil, r)
+	if err != nil {
+		return err
+	}
+	// 数据是流式写入的，S3 需要事先知道对象的大小
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	resp, err := st.do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (st *S3BackupTarget) GetObject(name string) (io.ReadCloser, error) {
+	req, err := st.newRequest(http.MethodGet, name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := st.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (st *S3BackupTarget) List(prefix string) ([]string, error) {
+	var names []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		req, err := st.newRequest(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := st.do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, content := range result.Contents {
+			names = append(names, content.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (st *S3BackupTarget) Delete(name string) error {
+	req, err := st.newRequest(http.MethodDelete, name, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := st.do(req)
+	if err == ErrObjectNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// newRequest 构造访问 bucket 中对象 name 的请求，name 为空时访问 bucket 本身
+func (st *S3BackupTarget) newRequest(method, name string, query url.Values, body io.Reader) (*http.Request, error) {
+	u, err := url.Parse(strings.TrimRight(st.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	u.Path += "/" + st.Bucket
+	if name != "" {
+		u.Path += "/" + name
+	}
+	u.RawQuery = query.Encode()
+	return http.NewRequest(method, u.String(), body)
+}
+
+// do 签名并发送请求，非 2xx 的响应转换为错误
+func (st *S3BackupTarget) do(req *http.Request) (*http.Response, error) {
+	st.sign(req, time.Now().UTC())
+
+	client := st.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrObjectNotFound
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, fmt.Errorf("s3 %s %s: %s %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// sign 使用 AWS Signature Version 4 对请求签名，请求体不参与签名，以便流式上传
+func (st *S3BackupTarget) sign(req *http.Request, now time.Time) {
+	const payloadHash = "UNSIGNED-PAYLOAD"
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	if st.AccessKey == "" {
+		return
+	}
+
+	region := st.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	date := now.Format("20060102")
+	scope := date + "/" + region + "/s3/aws4_request"
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + req.Header.Get("X-Amz-Date") + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + req.Header.Get("X-Amz-Date") + "\n" + scope + "\n" +
+		hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+st.SecretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+st.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,274 @@
+package bitcask
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"bitcask.go/utils"
+)
+
+// backupNameLayout 备份在 BackupTarget 中的名称（前缀），按照创建时间生成，字典序即为时间顺序
+const backupNameLayout = "20060102T150405.000000000Z"
+
+// BackupTarget 保存备份的对象存储，对象名称使用 / 分隔
+type BackupTarget interface {
+	// PutObject 写入一个对象，r 中恰好有 size 字节的数据
+	PutObject(name string, r io.Reader, size int64) error
+
+	// GetObject 读取一个对象，不存在时返回 ErrObjectNotFound
+	GetObject(name string) (io.ReadCloser, error)
+
+	// List 按字典序返回所有以 prefix 开头的对象名称
+	List(prefix string) ([]string, error)
+
+	// Delete 删除一个对象，对象不存在时不返回错误
+	Delete(name string) error
+}
+
+// fileLinker 可以直接链接本地文件的 BackupTarget，checkpoint 时不可变的文件不需要拷贝
+type fileLinker interface {
+	LinkFile(name, srcPath string) error
+}
+
+// LocalBackupTarget 使用本地目录保存备份，可以作为对象存储的替身，也可以是挂载的网络文件系统
+type LocalBackupTarget struct {
+	dir string
+}
+
+// NewLocalBackupTarget 初始化本地目录的 BackupTarget
+func NewLocalBackupTarget(dir string) *LocalBackupTarget {
+	return &LocalBackupTarget{dir: dir}
+}
+
+func (lt *LocalBackupTarget) PutObject(name string, r io.Reader, size int64) error {
+	fileName := filepath.Join(lt.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm); err != nil {
+		return err
+	}
+
+	// 先写入临时文件再重命名，读取到的对象一定是完整的
+	tmpFile, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	n, err := io.Copy(tmpFile, r)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return io.ErrUnexpectedEOF
+	}
+	if err := tmpFile.Sync(); err != nil {
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), fileName)
+}
+
+// LinkFile 将本地文件 srcPath 作为名为 name 的对象，创建硬链接，跨文件系统时拷贝文件
+func (lt *LocalBackupTarget) LinkFile(name, srcPath string) error {
+	fileName := filepath.Join(lt.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm); err != nil {
+		return err
+	}
+	return utils.LinkOrCopyFile(srcPath, fileName)
+}
+
+func (lt *LocalBackupTarget) GetObject(name string) (io.ReadCloser, error) {
+	file, err := os.Open(filepath.Join(lt.dir, filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	}
+	return file, err
+}
+
+func (lt *LocalBackupTarget) List(prefix string) ([]string, error) {
+	var names []string
+	err := filepath.Walk(lt.dir, func(fileName string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(lt.dir, fileName)
+		if err != nil {
+			return err
+		}
+		if name = filepath.ToSlash(name); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+func (lt *LocalBackupTarget) Delete(name string) error {
+	fileName := filepath.Join(lt.dir, filepath.FromSlash(name))
+	if err := os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// 顺便删除已经为空的上层目录
+	for dir := filepath.Dir(fileName); dir != filepath.Clean(lt.dir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// BackUpToTarget 将备份直接写入 target 中，不会在本地生成中间文件
+// since 为 nil 时进行全量备份（相当于一个 checkpoint），否则基于 since 进行增量备份
+// keepLast 大于 0 时，备份完成之后只保留最近的 keepLast 个备份（以及恢复它们所需要的更早的备份）
+func (db *DB) BackUpToTarget(target BackupTarget, since *Manifest, keepLast int) (*Manifest, error) {
+	if db.option.InMemory {
+		return nil, ErrNotSupportedInMemory
+	}
+	name := time.Now().UTC().Format(backupNameLayout)
+	manifest, err := db.backUpTo(target, name+"/", since)
+	if err != nil {
+		return nil, err
+	}
+	if keepLast > 0 {
+		if err := PruneBackups(target, keepLast); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+// ListBackups 按创建时间从早到晚返回 target 中所有完整的备份的名称
+func ListBackups(target BackupTarget) ([]string, error) {
+	names, err := target.List("")
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []string
+	for _, name := range names {
+		if path.Base(name) == BackupManifestFileName && path.Dir(name) != "." {
+			backups = append(backups, path.Dir(name))
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// ReadTargetManifest 读取 target 中一个备份的清单
+func ReadTargetManifest(target BackupTarget, backup string) (*Manifest, error) {
+	reader, err := target.GetObject(backup + "/" + BackupManifestFileName)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	manifest := &Manifest{}
+	if err := json.NewDecoder(reader).Decode(manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// PruneBackups 只保留最近的 keepLast 个备份，增量备份所依赖的更早的备份也会被保留
+// 比最近一个完整的备份更早的未完成的备份（没有清单）也会被删除
+func PruneBackups(target BackupTarget, keepLast int) error {
+	chains, manifests, err := readBackupChains(target)
+	if err != nil {
+		return err
+	}
+	if len(manifests) <= keepLast {
+		return nil
+	}
+
+	keep := make(map[string]bool)
+	for _, backup := range manifests[len(manifests)-keepLast:] {
+		for _, name := range chains[backup] {
+			keep[name] = true
+		}
+	}
+	newest := manifests[len(manifests)-1]
+
+	names, err := target.List("")
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		backup := strings.SplitN(name, "/", 2)[0]
+		if keep[backup] || backup > newest || !strings.Contains(name, "/") {
+			continue
+		}
+		if err := target.Delete(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBackupChains 读取 target 中的所有备份，返回每个备份对应的备份链（从全量备份开始），以及按时间排序的所有备份
+// 备份链不完整（依赖的备份已经不存在）的备份会被忽略
+func readBackupChains(target BackupTarget) (map[string][]string, []string, error) {
+	backups, err := ListBackups(target)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chains := make(map[string][]string)
+	byCreatedAt := make(map[time.Time]string)
+	var valid []string
+	for _, backup := range backups {
+		manifest, err := ReadTargetManifest(target, backup)
+		if err != nil {
+			return nil, nil, err
+		}
+		if manifest.Since.IsZero() {
+			chains[backup] = []string{backup}
+		} else if prev, ok := byCreatedAt[manifest.Since.UTC()]; ok {
+			chains[backup] = append(append([]string{}, chains[prev]...), backup)
+		} else {
+			continue
+		}
+		byCreatedAt[manifest.CreatedAt.UTC()] = backup
+		valid = append(valid, backup)
+	}
+	return chains, valid, nil
+}
+
+// RestoreFromTarget 从 target 中的备份恢复数据到 destDir，会自动找到 backup 所依赖的备份链
+// backup 为空时使用最近的一个备份
+func RestoreFromTarget(target BackupTarget, backup string, restoreTarget RestoreTarget, destDir string) error {
+	chains, backups, err := readBackupChains(target)
+	if err != nil {
+		return err
+	}
+	if backup == "" && len(backups) > 0 {
+		backup = backups[len(backups)-1]
+	}
+	chain, ok := chains[backup]
+	if !ok {
+		return ErrRestorePointNotFound
+	}
+
+	var manifests []*Manifest
+	for _, name := range chain {
+		manifest, err := ReadTargetManifest(target, name)
+		if err != nil {
+			return err
+		}
+		manifests = append(manifests, manifest)
+	}
+	return restore(manifests, func(i int, name string) (io.ReadCloser, error) {
+		return target.GetObject(chain[i] + "/" + name)
+	}, restoreTarget, destDir)
+}
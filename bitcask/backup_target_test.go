@@ -0,0 +1,234 @@
+package bitcask
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"bitcask.go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3Server 在内存中模拟兼容 S3 协议的对象存储，只支持备份用到的接口
+type fakeS3Server struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string][]byte
+}
+
+func newFakeS3Server(bucket string) *httptest.Server {
+	fake := &fakeS3Server{bucket: bucket, objects: make(map[string][]byte)}
+	return httptest.NewServer(fake)
+}
+
+func (f *fakeS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if path != f.bucket && !strings.HasPrefix(path, f.bucket+"/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(path, f.bucket), "/")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPut:
+		buf, err := io.ReadAll(r.Body)
+		if err != nil || int64(len(buf)) != r.ContentLength {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = buf
+	case r.Method == http.MethodGet && key == "":
+		var result struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+		}
+		var keys []string
+		for name := range f.objects {
+			if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+				keys = append(keys, name)
+			}
+		}
+		sort.Strings(keys)
+		for _, name := range keys {
+			result.Contents = append(result.Contents, struct {
+				Key string `xml:"Key"`
+			}{Key: name})
+		}
+		_ = xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodGet:
+		buf, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(buf)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func testBackUpToTarget(t *testing.T, target BackupTarget) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-backup-target")
+	opts.DirPath = dir
+	opts.DataFileSize = 4 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	var manifest *Manifest
+	for round := 0; round < 4; round++ {
+		for i := round * 50; i < (round+1)*50; i++ {
+			assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+		}
+		// 第三次备份时重新进行一次全量备份
+		since := manifest
+		if round == 2 {
+			since = nil
+		}
+		manifest, err = db.BackUpToTarget(target, since, 1)
+		assert.Nil(t, err)
+	}
+
+	// 只保留最近的一个备份，以及它依赖的全量备份
+	backups, err := ListBackups(target)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(backups))
+
+	restoreDir, _ := os.MkdirTemp("", "bitcask-go-restore-target")
+	defer os.RemoveAll(restoreDir)
+	assert.Nil(t, RestoreFromTarget(target, "", RestoreTarget{}, restoreDir))
+	restoreOpts := opts
+	restoreOpts.DirPath = restoreDir
+	restoreDB, err := Open(restoreOpts)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, len(restoreDB.ListKeys()))
+	assert.Nil(t, restoreDB.Close())
+
+	// 恢复到全量备份
+	restoreDir2, _ := os.MkdirTemp("", "bitcask-go-restore-target")
+	defer os.RemoveAll(restoreDir2)
+	assert.Nil(t, RestoreFromTarget(target, backups[0], RestoreTarget{}, restoreDir2))
+	restoreOpts.DirPath = restoreDir2
+	restoreDB, err = Open(restoreOpts)
+	assert.Nil(t, err)
+	assert.Equal(t, 150, len(restoreDB.ListKeys()))
+	assert.Nil(t, restoreDB.Close())
+
+	// 数据被篡改时校验失败
+	names, err := target.List(backups[0] + "/")
+	assert.Nil(t, err)
+	for _, name := range names {
+		if strings.HasSuffix(name, ".data") {
+			assert.Nil(t, target.PutObject(name, strings.NewReader("corrupted"), 9))
+			break
+		}
+	}
+	restoreDir3, _ := os.MkdirTemp("", "bitcask-go-restore-target")
+	defer os.RemoveAll(restoreDir3)
+	err = RestoreFromTarget(target, backups[0], RestoreTarget{}, restoreDir3)
+	assert.Equal(t, ErrBackupCorrupted, err)
+}
+
+func TestDB_BackUpToTarget_Local(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-backup-local-target")
+	defer os.RemoveAll(dir)
+	testBackUpToTarget(t, NewLocalBackupTarget(dir))
+}
+
+func TestDB_BackUpToTarget_S3(t *testing.T) {
+	server := newFakeS3Server("backups")
+	defer server.Close()
+
+	target := &S3BackupTarget{
+		Endpoint:  server.URL,
+		Bucket:    "backups",
+		AccessKey: "test-key",
+		SecretKey: "test-secret",
+	}
+	testBackUpToTarget(t, target)
+
+	_, err := target.GetObject("not-exist")
+	assert.Equal(t, ErrObjectNotFound, err)
+	assert.Nil(t, target.Delete("not-exist"))
+}
+
+func testCheckpointToTarget(t *testing.T, target BackupTarget) {
+	for _, indexType := range []IndexerType{BTree, BPlusTree} {
+		opts := DefaultOptions
+		dir, _ := os.MkdirTemp("", "bitcask-go-checkpoint-target")
+		opts.DirPath = dir
+		opts.DataFileSize = 4 * 1024
+		opts.IndexType = indexType
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		for i := 0; i < 100; i++ {
+			assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+		}
+		manifest, err := db.CheckpointToTarget(target, 1)
+		assert.Nil(t, err)
+		for _, file := range manifest.Files {
+			assert.NotEqual(t, fileLockName, file.Name)
+		}
+
+		// checkpoint 之后的写入不会出现在恢复的数据中
+		assert.Nil(t, db.Put(utils.GetTestKey(100), utils.RandomValue(24)))
+		destroyDB(db)
+
+		backups, err := ListBackups(target)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(backups))
+
+		restoreDir, _ := os.MkdirTemp("", "bitcask-go-restore-checkpoint")
+		assert.Nil(t, RestoreFromTarget(target, "", RestoreTarget{}, restoreDir))
+		restoreOpts := opts
+		restoreOpts.DirPath = restoreDir
+		restoreDB, err := Open(restoreOpts)
+		assert.Nil(t, err)
+		assert.Equal(t, 100, len(restoreDB.ListKeys()))
+		_, err = restoreDB.Get(utils.GetTestKey(100))
+		assert.Equal(t, ErrKeyNotFound, err)
+
+		// 恢复之后可以继续写入
+		wb := restoreDB.NewWriteBatch(DefaultWriteBatchOptions)
+		assert.Nil(t, wb.Put(utils.GetTestKey(100), utils.RandomValue(24)))
+		assert.Nil(t, wb.Commit())
+		destroyDB(restoreDB)
+	}
+}
+
+func TestDB_CheckpointToTarget_Local(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-checkpoint-local-target")
+	defer os.RemoveAll(dir)
+	testCheckpointToTarget(t, NewLocalBackupTarget(dir))
+}
+
+func TestDB_CheckpointToTarget_S3(t *testing.T) {
+	server := newFakeS3Server("checkpoints")
+	defer server.Close()
+
+	testCheckpointToTarget(t, &S3BackupTarget{
+		Endpoint:  server.URL,
+		Bucket:    "checkpoints",
+		AccessKey: "test-key",
+		SecretKey: "test-secret",
+	})
+}
@@ -0,0 +1,243 @@
+package bitcask
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"bitcask.go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_BackUpIncremental(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-backup")
+	opts.DirPath = dir
+	opts.DataFileSize = 4 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+
+	fullDir, _ := os.MkdirTemp("", "bitcask-go-backup-full")
+	defer os.RemoveAll(fullDir)
+	full, err := db.BackUpIncremental(fullDir, nil)
+	assert.Nil(t, err)
+	assert.True(t, full.Since.IsZero())
+
+	// 增量备份只拷贝新追加的数据
+	for i := 100; i < 110; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	incrDir, _ := os.MkdirTemp("", "bitcask-go-backup-incr")
+	defer os.RemoveAll(incrDir)
+	incr, err := db.BackUpIncremental(incrDir, full)
+	assert.Nil(t, err)
+	assert.Equal(t, full.CreatedAt, incr.Since)
+	var copied int64
+	for _, piece := range incr.Pieces {
+		copied += piece.Size
+	}
+	assert.True(t, copied < 4*1024)
+
+	readManifest, err := ReadBackupManifest(incrDir)
+	assert.Nil(t, err)
+	assert.Equal(t, len(incr.Pieces), len(readManifest.Pieces))
+
+	// 恢复整个备份链
+	restoreDir, _ := os.MkdirTemp("", "bitcask-go-restore")
+	defer os.RemoveAll(restoreDir)
+	assert.Nil(t, Restore([]string{fullDir, incrDir}, RestoreTarget{}, restoreDir))
+	restoreOpts := opts
+	restoreOpts.DirPath = restoreDir
+	restoreDB, err := Open(restoreOpts)
+	assert.Nil(t, err)
+	assert.Equal(t, 110, len(restoreDB.ListKeys()))
+	assert.Nil(t, restoreDB.Close())
+
+	// 恢复到全量备份的时间点
+	restoreDir2, _ := os.MkdirTemp("", "bitcask-go-restore")
+	defer os.RemoveAll(restoreDir2)
+	assert.Nil(t, Restore([]string{fullDir, incrDir}, RestoreTarget{Time: full.CreatedAt}, restoreDir2))
+	restoreOpts.DirPath = restoreDir2
+	restoreDB, err = Open(restoreOpts)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, len(restoreDB.ListKeys()))
+	assert.Nil(t, restoreDB.Close())
+
+	// 备份链不连续
+	restoreDir3, _ := os.MkdirTemp("", "bitcask-go-restore")
+	defer os.RemoveAll(restoreDir3)
+	err = Restore([]string{incrDir}, RestoreTarget{}, restoreDir3)
+	assert.Equal(t, ErrInvalidBackupChain, err)
+	err = Restore([]string{fullDir}, RestoreTarget{Time: full.CreatedAt.Add(-time.Hour)}, restoreDir3)
+	assert.Equal(t, ErrRestorePointNotFound, err)
+}
+
+func TestRestore_SeqNum(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-backup-seq")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 3; i++ {
+		wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+		assert.Nil(t, wb.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+		assert.Nil(t, wb.Commit())
+	}
+
+	backupDir, _ := os.MkdirTemp("", "bitcask-go-backup-seq-full")
+	defer os.RemoveAll(backupDir)
+	_, err = db.BackUpIncremental(backupDir, nil)
+	assert.Nil(t, err)
+
+	// 恢复到第二个事务提交之后
+	restoreDir, _ := os.MkdirTemp("", "bitcask-go-restore-seq")
+	defer os.RemoveAll(restoreDir)
+	assert.Nil(t, Restore([]string{backupDir}, RestoreTarget{SeqNum: 2}, restoreDir))
+	restoreOpts := opts
+	restoreOpts.DirPath = restoreDir
+	restoreDB, err := Open(restoreOpts)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(restoreDB.ListKeys()))
+	_, err = restoreDB.Get(utils.GetTestKey(2))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, restoreDB.Close())
+
+	restoreDir2, _ := os.MkdirTemp("", "bitcask-go-restore-seq")
+	defer os.RemoveAll(restoreDir2)
+	err = Restore([]string{backupDir}, RestoreTarget{SeqNum: 10}, restoreDir2)
+	assert.Equal(t, ErrRestorePointNotFound, err)
+
+	// 非事务的写入按照写入的顺序保留在事务之前或者之后
+	assert.Nil(t, db.Put(utils.GetTestKey(3), utils.RandomValue(24)))
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put(utils.GetTestKey(4), utils.RandomValue(24)))
+	assert.Nil(t, wb.Commit())
+	assert.Nil(t, db.Delete(utils.GetTestKey(0)))
+	assert.Nil(t, db.Put(utils.GetTestKey(5), utils.RandomValue(24)))
+	backupDir2, _ := os.MkdirTemp("", "bitcask-go-backup-seq-full")
+	defer os.RemoveAll(backupDir2)
+	_, err = db.BackUpIncremental(backupDir2, nil)
+	assert.Nil(t, err)
+	restoreDir3, _ := os.MkdirTemp("", "bitcask-go-restore-seq")
+	defer os.RemoveAll(restoreDir3)
+	assert.Nil(t, Restore([]string{backupDir2}, RestoreTarget{SeqNum: 4}, restoreDir3))
+	restoreOpts.DirPath = restoreDir3
+	restoreDB, err = Open(restoreOpts)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(restoreDB.ListKeys()))
+	_, err = restoreDB.Get(utils.GetTestKey(0))
+	assert.Nil(t, err)
+	_, err = restoreDB.Get(utils.GetTestKey(3))
+	assert.Nil(t, err)
+	_, err = restoreDB.Get(utils.GetTestKey(5))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, restoreDB.Close())
+}
+
+func TestRestore_Time(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-backup-time")
+	opts.DirPath = dir
+	opts.RestorePointInterval = 10 * time.Millisecond
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	fullDir, _ := os.MkdirTemp("", "bitcask-go-backup-time-full")
+	defer os.RemoveAll(fullDir)
+	full, err := db.BackUpIncremental(fullDir, nil)
+	assert.Nil(t, err)
+
+	// 两次备份之间的某个时间点
+	for i := 10; i < 20; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	time.Sleep(30 * time.Millisecond)
+	target := time.Now()
+	time.Sleep(30 * time.Millisecond)
+	for i := 20; i < 30; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	assert.Nil(t, db.Delete(utils.GetTestKey(0)))
+	incrDir, _ := os.MkdirTemp("", "bitcask-go-backup-time-incr")
+	defer os.RemoveAll(incrDir)
+	_, err = db.BackUpIncremental(incrDir, full)
+	assert.Nil(t, err)
+
+	// 恢复到两次备份之间的时间点，而不是之前的那次备份
+	restoreDir, _ := os.MkdirTemp("", "bitcask-go-restore-time")
+	defer os.RemoveAll(restoreDir)
+	assert.Nil(t, Restore([]string{fullDir, incrDir}, RestoreTarget{Time: target}, restoreDir))
+	restoreOpts := opts
+	restoreOpts.DirPath = restoreDir
+	restoreDB, err := Open(restoreOpts)
+	assert.Nil(t, err)
+	assert.Equal(t, 20, len(restoreDB.ListKeys()))
+	_, err = restoreDB.Get(utils.GetTestKey(0))
+	assert.Nil(t, err)
+	_, err = restoreDB.Get(utils.GetTestKey(20))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, restoreDB.Close())
+
+	// 只有时间点之后的一次全量备份
+	restoreDir2, _ := os.MkdirTemp("", "bitcask-go-restore-time")
+	defer os.RemoveAll(restoreDir2)
+	fullDir2, _ := os.MkdirTemp("", "bitcask-go-backup-time-full")
+	defer os.RemoveAll(fullDir2)
+	_, err = db.BackUpIncremental(fullDir2, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, Restore([]string{fullDir2}, RestoreTarget{Time: target}, restoreDir2))
+	restoreOpts.DirPath = restoreDir2
+	restoreDB, err = Open(restoreOpts)
+	assert.Nil(t, err)
+	assert.Equal(t, 20, len(restoreDB.ListKeys()))
+	assert.Nil(t, restoreDB.Close())
+}
+
+func TestRestore_RemoveDestDirOnError(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-backup-error")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	backupDir, _ := os.MkdirTemp("", "bitcask-go-backup-error-full")
+	defer os.RemoveAll(backupDir)
+	manifest, err := db.BackUpIncremental(backupDir, nil)
+	assert.Nil(t, err)
+
+	// 备份中的数据被破坏
+	fileName := filepath.Join(backupDir, manifest.Pieces[0].objectName())
+	buf, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	buf[len(buf)/2] ^= 0xff
+	assert.Nil(t, os.WriteFile(fileName, buf, 0644))
+
+	// Restore 创建的目录被删除，已经存在的目录被清空
+	parent, _ := os.MkdirTemp("", "bitcask-go-restore-error")
+	defer os.RemoveAll(parent)
+	destDir := filepath.Join(parent, "restore")
+	assert.Equal(t, ErrBackupCorrupted, Restore([]string{backupDir}, RestoreTarget{}, destDir))
+	_, err = os.Stat(destDir)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, os.Mkdir(destDir, os.ModePerm))
+	assert.Equal(t, ErrBackupCorrupted, Restore([]string{backupDir}, RestoreTarget{}, destDir))
+	entries, err := os.ReadDir(destDir)
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
@@ -6,6 +6,7 @@ import (
 	"sync/atomic"
 
 	"bitcask.go/data"
+	"bitcask.go/index"
 )
 
 // nonTransactionSeqNum 标志是否是事务操作
@@ -22,7 +23,7 @@ type WriteBatch struct {
 	pendingWrites map[string]*data.LogRecord // 缓存用户写入，暂时不提交，保证并发安全
 }
 
-// NewWriteBatch 初始化原子写实例
+// NewWriteBatch 初始化原子写实例，只读模式下批量写入的所有操作都会返回 ErrReadOnly
 func (db *DB) NewWriteBatch(options WriteBatchOptions) *WriteBatch {
 	//如果是B+树索引类型的话并且事务序列号文件不存在并且不是第一次初始化序列号文件的话，需要禁用 WriteBatch 功能
 	if db.option.IndexType == BPlusTree && !db.seqNumFileExists && !db.isNewInitial {
@@ -39,6 +40,19 @@ func (db *DB) NewWriteBatch(options WriteBatchOptions) *WriteBatch {
 
 // Put 批量操作的写数据
 func (wb *WriteBatch) Put(key []byte, value []byte) error {
+	return wb.put(0, key, value)
+}
+
+// PutInNamespace 在命名空间 ns 中写入数据，和同一个批次中其他命名空间的写入一起原子提交
+func (wb *WriteBatch) PutInNamespace(ns *Namespace, key []byte, value []byte) error {
+	return wb.put(ns.id, key, value)
+}
+
+func (wb *WriteBatch) put(namespace uint32, key []byte, value []byte) error {
+	if wb.db.option.ReadOnly {
+		return ErrReadOnly
+	}
+
 	// 校验Key
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
@@ -50,15 +64,29 @@ func (wb *WriteBatch) Put(key []byte, value []byte) error {
 
 	//将用户写入的数据存在LogRecord中缓存起来
 	logRecord := &data.LogRecord{
-		Key:   key,
-		Value: value,
+		Key:       key,
+		Value:     value,
+		Namespace: namespace,
 	} //注意默认Type值（正常情况）
-	wb.pendingWrites[string(key)] = logRecord
+	wb.pendingWrites[pendingWriteKey(namespace, key)] = logRecord
 	return nil
 }
 
 // Delete 删除数据
 func (wb *WriteBatch) Delete(key []byte) error {
+	return wb.delete(0, key)
+}
+
+// DeleteInNamespace 删除命名空间 ns 中的数据
+func (wb *WriteBatch) DeleteInNamespace(ns *Namespace, key []byte) error {
+	return wb.delete(ns.id, key)
+}
+
+func (wb *WriteBatch) delete(namespace uint32, key []byte) error {
+	if wb.db.option.ReadOnly {
+		return ErrReadOnly
+	}
+
 	// 校验Key
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
@@ -69,26 +97,38 @@ func (wb *WriteBatch) Delete(key []byte) error {
 	defer wb.mu.Unlock()
 
 	// 如果用户要删除的数据不存在(或在缓存中)直接删除缓存信息并返回
-	logRecordPos := wb.db.index.Get(key)
+	pendingKey := pendingWriteKey(namespace, key)
+	wb.db.rwmu.RLock()
+	idx := wb.db.indexOf(namespace)
+	wb.db.rwmu.RUnlock()
+	if idx == nil {
+		return ErrNamespaceNotFound
+	}
+	logRecordPos := idx.Get(key)
 	if logRecordPos == nil {
-		if wb.pendingWrites[string(key)] != nil {
-			delete(wb.pendingWrites, string(key))
+		if wb.pendingWrites[pendingKey] != nil {
+			delete(wb.pendingWrites, pendingKey)
 		}
 		return nil
 	}
 
 	// 暂存这个LogRecord
 	logRecord := &data.LogRecord{
-		Key:  key,
-		Type: data.LogRecordDeleted, //注意修改Type值（删除的情况）
+		Key:       key,
+		Type:      data.LogRecordDeleted, //注意修改Type值（删除的情况）
+		Namespace: namespace,
 	}
-	wb.pendingWrites[string(key)] = logRecord
+	wb.pendingWrites[pendingKey] = logRecord
 
 	return nil
 }
 
 // Commit 将批量写入的缓存数据全部写入磁盘中，并且更新索引
 func (wb *WriteBatch) Commit() error {
+	if wb.db.option.ReadOnly {
+		return ErrReadOnly
+	}
+
 	//加锁
 	wb.mu.Lock()
 	defer wb.mu.Unlock()
@@ -109,25 +149,33 @@ func (wb *WriteBatch) Commit() error {
 	wb.db.rwmu.Lock()
 	defer wb.db.rwmu.Unlock()
 
+	// 写入之前确认所有的命名空间都还存在，否则整个批次都不提交
+	for _, logRecord := range wb.pendingWrites {
+		if wb.db.indexOf(logRecord.Namespace) == nil {
+			return ErrNamespaceNotFound
+		}
+	}
+
 	// 1. 获取事务的序列号
 	// 进行原子性的增加操作,严格递增的同时保证并发安全
 	seqNum := atomic.AddUint64(&wb.db.seqNum, 1)
 
 	// 2. 将所有的缓存数据写进数据文件当中
 	positions := make(map[string]*data.LogRecordPos)
-	for _, logRecord := range wb.pendingWrites {
+	for pendingKey, logRecord := range wb.pendingWrites {
 		logRecordPos, err := wb.db.appendLogRecord(&data.LogRecord{
 			//需要加上我们的序列号
-			Key:   logRecordKeyWithSeqNum(logRecord.Key, seqNum),
-			Value: logRecord.Value,
-			Type:  logRecord.Type,
+			Key:       logRecordKeyWithSeqNum(logRecord.Key, seqNum),
+			Value:     logRecord.Value,
+			Type:      logRecord.Type,
+			Namespace: logRecord.Namespace,
 		})
 		if err != nil {
 			return err
 		}
 
 		// 拿到了索引位置的信息，我们不提交，等所有事务都完成后再写进磁盘
-		positions[string(logRecord.Key)] = logRecordPos
+		positions[pendingKey] = logRecordPos
 	}
 
 	// 我们需要写一条事务是否完成提交的标识，读取的时候需要找到这条标识，标识我们事务提交成功
@@ -151,22 +199,33 @@ func (wb *WriteBatch) Commit() error {
 		}
 	}
 
-	// 更新内存索引
-	for _, record := range wb.pendingWrites {
-		pos := positions[string(record.Key)]
-
-		var oldPos *data.LogRecordPos
+	// 更新内存索引：按照命名空间分组，每个索引批量更新（B+ 树索引整个批次只需要一个事务）
+	batches := make(map[uint32]*indexBatch)
+	for pendingKey, record := range wb.pendingWrites {
+		batch, ok := batches[record.Namespace]
+		if !ok {
+			batch = &indexBatch{}
+			batches[record.Namespace] = batch
+		}
 
 		//如果 Type 是正常类型的话就更新内存索引信息
 		if record.Type == data.LogRecordNormal {
-			oldPos = wb.db.index.Put(record.Key, pos)
+			batch.putKeys = append(batch.putKeys, record.Key)
+			batch.positions = append(batch.positions, positions[pendingKey])
 		}
 		//如果 Type 是被删除的数据类型则从对应的索引中删除
 		if record.Type == data.LogRecordDeleted {
-			oldPos, _ = wb.db.index.Delete(record.Key)
+			batch.deleteKeys = append(batch.deleteKeys, record.Key)
 		}
-		if oldPos != nil {
-			wb.db.reclaimSize += int64(oldPos.Size)
+	}
+	for namespace, batch := range batches {
+		idx := wb.db.indexOf(namespace)
+		oldPositions := index.PutBatch(idx, batch.putKeys, batch.positions)
+		oldPositions = append(oldPositions, index.DeleteBatch(idx, batch.deleteKeys)...)
+		for _, oldPos := range oldPositions {
+			if oldPos != nil {
+				wb.db.reclaimSize += int64(oldPos.Size)
+			}
 		}
 	}
 
@@ -176,6 +235,21 @@ func (wb *WriteBatch) Commit() error {
 	return nil
 }
 
+// indexBatch 提交时同一个命名空间中需要更新的索引
+type indexBatch struct {
+	putKeys    [][]byte
+	positions  []*data.LogRecordPos
+	deleteKeys [][]byte
+}
+
+// pendingWriteKey 缓存中的 Key：不同命名空间中的相同 Key 是不同的数据
+func pendingWriteKey(namespace uint32, key []byte) string {
+	buf := make([]byte, binary.MaxVarintLen32+len(key))
+	n := binary.PutUvarint(buf, uint64(namespace))
+	copy(buf[n:], key)
+	return string(buf[:n+len(key)])
+}
+
 // logRecordKeyWithSeqNum 对Key 和 seq进行编码处理
 func logRecordKeyWithSeqNum(key []byte, seqNum uint64) []byte {
 	seq := make([]byte, binary.MaxVarintLen64)
@@ -111,3 +111,34 @@ func TestDB_WriteBatch3(t *testing.T) {
 	err = wb.Commit()
 	assert.Nil(t, err)
 }
+
+func TestDB_WriteBatchBPlusTree(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-batch-bptree")
+	opts.DirPath = dir
+	opts.IndexType = BPlusTree
+	opts.SyncWrites = true
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	// 整个批次的索引在同一个 B+ 树事务中更新
+	assert.Nil(t, db.Put(utils.GetTestKey(0), utils.RandomValue(10)))
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	for i := 1; i < 10000; i++ {
+		assert.Nil(t, wb.Put(utils.GetTestKey(i), utils.RandomValue(10)))
+	}
+	assert.Nil(t, wb.Delete(utils.GetTestKey(0)))
+	assert.Nil(t, wb.Commit())
+
+	_, err = db.Get(utils.GetTestKey(0))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, uint(9999), db.Stat().KeyNum)
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+	assert.Equal(t, 9999, len(db.ListKeys()))
+	_, err = db.Get(utils.GetTestKey(9999))
+	assert.Nil(t, err)
+}
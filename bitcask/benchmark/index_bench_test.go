@@ -0,0 +1,68 @@
+package benchmark
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"bitcask.go/data"
+	"bitcask.go/index"
+	"bitcask.go/utils"
+)
+
+// Benchmark_IndexMemoryPerKey 比较不同的内存索引中每个 Key 占用的内存和 GC 的压力
+// BTree、ART、Hash 直接引用传入的 Key，B/key 不包括 Key 本身的数据；Compact 会拷贝 Key，B/key 包括了 Key（压缩之后）的数据
+// inuse-B/key 是堆中正在使用的 span 的增长，更接近进程 RSS 的增长；allocs/key 是构建索引时平均每个 Key 的内存分配次数，
+// gc-us 是索引构建完成之后一次完整 GC 的耗时，主要取决于 GC 需要扫描的对象和指针的数量
+func Benchmark_IndexMemoryPerKey(b *testing.B) {
+	const n = 100000
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = utils.GetTestKey(i)
+	}
+
+	indexTypes := []struct {
+		name string
+		typ  index.IndexType
+	}{
+		{"btree", index.BTRee},
+		{"art", index.ART},
+		{"hash", index.Hash},
+		{"compact", index.Compact},
+	}
+	for _, it := range indexTypes {
+		b.Run(it.name, func(b *testing.B) {
+			var perKey, inusePerKey, allocsPerKey float64
+			var gcTime time.Duration
+			for i := 0; i < b.N; i++ {
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+
+				indexer, err := index.NewIndexer(it.typ, "", false)
+				if err != nil {
+					b.Fatal(err)
+				}
+				for j, key := range keys {
+					indexer.Put(key, &data.LogRecordPos{Fid: 1, Offset: int64(j), Size: 100})
+				}
+
+				runtime.ReadMemStats(&after)
+				allocsPerKey = float64(after.Mallocs-before.Mallocs) / n
+
+				start := time.Now()
+				runtime.GC()
+				gcTime = time.Since(start)
+
+				runtime.ReadMemStats(&after)
+				perKey = float64(after.HeapAlloc-before.HeapAlloc) / n
+				inusePerKey = float64(after.HeapInuse-before.HeapInuse) / n
+				runtime.KeepAlive(indexer)
+			}
+			b.ReportMetric(perKey, "B/key")
+			b.ReportMetric(inusePerKey, "inuse-B/key")
+			b.ReportMetric(allocsPerKey, "allocs/key")
+			b.ReportMetric(float64(gcTime.Microseconds()), "gc-us")
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package benchmark
+
+import (
+	"math/rand"
+	"os"
+	"testing"
+
+	"bitcask.go"
+	"bitcask.go/fio"
+	"bitcask.go/utils"
+)
+
+// ioBackends 参与对比的 IO 类型
+var ioBackends = []struct {
+	name   string
+	ioType fio.FileIOType
+}{
+	{"StandardFIO", fio.StandardFIO},
+	{"WritableMemoryMap", fio.WritableMemoryMap},
+	{"DirectIO", fio.DirectIO},
+	{"URing", fio.URing},
+}
+
+const ioBenchKeys = 10000
+
+// openIOBenchDB 使用指定的 IO 类型打开一个写入了 ioBenchKeys 条数据的数据库
+func openIOBenchDB(b *testing.B, ioType fio.FileIOType) *bitcask.DB {
+	options := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-io-bench")
+	options.DirPath = dir
+	options.IOType = ioType
+	ioDB, err := bitcask.Open(options)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		_ = ioDB.Close()
+		_ = os.RemoveAll(dir)
+	})
+
+	for i := 0; i < ioBenchKeys; i++ {
+		if err := ioDB.Put(utils.GetTestKey(i), utils.RandomValue(1024)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return ioDB
+}
+
+func Benchmark_IOBackend_Get(b *testing.B) {
+	for _, backend := range ioBackends {
+		b.Run(backend.name, func(b *testing.B) {
+			ioDB := openIOBenchDB(b, backend.ioType)
+			r := rand.New(rand.NewSource(1))
+
+			b.ResetTimer()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := ioDB.Get(utils.GetTestKey(r.Intn(ioBenchKeys))); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// Benchmark_IOBackend_MultiGet 每次批量读取 100 个 Key
+func Benchmark_IOBackend_MultiGet(b *testing.B) {
+	for _, backend := range ioBackends {
+		b.Run(backend.name, func(b *testing.B) {
+			ioDB := openIOBenchDB(b, backend.ioType)
+			r := rand.New(rand.NewSource(1))
+			keys := make([][]byte, 100)
+
+			b.ResetTimer()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for j := range keys {
+					keys[j] = utils.GetTestKey(r.Intn(ioBenchKeys))
+				}
+				_, errs := ioDB.MultiGet(keys)
+				for _, err := range errs {
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func Benchmark_IOBackend_Put(b *testing.B) {
+	for _, backend := range ioBackends {
+		b.Run(backend.name, func(b *testing.B) {
+			ioDB := openIOBenchDB(b, backend.ioType)
+			value := utils.RandomValue(1024)
+
+			b.ResetTimer()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := ioDB.Put(utils.GetTestKey(i), value); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
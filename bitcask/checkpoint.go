@@ -0,0 +1,281 @@
+package bitcask
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"bitcask.go/data"
+	"bitcask.go/index"
+	"go.etcd.io/bbolt"
+)
+
+// CheckpointManifestFileName checkpoint 目录中记录了包含哪些文件的清单
+const CheckpointManifestFileName = "checkpoint-manifest"
+
+// Manifest 一次 checkpoint（或者备份）的清单
+type Manifest struct {
+	CreatedAt    time.Time      `json:"created_at"`       // 创建的时间
+	Since        time.Time      `json:"since"`            // 增量备份基于的上一次备份的创建时间，全量备份为零值
+	SeqNum       uint64         `json:"seq_num"`          // 创建时最新的事务序列号
+	ActiveFileID uint32         `json:"active_file_id"`   // 创建时的活跃文件ID
+	Files        []ManifestFile `json:"files"`            // 包含的所有文件
+	Pieces       []BackupPiece  `json:"pieces,omitempty"` // 备份时实际拷贝的数据
+
+	// 备份时数据库的 Options.RestorePointInterval，大于 0 时数据文件中带有时间点标记，可以按照时间截断
+	RestorePointInterval time.Duration `json:"restore_point_interval,omitempty"`
+}
+
+// ManifestFile 清单中的一个文件
+type ManifestFile struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	CRC     uint32    `json:"crc,omitempty"` // 整个文件内容的 crc 校验值
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Checkpoint 在线创建数据库的一致性快照，生成的目录可以直接作为数据库打开
+// 通过 LocalBackupTarget 写入 dir：只在封存活跃文件的时候短暂地持有锁，
+// 不可变的数据文件和 hint 文件通过硬链接的方式放入目标目录（跨文件系统时拷贝）
+func (db *DB) Checkpoint(dir string) (*Manifest, error) {
+	if err := db.checkCheckpoint(); err != nil {
+		return nil, err
+	}
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, ErrDirIsNotEmpty
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	target := NewLocalBackupTarget(dir)
+	return db.checkpointTo(target, target, "", CheckpointManifestFileName)
+}
+
+// CheckpointToTarget 将 checkpoint 写入 target 中（例如对象存储），每个文件都带有校验值
+// 和 BackUpToTarget 的备份一样按照创建时间命名，可以通过 ListBackups 列出、RestoreFromTarget 恢复成可以直接打开的数据目录
+// keepLast 大于 0 时，完成之后只保留最近的 keepLast 个备份
+func (db *DB) CheckpointToTarget(target BackupTarget, keepLast int) (*Manifest, error) {
+	if err := db.checkCheckpoint(); err != nil {
+		return nil, err
+	}
+	name := time.Now().UTC().Format(backupNameLayout)
+	manifest, err := db.checkpointTo(target, nil, name+"/", BackupManifestFileName)
+	if err != nil {
+		return nil, err
+	}
+	if keepLast > 0 {
+		if err := PruneBackups(target, keepLast); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+// checkCheckpoint 只读模式不能封存活跃文件，内存模式没有可以拷贝的文件
+func (db *DB) checkCheckpoint() error {
+	if db.option.ReadOnly {
+		return ErrReadOnly
+	}
+	if db.option.InMemory {
+		return ErrNotSupportedInMemory
+	}
+	return nil
+}
+
+// checkpointTo 封存活跃文件，将封存时的所有文件写入 target，对象名称都以 prefix 开头，最后写入名为 manifestName 的清单
+// linker 不为空时不可变的文件直接链接到 checkpoint 中，否则拷贝每个文件并记录校验值，之后可以通过 restore 校验并恢复
+func (db *DB) checkpointTo(target BackupTarget, linker fileLinker, prefix, manifestName string) (*Manifest, error) {
+	sealed, err := db.sealActiveFile()
+	if err != nil {
+		return nil, err
+	}
+	if sealed.bptreeTx != nil {
+		defer sealed.bptreeTx.Rollback()
+	}
+	fileIDs, activeFileID := sealed.fileIDs, sealed.activeFileID
+
+	manifest := &Manifest{
+		CreatedAt:    time.Now(),
+		SeqNum:       sealed.seqNum,
+		ActiveFileID: activeFileID,
+	}
+
+	// B+ 树的索引文件一直在被修改，只能拷贝封存时拿到的快照，不能直接链接
+	if sealed.bptreeTx != nil {
+		if err := checkpointBPlusTree(target, prefix, manifest, sealed.bptreeTx, sealed.seqNum); err != nil {
+			return nil, err
+		}
+	}
+
+	// 所有封存的数据文件
+	var fileNames []string
+	for _, fileID := range fileIDs {
+		fileNames = append(fileNames, filepath.Base(data.GetDataFileName(db.option.DirPath, fileID)))
+	}
+	// merge 之后生成的文件在数据库打开期间不会再被修改，NAMESPACES 文件每次修改都是重命名替换，链接之后不会受影响
+	for _, name := range []string{data.HintFilename, data.MergeFinishedFilename, NamespacesFileName} {
+		if _, err := os.Stat(filepath.Join(db.option.DirPath, name)); err == nil {
+			fileNames = append(fileNames, name)
+		}
+	}
+	for _, name := range fileNames {
+		srcPath := filepath.Join(db.option.DirPath, name)
+		info, err := os.Stat(srcPath)
+		if err != nil {
+			return nil, err
+		}
+		if linker != nil {
+			if err := linker.LinkFile(prefix+name, srcPath); err != nil {
+				return nil, err
+			}
+			manifest.Files = append(manifest.Files, ManifestFile{Name: name, Size: info.Size(), ModTime: info.ModTime()})
+			continue
+		}
+		if err := putFile(target, prefix, manifest, srcPath, name, info.Size(), info.ModTime()); err != nil {
+			return nil, err
+		}
+	}
+
+	// 链接的文件和原目录共享数据，打开 checkpoint 之后不能向它们追加写入，
+	// 因此新建一个空的数据文件，作为 checkpoint 被打开时的活跃文件
+	if len(fileIDs) > 0 {
+		name := filepath.Base(data.GetDataFileName(db.option.DirPath, activeFileID))
+		if err := putObject(target, prefix, manifest, name, nil, time.Time{}); err != nil {
+			return nil, err
+		}
+	}
+
+	// 最后写入清单，清单存在说明 checkpoint 是完整的
+	if err := putManifest(target, prefix+manifestName, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// sealedState 封存活跃文件时数据库的状态
+type sealedState struct {
+	fileIDs      []uint32  // 所有封存的数据文件ID(从小到大)
+	seqNum       uint64    // 当前的事务序列号
+	activeFileID uint32    // 新的活跃文件ID
+	bptreeTx     *bbolt.Tx // B+ 树索引在封存时的快照（只读事务，使用完之后需要 Rollback），不是 B+ 树索引时为空
+}
+
+// sealActiveFile 持久化并封存当前的活跃文件
+// B+ 树索引的快照也在锁内获取：索引和封存的数据文件是同一时刻的状态，快照不会指向之后写入新的活跃文件中的记录
+func (db *DB) sealActiveFile() (*sealedState, error) {
+	db.rwmu.Lock()
+	defer db.rwmu.Unlock()
+	db.waitPendingWrites()
+
+	// 活跃文件中有数据的话，将它转化为旧的数据文件，之后的写入都会进入新的活跃文件
+	if db.activeFile != nil && db.activeFile.Offsetnow > 0 {
+		if err := db.activeFile.Sync(); err != nil {
+			return nil, err
+		}
+		db.oldFiles[db.activeFile.FileID] = db.activeFile
+		if err := db.setActiveFile(); err != nil {
+			return nil, err
+		}
+	}
+
+	sealed := &sealedState{seqNum: db.seqNum}
+	if db.activeFile != nil {
+		sealed.activeFileID = db.activeFile.FileID
+	}
+
+	sealed.fileIDs = make([]uint32, 0, len(db.oldFiles))
+	for fileID := range db.oldFiles {
+		sealed.fileIDs = append(sealed.fileIDs, fileID)
+	}
+	sort.Slice(sealed.fileIDs, func(i, j int) bool {
+		return sealed.fileIDs[i] < sealed.fileIDs[j]
+	})
+
+	if bpt, ok := db.index.(*index.BPlusTree); ok {
+		tx, err := bpt.Snapshot()
+		if err != nil {
+			return nil, err
+		}
+		sealed.bptreeTx = tx
+	}
+	return sealed, nil
+}
+
+// checkpointBPlusTree 拷贝封存时 B+ 树索引的快照，并写入事务序列号文件（B+ 树打开时需要它才能使用 WriteBatch）
+func checkpointBPlusTree(target BackupTarget, prefix string, manifest *Manifest, tx *bbolt.Tx, seqNum uint64) error {
+	piece := &BackupPiece{Name: index.BPlusTreeIndexFileName, Size: tx.Size()}
+	reader, writer := io.Pipe()
+	go func() {
+		_, err := tx.WriteTo(writer)
+		_ = writer.CloseWithError(err)
+	}()
+	crc, err := putPiece(target, prefix, piece, reader, 0)
+	_ = reader.Close()
+	if err != nil {
+		return err
+	}
+	manifest.Pieces = append(manifest.Pieces, *piece)
+	manifest.Files = append(manifest.Files, ManifestFile{Name: piece.Name, Size: piece.Size, CRC: crc})
+
+	encRecord, _ := data.EncodeLogRecord(&data.LogRecord{
+		Key:   []byte(seqNumKey),
+		Value: []byte(strconv.FormatUint(seqNum, 10)),
+	})
+	return putObject(target, prefix, manifest, data.SeqNumFileName, encRecord, time.Time{})
+}
+
+// putFile 将文件的前 size 个字节作为名为 name 的对象写入 target，并记录到清单中
+func putFile(target BackupTarget, prefix string, manifest *Manifest, srcPath, name string, size int64, modTime time.Time) error {
+	piece := &BackupPiece{Name: name, Size: size}
+	crc, err := putFileRange(target, prefix, srcPath, piece, 0)
+	if err != nil {
+		return err
+	}
+	manifest.Pieces = append(manifest.Pieces, *piece)
+	manifest.Files = append(manifest.Files, ManifestFile{Name: name, Size: size, CRC: crc, ModTime: modTime})
+	return nil
+}
+
+// putObject 将 buf 作为名为 name 的对象写入 target，并记录到清单中
+func putObject(target BackupTarget, prefix string, manifest *Manifest, name string, buf []byte, modTime time.Time) error {
+	piece := &BackupPiece{Name: name, Size: int64(len(buf))}
+	crc, err := putPiece(target, prefix, piece, bytes.NewReader(buf), 0)
+	if err != nil {
+		return err
+	}
+	manifest.Pieces = append(manifest.Pieces, *piece)
+	manifest.Files = append(manifest.Files, ManifestFile{Name: name, Size: piece.Size, CRC: crc, ModTime: modTime})
+	return nil
+}
+
+// putManifest 编码清单并作为名为 name 的对象写入 target
+func putManifest(target BackupTarget, name string, manifest *Manifest) error {
+	buf, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return target.PutObject(name, bytes.NewReader(buf), int64(len(buf)))
+}
+
+// ReadManifest 读取 checkpoint 目录中的清单
+func ReadManifest(dir string) (*Manifest, error) {
+	return readManifest(filepath.Join(dir, CheckpointManifestFileName))
+}
+
+func readManifest(fileName string) (*Manifest, error) {
+	buf, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{}
+	if err := json.Unmarshal(buf, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
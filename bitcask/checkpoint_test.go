@@ -0,0 +1,159 @@
+package bitcask
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"bitcask.go/data"
+	"bitcask.go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Checkpoint(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-checkpoint")
+	opts.DirPath = dir
+	opts.DataFileSize = 4 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+
+	checkpointDir, _ := os.MkdirTemp("", "bitcask-go-checkpoint-dest")
+	defer os.RemoveAll(checkpointDir)
+	manifest, err := db.Checkpoint(checkpointDir)
+	assert.Nil(t, err)
+	assert.NotNil(t, manifest)
+
+	// checkpoint 之后的写入不会出现在 checkpoint 中
+	for i := 100; i < 200; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+
+	readManifest, err := ReadManifest(checkpointDir)
+	assert.Nil(t, err)
+	assert.Equal(t, len(manifest.Files), len(readManifest.Files))
+
+	// 目标目录不为空
+	_, err = db.Checkpoint(checkpointDir)
+	assert.Equal(t, ErrDirIsNotEmpty, err)
+
+	// checkpoint 可以直接作为数据库打开，写入不会影响原来的数据库
+	cpOpts := opts
+	cpOpts.DirPath = checkpointDir
+	cpDB, err := Open(cpOpts)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, len(cpDB.ListKeys()))
+	assert.Nil(t, cpDB.Put(utils.GetTestKey(1000), utils.RandomValue(24)))
+	assert.Nil(t, cpDB.Close())
+
+	_, err = db.Get(utils.GetTestKey(1000))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, 200, len(db.ListKeys()))
+}
+
+func TestDB_Checkpoint_BPlusTree(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-checkpoint-bptree")
+	defer os.RemoveAll(dir)
+	opts.DirPath = dir
+	opts.IndexType = BPlusTree
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, wb.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	assert.Nil(t, wb.Commit())
+
+	checkpointDir, _ := os.MkdirTemp("", "bitcask-go-checkpoint-bptree-dest")
+	defer os.RemoveAll(checkpointDir)
+	_, err = db.Checkpoint(checkpointDir)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+
+	_, err = os.Stat(filepath.Join(checkpointDir, data.SeqNumFileName))
+	assert.Nil(t, err)
+
+	opts.DirPath = checkpointDir
+	cpDB, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(cpDB.ListKeys()))
+	val, err := cpDB.Get(utils.GetTestKey(5))
+	assert.Nil(t, err)
+	assert.NotNil(t, val)
+
+	// 事务序列号文件存在，可以继续使用 WriteBatch
+	wb = cpDB.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put(utils.GetTestKey(10), utils.RandomValue(24)))
+	assert.Nil(t, wb.Commit())
+	assert.Nil(t, cpDB.Close())
+}
+
+func TestDB_Checkpoint_BPlusTreeConcurrentWrites(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-checkpoint-bptree-concurrent")
+	defer os.RemoveAll(dir)
+	opts.DirPath = dir
+	opts.IndexType = BPlusTree
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	// checkpoint 的同时不停地写入，快照中的索引不能指向封存之后写入的记录
+	value := utils.RandomValue(24)
+	var written atomic.Int64
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; ; i += 4 {
+				select {
+				case <-stop:
+					return
+				default:
+					assert.Nil(t, db.Put(utils.GetTestKey(i), value))
+					written.Add(1)
+				}
+			}
+		}(w)
+	}
+
+	for written.Load() < 100 {
+		runtime.Gosched()
+	}
+	var checkpointDirs []string
+	for i := 0; i < 20; i++ {
+		checkpointDir, _ := os.MkdirTemp("", "bitcask-go-checkpoint-bptree-concurrent-dest")
+		defer os.RemoveAll(checkpointDir)
+		_, err = db.Checkpoint(checkpointDir)
+		assert.Nil(t, err)
+		checkpointDirs = append(checkpointDirs, checkpointDir)
+	}
+	close(stop)
+	wg.Wait()
+
+	for _, checkpointDir := range checkpointDirs {
+		opts.DirPath = checkpointDir
+		cpDB, err := Open(opts)
+		assert.Nil(t, err)
+		keys := cpDB.ListKeys()
+		assert.True(t, len(keys) >= 100)
+		for _, key := range keys {
+			val, err := cpDB.Get(key)
+			assert.Nil(t, err)
+			assert.Equal(t, value, val)
+		}
+		assert.Nil(t, cpDB.Close())
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	bitcask "bitcask.go"
+	"bitcask.go/data"
+)
+
+// bitcask-dump 解码并输出 bitcask 的数据文件、hint 文件和 seq-num 文件
+// 用法:
+//
+//	bitcask-dump [-format text|jsonl] [-value-len n] <file>...
+//	bitcask-dump [-format text|jsonl] [-value-len n] -key <key> <data dir>
+func main() {
+	format := flag.String("format", "text", "output format: text or jsonl")
+	valueLen := flag.Int("value-len", 32, "max bytes of value to print, -1 means no limit")
+	key := flag.String("key", "", "list every historical version of the key in the data dir")
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "usage: %s [flags] <file>...\n", os.Args[0])
+		fmt.Fprintf(out, "       %s [flags] -key <key> <data dir>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 || (*format != "text" && *format != "jsonl") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	p := &printer{w: w, jsonl: *format == "jsonl", valueLen: *valueLen}
+
+	var err error
+	if *key != "" {
+		err = bitcask.DumpKeyHistory(flag.Arg(0), []byte(*key), p.print)
+	} else {
+		for _, fileName := range flag.Args() {
+			if err = bitcask.DumpFile(fileName, p.print); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		_ = w.Flush()
+		fmt.Fprintf(os.Stderr, "dump failed,err:%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// jsonRecord JSONL 格式输出的一条记录，Key 和 Value 使用 base64 编码
+type jsonRecord struct {
+	File      string             `json:"file"`
+	Offset    int64              `json:"offset"`
+	Size      int64              `json:"size"`
+	Type      string             `json:"type,omitempty"`
+	SeqNum    uint64             `json:"seq"`
+	Namespace uint32             `json:"namespace,omitempty"`
+	Key       []byte             `json:"key,omitempty"`
+	Value     []byte             `json:"value,omitempty"`
+	ValueSize int                `json:"value_size"`
+	Pos       *data.LogRecordPos `json:"pos,omitempty"`
+	Error     string             `json:"error,omitempty"`
+}
+
+type printer struct {
+	w        *bufio.Writer
+	jsonl    bool
+	valueLen int
+}
+
+func (p *printer) print(record *bitcask.DumpRecord) bool {
+	value := record.Value
+	if p.valueLen >= 0 && len(value) > p.valueLen {
+		value = value[:p.valueLen]
+	}
+
+	if p.jsonl {
+		jr := jsonRecord{
+			File:      record.FileName,
+			Offset:    record.Offset,
+			Size:      record.Size,
+			SeqNum:    record.SeqNum,
+			Namespace: record.Namespace,
+			Key:       record.Key,
+			Value:     value,
+			ValueSize: len(record.Value),
+			Pos:       record.Pos,
+		}
+		if record.Err != nil {
+			jr.Error = record.Err.Error()
+		} else {
+			jr.Type = typeName(record.Type)
+		}
+		_ = json.NewEncoder(p.w).Encode(jr)
+		return true
+	}
+
+	if record.Err != nil {
+		fmt.Fprintf(p.w, "%s offset=%d size=%d error=%q\n", record.FileName, record.Offset, record.Size, record.Err)
+		return true
+	}
+	fmt.Fprintf(p.w, "%s offset=%d size=%d type=%s seq=%d key=%q value(%d)=%q",
+		record.FileName, record.Offset, record.Size, typeName(record.Type), record.SeqNum,
+		record.Key, len(record.Value), value)
+	if record.Namespace != 0 {
+		fmt.Fprintf(p.w, " ns=%d", record.Namespace)
+	}
+	if record.Pos != nil {
+		fmt.Fprintf(p.w, " pos=%d:%d:%d", record.Pos.Fid, record.Pos.Offset, record.Pos.Size)
+	}
+	fmt.Fprintln(p.w)
+	return true
+}
+
+func typeName(typ data.LogRecordType) string {
+	switch typ {
+	case data.LogRecordNormal:
+		return "normal"
+	case data.LogRecordDeleted:
+		return "deleted"
+	case data.LogRecordTxnFinished:
+		return "txn-finished"
+	case data.LogRecordMerge:
+		return "merge"
+	default:
+		return fmt.Sprintf("unknown(%d)", typ)
+	}
+}
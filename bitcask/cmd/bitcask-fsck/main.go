@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	bitcask "bitcask.go"
+)
+
+// bitcask-fsck 离线检查（和修复）bitcask 的数据目录
+// 用法: bitcask-fsck [-repair] [-output dir] <data dir>
+func main() {
+	repair := flag.Bool("repair", false, "rewrite all valid records into a clean directory")
+	output := flag.String("output", "", "target directory of -repair (default: <data dir>-repaired)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-repair] [-output dir] <data dir>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dirPath := flag.Arg(0)
+
+	var report *bitcask.FsckReport
+	var err error
+	if *repair {
+		destPath := *output
+		if destPath == "" {
+			destPath = dirPath + "-repaired"
+		}
+		report, err = bitcask.Repair(dirPath, destPath)
+		if err == nil {
+			fmt.Printf("valid records have been rewritten to %s\n", destPath)
+		}
+	} else {
+		report, err = bitcask.Fsck(dirPath)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fsck failed,err:%v\n", err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("data files: %d, records: %d, hint records: %d\n",
+		report.DataFiles, report.Records, report.HintRecords)
+	for _, issue := range report.Issues {
+		fmt.Println(issue.String())
+	}
+
+	if !report.OK() {
+		fmt.Printf("%d issue(s) found\n", len(report.Issues))
+		os.Exit(1)
+	}
+	fmt.Println("no issue found")
+}
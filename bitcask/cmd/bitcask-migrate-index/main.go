@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	bitcask "bitcask.go"
+)
+
+// indexTypes 命令行中索引类型的名称
+var indexTypes = map[string]bitcask.IndexerType{
+	"btree":   bitcask.BTree,
+	"art":     bitcask.ART,
+	"hash":    bitcask.Hash,
+	"hybrid":  bitcask.Hybrid,
+	"compact": bitcask.Compact,
+	"bptree":  bitcask.BPlusTree,
+}
+
+// bitcask-migrate-index 离线切换数据目录的索引类型，执行期间数据目录不能被其他进程打开
+// 用法: bitcask-migrate-index -from btree -to bptree <data dir>
+// 升级之前先移动旧版本写在工作目录中的数据文件: bitcask-migrate-index -legacy-dir <old working dir> <data dir>
+func main() {
+	from := flag.String("from", "", "current index type: btree, art, hash, hybrid, compact or bptree")
+	to := flag.String("to", "", "target index type: btree, art, hash, hybrid, compact or bptree")
+	legacyDir := flag.String("legacy-dir", "", "move data files written by older versions from this working directory into the data dir")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-legacy-dir dir] [-from type -to type] <data dir>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *legacyDir != "" && flag.NArg() == 1 {
+		n, err := bitcask.MigrateLegacyDataFiles(*legacyDir, flag.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "move legacy data files failed,err:%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%d data files have been moved from %s to %s\n", n, *legacyDir, flag.Arg(0))
+		if *from == "" && *to == "" {
+			return
+		}
+	}
+
+	fromType, ok1 := indexTypes[*from]
+	toType, ok2 := indexTypes[*to]
+	if flag.NArg() != 1 || !ok1 || !ok2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := bitcask.MigrateIndex(flag.Arg(0), fromType, toType); err != nil {
+		fmt.Fprintf(os.Stderr, "migrate index failed,err:%v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("index of %s has been migrated from %s to %s\n", flag.Arg(0), *from, *to)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	bitcask "bitcask.go"
+)
+
+// bitcask-transfer 导出和导入 bitcask 数据目录中的数据
+// 用法:
+//
+//	bitcask-transfer export [-format jsonl|csv|binary] [-prefix p] [-output file] <data dir>
+//	bitcask-transfer import [-format jsonl|csv|binary] [-overwrite=false] [-batch-size n] [-input file] <data dir>
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = runExport(os.Args[2:])
+	case "import":
+		err = runImport(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed,err:%v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s export|import [flags] <data dir>\n", os.Args[0])
+	os.Exit(2)
+}
+
+// parseFlags 解析子命令的参数，返回数据目录和导入导出的格式
+func parseFlags(flags *flag.FlagSet, args []string, format *string) (string, bitcask.ExportFormat) {
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s %s [flags] <data dir>\n", os.Args[0], flags.Name())
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	exportFormat, err := bitcask.ParseExportFormat(*format)
+	if flags.NArg() != 1 || err != nil {
+		flags.Usage()
+		os.Exit(2)
+	}
+	return flags.Arg(0), exportFormat
+}
+
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "jsonl", "output format: jsonl, csv or binary")
+	prefix := flags.String("prefix", "", "only export keys with this prefix")
+	output := flags.String("output", "", "output file (default: stdout)")
+	dirPath, exportFormat := parseFlags(flags, args, format)
+
+	// 以只读的方式打开，可以在数据库运行的同时导出
+	options := bitcask.DefaultOptions
+	options.DirPath = dirPath
+	options.ReadOnly = true
+	db, err := bitcask.Open(options)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var writer io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+
+	iteratorOptions := bitcask.DefaultIteratorOptions
+	iteratorOptions.Prefix = []byte(*prefix)
+	return db.Export(writer, exportFormat, iteratorOptions)
+}
+
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", "jsonl", "input format: jsonl, csv or binary")
+	overwrite := flags.Bool("overwrite", true, "overwrite keys that already exist")
+	batchSize := flags.Uint("batch-size", bitcask.DefaultImportOptions.BatchSize, "number of keys committed in one write batch")
+	input := flags.String("input", "", "input file (default: stdin)")
+	dirPath, exportFormat := parseFlags(flags, args, format)
+
+	options := bitcask.DefaultOptions
+	options.DirPath = dirPath
+	db, err := bitcask.Open(options)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var reader io.Reader = os.Stdin
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	n, err := db.Import(reader, exportFormat, bitcask.ImportOptions{Overwrite: *overwrite, BatchSize: *batchSize})
+	fmt.Fprintf(os.Stderr, "%d key(s) imported\n", n)
+	return err
+}
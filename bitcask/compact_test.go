@@ -0,0 +1,48 @@
+package bitcask
+
+import (
+	"os"
+	"testing"
+
+	"bitcask.go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_CompactIndex(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-compact")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	opts.IndexType = Compact
+	opts.IndexShards = 4
+	opts.DataFileMergeRatio = 0
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	for i := 0; i < 2000; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(32)))
+	}
+	for i := 0; i < 2000; i += 4 {
+		assert.Nil(t, db.Delete(utils.GetTestKey(i)))
+	}
+	value, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	keys := db.ListKeys()
+	assert.Equal(t, 1500, len(keys))
+	for i := 1; i < len(keys); i++ {
+		assert.Less(t, string(keys[i-1]), string(keys[i]))
+	}
+	assert.Nil(t, db.Close())
+
+	// 关闭前缀压缩重新打开，索引从数据文件重建
+	opts.IndexPrefixCompression = false
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+	reopened, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, value, reopened)
+	assert.Equal(t, keys, db.ListKeys())
+	assert.Nil(t, db.Merge())
+	assert.Equal(t, uint(1500), db.Stat().KeyNum)
+}
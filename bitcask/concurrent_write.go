@@ -0,0 +1,208 @@
+package bitcask
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"bitcask.go/data"
+)
+
+// writeTracker 跟踪已经预留了位置、但是还没有提交的并发写入
+// 每次预留分配一个递增的序号，写入完成之后必须按照序号的顺序提交（更新索引、返回给调用方）：
+// 这样同一个 Key 的索引总是指向数据文件中更靠后的记录，崩溃之后也不会出现已经返回成功的记录前面还有空洞
+type writeTracker struct {
+	mu   *sync.Mutex
+	cond *sync.Cond
+	next uint64 // 下一次预留分配的序号
+	done uint64 // 序号小于 done 的写入都已经提交了
+}
+
+func newWriteTracker() *writeTracker {
+	mu := new(sync.Mutex)
+	return &writeTracker{mu: mu, cond: sync.NewCond(mu)}
+}
+
+// reserve 分配一个序号，调用时必须持有 DB 的互斥锁（和预留文件位置的顺序保持一致）
+func (wt *writeTracker) reserve() uint64 {
+	wt.mu.Lock()
+	defer wt.mu.Unlock()
+
+	ticket := wt.next
+	wt.next++
+	return ticket
+}
+
+// commit 等待序号更小的写入全部提交之后执行 apply，再提交自己
+func (wt *writeTracker) commit(ticket uint64, apply func()) {
+	wt.mu.Lock()
+	for wt.done != ticket {
+		wt.cond.Wait()
+	}
+	wt.mu.Unlock()
+
+	// 在 done 增加之前，其他的写入都不能提交，apply 不需要持有锁
+	apply()
+
+	wt.mu.Lock()
+	wt.done++
+	wt.cond.Broadcast()
+	wt.mu.Unlock()
+}
+
+// wait 等待所有已经预留的写入提交，调用时必须持有 DB 的锁（读锁或者互斥锁），保证不会有新的预留
+func (wt *writeTracker) wait() {
+	wt.mu.Lock()
+	defer wt.mu.Unlock()
+
+	for wt.done != wt.next {
+		wt.cond.Wait()
+	}
+}
+
+// pendingWrite 预留了位置、还没有提交的并发写入
+type pendingWrite struct {
+	dataFile *data.DataFile
+	offset   int64
+	size     int64
+	ticket   uint64
+}
+
+// writeHole 并发写入失败之后无法填充的空洞，重新打开时会被当作文件的末尾，之后的记录都会丢失
+type writeHole struct {
+	fileID uint32
+	offset int64
+}
+
+// appendLogRecordConcurrently 追加写入一条记录：只在预留活跃文件中的位置时持有互斥锁，
+// 编码和写入文件都不持有锁，写入完成之后按照预留的顺序调用 apply 更新内存索引
+// 写入之后需要持久化，或者数据文件的 IO 类型不支持并发写入时，在锁内完成整个写入
+func (db *DB) appendLogRecordConcurrently(logRecord *data.LogRecord, apply func(pos *data.LogRecordPos)) error {
+	encRecord, size := data.EncodeLogRecord(logRecord)
+
+	db.rwmu.Lock()
+	if err := db.writeRestorePoint(); err != nil {
+		db.rwmu.Unlock()
+		return err
+	}
+	if err := db.prepareActiveFile(size); err != nil {
+		db.rwmu.Unlock()
+		return err
+	}
+	if !db.canWriteConcurrently(size) {
+		defer db.rwmu.Unlock()
+		pos, err := db.appendLogRecord(logRecord)
+		if err != nil {
+			return err
+		}
+		apply(pos)
+		return nil
+	}
+	w := db.reserveWrite(size)
+	db.rwmu.Unlock()
+
+	return db.finishWrite(w, encRecord, apply)
+}
+
+// reserveWrite 在活跃文件的末尾预留 size 字节的位置，之后由 finishWrite 在锁外写入并提交
+// 注意！！！使用这个 DB 方法的时候必须持有互斥锁
+func (db *DB) reserveWrite(size int64) *pendingWrite {
+	w := &pendingWrite{dataFile: db.activeFile, size: size}
+	w.offset = w.dataFile.Reserve(size)
+	db.bytesWrite += uint(size)
+	w.ticket = db.writes.reserve()
+	return w
+}
+
+// finishWrite 将记录写入预留的位置，按照预留的顺序提交：写入成功时调用 apply 更新内存索引，
+// 写入失败时填充预留的位置；前面有无法填充的空洞时，这条记录重新打开之后也读不到，返回 ErrDataFileHole
+func (db *DB) finishWrite(w *pendingWrite, encRecord []byte, apply func(pos *data.LogRecordPos)) error {
+	err := w.dataFile.WriteAt(encRecord, w.offset)
+	db.writes.commit(w.ticket, func() {
+		if err != nil {
+			db.fillWriteHole(w)
+			return
+		}
+		if hole := db.writeHole.Load(); hole != nil && hole.fileID == w.dataFile.FileID && hole.offset < w.offset {
+			err = ErrDataFileHole
+			return
+		}
+		apply(&data.LogRecordPos{Fid: w.dataFile.FileID, Offset: w.offset, Size: uint32(w.size)})
+	})
+	return err
+}
+
+// fillWriteHole 写入失败之后，把预留的位置填成加载时会被忽略的记录，后面的记录仍然可以被加载
+// 填充也失败时记录空洞的位置，之后在这个文件中的写入都不能提交，下一次预留位置之前会把文件截断到空洞的位置
+// 在 writeTracker 提交的过程中调用，和其他写入的提交按照预留的顺序执行
+func (db *DB) fillWriteHole(w *pendingWrite) {
+	if err := w.dataFile.WriteAt(encodePadding(w.size), w.offset); err == nil {
+		return
+	}
+	db.writeHole.CompareAndSwap(nil, &writeHole{fileID: w.dataFile.FileID, offset: w.offset})
+}
+
+// truncateWriteHole 活跃文件中有无法填充的空洞时，将文件截断到空洞的位置，空洞之后的写入都没有提交
+// 注意！！！使用这个 DB 方法的时候必须持有互斥锁，并且已经等待了所有预留了位置的并发写入
+func (db *DB) truncateWriteHole() error {
+	hole := db.writeHole.Load()
+	if hole == nil {
+		return nil
+	}
+	if db.activeFile != nil && db.activeFile.FileID == hole.fileID {
+		if err := db.activeFile.Truncate(hole.offset); err != nil {
+			return err
+		}
+	}
+	db.writeHole.Store(nil)
+	return nil
+}
+
+// paddingRecordMinSize 填充记录最小的长度，比任何一条正常的记录都短（正常记录的 Key 不能为空）
+var paddingRecordMinSize = int64(len(encodePaddingRecord(0)))
+
+// encodePadding 编码恰好 size 字节的填充记录：Key 为空的删除记录，加载时不会修改索引，Merge 时被丢弃
+// Value 长度占用的字节数随着长度变化，一条记录凑不出 size 字节时拆成两条
+func encodePadding(size int64) []byte {
+	if buf := encodePaddingOfSize(size); buf != nil {
+		return buf
+	}
+	return append(encodePaddingRecord(0), encodePaddingOfSize(size-paddingRecordMinSize)...)
+}
+
+// encodePaddingOfSize 编码一条恰好 size 字节的填充记录，凑不出时返回 nil
+func encodePaddingOfSize(size int64) []byte {
+	for valueSize := size - paddingRecordMinSize; valueSize >= 0 && valueSize > size-paddingRecordMinSize-binary.MaxVarintLen64; valueSize-- {
+		if buf := encodePaddingRecord(valueSize); int64(len(buf)) == size {
+			return buf
+		}
+	}
+	return nil
+}
+
+// encodePaddingRecord 编码 Value 为 valueSize 字节的填充记录
+func encodePaddingRecord(valueSize int64) []byte {
+	buf, _ := data.EncodeLogRecord(&data.LogRecord{
+		Key:   logRecordKeyWithSeqNum(nil, nonTransactionSeqNum),
+		Value: make([]byte, valueSize),
+		Type:  data.LogRecordDeleted,
+	})
+	return buf
+}
+
+// canWriteConcurrently 写入 size 字节的记录时能否只在预留位置时持有锁
+// 注意！！！使用这个 DB 方法的时候必须持有互斥锁
+func (db *DB) canWriteConcurrently(size int64) bool {
+	if db.option.IndexShards <= 1 || db.option.SyncWrites {
+		return false
+	}
+	if db.option.BytesPerSync > 0 && db.bytesWrite+uint(size) >= db.option.BytesPerSync {
+		return false
+	}
+	return db.activeFile.SupportsWriteAt()
+}
+
+// waitPendingWrites 等待所有预留了位置的并发写入完成，之后数据文件和索引都是完整的
+// 注意！！！使用这个 DB 方法的时候必须持有锁（读锁或者互斥锁）
+func (db *DB) waitPendingWrites() {
+	db.writes.wait()
+}
@@ -0,0 +1,153 @@
+package bitcask
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+
+	"bitcask.go/fio"
+	"github.com/stretchr/testify/assert"
+)
+
+// crashWrite 崩溃测试中的一次写入，value 为 nil 表示删除
+type crashWrite struct {
+	key   string
+	value []byte
+}
+
+// TestDB_CrashRecovery 在 Put、WriteBatch.Commit 和 Merge 的随机位置模拟崩溃，
+// 重新打开之后，所有返回成功的写入都必须存在，崩溃时正在进行的写入要么全部生效要么全部不生效
+func TestDB_CrashRecovery(t *testing.T) {
+	for seed := int64(1); seed <= 50; seed++ {
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			runCrashTest(t, seed)
+		})
+	}
+}
+
+func runCrashTest(t *testing.T, seed int64) {
+	rnd := rand.New(rand.NewSource(seed))
+	dir, _ := os.MkdirTemp("", "bitcask-go-crash")
+	defer os.RemoveAll(dir)
+	defer os.RemoveAll(mergeDirPath(dir))
+
+	injector := fio.NewFaultInjector(seed)
+	injector.SetTornWrites(seed%2 == 0)
+
+	opts := DefaultOptions
+	opts.DirPath = dir
+	opts.DataFileSize = 8 * 1024
+	opts.SyncWrites = true
+	opts.DataFileMergeRatio = 0
+	faultOpts := opts
+	faultOpts.wrapIOManager = injector.Wrap
+	db, err := Open(faultOpts)
+	assert.Nil(t, err)
+
+	// 在随机的一次读、写或者持久化操作时崩溃
+	injector.AddRule(fio.FaultRule{Op: fio.FaultOp(rnd.Intn(3)), Kind: fio.FaultCrash, After: rnd.Intn(600)})
+
+	committed := make(map[string][]byte)
+	var inflight []crashWrite
+	for i := 0; i < 500 && !injector.Crashed(); i++ {
+		randomWrite := func() crashWrite {
+			key := fmt.Sprintf("key-%03d", rnd.Intn(100))
+			if rnd.Intn(10) == 0 {
+				return crashWrite{key: key}
+			}
+			return crashWrite{key: key, value: []byte(fmt.Sprintf("value-%d-%d", i, rnd.Int()))}
+		}
+
+		var writes []crashWrite
+		switch n := rnd.Intn(20); {
+		case n == 0:
+			if err := db.Merge(); err != nil && err != ErrUnderMergeRatio {
+				assert.True(t, injector.Crashed(), err)
+			}
+			continue
+		case n < 5:
+			wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+			for j := 0; j < 2+rnd.Intn(6); j++ {
+				write := randomWrite()
+				writes = append(writes, write)
+				if write.value == nil {
+					assert.Nil(t, wb.Delete([]byte(write.key)))
+				} else {
+					assert.Nil(t, wb.Put([]byte(write.key), write.value))
+				}
+			}
+			err = wb.Commit()
+		default:
+			write := randomWrite()
+			writes = append(writes, write)
+			if write.value == nil {
+				err = db.Delete([]byte(write.key))
+			} else {
+				err = db.Put([]byte(write.key), write.value)
+			}
+		}
+
+		if err != nil {
+			assert.True(t, injector.Crashed(), err)
+			inflight = writes
+			break
+		}
+		applyCrashWrites(committed, writes)
+	}
+
+	// 没有运行到崩溃点，手动崩溃
+	assert.Nil(t, injector.Crash())
+	_ = db.closeDataFiles()
+	_ = db.index.Close()
+	_ = db.fileLock.Unlock()
+
+	db2, err := Open(opts)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer destroyDB(db2)
+
+	// 崩溃时正在进行的写入要么全部生效，要么全部不生效
+	expected := committed
+	if len(inflight) > 0 {
+		applied := make(map[string][]byte, len(committed))
+		for key, value := range committed {
+			applied[key] = value
+		}
+		applyCrashWrites(applied, inflight)
+		if crashStateMatches(db2, applied) {
+			expected = applied
+		}
+	}
+	assert.True(t, crashStateMatches(db2, expected))
+	assert.Equal(t, len(expected), len(db2.ListKeys()))
+
+	// 恢复之后可以继续写入
+	assert.Nil(t, db2.Put([]byte("after-crash"), []byte("ok")))
+}
+
+func applyCrashWrites(state map[string][]byte, writes []crashWrite) {
+	for _, write := range writes {
+		if write.value == nil {
+			delete(state, write.key)
+		} else {
+			state[write.key] = write.value
+		}
+	}
+}
+
+// crashStateMatches 数据库中的数据是否和 state 完全一致
+func crashStateMatches(db *DB, state map[string][]byte) bool {
+	if len(db.ListKeys()) != len(state) {
+		return false
+	}
+	for key, value := range state {
+		got, err := db.Get([]byte(key))
+		if err != nil || !bytes.Equal(got, value) {
+			return false
+		}
+	}
+	return true
+}
@@ -19,7 +19,8 @@ const (
 
 var (
 	//自定义错误信息：
-	ErrInvalidCRC = errors.New("crc value invalid,log record maybe corrupted")
+	ErrInvalidCRC          = errors.New("crc value invalid,log record maybe corrupted")
+	ErrIncompleteLogRecord = errors.New("log record is incomplete,data file maybe truncated")
 )
 
 // DataFile 数据文件的结构体
@@ -58,10 +59,15 @@ func OpenSeqNUmFile(dirPath string) (*DataFile, error) {
 	return newGetDataFile(fileName, 0, fio.StandardFIO)
 }
 
+// OpenReadOnlyFile 以只读的方式（内存映射）打开一个已经存在的文件，用于离线检查等工具
+func OpenReadOnlyFile(fileName string, fileID uint32) (*DataFile, error) {
+	return newGetDataFile(fileName, fileID, fio.MemoryMap)
+}
+
 // GetDataFileName 获取数据文件的ID
 func GetDataFileName(dirPath string, fileID uint32) string {
 
-	return filepath.Join(fmt.Sprintf("%09d", fileID) + DataFileSuffix)
+	return filepath.Join(dirPath, fmt.Sprintf("%09d", fileID)+DataFileSuffix)
 
 }
 
@@ -71,10 +77,15 @@ func newGetDataFile(fileName string, fileID uint32, IOType fio.FileIOType) (*Dat
 	if err != nil {
 		return nil, err
 	}
-	// 初始化数据文件
+	// 初始化数据文件，Write 从文件的末尾开始写入，加载数据文件时会再设置为有效数据的末尾
+	size, err := ioManager.Size()
+	if err != nil {
+		_ = ioManager.Close()
+		return nil, err
+	}
 	return &DataFile{
 		FileID:    fileID,
-		Offsetnow: 0,
+		Offsetnow: size,
 		IOManager: ioManager,
 	}, nil
 }
@@ -116,7 +127,12 @@ func (df *DataFile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 	//记录整个logRecord的长度 = header 的长度 + keySize + valueSize
 	var recordSize = headerSize + keySize + valueSize
 
-	logRecord := &LogRecord{Type: header.recordType}
+	// 如果记录的长度超过了文件的末尾，说明这条记录没有完整写入（例如写入过程中进程崩溃）
+	if offset+recordSize > fileSize {
+		return nil, 0, ErrIncompleteLogRecord
+	}
+
+	logRecord := &LogRecord{Type: header.recordType, Namespace: header.namespace}
 
 	// 根据 keySize 和 valueSize 读取用户实际读取的 key 和 value
 	// 如果 size 确实大于 0 就读取出来
@@ -137,8 +153,9 @@ func (df *DataFile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 
 	crc := getLogRecordCrc(logRecord, headerbuf[crc32.Size:headerSize]) //取从 crc32.Size 到 headerSize-1 的部分
 	// 将LogRecord中的CRC与数据文件中的CRC进行比较，检验数据的有效性（是否被损坏）
+	// 注意：这里仍然返回记录的长度，方便恢复时跳过这条损坏的记录
 	if crc != header.crc {
-		return nil, 0, ErrInvalidCRC
+		return nil, recordSize, ErrInvalidCRC
 	}
 
 	//检验通过表示读取到的数据是有效的，进行返回
@@ -149,9 +166,15 @@ func (df *DataFile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 
 // WriteHintRecord 创建一条Hint文件的logRecord（储存原文件的 Key 和索引信息）
 func (df *DataFile) WriteHintRecord(key []byte, pos *LogRecordPos) error {
+	return df.WriteNamespaceHintRecord(0, key, pos)
+}
+
+// WriteNamespaceHintRecord 创建一条属于 namespace 命名空间的 Hint 记录
+func (df *DataFile) WriteNamespaceHintRecord(namespace uint32, key []byte, pos *LogRecordPos) error {
 	record := &LogRecord{
-		Key:   key,
-		Value: EncodeLogRecordPos(pos), //对应的位置索引
+		Key:       key,
+		Value:     EncodeLogRecordPos(pos), //对应的位置索引
+		Namespace: namespace,
 	}
 
 	// 对这个record进行编码
@@ -172,7 +195,17 @@ func (df *DataFile) Close() error {
 }
 
 // Write 写入操作
+// 支持在指定位置写入的 IO 类型在 Offsetnow 处写入，和 Reserve 之后的 WriteAt 一样以偏移量为准：
+// 并发写入失败之后文件被截断，或者预留的位置还没有写入时，写入的位置也和索引中记录的偏移量一致
 func (df *DataFile) Write(buf []byte) error {
+	if df.SupportsWriteAt() {
+		if err := df.WriteAt(buf, df.Offsetnow); err != nil {
+			return err
+		}
+		df.Offsetnow += int64(len(buf))
+		return nil
+	}
+
 	//更新我们现在文件写道哪里了（更新偏移量：Offsetnow）
 	n, err := df.IOManager.Write(buf)
 	if err != nil {
@@ -183,6 +216,53 @@ func (df *DataFile) Write(buf []byte) error {
 	return nil
 }
 
+// Reserve 在文件末尾预留 size 字节的空间并返回预留的偏移量，之后再通过 WriteAt 写入数据
+// 预留只修改偏移量，调用方需要保证同一时刻只有一个 Reserve 或者 Write
+func (df *DataFile) Reserve(size int64) int64 {
+	offset := df.Offsetnow
+	df.Offsetnow += size
+	return offset
+}
+
+// WriteAt 将数据写入 Reserve 预留的位置，不同位置的写入可以并发执行
+func (df *DataFile) WriteAt(buf []byte, offset int64) error {
+	writer, ok := df.IOManager.(fio.PositionalWriter)
+	if !ok {
+		return fio.ErrWriteAtNotSupported
+	}
+	n, err := writer.WriteAt(buf, offset)
+	if err != nil {
+		return err
+	}
+	if n < len(buf) {
+		return io.ErrShortWrite
+	}
+	return nil
+}
+
+// SupportsWriteAt 数据文件的 IO 类型是否支持 Reserve 之后并发写入
+func (df *DataFile) SupportsWriteAt() bool {
+	return fio.SupportsWriteAt(df.IOManager)
+}
+
+// Truncate 将数据文件截断到指定大小，并更新当前的偏移量
+func (df *DataFile) Truncate(size int64) error {
+	if err := df.IOManager.Truncate(size); err != nil {
+		return err
+	}
+
+	df.Offsetnow = size
+	return nil
+}
+
+// Preallocate 预先分配文件空间，IOManager 不支持预分配时什么都不做
+func (df *DataFile) Preallocate(size int64) error {
+	if preallocator, ok := df.IOManager.(fio.Preallocator); ok {
+		return preallocator.Preallocate(size)
+	}
+	return nil
+}
+
 // SetIOManager 设置文件 IO 类型
 func (df *DataFile) SetIOManager(dirPath string, IOType fio.FileIOType) error {
 	//关闭原来的IOManager
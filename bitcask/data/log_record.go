@@ -11,10 +11,14 @@ const (
 	LogRecordNormal      LogRecordType = iota //正常操作的类型
 	LogRecordDeleted                          //针对被删除的文件操作的类型
 	LogRecordTxnFinished                      //标识事务提交的类型
+	LogRecordMerge                            //合并操作数，读取时由 MergeOperator 合并到之前的值上
 
-	// 包括 crc校验值(4字节) 、Type类型(1字节)、Key 的大小、Value 的大小 (这两个为动态长度，节约内存)
-	// 4 + 1 + 5 + 5 =15
-	maxLogRecordHeaderSize = binary.MaxVarintLen32*2 + 5 //最大头部信息字节数：15
+	// 包括 crc校验值(4字节) 、Type类型(1字节)、Key 的大小、Value 的大小、命名空间 ID (这三个为动态长度，节约内存)
+	// 4 + 1 + 5 + 5 + 5 =20
+	maxLogRecordHeaderSize = binary.MaxVarintLen32*3 + 5 //最大头部信息字节数：20
+
+	// namespaceFlag Type 字节的最高位，标识 header 中带有命名空间 ID（默认命名空间的记录没有，和之前的格式相同）
+	namespaceFlag byte = 0x80
 )
 
 // LogRecordPos 数据内存索引，描述数据在磁盘上的位置
@@ -29,6 +33,8 @@ type LogRecord struct {
 	Key   []byte
 	Value []byte
 	Type  LogRecordType //墓碑值，可用于标记删除
+
+	Namespace uint32 //记录所属的命名空间 ID，0 为默认命名空间
 }
 
 // logRecordHeader header 的信息
@@ -37,6 +43,7 @@ type logRecordHeader struct {
 	keySize    uint32        // Key 的大小
 	valueSize  uint32        // Value 的大小
 	recordType LogRecordType // Type类型(1字节)
+	namespace  uint32        // 命名空间 ID
 }
 
 // TransactionRecord 缓存事务类型的相关数据
@@ -48,8 +55,9 @@ type TransactionRecord struct {
 // EncodeLogRecord 对 LogRecord 进行编码，返回字节数组及长度
 
 // LogRecord图 如下：
-//	（ crc 校验值 ） （  type 类型 ）  （   key size )    (value size )        (  key  )    (     value   )
-//	    4字节           1字节          动态长度（max:5）     动态长度（max:5）    动态长度         动态长度
+//	（ crc 校验值 ） （  type 类型 ）  （   key size )    (value size )    ( namespace )      (  key  )    (     value   )
+//	    4字节           1字节          动态长度（max:5）     动态长度（max:5）  动态长度（max:5）    动态长度         动态长度
+// namespace 只有在 type 的最高位为 1 时才存在
 
 // EncodeLogRecord 编码: 数据文件写入时需要将对应结构体解码转为字符数组类型（切片）
 func EncodeLogRecord(logRecord *LogRecord) ([]byte, int64) {
@@ -67,6 +75,11 @@ func EncodeLogRecord(logRecord *LogRecord) ([]byte, int64) {
 	index += binary.PutVarint(header[index:], int64(len(logRecord.Key)))
 	//写入 Value 的长度
 	index += binary.PutVarint(header[index:], int64(len(logRecord.Value)))
+	//不是默认命名空间的记录写入命名空间 ID
+	if logRecord.Namespace != 0 {
+		header[4] |= namespaceFlag
+		index += binary.PutUvarint(header[index:], uint64(logRecord.Namespace))
+	}
 
 	//记录完了k/v的长度（实际的长度，但我们设定的长度为5/每个key或者value），因此这里的Index很有可能
 	//小于Key的位置，因为要返回，所以需要手动调整 index 保证编码正确性
@@ -126,6 +139,48 @@ func DecodeLogRecordPos(buf []byte) *LogRecordPos {
 
 }
 
+// EncodeMergeOperand 编码合并操作数记录的 Value：同一个文件中这个 Key 前一条记录的偏移量和操作数
+// prevOffset 为 -1 表示没有前一条记录，操作数直接合并到空值上
+func EncodeMergeOperand(prevOffset int64, operand []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen64+len(operand))
+	index := binary.PutUvarint(buf, uint64(prevOffset+1))
+	copy(buf[index:], operand)
+	return buf[:index+len(operand)]
+}
+
+// DecodeMergeOperand 解码合并操作数记录的 Value，返回前一条记录的偏移量（没有时为 -1）和操作数
+func DecodeMergeOperand(value []byte) (int64, []byte) {
+	prevOffset, n := binary.Uvarint(value)
+	if n <= 0 {
+		return -1, nil
+	}
+	return int64(prevOffset) - 1, value[n:]
+}
+
+// DecodeLogRecord 从一段完整的记录数据中解码出 LogRecord 并校验 crc（用于批量读取之后解码）
+func DecodeLogRecord(buf []byte) (*LogRecord, error) {
+	header, headerSize := decodeLogRecordHeader(buf)
+	if header == nil {
+		return nil, ErrIncompleteLogRecord
+	}
+
+	keySize, valueSize := int64(header.keySize), int64(header.valueSize)
+	if headerSize+keySize+valueSize > int64(len(buf)) {
+		return nil, ErrIncompleteLogRecord
+	}
+
+	logRecord := &LogRecord{
+		Key:       buf[headerSize : headerSize+keySize],
+		Value:     buf[headerSize+keySize : headerSize+keySize+valueSize],
+		Type:      header.recordType,
+		Namespace: header.namespace,
+	}
+	if getLogRecordCrc(logRecord, buf[crc32.Size:headerSize]) != header.crc {
+		return nil, ErrInvalidCRC
+	}
+	return logRecord, nil
+}
+
 // 对 headerbuf 进行解码的方法,返回 header 的实际的头部信息和长度
 func decodeLogRecordHeader(buf []byte) (*logRecordHeader, int64) {
 	//如果连CRC的四个字节长度都没达到，直接返回
@@ -136,7 +191,7 @@ func decodeLogRecordHeader(buf []byte) (*logRecordHeader, int64) {
 	// 从前往后依次拿出来所有的数据
 	header := &logRecordHeader{
 		crc:        binary.LittleEndian.Uint32(buf[:4]), //拿四个字节，但从第五个字节开始索引
-		recordType: buf[4],
+		recordType: buf[4] &^ namespaceFlag,
 	}
 
 	//从第五个字节开始拿出后面的数据,更新index,取出实际的数据
@@ -151,6 +206,13 @@ func decodeLogRecordHeader(buf []byte) (*logRecordHeader, int64) {
 	header.valueSize = uint32(valueSize)
 	index += n
 
+	// 取出命名空间 ID
+	if buf[4]&namespaceFlag != 0 {
+		namespace, n := binary.Uvarint(buf[index:])
+		header.namespace = uint32(namespace)
+		index += n
+	}
+
 	//目前的index代表实际header的长度,返回到上一层
 	return header, int64(index)
 }
@@ -97,3 +97,45 @@ func TestGetLogRecordCRC(t *testing.T) {
 	crc3 := getLogRecordCrc(rec3, headerBuf3[crc32.Size:])
 	assert.Equal(t, uint32(290887979), crc3)
 }
+
+func TestEncodeMergeOperand(t *testing.T) {
+	// 没有前一条记录
+	prevOffset, operand := DecodeMergeOperand(EncodeMergeOperand(-1, []byte("1")))
+	assert.Equal(t, int64(-1), prevOffset)
+	assert.Equal(t, []byte("1"), operand)
+
+	// 前一条记录在文件开头
+	prevOffset, operand = DecodeMergeOperand(EncodeMergeOperand(0, []byte("bitcask")))
+	assert.Equal(t, int64(0), prevOffset)
+	assert.Equal(t, []byte("bitcask"), operand)
+
+	// 空的操作数
+	prevOffset, operand = DecodeMergeOperand(EncodeMergeOperand(1<<40, nil))
+	assert.Equal(t, int64(1<<40), prevOffset)
+	assert.Equal(t, 0, len(operand))
+}
+
+func TestEncodeLogRecord_Namespace(t *testing.T) {
+	rec := &LogRecord{
+		Key:       []byte("name"),
+		Value:     []byte("bitcask-go"),
+		Type:      LogRecordDeleted,
+		Namespace: 300,
+	}
+	enc, size := EncodeLogRecord(rec)
+	assert.Equal(t, int64(len(enc)), size)
+
+	header, headerSize := decodeLogRecordHeader(enc)
+	assert.Equal(t, LogRecordDeleted, header.recordType)
+	assert.Equal(t, uint32(300), header.namespace)
+	assert.Equal(t, int64(size)-int64(len(rec.Key)+len(rec.Value)), headerSize)
+
+	decoded, err := DecodeLogRecord(enc)
+	assert.Nil(t, err)
+	assert.Equal(t, rec, decoded)
+
+	// 默认命名空间的记录和之前的格式相同
+	rec.Namespace = 0
+	enc, _ = EncodeLogRecord(rec)
+	assert.Equal(t, LogRecordDeleted, enc[4])
+}
@@ -9,6 +9,8 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"bitcask.go/data"
 	"bitcask.go/fio"
@@ -37,6 +39,15 @@ type DB struct {
 	fileLock         *flock.Flock              //文件锁，保证多进程之间互斥
 	bytesWrite       uint                      //当前写了多少字节
 	reclaimSize      int64                     //标识有多少无效数据
+	writes           *writeTracker             //只预留了位置、还没有提交的并发写入
+	writeHole        atomic.Pointer[writeHole] //并发写入失败之后活跃文件中无法填充的空洞
+	restorePoint     time.Time                 //最后一个时间点标记的时间段的开始时间
+
+	transactionRecords map[uint64][]*data.TransactionRecord //还没有看到完成标识的事务数据，只读模式下 Refresh 时接着使用
+
+	namespaces      map[string]*Namespace // 所有的命名空间（不包括默认命名空间）
+	namespaceIDs    map[uint32]*Namespace // 命名空间 ID 到命名空间的映射
+	nextNamespaceID uint32                // 下一个创建的命名空间使用的 ID
 }
 
 type Stat struct {
@@ -48,10 +59,15 @@ type Stat struct {
 
 // BackUp 拷贝数据库的方法(dir 用户传递过来的需要拷贝的目标目录)
 func (db *DB) BackUp(dir string) error {
+	if db.option.InMemory {
+		return ErrNotSupportedInMemory
+	}
+
 	db.rwmu.RLock()
 	defer db.rwmu.RUnlock()
+	db.waitPendingWrites()
 
-	return utils.CopyDir(db.option.DirPath, dir, []string{fileLockName})
+	return db.backUpAll(NewLocalBackupTarget(dir))
 }
 
 // Open 打开 bitcask 储存引擎的实例
@@ -61,10 +77,19 @@ func Open(options Options) (*DB, error) {
 		return nil, err
 	}
 
+	//内存模式下不需要访问磁盘
+	if options.InMemory {
+		return openInMemory(options)
+	}
+
 	var isNewInitial bool
 
 	// 对用户传递过来的目录进行校验，如果目录不为空，但这个目录不存在（第一次使用），需要创建这个目录
 	if _, err := os.Stat(options.DirPath); os.IsNotExist(err) {
+		//只读模式下不能创建目录
+		if options.ReadOnly {
+			return nil, err
+		}
 
 		isNewInitial = true //第一次初始化数据文件
 
@@ -73,17 +98,34 @@ func Open(options Options) (*DB, error) {
 		}
 	}
 
-	// 判断当前数据目录是否正在使用
-	fileLock := flock.New(filepath.Join(options.DirPath, fileLockName)) //初始化文件锁
+	//只读模式下不需要获取文件锁，可以和正在写入的进程同时打开同一个目录
+	var fileLock *flock.Flock
+	var opened bool
+	if !options.ReadOnly {
+		// 判断当前数据目录是否正在使用
+		fileLock = flock.New(filepath.Join(options.DirPath, fileLockName)) //初始化文件锁
 
-	//尝试去获取这把锁
-	hold, err := fileLock.TryLock()
-	if err != nil {
-		return nil, err
+		//尝试去获取这把锁
+		hold, err := fileLock.TryLock()
+		if err != nil {
+			return nil, err
+		}
+		//如果没获取到，说明有进程在使用这把锁，返回错误
+		if !hold {
+			return nil, ErrFilelockIsInUse
+		}
+
+		//打开失败的时候需要释放文件锁，否则修复数据之后无法再次打开这个目录
+		defer func() {
+			if !opened {
+				_ = fileLock.Unlock()
+			}
+		}()
 	}
-	//如果没获取到，说明有进程在使用这把锁，返回错误
-	if !hold {
-		return nil, ErrFilelockIsInUse
+
+	//只读模式下不能打开 B+ 树和混合索引的索引文件（它由写入的进程独占），直接从数据文件在内存中构建索引
+	if options.ReadOnly && (options.IndexType == BPlusTree || options.IndexType == Hybrid) {
+		options.IndexType = BTree
 	}
 
 	//如果序列号文件存在但是对应的文件为空 isNewInitial 也应该为 true
@@ -91,8 +133,19 @@ func Open(options Options) (*DB, error) {
 	if err != nil {
 		return nil, err
 	}
-	if len(entries) == 0 {
-		isNewInitial = true
+	//文件锁、MANIFEST 文件和混合索引遗留的冷数据文件不算作数据文件
+	isNewInitial = true
+	for _, entry := range entries {
+		if entry.Name() != fileLockName && entry.Name() != FormatManifestFileName && entry.Name() != index.HybridIndexFileName {
+			isNewInitial = false
+			break
+		}
+	}
+
+	//用户自己选择索引类型（Btree ART），混合索引打开冷数据文件失败时返回错误
+	indexer, err := newIndexer(options, options.IndexType)
+	if err != nil {
+		return nil, err
 	}
 
 	//初始化 DB 实例的结构体，对其数据结构进行初始化
@@ -101,14 +154,23 @@ func Open(options Options) (*DB, error) {
 		option:       options,
 		rwmu:         new(sync.RWMutex),
 		oldFiles:     make(map[uint32]*data.DataFile),
-		index:        index.NewIndexer(options.IndexType, options.DirPath, options.SyncWrites), //用户自己选择索引类型（Btree ART）
+		index:        indexer,
 		isNewInitial: isNewInitial,
+		writes:       newWriteTracker(),
 		fileLock:     fileLock,
+		// 缓存我们事务的数据，等待一整批事务都完成之后再更新索引
+		transactionRecords: make(map[uint64][]*data.TransactionRecord), //map[序列号]
 	}
 
-	// 首先加载 merge 的数据目录
-	if err := db.loadMergeFiles(); err != nil {
-		return nil, err
+	// 首先加载 merge 的数据目录（只读模式下不能移动文件）
+	var mergeLoaded bool
+	if !options.ReadOnly {
+		if _, err := os.Stat(db.getMergePath()); err == nil {
+			mergeLoaded = true
+		}
+		if err := db.loadMergeFiles(); err != nil {
+			return nil, err
+		}
 	}
 
 	// 然后加载对应的数据文件
@@ -116,6 +178,16 @@ func Open(options Options) (*DB, error) {
 		return nil, err
 	}
 
+	// 加载索引之前需要知道有哪些命名空间
+	if err := db.loadNamespaces(); err != nil {
+		return nil, err
+	}
+
+	// 校验数据目录的格式版本
+	if err := db.loadFormatManifest(mergeLoaded); err != nil {
+		return nil, err
+	}
+
 	//如果使用的是B+树索引类型，不需要加载索引了
 	if options.IndexType != BPlusTree {
 		//首先从 hint文件中加载索引
@@ -129,6 +201,11 @@ func Open(options Options) (*DB, error) {
 		}
 	}
 
+	//只读模式 Refresh 时还要接着使用没有完成的事务数据，写入模式下崩溃时没有完成的事务不会再完成，直接释放
+	if !options.ReadOnly {
+		db.transactionRecords = nil
+	}
+
 	//如果是B+树类型，打开当前事务序列号的文件，取出事务序列号
 	if options.IndexType == BPlusTree {
 		//加载事务序列号
@@ -136,9 +213,9 @@ func Open(options Options) (*DB, error) {
 			return nil, err
 		}
 
-		//直接将偏移量设置为文件的大小
+		//不需要重建索引，但仍然要校验活跃文件，截断写了一半的尾部记录后，将偏移量设置为有效数据的末尾
 		if db.activeFile != nil {
-			size, err := db.activeFile.IOManager.Size()
+			size, err := db.loadLogRecords(db.activeFile, 0, true, func(*data.LogRecord, int64, int64) {})
 			if err != nil {
 				return nil, err
 			}
@@ -146,19 +223,79 @@ func Open(options Options) (*DB, error) {
 		}
 	}
 
-	//重置 IO 类型为标准IO类型
-	if db.option.MMapAtStartup { //只用作启动加速
+	//预分配的活跃文件在崩溃之后末尾会留下一段 0，需要截断掉，否则之后追加的数据无法被加载
+	if !db.option.ReadOnly && db.activeFile != nil {
+		size, err := db.activeFile.IOManager.Size()
+		if err != nil {
+			return nil, err
+		}
+		if size > db.activeFile.Offsetnow {
+			if err := db.activeFile.Truncate(db.activeFile.Offsetnow); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	//重置 IO 类型为用户设置的IO类型（只读模式下一直使用内存映射）
+	if db.option.MMapAtStartup && !db.option.ReadOnly { //只用作启动加速
 		if err := db.resetIOType(); err != nil {
 			return nil, err
 		}
 	}
 
 	//加载完成之后，返回DB的结构体实例
+	opened = true
 	return db, nil
 }
 
+// openInMemory 打开一个只保存在内存中的数据库实例：没有需要加载的数据，也不需要文件锁
+func openInMemory(options Options) (*DB, error) {
+	//B+ 树索引和混合索引需要保存在磁盘上，改为使用 BTree 索引
+	if options.IndexType == BPlusTree || options.IndexType == Hybrid {
+		options.IndexType = BTree
+	}
+	indexer, err := newIndexer(options, options.IndexType)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{
+		option:          options,
+		rwmu:            new(sync.RWMutex),
+		oldFiles:        make(map[uint32]*data.DataFile),
+		index:           indexer,
+		isNewInitial:    true,
+		writes:          newWriteTracker(),
+		namespaces:      make(map[string]*Namespace),
+		namespaceIDs:    make(map[uint32]*Namespace),
+		nextNamespaceID: 1,
+	}, nil
+}
+
+// newIndexer 根据配置创建 typ 类型的索引，IndexShards 大于 1 时按照 Key 的哈希值分片
+func newIndexer(options Options, typ IndexerType) (index.Indexer, error) {
+	opts := index.IndexerOptions{
+		DirPath:           options.DirPath,
+		Sync:              options.SyncWrites,
+		Comparator:        options.Comparator,
+		PrefixCompression: options.IndexPrefixCompression,
+		MemoryBudget:      options.IndexMemoryBudget,
+	}
+	if options.IndexShards > 1 && typ != Hybrid && typ != BPlusTree {
+		sharded, err := index.NewShardedIndex(typ, options.IndexShards, opts)
+		if err != nil {
+			return nil, err
+		}
+		return sharded, nil
+	}
+	return index.NewIndexerWithOptions(typ, opts)
+}
+
 // Put DB数据写入的方法：写入 Key(非空) 和 Value
 func (db *DB) Put(key []byte, value []byte) error {
+	if db.option.ReadOnly {
+		return ErrReadOnly
+	}
+
 	//要写入的数据为空直接返回
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
@@ -171,20 +308,13 @@ func (db *DB) Put(key []byte, value []byte) error {
 		Type:  data.LogRecordNormal,
 	}
 
-	//调用 appendLogRecord,追加写入当前的活跃文件中
-	pos, err := db.appendLogRecordWithLock(logRecord)
-	if err != nil {
-		return err
-	}
-
-	//拿到索引信息之后，更新内存索引
-	if oldPos := db.index.Put(key, pos); oldPos != nil {
-		//递增size
-		db.reclaimSize += int64(oldPos.Size)
-	}
-
-	//没问题就直接返回
-	return nil
+	//追加写入当前的活跃文件中，拿到索引信息之后，更新内存索引
+	return db.appendLogRecordConcurrently(logRecord, func(pos *data.LogRecordPos) {
+		if oldPos := db.index.Put(key, pos); oldPos != nil {
+			//递增size
+			db.reclaimSize += int64(oldPos.Size)
+		}
+	})
 }
 
 // Get DB数据读取的方法
@@ -209,10 +339,150 @@ func (db *DB) Get(key []byte) ([]byte, error) {
 	return db.getValueByPosition(logRecordPos)
 }
 
+// MultiPut 在一次加锁中写入多条数据，所有数据写完之后才根据配置持久化一次
+// 注意：和 WriteBatch 不同，MultiPut 不保证原子性，出错时之前已经写入的数据仍然有效
+func (db *DB) MultiPut(keys, values [][]byte) error {
+	if db.option.ReadOnly {
+		return ErrReadOnly
+	}
+	if len(keys) != len(values) {
+		return ErrKeyValueCountMismatch
+	}
+	for _, key := range keys {
+		if len(key) == 0 {
+			return ErrKeyIsEmpty
+		}
+	}
+
+	db.rwmu.Lock()
+	defer db.rwmu.Unlock()
+
+	for i, key := range keys {
+		logRecord := &data.LogRecord{
+			Key:   logRecordKeyWithSeqNum(key, nonTransactionSeqNum),
+			Value: values[i],
+			Type:  data.LogRecordNormal,
+		}
+		pos, err := db.writeLogRecord(logRecord)
+		if err != nil {
+			return err
+		}
+		if oldPos := db.index.Put(key, pos); oldPos != nil {
+			db.reclaimSize += int64(oldPos.Size)
+		}
+	}
+	return db.syncAfterWrite()
+}
+
+// MultiGet 批量读取多个 Key，返回的 values 和 errs 与 keys 一一对应
+// 在一次加锁中查找所有 Key 的位置，按照 (Fid, Offset) 排序之后在一次批量请求中读取，使用 io_uring 时只需要一次系统调用
+func (db *DB) MultiGet(keys [][]byte) ([][]byte, []error) {
+	db.rwmu.RLock()
+	defer db.rwmu.RUnlock()
+
+	values := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+
+	reqs := make([]*fio.ReadRequest, 0, len(keys))
+	reqIndexes := make([]int, 0, len(keys))
+	positions := make([]*data.LogRecordPos, 0, len(keys))
+	for i, key := range keys {
+		if len(key) == 0 {
+			errs[i] = ErrKeyIsEmpty
+			continue
+		}
+		logRecordPos := db.index.Get(key)
+		if logRecordPos == nil {
+			errs[i] = ErrKeyNotFound
+			continue
+		}
+		//没有记录长度的位置信息只能逐个读取
+		if logRecordPos.Size == 0 {
+			values[i], errs[i] = db.getValueByPosition(logRecordPos)
+			continue
+		}
+		dataFile := db.getDataFile(logRecordPos.Fid)
+		if dataFile == nil {
+			errs[i] = ErrDataFileNotFound
+			continue
+		}
+		reqs = append(reqs, &fio.ReadRequest{
+			File:   dataFile.IOManager,
+			Buf:    make([]byte, logRecordPos.Size),
+			Offset: logRecordPos.Offset,
+		})
+		reqIndexes = append(reqIndexes, i)
+		positions = append(positions, logRecordPos)
+	}
+
+	//按照数据在磁盘上的位置排序，顺序读取局部性更好
+	sort.Sort(&multiGetReads{reqs: reqs, indexes: reqIndexes, positions: positions})
+	fio.ReadBatch(reqs)
+
+	for j, req := range reqs {
+		i := reqIndexes[j]
+		if req.N < len(req.Buf) {
+			if req.Err == nil || req.Err == io.EOF {
+				req.Err = data.ErrIncompleteLogRecord
+			}
+			errs[i] = req.Err
+			continue
+		}
+		logRecord, err := data.DecodeLogRecord(req.Buf)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		if logRecord.Type == data.LogRecordDeleted {
+			errs[i] = ErrKeyNotFound
+			continue
+		}
+		if logRecord.Type == data.LogRecordMerge {
+			values[i], errs[i] = db.resolveMergeOperands(db.getDataFile(positions[j].Fid), logRecord)
+			continue
+		}
+		values[i] = logRecord.Value
+	}
+	return values, errs
+}
+
+// multiGetReads MultiGet 中需要读取的数据，按照 (Fid, Offset) 排序
+type multiGetReads struct {
+	reqs      []*fio.ReadRequest
+	indexes   []int
+	positions []*data.LogRecordPos
+}
+
+func (r *multiGetReads) Len() int { return len(r.reqs) }
+
+func (r *multiGetReads) Less(i, j int) bool {
+	if r.positions[i].Fid != r.positions[j].Fid {
+		return r.positions[i].Fid < r.positions[j].Fid
+	}
+	return r.positions[i].Offset < r.positions[j].Offset
+}
+
+func (r *multiGetReads) Swap(i, j int) {
+	r.reqs[i], r.reqs[j] = r.reqs[j], r.reqs[i]
+	r.indexes[i], r.indexes[j] = r.indexes[j], r.indexes[i]
+	r.positions[i], r.positions[j] = r.positions[j], r.positions[i]
+}
+
+// getDataFile 根据文件ID找到对应的数据文件，调用时必须持有锁
+func (db *DB) getDataFile(fileID uint32) *data.DataFile {
+	if db.activeFile != nil && db.activeFile.FileID == fileID {
+		return db.activeFile
+	}
+	return db.oldFiles[fileID]
+}
+
 // Close 关闭数据库,只需要关闭当前的活跃文件即可
 func (db *DB) Close() error {
-	//关闭文件锁
+	//关闭文件锁(只读模式下没有获取文件锁)
 	defer func() {
+		if db.fileLock == nil {
+			return
+		}
 		if err := db.fileLock.Unlock(); err != nil {
 			panic(fmt.Sprintf("failed to unlock the directory,%#v", err))
 		}
@@ -226,17 +496,29 @@ func (db *DB) Close() error {
 	//加锁，保证没有其他并发操作干扰到数据库的状态
 	db.rwmu.Lock()
 	defer db.rwmu.Unlock()
+	db.waitPendingWrites()
+	if err := db.truncateWriteHole(); err != nil {
+		return err
+	}
 
 	// 关闭索引
 	if err := db.index.Close(); err != nil {
 		return err
 	}
 
+	//只读模式和内存模式下不能写入序列号文件，直接关闭所有的数据文件
+	if db.option.ReadOnly || db.option.InMemory {
+		return db.closeDataFiles()
+	}
+
 	//B+树拿不到事务的序列号，因此我们需要将事务序列号提前保存起来
 	seqNumFile, err := data.OpenSeqNUmFile(db.option.DirPath)
 	if err != nil {
 		return err
 	}
+	if err := db.wrapIOManager(seqNumFile); err != nil {
+		return err
+	}
 	//保存一条关于当前序列号的记录
 	record := &data.LogRecord{
 		Key:   []byte(seqNumKey),
@@ -254,6 +536,11 @@ func (db *DB) Close() error {
 		return err
 	}
 
+	return db.closeDataFiles()
+}
+
+// closeDataFiles 关闭当前活跃文件和所有旧的数据文件
+func (db *DB) closeDataFiles() error {
 	// 关闭当前活跃文件
 	if err := db.activeFile.Close(); err != nil {
 		return err
@@ -270,30 +557,94 @@ func (db *DB) Close() error {
 
 // Sync 持久化数据文件
 func (db *DB) Sync() error {
-	//活跃文件为空就返回
-	if db.activeFile == nil {
+	//活跃文件为空就返回，只读模式下没有需要持久化的数据
+	if db.activeFile == nil || db.option.ReadOnly {
 		return nil
 	}
 
 	//加锁，保证没有其他并发操作干扰到数据库的状态
 	db.rwmu.Lock()
 	defer db.rwmu.Unlock()
+	db.waitPendingWrites()
 
 	//持久化当前的活跃文件
 	return db.activeFile.Sync()
 }
 
+// Refresh 只读模式下加载其他进程新写入的数据（新的数据文件，以及最新的数据文件中追加的记录）
+// 注意：其他进程 merge 之后的数据需要重新打开数据库才能看到
+func (db *DB) Refresh() error {
+	if !db.option.ReadOnly {
+		return nil
+	}
+
+	db.rwmu.Lock()
+	defer db.rwmu.Unlock()
+
+	fileIDs, err := getDataFileIDs(db.option.DirPath)
+	if err != nil {
+		return err
+	}
+
+	// 写入的进程可能新建或者删除了命名空间
+	if err := db.refreshNamespaces(); err != nil {
+		return err
+	}
+
+	// 找出新的数据文件
+	var newFileIDs []uint32
+	for _, fid := range fileIDs {
+		if db.activeFile == nil || uint32(fid) > db.activeFile.FileID {
+			newFileIDs = append(newFileIDs, uint32(fid))
+		}
+	}
+
+	// 之前最新的数据文件可能又追加了数据，重新映射之后从上次读到的位置继续加载
+	if db.activeFile != nil {
+		if err := db.activeFile.SetIOManager(db.option.DirPath, fio.MemoryMap); err != nil {
+			return err
+		}
+		if err := db.wrapIOManager(db.activeFile); err != nil {
+			return err
+		}
+		if err := db.loadIndexFromDataFile(db.activeFile, db.activeFile.Offsetnow, len(newFileIDs) == 0); err != nil {
+			return err
+		}
+	}
+
+	for i, fileID := range newFileIDs {
+		dataFile, err := data.OpenDataFile(db.option.DirPath, fileID, fio.MemoryMap)
+		if err != nil {
+			return err
+		}
+		if err := db.wrapIOManager(dataFile); err != nil {
+			return err
+		}
+		if db.activeFile != nil {
+			db.oldFiles[db.activeFile.FileID] = db.activeFile
+		}
+		db.activeFile = dataFile
+		db.fileIDs = append(db.fileIDs, int(fileID))
+
+		if err := db.loadIndexFromDataFile(dataFile, 0, i == len(newFileIDs)-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Stat 返回数据库相关信息
 func (db *DB) Stat() *Stat {
 	db.rwmu.RLock()
 	defer db.rwmu.RUnlock()
+	db.waitPendingWrites()
 
 	var dataFiles = uint(len(db.oldFiles))
 	if db.activeFile != nil {
 		dataFiles += 1
 	}
 
-	dirSize, err := utils.DirSize(db.option.DirPath)
+	dirSize, err := db.dataSize()
 	if err != nil {
 		panic(fmt.Sprintf("failed to get dir size,err:%#v", err))
 	}
@@ -375,12 +726,20 @@ func (db *DB) getValueByPosition(logRecordPos *data.LogRecordPos) ([]byte, error
 	if logRecord.Type == data.LogRecordDeleted {
 		return nil, ErrKeyNotFound
 	}
+	//合并操作数需要和之前的记录一起合并出实际的数据
+	if logRecord.Type == data.LogRecordMerge {
+		return db.resolveMergeOperands(dataFile, logRecord)
+	}
 	//返回实际的数据
 	return logRecord.Value, nil
 }
 
 // Delete 删除数据的方法
 func (db *DB) Delete(key []byte) error {
+	if db.option.ReadOnly {
+		return ErrReadOnly
+	}
+
 	// 首先校验用户传入的Key,为空直接返回
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
@@ -399,22 +758,23 @@ func (db *DB) Delete(key []byte) error {
 		Type: data.LogRecordDeleted}
 
 	// 写入数据文件中
-	pos, err := db.appendLogRecordWithLock(logRecord)
+	var indexUpdated bool
+	err := db.appendLogRecordConcurrently(logRecord, func(pos *data.LogRecordPos) {
+		//将删除这个标记也标记为删除
+		db.reclaimSize += int64(pos.Size)
+
+		// 在对应的内存索引中删除
+		var oldPos *data.LogRecordPos
+		if oldPos, indexUpdated = db.index.Delete(key); oldPos != nil {
+			db.reclaimSize += int64(oldPos.Size)
+		}
+	})
 	if err != nil {
-		return nil
+		return err
 	}
-
-	//将删除这个标记也标记为删除
-	db.reclaimSize += int64(pos.Size)
-
-	// 在对应的内存索引中删除
-	oldPos, ok := db.index.Delete(key)
-	if !ok {
+	if !indexUpdated {
 		return ErrIndexUpdateFailed
 	}
-	if oldPos != nil {
-		db.reclaimSize += int64(oldPos.Size)
-	}
 
 	return nil
 }
@@ -429,42 +789,94 @@ func (db *DB) appendLogRecordWithLock(logRecord *data.LogRecord) (*data.LogRecor
 
 // appendLogRecord 构造 LogRecord append 的方法：数据文件的追加写入
 func (db *DB) appendLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, error) {
+	pos, err := db.writeLogRecord(logRecord)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.syncAfterWrite(); err != nil {
+		return nil, err
+	}
+	return pos, nil
+}
+
+// writeLogRecord 将记录追加写入活跃文件（活跃文件写满之后切换到新的文件），不进行持久化
+// 注意！！！使用这个 DB 方法的时候必须持有互斥锁
+func (db *DB) writeLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, error) {
+	//等待预留了位置的并发写入完成，保证这条记录在它们之后更新索引
+	db.waitPendingWrites()
+
+	//进入新的时间段时先写入时间点标记
+	if err := db.writeRestorePoint(); err != nil {
+		return nil, err
+	}
+
+	// 开始对当前数据文件进行读写操作
+	encRecord, size := data.EncodeLogRecord(logRecord) //拿到一个编码后的结果和长度
+	if err := db.prepareActiveFile(size); err != nil {
+		return nil, err
+	}
+
+	//开始实现数据文件写入操作：
+	//记录当前的offset
+	writeOff := db.activeFile.Offsetnow
+	//将编码后的文件写入新的活跃文件
+	if err := db.activeFile.Write(encRecord); err != nil {
+		return nil, err
+	}
+
+	//对已经写的数据字段进行递增
+	db.bytesWrite += uint(size)
+
+	//构造内存索引信息，返回去上一层
+	pos := &data.LogRecordPos{
+		Fid:    db.activeFile.FileID,
+		Offset: writeOff,
+		Size:   uint32(size),
+	}
+	return pos, nil
+}
+
+// prepareActiveFile 保证活跃文件存在并且还能写下 size 字节的数据，写满时切换到新的活跃文件
+// 注意！！！使用这个 DB 方法的时候必须持有互斥锁
+func (db *DB) prepareActiveFile(size int64) error {
 	//判断当前的活跃文件是否存在(因为数据库没有写入的之前没有文件生成)，将其初始化
 	//如果活跃文件为空则初始化该文件
 	if db.activeFile == nil {
 		if err := db.setActiveFile(); err != nil {
-			return nil, err
+			return err
+		}
+	}
+	//之前的并发写入留下了无法填充的空洞，等待预留了位置的写入都完成之后截断到空洞的位置
+	if db.writeHole.Load() != nil {
+		db.waitPendingWrites()
+		if err := db.truncateWriteHole(); err != nil {
+			return err
 		}
 	}
-	// 开始对当前数据文件进行读写操作
-	encRecord, size := data.EncodeLogRecord(logRecord) //拿到一个编码后的结果和长度
 	//注意! ! ! 写入之前判断:当前活跃文件大小再加上需要写入的数据的大小是否超过阈值，
 	//超过则改变目前活跃文件的状态并且需要新打开一个活跃文件，然后再写入新的活跃文件
 	if db.activeFile.Offsetnow+size > db.option.DataFileSize {
+		//预留了位置的并发写入都完成之后，才能持久化当前的活跃文件
+		db.waitPendingWrites()
+
 		//将当前活跃的文件进行持久化（保证安全持久化进入磁盘）
 		if err := db.activeFile.Sync(); err != nil {
-			return nil, err
+			return err
 		}
 		//将之前的活跃文件持久化之后，将其转化为旧的数据文件，以便于更新活跃文件
 		db.oldFiles[db.activeFile.FileID] = db.activeFile
 
 		//打开新的数据文件作为新的活跃文件
 		if err := db.setActiveFile(); err != nil {
-			return nil, err
+			return err
 		}
 	}
+	return nil
+}
 
-	//开始实现数据文件写入操作：
-	//记录当前的offset
-	writeOff := db.activeFile.Offsetnow
-	//将编码后的文件写入新的活跃文件
-	if err := db.activeFile.Write(encRecord); err != nil {
-		return nil, err
-	}
-
-	//对已经写的数据字段进行递增
-	db.bytesWrite += uint(size)
-
+// syncAfterWrite 根据用户配置（SyncWrites、BytesPerSync）决定写入之后是否需要持久化活跃文件
+// 注意！！！使用这个 DB 方法的时候必须持有互斥锁
+func (db *DB) syncAfterWrite() error {
 	//根据用户配置来决定是否需要持久化
 	var isNeedSync = db.option.SyncWrites
 
@@ -475,73 +887,99 @@ func (db *DB) appendLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, er
 
 	if isNeedSync {
 		if err := db.activeFile.Sync(); err != nil {
-			return nil, err
+			return err
 		}
 		// 清空累计值
 		if db.bytesWrite > 0 {
 			db.bytesWrite = 0
 		}
 	}
-
-	//构造内存索引信息，返回去上一层
-	pos := &data.LogRecordPos{
-		Fid:    db.activeFile.FileID,
-		Offset: writeOff,
-		Size:   uint32(size),
-	}
-	return pos, nil
+	return nil
 }
 
 // setActiveFile 设置当前活跃文件
 // 注意！！！使用这个 DB 方法的时候必须持有互斥锁，不然并发访问会崩
 func (db *DB) setActiveFile() error {
+	//切换之前已经等待了所有的并发写入，之前的活跃文件中无法填充的空洞需要截断
+	if err := db.truncateWriteHole(); err != nil {
+		return err
+	}
+
 	var defaultFileID uint32 = 0 //默认初始化为0
 
 	if db.activeFile != nil { //如果目前活跃文件不为空，则初始化的时候Fileid+1(保证Fileid递增)
 		defaultFileID = db.activeFile.FileID + 1
 	}
 	//打开新的数据文件作为活跃文件
-	datafile, err := data.OpenDataFile(db.option.DirPath, defaultFileID, fio.StandardFIO)
+	datafile, err := data.OpenDataFile(db.option.DirPath, defaultFileID, db.writeIOType())
 	if err != nil {
 		return err
 	}
+	if err := db.wrapIOManager(datafile); err != nil {
+		return err
+	}
 	db.activeFile = datafile //修改目前的活跃文件
 
-	return nil
+	//内存模式下没有 MANIFEST 文件
+	if db.option.InMemory {
+		return nil
+	}
+
+	//预先分配整个数据文件的空间（IO 类型不支持时什么都不做）
+	if err := datafile.Preallocate(db.option.DataFileSize); err != nil {
+		return err
+	}
+
+	// 数据文件发生了变化，更新 MANIFEST 文件
+	return db.writeFormatManifest()
+}
+
+// writeIOType 启动之后读写数据文件使用的 IO 类型
+func (db *DB) writeIOType() fio.FileIOType {
+	if db.option.InMemory {
+		return fio.InMemory
+	}
+	return db.option.IOType
+}
+
+// dataSize 所有数据占用的空间大小，内存模式下为所有数据文件的大小之和
+// 注意！！！内存模式下调用时必须持有锁
+func (db *DB) dataSize() (int64, error) {
+	if !db.option.InMemory {
+		return utils.DirSize(db.option.DirPath)
+	}
+
+	var size int64
+	files := make([]*data.DataFile, 0, len(db.oldFiles)+1)
+	for _, file := range db.oldFiles {
+		files = append(files, file)
+	}
+	if db.activeFile != nil {
+		files = append(files, db.activeFile)
+	}
+	for _, file := range files {
+		fileSize, err := file.IOManager.Size()
+		if err != nil {
+			return 0, err
+		}
+		size += fileSize
+	}
+	return size, nil
 }
 
 // loadDataFiles 数据库启动时：加载对应的数据文件
 func (db *DB) loadDataFiles() error {
-	//首先根据配置项读取存储的对应目录，拿到目录列表
-	dirEntry, err := os.ReadDir(db.option.DirPath)
+	//首先根据配置项读取存储的对应目录，拿到有序的文件ID
+	fileIDs, err := getDataFileIDs(db.option.DirPath)
 	if err != nil {
 		return err
 	}
-
-	//参考网上资料:约定以 .data 为后缀的文件为目标数据文件
-	var fileIDs []int
-	for _, entry := range dirEntry { //entry: 其中的一个子目录
-		if strings.HasSuffix(entry.Name(), data.DataFileSuffix) {
-			//如果是以 .data 结尾的文件：对这个文件进行名称分割,拿到前半部分(0001.data -> 0001)
-			splitName := strings.Split(entry.Name(), ".")
-			//以 ASCII 码为中介将 string 解析为 int 类型,拿到对应的fileid
-			fileID, err := strconv.Atoi(splitName[0])
-			//解析错误说明数据目录可能被损坏了
-			if err != nil {
-				return ErrDataDirectoryCorrupted
-			}
-			//将对应的fileID分别存放到fileIDs中
-			fileIDs = append(fileIDs, fileID)
-		}
-	}
-	// 对 fileIDs进行排序，需要从小到大分别分别加载数据文件，保证递增性
-	sort.Ints(fileIDs)
 	db.fileIDs = fileIDs //赋值，使其实例化的同时满足有序
 
 	//遍历每一个文件的ID,打开每一个对应的数据文件
 	for i, fid := range fileIDs {
-		IOType := fio.StandardFIO
-		if db.option.MMapAtStartup {
+		IOType := db.option.IOType
+		if db.option.MMapAtStartup || db.option.ReadOnly {
 			IOType = fio.MemoryMap
 		}
 
@@ -549,6 +987,9 @@ func (db *DB) loadDataFiles() error {
 		if err != nil {
 			return err
 		}
+		if err := db.wrapIOManager(datafile); err != nil {
+			return err
+		}
 		//如果遍历到最新的文件(活跃文件)则停止，否则就将该文件加入旧文件队伍中（保证活跃文件的唯一性）
 		//一个简单的算法：(注意 ! ! ! 从0开始索引)
 		if i == len(fileIDs)-1 {
@@ -561,6 +1002,34 @@ func (db *DB) loadDataFiles() error {
 	return nil
 }
 
+// getDataFileIDs 读取目录中所有的数据文件，返回从小到大排好序的文件ID
+func getDataFileIDs(dirPath string) ([]int, error) {
+	dirEntry, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	//参考网上资料:约定以 .data 为后缀的文件为目标数据文件
+	var fileIDs []int
+	for _, entry := range dirEntry { //entry: 其中的一个子目录
+		if strings.HasSuffix(entry.Name(), data.DataFileSuffix) {
+			//如果是以 .data 结尾的文件：对这个文件进行名称分割,拿到前半部分(0001.data -> 0001)
+			splitName := strings.Split(entry.Name(), ".")
+			//以 ASCII 码为中介将 string 解析为 int 类型,拿到对应的fileid
+			fileID, err := strconv.Atoi(splitName[0])
+			//解析错误说明数据目录可能被损坏了
+			if err != nil {
+				return nil, ErrDataDirectoryCorrupted
+			}
+			//将对应的fileID分别存放到fileIDs中
+			fileIDs = append(fileIDs, fileID)
+		}
+	}
+	// 对 fileIDs进行排序，需要从小到大分别分别加载数据文件，保证递增性
+	sort.Ints(fileIDs)
+	return fileIDs, nil
+}
+
 // loadIndexFromFiles 从数据文件中加载索引的方法
 func (db *DB) loadIndexFromDataFiles() error {
 	// 遍历文件中的所有记录，并加载到内存的索引中去
@@ -588,31 +1057,6 @@ func (db *DB) loadIndexFromDataFiles() error {
 		nonMergeFileID = fileID
 	}
 
-	//定义更新内存索引的方法
-	updateIndex := func(key []byte, typ data.LogRecordType, pos *data.LogRecordPos) {
-		var oldPos *data.LogRecordPos
-		//这个索引可能被删除，查看是否有墓碑值,有的话直接删除
-		if typ == data.LogRecordDeleted {
-			oldPos, _ = db.index.Delete(key)
-
-			//加上墓碑值的大小
-			db.reclaimSize += int64(pos.Size)
-
-		} else {
-			//正常的话就加入内存索引
-			oldPos = db.index.Put(key, pos)
-		}
-		if oldPos != nil {
-			db.reclaimSize += int64(oldPos.Size)
-		}
-	}
-
-	// 缓存我们事务的数据，等待一整批事务都完成之后再更新索引
-	transactionRecords := make(map[uint64][]*data.TransactionRecord) //map[序列号]
-
-	// 序列号从零开始
-	var currentSeqNum = nonTransactionSeqNum
-
 	// 遍历所有的文件ID,取出所有文件中的内容
 	for i, fid := range db.fileIDs {
 		//类型转换，方便处理活跃文件和旧文件
@@ -632,75 +1076,101 @@ func (db *DB) loadIndexFromDataFiles() error {
 		}
 
 		// 拿到一个文件后，从 0 开始循环处理这个文件中的所有内容
-		var offset int64 = 0
-		// 遍历一个文件的所有内容
-		for {
-			logRecord, size, err := dataFile.ReadLogRecord(offset)
-			if err != nil {
-				//如果文件读完了，需要跳出循环
-				if err == io.EOF {
-					break
-				} else {
-					//如果是其他错误直接返回
-					return err
-				}
-			}
+		if err := db.loadIndexFromDataFile(dataFile, 0, i == len(db.fileIDs)-1); err != nil {
+			return err
+		}
+	}
 
-			//构造内存索引并保存
-			logRecordPos := data.LogRecordPos{Fid: fileID, Offset: offset, Size: uint32(size)}
+	return nil
+}
 
-			//解析Key,拿到对应的事务序列号
-			realKey, seqNum := parseLogRecordKey(logRecord.Key)
+// loadIndexFromDataFile 从一个数据文件的 offset 位置开始加载索引
+func (db *DB) loadIndexFromDataFile(dataFile *data.DataFile, offset int64, isLastFile bool) error {
+	//定义更新内存索引的方法
+	updateIndex := func(namespace uint32, key []byte, typ data.LogRecordType, pos *data.LogRecordPos) {
+		//已经被删除的命名空间中的记录都是无效数据
+		idx := db.indexOf(namespace)
+		if idx == nil {
+			db.reclaimSize += int64(pos.Size)
+			return
+		}
 
-			//判断我们的序列号是否是事务类型，非事务提交的话直接更新内存索引
-			if seqNum == nonTransactionSeqNum {
-				updateIndex(realKey, logRecord.Type, &logRecordPos)
-			} else {
-				//如果是 WriteBatch 的事务类型
-				//事务完成之后，对应的数据更新到内存索引中
-				if logRecord.Type == data.LogRecordTxnFinished {
-
-					for _, txnRecord := range transactionRecords[seqNum] {
-
-						updateIndex(txnRecord.Record.Key, txnRecord.Record.Type, txnRecord.Pos)
-
-					}
-					// 对map类型进行清理缓存，方便下次继续使用
-					delete(transactionRecords, seqNum)
-				} else {
-					//  走到这里说明是在WriteBatch中写入的数据，但是目前还没有提交成功，先缓存起来
-					logRecord.Key = realKey
-					transactionRecords[seqNum] = append(transactionRecords[seqNum], &data.TransactionRecord{
-						Record: logRecord,
-						Pos:    &logRecordPos,
-					})
-				}
-			}
+		var oldPos *data.LogRecordPos
+		//这个索引可能被删除，查看是否有墓碑值,有的话直接删除
+		if typ == data.LogRecordDeleted {
+			oldPos, _ = idx.Delete(key)
 
-			//标记最新的序列号，方便我们每一批事务都从最新的序列号开始
-			if seqNum > currentSeqNum {
-				currentSeqNum = seqNum
-			}
+			//加上墓碑值的大小
+			db.reclaimSize += int64(pos.Size)
 
-			//对偏移量 offset 进行递增
-			offset += size
+		} else {
+			//正常的话就加入内存索引
+			oldPos = idx.Put(key, pos)
+
+			//合并操作数仍然引用着之前的记录，之前的记录不是无效数据
+			if typ == data.LogRecordMerge {
+				return
+			}
 		}
-		//读取到活跃文件跳出循环之后:进行当前offset的更新，以便于下一次从这里开始写入数据
-		if i == len(db.fileIDs)-1 {
-			db.activeFile.Offsetnow = offset
+		if oldPos != nil {
+			db.reclaimSize += int64(oldPos.Size)
 		}
 	}
 
-	//更新事务的序列号
-	db.seqNum = currentSeqNum
+	transactionRecords := db.transactionRecords
+	fileID := dataFile.FileID
+	offset, err := db.loadLogRecords(dataFile, offset, isLastFile, func(logRecord *data.LogRecord, offset int64, size int64) {
+		//构造内存索引并保存
+		logRecordPos := data.LogRecordPos{Fid: fileID, Offset: offset, Size: uint32(size)}
+
+		//解析Key,拿到对应的事务序列号
+		realKey, seqNum := parseLogRecordKey(logRecord.Key)
+
+		//判断我们的序列号是否是事务类型，非事务提交的话直接更新内存索引
+		if seqNum == nonTransactionSeqNum {
+			updateIndex(logRecord.Namespace, realKey, logRecord.Type, &logRecordPos)
+		} else {
+			//如果是 WriteBatch 的事务类型
+			//事务完成之后，对应的数据更新到内存索引中
+			if logRecord.Type == data.LogRecordTxnFinished {
+
+				for _, txnRecord := range transactionRecords[seqNum] {
 
+					updateIndex(txnRecord.Record.Namespace, txnRecord.Record.Key, txnRecord.Record.Type, txnRecord.Pos)
+
+				}
+				// 对map类型进行清理缓存，方便下次继续使用
+				delete(transactionRecords, seqNum)
+			} else {
+				//  走到这里说明是在WriteBatch中写入的数据，但是目前还没有提交成功，先缓存起来
+				logRecord.Key = realKey
+				transactionRecords[seqNum] = append(transactionRecords[seqNum], &data.TransactionRecord{
+					Record: logRecord,
+					Pos:    &logRecordPos,
+				})
+			}
+		}
+
+		//标记最新的序列号，方便我们每一批事务都从最新的序列号开始
+		if seqNum > db.seqNum {
+			db.seqNum = seqNum
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	//读取到活跃文件跳出循环之后:进行当前offset的更新，以便于下一次从这里开始写入数据
+	if isLastFile {
+		dataFile.Offsetnow = offset
+	}
 	return nil
 }
 
 // checkOptions 对用户传入的配置项进行校验
 func checkOptions(options Options) error {
-	// 如果用户传入的目录为空，直接返回
-	if options.DirPath == "" {
+	// 如果用户传入的目录为空，直接返回（内存模式下不需要目录）
+	if options.DirPath == "" && !options.InMemory {
 		return ErrDirPathNil
 	}
 	//大小为0，同样返回
@@ -713,6 +1183,41 @@ func checkOptions(options Options) error {
 		return ErrInvalidMergeRatio
 	}
 
+	// 恢复策略必须是已定义的类型
+	if options.RecoveryMode < RecoveryTruncateTail || options.RecoveryMode > RecoverySkipCorrupted {
+		return ErrInvalidRecoveryMode
+	}
+
+	// 内存模式下没有可以读取的已有数据
+	if options.InMemory && options.ReadOnly {
+		return ErrNotSupportedInMemory
+	}
+
+	// 只有这几种 IO 类型可以写入数据
+	switch options.IOType {
+	case fio.StandardFIO, fio.WritableMemoryMap, fio.DirectIO, fio.URing:
+	default:
+		return ErrInvalidIOType
+	}
+
+	// B+ 树和混合索引的冷数据按照字节序保存 Key
+	if options.Comparator != nil && (options.IndexType == BPlusTree || options.IndexType == Hybrid) {
+		return ErrComparatorNotSupported
+	}
+
+	// B+ 树的索引保存在同一个 bbolt 文件中，不能分片
+	if options.IndexShards < 0 || (options.IndexShards > 1 && (options.IndexType == BPlusTree || options.IndexType == Hybrid)) {
+		return ErrInvalidIndexShards
+	}
+
+	if options.IndexType == Hybrid && options.IndexMemoryBudget <= 0 {
+		return ErrInvalidIndexMemoryBudget
+	}
+
+	if options.RestorePointInterval < 0 {
+		return ErrInvalidRestorePoint
+	}
+
 	return nil
 }
 
@@ -746,7 +1251,7 @@ func (db *DB) loadSeqNum() error {
 	return os.Remove(fileName)
 }
 
-// resetIOType 将数据文件的 IO 类型设置为标准的文件IO类型（golang自带的）
+// resetIOType 启动加载完成之后，将数据文件的 IO 类型设置为用户配置的 IO 类型
 func (db *DB) resetIOType() error {
 	//当前活跃文件为空直接返回
 	if db.activeFile == nil {
@@ -754,15 +1259,35 @@ func (db *DB) resetIOType() error {
 	}
 
 	//设置当前活跃文件
-	if err := db.activeFile.SetIOManager(db.option.DirPath, fio.StandardFIO); err != nil {
+	if err := db.activeFile.SetIOManager(db.option.DirPath, db.writeIOType()); err != nil {
+		return err
+	}
+	if err := db.wrapIOManager(db.activeFile); err != nil {
 		return err
 	}
 
 	//遍历设置旧的数据文件
 	for _, dataFile := range db.oldFiles {
-		if err := dataFile.SetIOManager(db.option.DirPath, fio.StandardFIO); err != nil {
+		if err := dataFile.SetIOManager(db.option.DirPath, db.writeIOType()); err != nil {
+			return err
+		}
+		if err := db.wrapIOManager(dataFile); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// wrapIOManager 配置了 Options.wrapIOManager 时（测试中注入故障）包装文件的 IOManager
+func (db *DB) wrapIOManager(dataFile *data.DataFile) error {
+	if db.option.wrapIOManager == nil {
+		return nil
+	}
+	ioManager, err := db.option.wrapIOManager(dataFile.IOManager)
+	if err != nil {
+		_ = dataFile.Close()
+		return err
+	}
+	dataFile.IOManager = ioManager
+	return nil
+}
@@ -1,352 +1,459 @@
-package bitcask
-
-import (
-	"os"
-	"testing"
-
-	"bitcask.go/utils"
-	"github.com/stretchr/testify/assert"
-)
-
-// 测试完成之后销毁 DB 数据目录
-func destroyDB(db *DB) {
-	if db != nil {
-		if db.activeFile != nil {
-			_ = db.Close()
-		}
-		for _, of := range db.oldFiles {
-			if of != nil {
-				_ = of.Close()
-			}
-		}
-		err := os.RemoveAll(db.option.DirPath)
-		if err != nil {
-			panic(err)
-		}
-	}
-}
-
-// ok
-func TestOpen(t *testing.T) {
-	opts := DefaultOptions
-	dir, _ := os.MkdirTemp("", "bitcask-go")
-	opts.DirPath = dir
-	db, err := Open(opts)
-	defer destroyDB(db)
-	assert.Nil(t, err)
-	assert.NotNil(t, db)
-}
-
-// 除了 4 6 其他ok
-func TestDB_Put(t *testing.T) {
-	opts := DefaultOptions
-	dir, _ := os.MkdirTemp("", "bitcask-go-put")
-	opts.DirPath = dir
-	opts.DataFileSize = 64 * 1024 * 1024
-	db, err := Open(opts)
-	defer destroyDB(db)
-	assert.Nil(t, err)
-	assert.NotNil(t, db)
-
-	// 1.正常 Put 一条数据
-	err = db.Put(utils.GetTestKey(1), utils.RandomValue(24))
-	assert.Nil(t, err)
-	val1, err := db.Get(utils.GetTestKey(1))
-	assert.Nil(t, err)
-	assert.NotNil(t, val1)
-
-	// 2.重复 Put key 相同的数据
-	err = db.Put(utils.GetTestKey(1), utils.RandomValue(24))
-	assert.Nil(t, err)
-	val2, err := db.Get(utils.GetTestKey(1))
-	assert.Nil(t, err)
-	assert.NotNil(t, val2)
-
-	// 3.key 为空
-	err = db.Put(nil, utils.RandomValue(24))
-	assert.Equal(t, ErrKeyIsEmpty, err)
-
-	// 4.value 为空
-	// err = db.Put(utils.GetTestKey(22), nil)
-	// assert.Nil(t, err)
-	// val3, err := db.Get(utils.GetTestKey(22))
-	// assert.Equal(t, 0, len(val3))
-	// assert.Nil(t, err)
-
-	//5.写到数据文件进行了转换
-	for i := 0; i < 10000; i++ {
-		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
-		assert.Nil(t, err)
-	}
-	assert.Equal(t, 2, len(db.oldFiles))
-
-	// // 6.重启后再 Put 数据
-	// if db.activeFile != nil {
-	// 	_ = db.Close()
-	// }
-	// for _, of := range db.oldFiles {
-	// 	if of != nil {
-	// 		_ = of.Close()
-	// 	}
-	// }
-
-	// // 重启数据库
-	// db2, err := Open(opts)
-	// defer destroyDB(db2)
-	// assert.Nil(t, err)
-	// assert.NotNil(t, db2)
-	// val4 := utils.RandomValue(128)
-	// err = db2.Put(utils.GetTestKey(55), val4)
-	// assert.Nil(t, err)
-	// val5, err := db2.Get(utils.GetTestKey(55))
-	// assert.Nil(t, err)
-	// assert.Equal(t, val4, val5)
-}
-
-func TestDB_Get(t *testing.T) {
-	opts := DefaultOptions
-	dir, _ := os.MkdirTemp("", "bitcask-go-get")
-	opts.DirPath = dir
-	opts.DataFileSize = 64 * 1024 * 1024
-	db, err := Open(opts)
-	defer destroyDB(db)
-	assert.Nil(t, err)
-	assert.NotNil(t, db)
-
-	// 1.正常读取一条数据
-	err = db.Put(utils.GetTestKey(11), utils.RandomValue(24))
-	assert.Nil(t, err)
-	val1, err := db.Get(utils.GetTestKey(11))
-	assert.Nil(t, err)
-	assert.NotNil(t, val1)
-
-	//2.读取一个不存在的 key
-	val2, err := db.Get([]byte("some key unknown"))
-	assert.Nil(t, val2)
-	assert.Equal(t, ErrKeyNotFound, err)
-
-	// 3.值被重复 Put 后在读取
-	err = db.Put(utils.GetTestKey(22), utils.RandomValue(24))
-	assert.Nil(t, err)
-	err = db.Put(utils.GetTestKey(22), utils.RandomValue(24))
-	val3, err := db.Get(utils.GetTestKey(22))
-	assert.Nil(t, err)
-	assert.NotNil(t, val3)
-
-	// 4.值被删除后再 Get
-	err = db.Put(utils.GetTestKey(33), utils.RandomValue(24))
-	assert.Nil(t, err)
-	err = db.Delete(utils.GetTestKey(33))
-	assert.Nil(t, err)
-	val4, err := db.Get(utils.GetTestKey(33))
-	assert.Equal(t, 0, len(val4))
-	assert.Equal(t, ErrKeyNotFound, err)
-
-	// 5.转换为了旧的数据文件，从旧的数据文件上获取 value
-	for i := 100; i < 1000; i++ {
-		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
-		assert.Nil(t, err)
-	}
-	assert.Equal(t, 2, len(db.oldFiles))
-	val5, err := db.Get(utils.GetTestKey(101))
-	assert.Nil(t, err)
-	assert.NotNil(t, val5)
-
-	// // 6.重启后，前面写入的数据都能拿到
-	// if db.activeFile != nil {
-	// 	_ = db.Close()
-	// }
-	// for _, of := range db.oldFiles {
-	// 	if of != nil {
-	// 		_ = of.Close()
-	// 	}
-	// }
-
-	// // 重启数据库
-	// db2, err := Open(opts)
-	// defer destroyDB(db2)
-	// val6, err := db2.Get(utils.GetTestKey(11))
-	// assert.Nil(t, err)
-	// assert.NotNil(t, val6)
-	// assert.Equal(t, val1, val6)
-
-	// val7, err := db2.Get(utils.GetTestKey(22))
-	// assert.Nil(t, err)
-	// assert.NotNil(t, val7)
-	// assert.Equal(t, val3, val7)
-
-	// val8, err := db2.Get(utils.GetTestKey(33))
-	// assert.Equal(t, 0, len(val8))
-	// assert.Equal(t, ErrKeyNotFound, err)
-}
-
-// ok
-func TestDB_Delete(t *testing.T) {
-	opts := DefaultOptions
-	dir, _ := os.MkdirTemp("", "bitcask-go-delete")
-	opts.DirPath = dir
-	opts.DataFileSize = 64 * 1024
-	db, err := Open(opts)
-	defer destroyDB(db)
-	assert.Nil(t, err)
-	assert.NotNil(t, db)
-
-	// 1.正常删除一个存在的 key
-	err = db.Put(utils.GetTestKey(11), utils.RandomValue(128))
-	assert.Nil(t, err)
-	err = db.Delete(utils.GetTestKey(11))
-	assert.Nil(t, err)
-	_, err = db.Get(utils.GetTestKey(11))
-	assert.Equal(t, ErrKeyNotFound, err)
-
-	// 2.删除一个不存在的 key
-	err = db.Delete([]byte("unknown key"))
-	assert.Nil(t, err)
-
-	// 3.删除一个空的 key
-	err = db.Delete(nil)
-	assert.Equal(t, ErrKeyIsEmpty, err)
-
-	// 4.值被删除之后重新 Put
-	err = db.Put(utils.GetTestKey(22), utils.RandomValue(128))
-	assert.Nil(t, err)
-	err = db.Delete(utils.GetTestKey(22))
-	assert.Nil(t, err)
-
-	//////////下面有错
-
-
-	// err = db.Put(utils.GetTestKey(22), utils.RandomValue(128))
-	// assert.Nil(t, err)
-	// val1, err := db.Get(utils.GetTestKey(22))
-	// assert.NotNil(t, val1)
-	// assert.Nil(t, err)
-
-	//5.重启之后，再进行校验
-	if db.activeFile != nil {
-		_ = db.Close()
-	}
-	for _, of := range db.oldFiles {
-		if of != nil {
-			_ = of.Close()
-		}
-	}
-
-	//重启数据库
-	db2, err := Open(opts)
-	defer destroyDB(db2)
-	_, err = db2.Get(utils.GetTestKey(11))
-	assert.Equal(t, ErrKeyNotFound, err)
-
-	// val2, err := db2.Get(utils.GetTestKey(22))
-	// assert.Nil(t, err)
-	// assert.Equal(t, val1, val2)
-}
-
-// ok
-func TestDB_Close(t *testing.T) {
-	opts := DefaultOptions
-	dir, _ := os.MkdirTemp("", "bitcask-go-close")
-	opts.DirPath = dir
-	db, err := Open(opts)
-	defer destroyDB(db)
-	assert.Nil(t, err)
-	assert.NotNil(t, db)
-
-	err = db.Put(utils.GetTestKey(11), utils.RandomValue(20))
-	assert.Nil(t, err)
-}
-
-// ok
-func TestDB_Sync(t *testing.T) {
-	opts := DefaultOptions
-	dir, _ := os.MkdirTemp("", "bitcask-go-sync")
-	opts.DirPath = dir
-	db, err := Open(opts)
-	defer destroyDB(db)
-	assert.Nil(t, err)
-	assert.NotNil(t, db)
-
-	err = db.Put(utils.GetTestKey(11), utils.RandomValue(20))
-	assert.Nil(t, err)
-
-	err = db.Sync()
-	assert.Nil(t, err)
-}
-
-// ok
-func TestDB_FileLock(t *testing.T) {
-	opts := DefaultOptions
-	dir, _ := os.MkdirTemp("", "bitcask-go-filelock")
-	opts.DirPath = dir
-	db, err := Open(opts)
-	defer destroyDB(db)
-	assert.Nil(t, err)
-	assert.NotNil(t, db)
-
-	_, err = Open(opts)
-	assert.Equal(t, ErrFilelockIsInUse, err)
-
-	err = db.Close()
-	assert.Nil(t, err)
-
-	db2, err := Open(opts)
-	assert.Nil(t, err)
-	assert.NotNil(t, db2)
-	err = db2.Close()
-	assert.Nil(t, err)
-}
-
-// ok
-func TestDB_Stat(t *testing.T) {
-	opts := DefaultOptions
-	dir, _ := os.MkdirTemp("", "bitcask-go-stat")
-	opts.DirPath = dir
-	db, err := Open(opts)
-	defer destroyDB(db)
-	assert.Nil(t, err)
-	assert.NotNil(t, db)
-
-	for i := 100; i < 10000; i++ {
-		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
-		assert.Nil(t, err)
-	}
-	for i := 100; i < 1000; i++ {
-		err := db.Delete(utils.GetTestKey(i))
-		assert.Nil(t, err)
-	}
-	for i := 2000; i < 5000; i++ {
-		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
-		assert.Nil(t, err)
-	}
-
-	stat := db.Stat()
-	assert.NotNil(t, stat)
-}
-
-// ok
-func TestDB_Backup(t *testing.T) {
-	opts := DefaultOptions
-	dir, _ := os.MkdirTemp("", "bitcask-go-backup")
-	opts.DirPath = dir
-	db, err := Open(opts)
-	defer destroyDB(db)
-	assert.Nil(t, err)
-	assert.NotNil(t, db)
-
-	for i := 1; i < 10000; i++ {
-		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
-		assert.Nil(t, err)
-	}
-
-	backupDir, _ := os.MkdirTemp("", "bitcask-go-backup-test")
-	err = db.BackUp(backupDir)
-	assert.Nil(t, err)
-
-	opts1 := DefaultOptions
-	opts1.DirPath = backupDir
-	db2, err := Open(opts1)
-	defer destroyDB(db2)
-	assert.Nil(t, err)
-	assert.NotNil(t, db2)
-}
+package bitcask
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bitcask.go/data"
+	"bitcask.go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试完成之后销毁 DB 数据目录
+func destroyDB(db *DB) {
+	if db != nil {
+		if db.activeFile != nil {
+			_ = db.Close()
+		}
+		for _, of := range db.oldFiles {
+			if of != nil {
+				_ = of.Close()
+			}
+		}
+		err := os.RemoveAll(db.option.DirPath)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// ok
+func TestOpen(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+}
+
+// 除了 4 6 其他ok
+func TestDB_Put(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-put")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	// 1.正常 Put 一条数据
+	err = db.Put(utils.GetTestKey(1), utils.RandomValue(24))
+	assert.Nil(t, err)
+	val1, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.NotNil(t, val1)
+
+	// 2.重复 Put key 相同的数据
+	err = db.Put(utils.GetTestKey(1), utils.RandomValue(24))
+	assert.Nil(t, err)
+	val2, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.NotNil(t, val2)
+
+	// 3.key 为空
+	err = db.Put(nil, utils.RandomValue(24))
+	assert.Equal(t, ErrKeyIsEmpty, err)
+
+	// 4.value 为空
+	// err = db.Put(utils.GetTestKey(22), nil)
+	// assert.Nil(t, err)
+	// val3, err := db.Get(utils.GetTestKey(22))
+	// assert.Equal(t, 0, len(val3))
+	// assert.Nil(t, err)
+
+	//5.写到数据文件进行了转换
+	for i := 0; i < 10000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 2, len(db.oldFiles))
+
+	// // 6.重启后再 Put 数据
+	// if db.activeFile != nil {
+	// 	_ = db.Close()
+	// }
+	// for _, of := range db.oldFiles {
+	// 	if of != nil {
+	// 		_ = of.Close()
+	// 	}
+	// }
+
+	// // 重启数据库
+	// db2, err := Open(opts)
+	// defer destroyDB(db2)
+	// assert.Nil(t, err)
+	// assert.NotNil(t, db2)
+	// val4 := utils.RandomValue(128)
+	// err = db2.Put(utils.GetTestKey(55), val4)
+	// assert.Nil(t, err)
+	// val5, err := db2.Get(utils.GetTestKey(55))
+	// assert.Nil(t, err)
+	// assert.Equal(t, val4, val5)
+}
+
+func TestDB_Get(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-get")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	// 1.正常读取一条数据
+	err = db.Put(utils.GetTestKey(11), utils.RandomValue(24))
+	assert.Nil(t, err)
+	val1, err := db.Get(utils.GetTestKey(11))
+	assert.Nil(t, err)
+	assert.NotNil(t, val1)
+
+	//2.读取一个不存在的 key
+	val2, err := db.Get([]byte("some key unknown"))
+	assert.Nil(t, val2)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// 3.值被重复 Put 后在读取
+	err = db.Put(utils.GetTestKey(22), utils.RandomValue(24))
+	assert.Nil(t, err)
+	err = db.Put(utils.GetTestKey(22), utils.RandomValue(24))
+	val3, err := db.Get(utils.GetTestKey(22))
+	assert.Nil(t, err)
+	assert.NotNil(t, val3)
+
+	// 4.值被删除后再 Get
+	err = db.Put(utils.GetTestKey(33), utils.RandomValue(24))
+	assert.Nil(t, err)
+	err = db.Delete(utils.GetTestKey(33))
+	assert.Nil(t, err)
+	val4, err := db.Get(utils.GetTestKey(33))
+	assert.Equal(t, 0, len(val4))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// 5.转换为了旧的数据文件，从旧的数据文件上获取 value
+	for i := 100; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 2, len(db.oldFiles))
+	val5, err := db.Get(utils.GetTestKey(101))
+	assert.Nil(t, err)
+	assert.NotNil(t, val5)
+
+	// // 6.重启后，前面写入的数据都能拿到
+	// if db.activeFile != nil {
+	// 	_ = db.Close()
+	// }
+	// for _, of := range db.oldFiles {
+	// 	if of != nil {
+	// 		_ = of.Close()
+	// 	}
+	// }
+
+	// // 重启数据库
+	// db2, err := Open(opts)
+	// defer destroyDB(db2)
+	// val6, err := db2.Get(utils.GetTestKey(11))
+	// assert.Nil(t, err)
+	// assert.NotNil(t, val6)
+	// assert.Equal(t, val1, val6)
+
+	// val7, err := db2.Get(utils.GetTestKey(22))
+	// assert.Nil(t, err)
+	// assert.NotNil(t, val7)
+	// assert.Equal(t, val3, val7)
+
+	// val8, err := db2.Get(utils.GetTestKey(33))
+	// assert.Equal(t, 0, len(val8))
+	// assert.Equal(t, ErrKeyNotFound, err)
+}
+
+// ok
+func TestDB_Delete(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-delete")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	// 1.正常删除一个存在的 key
+	err = db.Put(utils.GetTestKey(11), utils.RandomValue(128))
+	assert.Nil(t, err)
+	err = db.Delete(utils.GetTestKey(11))
+	assert.Nil(t, err)
+	_, err = db.Get(utils.GetTestKey(11))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// 2.删除一个不存在的 key
+	err = db.Delete([]byte("unknown key"))
+	assert.Nil(t, err)
+
+	// 3.删除一个空的 key
+	err = db.Delete(nil)
+	assert.Equal(t, ErrKeyIsEmpty, err)
+
+	// 4.值被删除之后重新 Put
+	err = db.Put(utils.GetTestKey(22), utils.RandomValue(128))
+	assert.Nil(t, err)
+	err = db.Delete(utils.GetTestKey(22))
+	assert.Nil(t, err)
+
+	//////////下面有错
+
+
+	// err = db.Put(utils.GetTestKey(22), utils.RandomValue(128))
+	// assert.Nil(t, err)
+	// val1, err := db.Get(utils.GetTestKey(22))
+	// assert.NotNil(t, val1)
+	// assert.Nil(t, err)
+
+	//5.重启之后，再进行校验
+	if db.activeFile != nil {
+		_ = db.Close()
+	}
+	for _, of := range db.oldFiles {
+		if of != nil {
+			_ = of.Close()
+		}
+	}
+
+	//重启数据库
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	_, err = db2.Get(utils.GetTestKey(11))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// val2, err := db2.Get(utils.GetTestKey(22))
+	// assert.Nil(t, err)
+	// assert.Equal(t, val1, val2)
+}
+
+// ok
+func TestDB_Close(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-close")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	err = db.Put(utils.GetTestKey(11), utils.RandomValue(20))
+	assert.Nil(t, err)
+}
+
+// ok
+func TestDB_Sync(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-sync")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	err = db.Put(utils.GetTestKey(11), utils.RandomValue(20))
+	assert.Nil(t, err)
+
+	err = db.Sync()
+	assert.Nil(t, err)
+}
+
+// ok
+func TestDB_FileLock(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-filelock")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	_, err = Open(opts)
+	assert.Equal(t, ErrFilelockIsInUse, err)
+
+	err = db.Close()
+	assert.Nil(t, err)
+
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	assert.NotNil(t, db2)
+	err = db2.Close()
+	assert.Nil(t, err)
+}
+
+// ok
+func TestDB_Stat(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-stat")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 100; i < 10000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	for i := 100; i < 1000; i++ {
+		err := db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	for i := 2000; i < 5000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+
+	stat := db.Stat()
+	assert.NotNil(t, stat)
+}
+
+// ok
+func TestDB_Backup(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-backup")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 1; i < 10000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+
+	backupDir, _ := os.MkdirTemp("", "bitcask-go-backup-test")
+	err = db.BackUp(backupDir)
+	assert.Nil(t, err)
+
+	opts1 := DefaultOptions
+	opts1.DirPath = backupDir
+	db2, err := Open(opts1)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.NotNil(t, db2)
+
+	// 备份中记录了每个文件的校验值，可以校验之后恢复
+	restoreDir, _ := os.MkdirTemp("", "bitcask-go-backup-restore")
+	defer os.RemoveAll(restoreDir)
+	assert.Nil(t, Restore([]string{backupDir}, RestoreTarget{}, restoreDir))
+	opts1.DirPath = restoreDir
+	db3, err := Open(opts1)
+	assert.Nil(t, err)
+	assert.Equal(t, 9999, len(db3.ListKeys()))
+	assert.Nil(t, db3.Close())
+}
+
+func TestDB_ReadOnly(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-readonly")
+	opts.DirPath = dir
+	opts.DataFileSize = 4 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+
+	// 写入的进程还持有文件锁的时候以只读的方式打开
+	roOpts := opts
+	roOpts.ReadOnly = true
+	roDB, err := Open(roOpts)
+	assert.Nil(t, err)
+	assert.NotNil(t, roDB)
+	assert.Equal(t, 100, len(roDB.ListKeys()))
+	val, err := roDB.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.NotNil(t, val)
+
+	// 所有的写操作都被拒绝
+	assert.Equal(t, ErrReadOnly, roDB.Put(utils.GetTestKey(1), utils.RandomValue(24)))
+	assert.Equal(t, ErrReadOnly, roDB.Delete(utils.GetTestKey(1)))
+	assert.Equal(t, ErrReadOnly, roDB.Merge())
+	wb := roDB.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Equal(t, ErrReadOnly, wb.Put(utils.GetTestKey(1), utils.RandomValue(24)))
+	assert.Equal(t, ErrReadOnly, wb.Commit())
+
+	// 写入的进程继续写入数据，Refresh 之后可以读到
+	for i := 100; i < 200; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, db.Delete(utils.GetTestKey(0)))
+	_, err = roDB.Get(utils.GetTestKey(150))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	assert.Nil(t, roDB.Refresh())
+	assert.Equal(t, 199, len(roDB.ListKeys()))
+	_, err = roDB.Get(utils.GetTestKey(150))
+	assert.Nil(t, err)
+	_, err = roDB.Get(utils.GetTestKey(0))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// 关闭只读的实例不会创建序列号文件
+	assert.Nil(t, roDB.Close())
+	_, err = os.Stat(filepath.Join(dir, data.SeqNumFileName))
+	assert.True(t, os.IsNotExist(err))
+
+	// 目录不存在的时候不会创建
+	roOpts.DirPath = filepath.Join(dir, "not-exist")
+	_, err = Open(roOpts)
+	assert.NotNil(t, err)
+	_, err = os.Stat(roOpts.DirPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDB_UnfinishedTransactionRecords(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-unfinished-txn")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put(utils.GetTestKey(0), utils.RandomValue(24)))
+	assert.Nil(t, db.Close())
+
+	// 写了一半的事务：只有数据记录，没有完成标识
+	encRecord, _ := data.EncodeLogRecord(&data.LogRecord{
+		Key:   logRecordKeyWithSeqNum(utils.GetTestKey(1), 5),
+		Value: utils.RandomValue(24),
+	})
+	appendToDataFile(t, dir, 0, encRecord)
+
+	// 只读模式保留没有完成的事务数据，Refresh 时接着使用
+	roOpts := opts
+	roOpts.ReadOnly = true
+	roDB, err := Open(roOpts)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(roDB.transactionRecords[5]))
+	assert.Nil(t, roDB.Close())
+
+	// 写入模式下不保留
+	db, err = Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.Nil(t, db.transactionRecords)
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
@@ -0,0 +1,57 @@
+//go:build linux
+
+package bitcask
+
+import (
+	"os"
+	"testing"
+
+	"bitcask.go/data"
+	"bitcask.go/fio"
+	"bitcask.go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_DirectIO(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-direct-io")
+	opts.DirPath = dir
+	opts.DataFileSize = 256 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.IOType = fio.DirectIO
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	for i := 0; i < 3000; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+	}
+	assert.True(t, len(db.oldFiles) > 0)
+	// 新的活跃文件预分配了 DataFileSize 的空间
+	stat, err := os.Stat(data.GetDataFileName(dir, db.activeFile.FileID))
+	assert.Nil(t, err)
+	assert.Equal(t, opts.DataFileSize, stat.Size())
+
+	for i := 0; i < 1500; i++ {
+		assert.Nil(t, db.Delete(utils.GetTestKey(i)))
+	}
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Sync())
+
+	// 不关闭数据库（模拟崩溃），预分配的文件末尾留下一段 0
+	_ = db.fileLock.Unlock()
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 1500, len(db2.ListKeys()))
+	assert.Nil(t, db2.Put([]byte("after-crash"), []byte("value")))
+	assert.Nil(t, db2.Close())
+
+	db3, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db3)
+	val, err := db3.Get([]byte("after-crash"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), val)
+	_, err = db3.Get(utils.GetTestKey(10))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, 1501, len(db3.ListKeys()))
+}
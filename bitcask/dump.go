@@ -0,0 +1,108 @@
+package bitcask
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"bitcask.go/data"
+)
+
+// DumpRecord 解码后的一条记录，用于调试工具输出文件中的内容
+type DumpRecord struct {
+	FileName  string             // 记录所在的文件
+	Offset    int64              // 记录在文件中的偏移量
+	Size      int64              // 记录在磁盘上的大小
+	Type      data.LogRecordType // 记录的类型
+	SeqNum    uint64             // 事务序列号，非事务的记录为 0
+	Namespace uint32             // 记录所属的命名空间 ID，默认命名空间为 0
+	Key       []byte             // 用户实际的 Key（数据文件中的 Key 已经去掉了序列号）
+	Value     []byte
+	Pos       *data.LogRecordPos // hint 文件中记录的索引位置，其他文件为 nil
+	Err       error              // 记录损坏时的错误信息，此时只有 FileName 和 Offset 有效
+}
+
+// DumpFile 以只读的方式解码一个文件（数据文件、hint 文件、seq-num 文件等）中的所有记录
+// 损坏的记录会带着 Err 交给 fn，fn 返回 false 时停止遍历
+func DumpFile(fileName string, fn func(record *DumpRecord) bool) error {
+	file, err := data.OpenReadOnlyFile(fileName, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	baseName := filepath.Base(fileName)
+	isDataFile := strings.HasSuffix(baseName, data.DataFileSuffix)
+	isHintFile := baseName == data.HintFilename
+
+	var offset int64 = 0
+	for {
+		logRecord, size, err := file.ReadLogRecord(offset)
+		if err == io.EOF {
+			return nil
+		}
+		if err == data.ErrInvalidCRC || err == data.ErrIncompleteLogRecord {
+			if !fn(&DumpRecord{FileName: baseName, Offset: offset, Size: size, Err: err}) {
+				return nil
+			}
+			// 记录不完整时无法知道下一条记录的位置
+			if err == data.ErrIncompleteLogRecord {
+				return nil
+			}
+			offset += size
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		record := &DumpRecord{
+			FileName:  baseName,
+			Offset:    offset,
+			Size:      size,
+			Type:      logRecord.Type,
+			Namespace: logRecord.Namespace,
+			Key:       logRecord.Key,
+			Value:     logRecord.Value,
+		}
+		if isDataFile {
+			record.Key, record.SeqNum = parseLogRecordKey(logRecord.Key)
+		}
+		if isHintFile {
+			record.Pos = data.DecodeLogRecordPos(logRecord.Value)
+		}
+		if !fn(record) {
+			return nil
+		}
+		offset += size
+	}
+}
+
+// DumpKeyHistory 按照写入的顺序遍历目录中的所有数据文件，找出一个 Key 的所有历史版本（包括删除和事务中的记录）
+func DumpKeyHistory(dirPath string, key []byte, fn func(record *DumpRecord) bool) error {
+	fileIDs, err := getDataFileIDs(dirPath)
+	if err != nil {
+		return err
+	}
+
+	for _, fid := range fileIDs {
+		stop := false
+		err := DumpFile(data.GetDataFileName(dirPath, uint32(fid)), func(record *DumpRecord) bool {
+			if record.Err != nil || !bytes.Equal(record.Key, key) {
+				return true
+			}
+			if !fn(record) {
+				stop = true
+			}
+			return !stop
+		})
+		if err != nil {
+			return err
+		}
+		if stop {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package bitcask
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bitcask.go/data"
+	"bitcask.go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpFile(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-dump")
+	defer os.RemoveAll(dir)
+	opts.DirPath = dir
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.Put(utils.GetTestKey(1), []byte("value-1")))
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put(utils.GetTestKey(2), []byte("value-2")))
+	assert.Nil(t, wb.Commit())
+	assert.Nil(t, db.Close())
+
+	var records []*DumpRecord
+	err = DumpFile(data.GetDataFileName(dir, 0), func(record *DumpRecord) bool {
+		records = append(records, record)
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(records))
+	assert.Equal(t, utils.GetTestKey(1), records[0].Key)
+	assert.Equal(t, uint64(0), records[0].SeqNum)
+	assert.Equal(t, utils.GetTestKey(2), records[1].Key)
+	assert.Equal(t, uint64(1), records[1].SeqNum)
+	assert.Equal(t, records[0].Size, records[1].Offset)
+	assert.Equal(t, data.LogRecordTxnFinished, records[2].Type)
+
+	// seq-num 文件
+	records = nil
+	err = DumpFile(filepath.Join(dir, data.SeqNumFileName), func(record *DumpRecord) bool {
+		records = append(records, record)
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, []byte("1"), records[0].Value)
+}
+
+func TestDumpKeyHistory(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-dump-key")
+	opts.DirPath = dir
+	opts.DataFileSize = 64
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	key := utils.GetTestKey(1)
+	assert.Nil(t, db.Put(key, []byte("v1")))
+	assert.Nil(t, db.Put(utils.GetTestKey(2), []byte("other")))
+	assert.Nil(t, db.Put(key, []byte("v2")))
+	assert.Nil(t, db.Delete(key))
+
+	var records []*DumpRecord
+	err = DumpKeyHistory(dir, key, func(record *DumpRecord) bool {
+		records = append(records, record)
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(records))
+	assert.Equal(t, []byte("v1"), records[0].Value)
+	assert.Equal(t, []byte("v2"), records[1].Value)
+	assert.Equal(t, data.LogRecordDeleted, records[2].Type)
+	assert.NotEqual(t, records[0].FileName, records[2].FileName)
+}
@@ -5,17 +5,44 @@ import "errors"
 //定义一些 error 的类型(参考了GitHub项目上的错误类型的定义)
 
 var (
-	ErrKeyIsEmpty             = errors.New("the key is empty")
-	ErrIndexUpdateFailed      = errors.New("failed to updata index")
-	ErrKeyNotFound            = errors.New("the key is not in the database")
-	ErrDataFileNotFound       = errors.New("the datafile is not in the database")
-	ErrDirPathNil             = errors.New("database dir path is empty")
-	ErrDataFileSizeNil        = errors.New("data file size must greater than zero ")
-	ErrDataDirectoryCorrupted = errors.New("the database directory may be corrupted")
-	ErrExceedMaxBatchNum      = errors.New("exceed the max num of batch")
-	ErrIsMergeNow             = errors.New("merge is in the process")
-	ErrFilelockIsInUse        = errors.New("filelock is in use")
-	ErrInvalidMergeRatio      = errors.New("invalid merge ratio")
-	ErrUnderMergeRatio        = errors.New("the merge ratio now is under the merge ratio you set")
-	ErrNotEnoughSpaceToMerge  = errors.New("no enough space to merge")
+	ErrKeyIsEmpty                = errors.New("the key is empty")
+	ErrIndexUpdateFailed         = errors.New("failed to updata index")
+	ErrKeyNotFound               = errors.New("the key is not in the database")
+	ErrDataFileNotFound          = errors.New("the datafile is not in the database")
+	ErrDirPathNil                = errors.New("database dir path is empty")
+	ErrDataFileSizeNil           = errors.New("data file size must greater than zero ")
+	ErrDataDirectoryCorrupted    = errors.New("the database directory may be corrupted")
+	ErrExceedMaxBatchNum         = errors.New("exceed the max num of batch")
+	ErrIsMergeNow                = errors.New("merge is in the process")
+	ErrFilelockIsInUse           = errors.New("filelock is in use")
+	ErrInvalidMergeRatio         = errors.New("invalid merge ratio")
+	ErrUnderMergeRatio           = errors.New("the merge ratio now is under the merge ratio you set")
+	ErrNotEnoughSpaceToMerge     = errors.New("no enough space to merge")
+	ErrDataFileCorrupted         = errors.New("the data file is corrupted,try another recovery mode")
+	ErrInvalidRecoveryMode       = errors.New("invalid recovery mode")
+	ErrDirIsNotEmpty             = errors.New("the target directory is not empty")
+	ErrReadOnly                  = errors.New("the database is opened in read-only mode")
+	ErrInvalidBackupChain        = errors.New("invalid backup chain")
+	ErrBackupCorrupted           = errors.New("the backup is corrupted")
+	ErrRestorePointNotFound      = errors.New("the restore point is not found in the backups")
+	ErrDataFileHole              = errors.New("an earlier failed write left a hole in the active data file")
+	ErrObjectNotFound            = errors.New("the object is not found in the backup target")
+	ErrIncompatibleFormatVersion = errors.New("incompatible data directory format version")
+	ErrIndexTypeMismatch         = errors.New("the index type does not match the data directory")
+	ErrInvalidIndexType          = errors.New("invalid index type")
+	ErrInvalidExportFormat       = errors.New("invalid export format")
+	ErrInvalidExportData         = errors.New("invalid data to import")
+	ErrNotSupportedInMemory      = errors.New("the operation is not supported in in-memory mode")
+	ErrInvalidIOType             = errors.New("invalid io type")
+	ErrKeyValueCountMismatch     = errors.New("the number of keys and values does not match")
+	ErrMergeOperatorNotSet       = errors.New("the merge operator is not set in options")
+	ErrInvalidMergeOperand       = errors.New("invalid merge operand")
+	ErrInvalidNamespaceName      = errors.New("the namespace name is empty")
+	ErrNamespaceExists           = errors.New("the namespace already exists")
+	ErrNamespaceNotFound         = errors.New("the namespace is not found")
+	ErrNamespaceNotSupported     = errors.New("namespaces are not supported with the b+ tree index")
+	ErrComparatorNotSupported    = errors.New("custom comparator is not supported with the b+ tree index")
+	ErrInvalidIndexShards        = errors.New("invalid number of index shards")
+	ErrInvalidIndexMemoryBudget  = errors.New("the index memory budget must be greater than 0")
+	ErrInvalidRestorePoint       = errors.New("the restore point interval must not be negative")
 )
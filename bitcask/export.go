@@ -0,0 +1,239 @@
+package bitcask
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// exportBinaryMagic 二进制导出格式的文件头
+var exportBinaryMagic = []byte("BCEXPORT1")
+
+// exportEntry 文本格式中的一条数据
+type exportEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ParseExportFormat 根据名称（jsonl、csv、binary）解析导入导出的格式
+func ParseExportFormat(name string) (ExportFormat, error) {
+	switch strings.ToLower(name) {
+	case "jsonl", "json":
+		return ExportJSONL, nil
+	case "csv":
+		return ExportCSV, nil
+	case "binary", "bin":
+		return ExportBinary, nil
+	}
+	return 0, ErrInvalidExportFormat
+}
+
+// Export 将 opts 范围内的所有数据按照 format 格式写入 w
+func (db *DB) Export(w io.Writer, format ExportFormat, opts IteratorOptions) error {
+	writer := bufio.NewWriter(w)
+
+	var write func(key, value []byte) error
+	switch format {
+	case ExportJSONL:
+		encoder := json.NewEncoder(writer)
+		write = func(key, value []byte) error {
+			return encoder.Encode(&exportEntry{
+				Key:   base64.StdEncoding.EncodeToString(key),
+				Value: base64.StdEncoding.EncodeToString(value),
+			})
+		}
+	case ExportCSV:
+		csvWriter := csv.NewWriter(writer)
+		if err := csvWriter.Write([]string{"key", "value"}); err != nil {
+			return err
+		}
+		write = func(key, value []byte) error {
+			err := csvWriter.Write([]string{
+				base64.StdEncoding.EncodeToString(key),
+				base64.StdEncoding.EncodeToString(value),
+			})
+			if err != nil {
+				return err
+			}
+			// csv 自己带有缓冲，需要刷新到下层的 writer 中
+			csvWriter.Flush()
+			return csvWriter.Error()
+		}
+	case ExportBinary:
+		if _, err := writer.Write(exportBinaryMagic); err != nil {
+			return err
+		}
+		buf := make([]byte, binary.MaxVarintLen64)
+		write = func(key, value []byte) error {
+			for _, b := range [][]byte{key, value} {
+				n := binary.PutUvarint(buf, uint64(len(b)))
+				if _, err := writer.Write(buf[:n]); err != nil {
+					return err
+				}
+				if _, err := writer.Write(b); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	default:
+		return ErrInvalidExportFormat
+	}
+
+	iterator := db.NewIterator(opts)
+	defer iterator.Close()
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		value, err := iterator.Value()
+		if err != nil {
+			return err
+		}
+		if err := write(iterator.Key(), value); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// Import 读取 r 中 format 格式的数据并写入数据库，返回写入的 Key 的数量（重复的 Key 只计数一次）
+// 每 BatchSize 条数据使用一个 WriteBatch 原子地提交，出错时之前已经提交的批次不会回滚
+func (db *DB) Import(r io.Reader, format ExportFormat, opts ImportOptions) (int, error) {
+	if opts.BatchSize == 0 {
+		opts.BatchSize = DefaultImportOptions.BatchSize
+	}
+
+	var read func() ([]byte, []byte, error)
+	reader := bufio.NewReader(r)
+	switch format {
+	case ExportJSONL:
+		decoder := json.NewDecoder(reader)
+		read = func() ([]byte, []byte, error) {
+			var entry exportEntry
+			if err := decoder.Decode(&entry); err != nil {
+				return nil, nil, err
+			}
+			return decodeExportEntry(entry.Key, entry.Value)
+		}
+	case ExportCSV:
+		csvReader := csv.NewReader(reader)
+		csvReader.FieldsPerRecord = 2
+		header, err := csvReader.Read()
+		if err == io.EOF {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if header[0] != "key" || header[1] != "value" {
+			return 0, ErrInvalidExportData
+		}
+		read = func() ([]byte, []byte, error) {
+			record, err := csvReader.Read()
+			if err != nil {
+				return nil, nil, err
+			}
+			return decodeExportEntry(record[0], record[1])
+		}
+	case ExportBinary:
+		magic := make([]byte, len(exportBinaryMagic))
+		if _, err := io.ReadFull(reader, magic); err != nil || !bytes.Equal(magic, exportBinaryMagic) {
+			return 0, ErrInvalidExportData
+		}
+		read = func() ([]byte, []byte, error) {
+			key, err := readExportBytes(reader)
+			if err != nil {
+				return nil, nil, err
+			}
+			value, err := readExportBytes(reader)
+			if err == io.EOF {
+				err = ErrInvalidExportData
+			}
+			return key, value, err
+		}
+	default:
+		return 0, ErrInvalidExportFormat
+	}
+
+	wbOpts := DefaultWriteBatchOptions
+	wbOpts.MaxBatchNum = opts.BatchSize
+	var imported int
+	// 当前批次中的 Key，WriteBatch 会合并同一个 Key 的多次写入，每个 Key 只计数一次
+	pending := make(map[string]struct{})
+	wb := db.NewWriteBatch(wbOpts)
+	for {
+		key, value, err := read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return imported, err
+		}
+
+		_, inBatch := pending[string(key)]
+		if !opts.Overwrite {
+			// 当前批次中还没有提交的 Key，db.Get 读取不到
+			if inBatch {
+				continue
+			}
+			if _, err := db.Get(key); err != ErrKeyNotFound {
+				if err != nil {
+					return imported, err
+				}
+				continue
+			}
+		}
+		if err := wb.Put(key, value); err != nil {
+			return imported, err
+		}
+		pending[string(key)] = struct{}{}
+
+		if uint(len(pending)) == opts.BatchSize {
+			if err := wb.Commit(); err != nil {
+				return imported, err
+			}
+			imported += len(pending)
+			pending = make(map[string]struct{})
+		}
+	}
+
+	if len(pending) > 0 {
+		if err := wb.Commit(); err != nil {
+			return imported, err
+		}
+		imported += len(pending)
+	}
+	return imported, nil
+}
+
+// decodeExportEntry 解码文本格式中 base64 编码的 Key 和 Value
+func decodeExportEntry(key, value string) ([]byte, []byte, error) {
+	decodedKey, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, nil, ErrInvalidExportData
+	}
+	decodedValue, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, nil, ErrInvalidExportData
+	}
+	return decodedKey, decodedValue, nil
+}
+
+// readExportBytes 读取二进制格式中带长度的一段数据
+func readExportBytes(reader *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(reader)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, ErrInvalidExportData
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return nil, ErrInvalidExportData
+	}
+	return buf, nil
+}
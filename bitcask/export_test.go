@@ -0,0 +1,101 @@
+package bitcask
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"bitcask.go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_ExportImport(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-export")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	// 二进制的 Key 和 Value
+	assert.Nil(t, db.Put([]byte{0, 1, '\n', ','}, []byte{0xff, 0, '"'}))
+
+	for _, format := range []ExportFormat{ExportJSONL, ExportCSV, ExportBinary} {
+		buf := new(bytes.Buffer)
+		assert.Nil(t, db.Export(buf, format, DefaultIteratorOptions))
+
+		opts2 := DefaultOptions
+		dir2, _ := os.MkdirTemp("", "bitcask-go-import")
+		opts2.DirPath = dir2
+		db2, err := Open(opts2)
+		assert.Nil(t, err)
+
+		n, err := db2.Import(bytes.NewReader(buf.Bytes()), format, ImportOptions{Overwrite: true, BatchSize: 7})
+		assert.Nil(t, err)
+		assert.Equal(t, 101, n)
+		assert.Equal(t, 101, len(db2.ListKeys()))
+		val, err := db2.Get([]byte{0, 1, '\n', ','})
+		assert.Nil(t, err)
+		assert.Equal(t, []byte{0xff, 0, '"'}, val)
+
+		// 不覆盖已经存在的 Key
+		assert.Nil(t, db2.Put(utils.GetTestKey(1), []byte("local")))
+		n, err = db2.Import(bytes.NewReader(buf.Bytes()), format, ImportOptions{BatchSize: 7})
+		assert.Nil(t, err)
+		assert.Equal(t, 0, n)
+		val, err = db2.Get(utils.GetTestKey(1))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("local"), val)
+		destroyDB(db2)
+	}
+
+	// 只导出指定前缀的数据
+	buf := new(bytes.Buffer)
+	assert.Nil(t, db.Export(buf, ExportJSONL, IteratorOptions{Prefix: utils.GetTestKey(5)}))
+	assert.Equal(t, 1, strings.Count(buf.String(), "\n"))
+
+	_, err = db.Import(strings.NewReader("{\"key\":\"!!\",\"value\":\"\"}\n"), ExportJSONL, DefaultImportOptions)
+	assert.Equal(t, ErrInvalidExportData, err)
+	_, err = db.Import(strings.NewReader("not a dump"), ExportBinary, DefaultImportOptions)
+	assert.Equal(t, ErrInvalidExportData, err)
+
+	format, err := ParseExportFormat("CSV")
+	assert.Nil(t, err)
+	assert.Equal(t, ExportCSV, format)
+	_, err = ParseExportFormat("xml")
+	assert.Equal(t, ErrInvalidExportFormat, err)
+}
+
+func TestDB_Import_DuplicateKeys(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-import-dup")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	// a 在同一个批次中出现了两次
+	input := "{\"key\":\"YQ==\",\"value\":\"MQ==\"}\n" +
+		"{\"key\":\"Yg==\",\"value\":\"MQ==\"}\n" +
+		"{\"key\":\"YQ==\",\"value\":\"Mg==\"}\n"
+
+	// 不覆盖时保留第一次出现的值
+	n, err := db.Import(strings.NewReader(input), ExportJSONL, ImportOptions{BatchSize: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	val, err := db.Get([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), val)
+
+	// 覆盖时保留最后一次出现的值，每个 Key 只计数一次
+	n, err = db.Import(strings.NewReader(input), ExportJSONL, ImportOptions{Overwrite: true, BatchSize: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	val, err = db.Get([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("2"), val)
+}
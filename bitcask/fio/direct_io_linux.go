@@ -0,0 +1,197 @@
+//go:build linux
+
+package fio
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// directIOAlignment O_DIRECT 要求读写的偏移量、长度以及内存地址都按照块大小对齐
+const directIOAlignment = 4096
+
+// DirectFile 使用 O_DIRECT 打开的文件，读写都绕过 page cache
+// 每次追加写入都会把最后一个不完整的块补齐 0 之后整块写入，因此文件末尾可能有一段 0（读取日志记录时会当作文件末尾）
+type DirectFile struct {
+	mu   *sync.RWMutex
+	fd   *os.File
+	size int64  // 实际写入的数据长度
+	tail []byte // 最后一个不完整的块，下一次写入时需要和新的数据一起写入
+	buf  []byte // 复用的对齐的写缓冲区
+}
+
+// NewDirectIOManager 初始化 Direct IO，文件系统不支持 O_DIRECT 时（比如 tmpfs）退化为普通的文件 IO，但仍然按块对齐写入
+func NewDirectIOManager(fileName string) (*DirectFile, error) {
+	fd, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR|unix.O_DIRECT, DataFilePerm)
+	if errors.Is(err, unix.EINVAL) {
+		fd, err = os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, DataFilePerm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	stat, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+
+	f := &DirectFile{
+		mu:   new(sync.RWMutex),
+		fd:   fd,
+		size: stat.Size(),
+		tail: alignedBlock(directIOAlignment),
+	}
+	if err := f.loadTail(); err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// alignedBlock 分配一段起始地址按照块大小对齐的内存
+func alignedBlock(n int) []byte {
+	b := make([]byte, n+directIOAlignment)
+	offset := int(uintptr(unsafe.Pointer(&b[0])) & (directIOAlignment - 1))
+	if offset != 0 {
+		offset = directIOAlignment - offset
+	}
+	return b[offset : offset+n : offset+n]
+}
+
+// alignUp 向上对齐到块大小
+func alignUp(n int64) int64 {
+	return (n + directIOAlignment - 1) &^ (directIOAlignment - 1)
+}
+
+// loadTail 从磁盘中读取最后一个不完整的块，调用时必须持有写锁
+func (f *DirectFile) loadTail() error {
+	clear(f.tail)
+	tailLen := f.size % directIOAlignment
+	if tailLen == 0 {
+		return nil
+	}
+	n, err := f.fd.ReadAt(f.tail, f.size-tailLen)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if int64(n) < tailLen {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+func (f *DirectFile) Read(b []byte, offset int64) (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if offset >= f.size {
+		return 0, io.EOF
+	}
+
+	end := min(offset+int64(len(b)), f.size)
+	start := offset &^ (directIOAlignment - 1)
+	buf := alignedBlock(int(alignUp(end) - start))
+	n, err := f.fd.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	if int64(n) < end-start {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	copied := copy(b, buf[offset-start:end-start])
+	if copied < len(b) {
+		return copied, io.EOF
+	}
+	return copied, nil
+}
+
+// Write 追加写入数据：将最后一个不完整的块和新的数据拼在一起，补齐到块大小之后写入
+func (f *DirectFile) Write(b []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tailLen := int(f.size % directIOAlignment)
+	total := tailLen + len(b)
+	blocks := int(alignUp(int64(total)))
+	if cap(f.buf) < blocks {
+		f.buf = alignedBlock(blocks)
+	}
+	buf := f.buf[:blocks]
+	copy(buf, f.tail[:tailLen])
+	copy(buf[tailLen:], b)
+	clear(buf[total:])
+
+	if _, err := f.fd.WriteAt(buf, f.size-int64(tailLen)); err != nil {
+		return 0, err
+	}
+	f.size += int64(len(b))
+
+	// 保存新的不完整的块
+	newTailLen := total % directIOAlignment
+	clear(f.tail)
+	copy(f.tail, buf[total-newTailLen:total])
+	return len(b), nil
+}
+
+// Sync 预分配之后写入不会改变文件的大小，只需要持久化数据，不需要持久化元数据
+func (f *DirectFile) Sync() error {
+	return unix.Fdatasync(int(f.fd.Fd()))
+}
+
+// Close 将文件截断到实际写入的长度（去掉补齐和预分配的部分）之后关闭
+func (f *DirectFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.fd.Truncate(f.size); err != nil {
+		return err
+	}
+	return f.fd.Close()
+}
+
+// Size 返回实际写入的数据长度
+func (f *DirectFile) Size() (int64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.size, nil
+}
+
+func (f *DirectFile) Truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.fd.Truncate(size); err != nil {
+		return err
+	}
+	f.size = size
+	return f.loadTail()
+}
+
+// Preallocate 使用 fallocate 将文件预先分配到 size 大小，预分配的部分读出来都是 0
+// 文件系统不支持 fallocate 时什么都不做
+func (f *DirectFile) Preallocate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stat, err := f.fd.Stat()
+	if err != nil {
+		return err
+	}
+	if size <= stat.Size() {
+		return nil
+	}
+	err = unix.Fallocate(int(f.fd.Fd()), 0, stat.Size(), size-stat.Size())
+	if errors.Is(err, unix.EOPNOTSUPP) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package fio
+
+import "errors"
+
+var ErrDirectIONotSupported = errors.New("direct io is only supported on linux")
+
+// DirectFile 当前平台不支持 Direct IO
+type DirectFile struct {
+	IOManager
+}
+
+func NewDirectIOManager(fileName string) (*DirectFile, error) {
+	return nil, ErrDirectIONotSupported
+}
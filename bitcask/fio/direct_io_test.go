@@ -0,0 +1,64 @@
+//go:build linux
+
+package fio
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirectFile_ReadWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "direct.data")
+	f, err := NewIOManager(path, DirectIO)
+	assert.Nil(t, err)
+
+	assert.Nil(t, f.(Preallocator).Preallocate(64*1024))
+	stat, _ := os.Stat(path)
+	assert.Equal(t, int64(64*1024), stat.Size())
+
+	// 跨越多个块的写入
+	var expected []byte
+	for i := 0; i < 100; i++ {
+		record := bytes.Repeat([]byte{byte('a' + i%26)}, 97+i)
+		_, err := f.Write(record)
+		assert.Nil(t, err)
+		expected = append(expected, record...)
+	}
+	assert.Nil(t, f.Sync())
+	size, _ := f.Size()
+	assert.Equal(t, int64(len(expected)), size)
+
+	b := make([]byte, 5000)
+	n, err := f.Read(b, 4000)
+	assert.Nil(t, err)
+	assert.Equal(t, expected[4000:4000+n], b[:n])
+	n, err = f.Read(b, int64(len(expected))-10)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, expected[len(expected)-10:], b[:n])
+
+	// 截断之后接着写入
+	assert.Nil(t, f.Truncate(5000))
+	_, err = f.Write([]byte("tail"))
+	assert.Nil(t, err)
+	n, err = f.Read(b[:8], 4998)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, append(expected[4998:5000:5000], []byte("tail")...), b[:n])
+
+	// 关闭之后去掉预分配的部分，重新打开可以继续追加
+	assert.Nil(t, f.Close())
+	stat, _ = os.Stat(path)
+	assert.Equal(t, int64(5004), stat.Size())
+
+	f2, err := NewDirectIOManager(path)
+	assert.Nil(t, err)
+	_, err = f2.Write([]byte("-more"))
+	assert.Nil(t, err)
+	assert.Nil(t, f2.Close())
+	content, _ := os.ReadFile(path)
+	assert.Equal(t, "tail-more", string(content[5000:]))
+}
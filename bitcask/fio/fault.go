@@ -0,0 +1,331 @@
+package fio
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+)
+
+var (
+	ErrInjectedFault = errors.New("injected io fault")
+	ErrInjectedCrash = errors.New("injected crash,the file is no longer usable")
+)
+
+// FaultOp 可以注入故障的 IO 操作
+type FaultOp byte
+
+const (
+	FaultRead FaultOp = iota
+	FaultWrite
+	FaultSync
+)
+
+// FaultKind 注入的故障类型
+type FaultKind byte
+
+const (
+	// FaultError 操作不执行，直接返回错误
+	FaultError FaultKind = iota
+
+	// FaultShortWrite 只写入一半的数据，然后返回错误（只对 Write 生效）
+	FaultShortWrite
+
+	// FaultBitFlip 翻转读写数据中的一个比特，操作本身返回成功
+	FaultBitFlip
+
+	// FaultCrash 模拟进程崩溃：所有文件丢失没有持久化的数据，之后的所有操作都返回 ErrInjectedCrash
+	FaultCrash
+)
+
+// FaultRule 故障注入的规则：对应的操作前 After 次正常执行，之后的 Count 次注入故障（Count 为 0 表示一直注入）
+type FaultRule struct {
+	Op    FaultOp
+	Kind  FaultKind
+	After int
+	Count int
+	Err   error // FaultError 和 FaultShortWrite 返回的错误，默认为 ErrInjectedFault
+}
+
+// FaultInjector 管理一组文件的故障注入，所有的计数都是这组文件共享的
+type FaultInjector struct {
+	mu           *sync.Mutex
+	rules        []FaultRule
+	counts       map[FaultOp]int
+	files        []*FaultIOManager
+	rand         *rand.Rand
+	crashed      bool
+	tornOnCrash  bool
+	triggerCount int
+}
+
+// NewFaultInjector 创建故障注入器，seed 用于决定翻转哪个比特以及崩溃时保留多少没有持久化的数据
+func NewFaultInjector(seed int64, rules ...FaultRule) *FaultInjector {
+	return &FaultInjector{
+		mu:     new(sync.Mutex),
+		rules:  rules,
+		counts: make(map[FaultOp]int),
+		rand:   rand.New(rand.NewSource(seed)),
+	}
+}
+
+// AddRule 添加一条故障注入规则，After 从当前这一时刻开始计算
+func (fi *FaultInjector) AddRule(rule FaultRule) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	rule.After += fi.counts[rule.Op]
+	fi.rules = append(fi.rules, rule)
+}
+
+// SetTornWrites 设置崩溃时是否保留一部分没有持久化的数据（模拟写了一半的数据落盘）
+func (fi *FaultInjector) SetTornWrites(torn bool) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.tornOnCrash = torn
+}
+
+// Crashed 是否已经发生了崩溃
+func (fi *FaultInjector) Crashed() bool {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	return fi.crashed
+}
+
+// Triggered 已经注入故障的次数
+func (fi *FaultInjector) Triggered() int {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	return fi.triggerCount
+}
+
+// Crash 立即模拟崩溃，所有文件回退到最后一次持久化时的状态
+func (fi *FaultInjector) Crash() error {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	return fi.crash()
+}
+
+// crash 调用时必须持有锁
+func (fi *FaultInjector) crash() error {
+	if fi.crashed {
+		return nil
+	}
+	fi.crashed = true
+
+	for _, file := range fi.files {
+		if file.closed {
+			continue
+		}
+		size, err := file.ioManager.Size()
+		if err != nil {
+			return err
+		}
+		keep := file.syncedSize
+		if fi.tornOnCrash && size > keep {
+			keep += fi.rand.Int63n(size - keep + 1)
+		}
+		if keep < size {
+			if err := file.ioManager.Truncate(keep); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// next 记录一次操作，返回需要注入的故障
+func (fi *FaultInjector) next(op FaultOp) (*FaultRule, error) {
+	if fi.crashed {
+		return nil, ErrInjectedCrash
+	}
+
+	count := fi.counts[op]
+	fi.counts[op]++
+	for i := range fi.rules {
+		rule := &fi.rules[i]
+		if rule.Op != op || count < rule.After || (rule.Count > 0 && count >= rule.After+rule.Count) {
+			continue
+		}
+		fi.triggerCount++
+		if rule.Kind == FaultCrash {
+			if err := fi.crash(); err != nil {
+				return nil, err
+			}
+			return nil, ErrInjectedCrash
+		}
+		return rule, nil
+	}
+	return nil, nil
+}
+
+// flipBit 随机翻转 b 中的一个比特
+func (fi *FaultInjector) flipBit(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	i := fi.rand.Intn(len(b) * 8)
+	b[i/8] ^= 1 << (i % 8)
+}
+
+// FaultIOManager 包装其他的 IOManager，按照 FaultInjector 的规则注入故障
+type FaultIOManager struct {
+	injector   *FaultInjector
+	ioManager  IOManager
+	syncedSize int64 // 最后一次持久化时文件的大小
+	closed     bool
+}
+
+// positionalFaultIOManager 被包装的 IOManager 支持在指定位置写入时，FaultIOManager 也实现 PositionalWriter
+type positionalFaultIOManager struct {
+	*FaultIOManager
+	writer PositionalWriter
+}
+
+// NewFaultIOManager 包装 ioManager，文件中已有的数据认为是已经持久化的
+// 被包装的 IOManager 实现了 PositionalWriter 时，返回的 IOManager 也实现 PositionalWriter
+func NewFaultIOManager(ioManager IOManager, injector *FaultInjector) (IOManager, error) {
+	size, err := ioManager.Size()
+	if err != nil {
+		return nil, err
+	}
+	file := &FaultIOManager{injector: injector, ioManager: ioManager, syncedSize: size}
+
+	injector.mu.Lock()
+	injector.files = append(injector.files, file)
+	injector.mu.Unlock()
+
+	if writer, ok := ioManager.(PositionalWriter); ok {
+		return &positionalFaultIOManager{FaultIOManager: file, writer: writer}, nil
+	}
+	return file, nil
+}
+
+// Wrap 使用这个故障注入器包装 ioManager，可以作为打开文件时包装 IOManager 的钩子
+func (fi *FaultInjector) Wrap(ioManager IOManager) (IOManager, error) {
+	return NewFaultIOManager(ioManager, fi)
+}
+
+func (f *FaultIOManager) Read(b []byte, offset int64) (int, error) {
+	f.injector.mu.Lock()
+	defer f.injector.mu.Unlock()
+
+	rule, err := f.injector.next(FaultRead)
+	if err != nil {
+		return 0, err
+	}
+	if rule != nil && rule.Kind != FaultBitFlip {
+		return 0, ruleError(rule)
+	}
+
+	n, err := f.ioManager.Read(b, offset)
+	if rule != nil && (err == nil || err == io.EOF) {
+		f.injector.flipBit(b[:n])
+	}
+	return n, err
+}
+
+func (f *FaultIOManager) Write(b []byte) (int, error) {
+	f.injector.mu.Lock()
+	defer f.injector.mu.Unlock()
+	return f.write(b, f.ioManager.Write)
+}
+
+func (f *positionalFaultIOManager) WriteAt(b []byte, offset int64) (int, error) {
+	f.injector.mu.Lock()
+	defer f.injector.mu.Unlock()
+	return f.write(b, func(b []byte) (int, error) {
+		return f.writer.WriteAt(b, offset)
+	})
+}
+
+// write 按照规则注入写入的故障，调用时必须持有锁
+func (f *FaultIOManager) write(b []byte, write func([]byte) (int, error)) (int, error) {
+	rule, err := f.injector.next(FaultWrite)
+	if err != nil {
+		return 0, err
+	}
+	if rule == nil {
+		return write(b)
+	}
+
+	switch rule.Kind {
+	case FaultShortWrite:
+		n, err := write(b[:len(b)/2])
+		if err != nil {
+			return n, err
+		}
+		return n, ruleError(rule)
+	case FaultBitFlip:
+		// 不能修改调用方的数据
+		corrupted := make([]byte, len(b))
+		copy(corrupted, b)
+		f.injector.flipBit(corrupted)
+		return write(corrupted)
+	default:
+		return 0, ruleError(rule)
+	}
+}
+
+func (f *FaultIOManager) Sync() error {
+	f.injector.mu.Lock()
+	defer f.injector.mu.Unlock()
+
+	rule, err := f.injector.next(FaultSync)
+	if err != nil {
+		return err
+	}
+	if rule != nil && rule.Kind != FaultBitFlip {
+		return ruleError(rule)
+	}
+
+	if err := f.ioManager.Sync(); err != nil {
+		return err
+	}
+	size, err := f.ioManager.Size()
+	if err != nil {
+		return err
+	}
+	f.syncedSize = size
+	return nil
+}
+
+// Close 总是关闭被包装的文件，崩溃之后也需要释放文件描述符
+func (f *FaultIOManager) Close() error {
+	f.injector.mu.Lock()
+	defer f.injector.mu.Unlock()
+
+	f.closed = true
+	return f.ioManager.Close()
+}
+
+func (f *FaultIOManager) Size() (int64, error) {
+	f.injector.mu.Lock()
+	defer f.injector.mu.Unlock()
+
+	if f.injector.crashed {
+		return 0, ErrInjectedCrash
+	}
+	return f.ioManager.Size()
+}
+
+// Truncate 截断文件，截断之后的大小认为是已经持久化的
+func (f *FaultIOManager) Truncate(size int64) error {
+	f.injector.mu.Lock()
+	defer f.injector.mu.Unlock()
+
+	if f.injector.crashed {
+		return ErrInjectedCrash
+	}
+	if err := f.ioManager.Truncate(size); err != nil {
+		return err
+	}
+	f.syncedSize = size
+	return nil
+}
+
+func ruleError(rule *FaultRule) error {
+	if rule.Err != nil {
+		return rule.Err
+	}
+	return ErrInjectedFault
+}
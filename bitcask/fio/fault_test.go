@@ -0,0 +1,78 @@
+package fio
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaultIOManager_Rules(t *testing.T) {
+	injector := NewFaultInjector(1,
+		FaultRule{Op: FaultWrite, Kind: FaultError, After: 1, Count: 1},
+		FaultRule{Op: FaultWrite, Kind: FaultShortWrite, After: 2, Count: 1},
+		FaultRule{Op: FaultWrite, Kind: FaultBitFlip, After: 3, Count: 1},
+		FaultRule{Op: FaultSync, Kind: FaultError, After: 0, Count: 1},
+	)
+	f, err := NewFaultIOManager(NewMemoryIOManager(), injector)
+	assert.Nil(t, err)
+	assert.True(t, SupportsWriteAt(f))
+
+	_, err = f.Write([]byte("aaaa"))
+	assert.Nil(t, err)
+	_, err = f.Write([]byte("bbbb"))
+	assert.Equal(t, ErrInjectedFault, err)
+	n, err := f.Write([]byte("cccc"))
+	assert.Equal(t, ErrInjectedFault, err)
+	assert.Equal(t, 2, n)
+	data := []byte("dddd")
+	_, err = f.Write(data)
+	assert.Nil(t, err)
+	// 调用方的数据没有被修改
+	assert.Equal(t, []byte("dddd"), data)
+
+	b := make([]byte, 10)
+	n, err = f.Read(b, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "aaaacc", string(b[:6]))
+	assert.NotEqual(t, "dddd", string(b[6:n]))
+
+	assert.Equal(t, ErrInjectedFault, f.Sync())
+	assert.Nil(t, f.Sync())
+	assert.Equal(t, 4, injector.Triggered())
+}
+
+func TestFaultIOManager_Crash(t *testing.T) {
+	dir := t.TempDir()
+	injector := NewFaultInjector(1)
+
+	fileIO, err := NewIOManager(filepath.Join(dir, "a.data"), StandardFIO)
+	assert.Nil(t, err)
+	ioManager, err := injector.Wrap(fileIO)
+	assert.Nil(t, err)
+	assert.True(t, SupportsWriteAt(ioManager))
+
+	_, err = ioManager.Write([]byte("synced"))
+	assert.Nil(t, err)
+	assert.Nil(t, ioManager.Sync())
+	_, err = ioManager.Write([]byte("lost"))
+	assert.Nil(t, err)
+
+	// 第二次 Sync 的时候崩溃，没有持久化的数据丢失
+	injector.AddRule(FaultRule{Op: FaultSync, Kind: FaultCrash})
+	assert.Equal(t, ErrInjectedCrash, ioManager.Sync())
+	assert.True(t, injector.Crashed())
+	_, err = ioManager.Write([]byte("x"))
+	assert.Equal(t, ErrInjectedCrash, err)
+	assert.Nil(t, ioManager.Close())
+
+	fileIO, err = NewIOManager(filepath.Join(dir, "a.data"), StandardFIO)
+	assert.Nil(t, err)
+	defer fileIO.Close()
+	b := make([]byte, 20)
+	n, err := fileIO.Read(b, 0)
+	assert.Equal(t, io.EOF, err)
+	assert.True(t, bytes.Equal([]byte("synced"), b[:n]))
+}
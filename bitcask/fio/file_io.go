@@ -1,6 +1,9 @@
 package fio
 
-import "os"
+import (
+	"io"
+	"os"
+)
 
 //对golang标准的文件操作进行封装
 type FileID struct {
@@ -8,15 +11,21 @@ type FileID struct {
 }
 
 // NewFileIOManager 初始化标准文件 IO
+// 文件不使用追加模式打开（追加模式的文件不能使用 WriteAt），Write 和 WriteAt 使用同一个文件描述符
 func NewFileIOManager(filename string) (*FileID, error) {
 	fid, err := os.OpenFile(
 		filename,
-		os.O_CREATE|os.O_RDWR|os.O_APPEND, //没有则创建，只允许追加写入
-		DataFilePerm,                      //文件所有者可写可读，其他用户只可读
+		os.O_CREATE|os.O_RDWR, //没有则创建
+		DataFilePerm,          //文件所有者可写可读，其他用户只可读
 	)
 	if err != nil {
 		return nil, err
 	}
+	// Write 从文件的末尾开始追加写入
+	if _, err := fid.Seek(0, io.SeekEnd); err != nil {
+		_ = fid.Close()
+		return nil, err
+	}
 	return &FileID{fd: fid}, nil
 }
 
@@ -30,6 +39,11 @@ func (fio *FileID) Write(b []byte) (int, error) {
 	return fio.fd.Write(b)
 }
 
+// WriteAt 在指定的位置写入数据，可以和其他位置的 WriteAt 并发执行，不会移动 Write 追加写入的位置
+func (fio *FileID) WriteAt(b []byte, offset int64) (int, error) {
+	return fio.fd.WriteAt(b, offset)
+}
+
 func (fio *FileID) Sync() error {
 	return fio.fd.Sync()
 }
@@ -45,4 +59,8 @@ func (fio *FileID) Size() (int64, error) {
 	}
 
 	return stat.Size(), nil
-}
\ No newline at end of file
+}
+
+func (fio *FileID) Truncate(size int64) error {
+	return fio.fd.Truncate(size)
+}
@@ -1,5 +1,13 @@
 package fio
 
+import "errors"
+
+// ErrWriteAtNotSupported IOManager 不支持在指定位置写入
+var ErrWriteAtNotSupported = errors.New("the io manager does not support positional writes")
+
+// ErrReadOnlyIOManager 只读的 IOManager（例如 MemoryMap）不能写入和持久化
+var ErrReadOnlyIOManager = errors.New("the io manager is read only")
+
 const DataFilePerm = 8644
 
 const (
@@ -8,6 +16,18 @@ const (
 
 	// MemoryMap 内存文件映射
 	MemoryMap
+
+	// InMemory 数据只保存在内存中，不会读写磁盘
+	InMemory
+
+	// WritableMemoryMap 可读写的内存映射，写入数据只需要内存拷贝
+	WritableMemoryMap
+
+	// DirectIO 使用 O_DIRECT 读写文件，不经过 page cache（只支持 Linux）
+	DirectIO
+
+	// URing 使用 io_uring 读写文件（只支持 Linux），内核不支持时使用标准文件 IO
+	URing
 )
 
 type FileIOType = byte
@@ -28,6 +48,28 @@ type IOManager interface {
 
 	// Size 获取剩余文件大小
 	Size() (int64, error)
+
+	// Truncate 将文件截断到指定的大小（用于丢弃损坏的尾部数据）
+	Truncate(size int64) error
+}
+
+// Preallocator 可以预先分配文件空间的 IOManager（可选实现）
+type Preallocator interface {
+	// Preallocate 预先将文件的空间分配到 size 大小，预分配的部分读出来都是 0
+	Preallocate(size int64) error
+}
+
+// PositionalWriter 可以在指定位置写入数据的 IOManager（可选实现）
+// 多个写入者预留好各自的位置之后，可以不持有锁并发地写入文件的不同位置
+type PositionalWriter interface {
+	// WriteAt 从 offset 开始写入数据，写入的位置超过文件末尾时文件大小随之增长
+	WriteAt(b []byte, offset int64) (int, error)
+}
+
+// SupportsWriteAt ioManager 是否支持在指定位置写入
+func SupportsWriteAt(ioManager IOManager) bool {
+	_, ok := ioManager.(PositionalWriter)
+	return ok
 }
 
 // FileID 标准系统文件 ID
@@ -39,6 +81,14 @@ func NewIOManager(fileName string, IOType FileIOType) (IOManager, error) {
 		return NewFileIOManager(fileName)
 	case MemoryMap:
 		return NewMMapIOManager(fileName)
+	case InMemory:
+		return NewMemoryIOManager(), nil
+	case WritableMemoryMap:
+		return NewWritableMMapIOManager(fileName)
+	case DirectIO:
+		return NewDirectIOManager(fileName)
+	case URing:
+		return NewURingIOManager(fileName)
 
 	default:
 		panic("unsuported io type")
@@ -0,0 +1,89 @@
+package fio
+
+import (
+	"io"
+	"sync"
+)
+
+// MemoryFile 完全保存在内存中的文件，数据储存在可以增长的字节切片中，关闭之后数据就丢失了
+type MemoryFile struct {
+	mu  *sync.RWMutex
+	buf []byte
+}
+
+// NewMemoryIOManager 初始化内存文件 IO，每次调用都会得到一个新的空文件
+func NewMemoryIOManager() *MemoryFile {
+	return &MemoryFile{mu: new(sync.RWMutex)}
+}
+
+// Read 从对应位置读取数据，读到文件末尾时返回 io.EOF
+func (mf *MemoryFile) Read(b []byte, offset int64) (int, error) {
+	mf.mu.RLock()
+	defer mf.mu.RUnlock()
+
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if offset >= int64(len(mf.buf)) {
+		return 0, io.EOF
+	}
+	n := copy(b, mf.buf[offset:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Write 追加写入数据，切片容量不够时自动扩容
+func (mf *MemoryFile) Write(b []byte) (int, error) {
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+
+	mf.buf = append(mf.buf, b...)
+	return len(b), nil
+}
+
+// WriteAt 在指定的位置写入数据，超过末尾的部分自动扩容（中间空出来的部分为 0）
+func (mf *MemoryFile) WriteAt(b []byte, offset int64) (int, error) {
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+
+	if need := offset + int64(len(b)); need > int64(len(mf.buf)) {
+		mf.buf = append(mf.buf, make([]byte, need-int64(len(mf.buf)))...)
+	}
+	copy(mf.buf[offset:], b)
+	return len(b), nil
+}
+
+// Sync 内存中的数据不需要持久化
+func (mf *MemoryFile) Sync() error {
+	return nil
+}
+
+// Close 释放文件占用的内存
+func (mf *MemoryFile) Close() error {
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+
+	mf.buf = nil
+	return nil
+}
+
+func (mf *MemoryFile) Size() (int64, error) {
+	mf.mu.RLock()
+	defer mf.mu.RUnlock()
+
+	return int64(len(mf.buf)), nil
+}
+
+func (mf *MemoryFile) Truncate(size int64) error {
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+
+	if size < int64(len(mf.buf)) {
+		mf.buf = mf.buf[:size]
+	} else {
+		mf.buf = append(mf.buf, make([]byte, size-int64(len(mf.buf)))...)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package fio
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryFile_ReadWrite(t *testing.T) {
+	mf, err := NewIOManager("", InMemory)
+	assert.Nil(t, err)
+
+	// 文件为空
+	b := make([]byte, 4)
+	n, err := mf.Read(b, 0)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, io.EOF, err)
+
+	_, err = mf.Write([]byte("key-a"))
+	assert.Nil(t, err)
+	_, err = mf.Write([]byte("key-b"))
+	assert.Nil(t, err)
+	size, err := mf.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), size)
+
+	n, err = mf.Read(b, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, "key-", string(b[:n]))
+
+	// 读到文件末尾
+	n, err = mf.Read(b, 8)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "-b", string(b[:n]))
+
+	assert.Nil(t, mf.Truncate(3))
+	size, _ = mf.Size()
+	assert.Equal(t, int64(3), size)
+	assert.Nil(t, mf.Sync())
+	assert.Nil(t, mf.Close())
+}
@@ -10,6 +10,7 @@ import (
 
 // MMap 内存映射
 type MMap struct {
+	fileName string
 	readerAt *mmap.ReaderAt
 }
 
@@ -28,6 +29,7 @@ func NewMMapIOManager(fileName string) (*MMap, error) {
 	}
 
 	return &MMap{
+		fileName: fileName,
 		readerAt: readerAt,
 	}, nil
 }
@@ -37,16 +39,14 @@ func (mmp *MMap) Read(b []byte, offset int64) (int, error) {
 	return mmp.readerAt.ReadAt(b, offset) //读取内容，并将数据缓存到 b 中
 }
 
-// Write 写入字节级别文件中
+// Write 内存映射是只读的，不用这个来写数据，返回 ErrReadOnlyIOManager
 func (mmp *MMap) Write([]byte) (int, error) {
-	// 不用这个来写数据
-	panic("not implemented")
+	return 0, ErrReadOnlyIOManager
 }
 
-// Sync 持久化数据
+// Sync 内存映射是只读的，没有需要持久化的数据，返回 ErrReadOnlyIOManager
 func (mmp *MMap) Sync() error {
-	//不用内存索引来持久化
-	panic("not implemented")
+	return ErrReadOnlyIOManager
 }
 
 // Close 关闭文件
@@ -58,3 +58,20 @@ func (mmp *MMap) Close() error {
 func (mmp *MMap) Size() (int64, error) {
 	return int64(mmp.readerAt.Len()), nil
 }
+
+// Truncate 截断文件，内存映射是只读的，需要先解除映射，截断后再重新映射
+func (mmp *MMap) Truncate(size int64) error {
+	if err := mmp.readerAt.Close(); err != nil {
+		return err
+	}
+	if err := os.Truncate(mmp.fileName, size); err != nil {
+		return err
+	}
+
+	readerAt, err := mmap.Open(mmp.fileName)
+	if err != nil {
+		return err
+	}
+	mmp.readerAt = readerAt
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package fio
+
+import "errors"
+
+var ErrWritableMMapNotSupported = errors.New("writable mmap is not supported on this platform")
+
+// WritableMMap 当前平台不支持可写的内存映射
+type WritableMMap struct {
+	IOManager
+}
+
+func NewWritableMMapIOManager(fileName string) (*WritableMMap, error) {
+	return nil, ErrWritableMMapNotSupported
+}
@@ -0,0 +1,60 @@
+//go:build unix
+
+package fio
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritableMMap_ReadWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mmap-rw.data")
+	m, err := NewIOManager(path, WritableMemoryMap)
+	assert.Nil(t, err)
+
+	_, err = m.Write([]byte("key-a"))
+	assert.Nil(t, err)
+	_, err = m.Write([]byte("key-b"))
+	assert.Nil(t, err)
+	size, err := m.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), size)
+
+	b := make([]byte, 8)
+	n, err := m.Read(b, 5)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "key-b", string(b[:n]))
+
+	// 预分配之后文件变大，但是有效数据的长度不变
+	assert.Nil(t, m.(Preallocator).Preallocate(4*mmapMinSize))
+	stat, _ := os.Stat(path)
+	assert.Equal(t, int64(4*mmapMinSize), stat.Size())
+	assert.Nil(t, m.Sync())
+
+	// 超过映射的大小之后自动扩容
+	big := make([]byte, 5*mmapMinSize)
+	big[len(big)-1] = 'z'
+	_, err = m.Write(big)
+	assert.Nil(t, err)
+	n, err = m.Read(b[:1], 10+int64(len(big))-1)
+	assert.Nil(t, err)
+	assert.Equal(t, byte('z'), b[0])
+
+	// 截掉的部分重新置为 0
+	assert.Nil(t, m.Truncate(5))
+	n, err = m.Read(b, 5)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, io.EOF, err)
+	_, err = m.Write([]byte("c"))
+	assert.Nil(t, err)
+
+	// 关闭之后截断到实际写入的长度
+	assert.Nil(t, m.Close())
+	content, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "key-ac", string(content))
+}
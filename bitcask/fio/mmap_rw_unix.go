@@ -0,0 +1,162 @@
+//go:build unix
+
+package fio
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// mmapMinSize 可写内存映射每次至少映射的大小
+const mmapMinSize = 1 << 20
+
+// WritableMMap 可读写的内存映射，写入时直接拷贝到映射的内存中
+// 映射的长度可以比实际写入的数据长（预分配），多出来的部分都是 0，关闭的时候截断到实际写入的长度
+type WritableMMap struct {
+	mu   *sync.RWMutex
+	fd   *os.File
+	data []byte // 映射的内存
+	size int64  // 实际写入的数据长度
+}
+
+// NewWritableMMapIOManager 初始化可写的内存映射，文件中已有的数据都认为是有效的
+func NewWritableMMapIOManager(fileName string) (*WritableMMap, error) {
+	fd, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, DataFilePerm)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+
+	m := &WritableMMap{mu: new(sync.RWMutex), fd: fd, size: stat.Size()}
+	if err := m.remap(max(m.size, mmapMinSize)); err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// remap 将文件扩展到 length 之后重新映射，调用时必须持有写锁
+func (m *WritableMMap) remap(length int64) error {
+	if m.data != nil {
+		if err := unix.Munmap(m.data); err != nil {
+			return err
+		}
+		m.data = nil
+	}
+	if err := m.fd.Truncate(length); err != nil {
+		return err
+	}
+	data, err := unix.Mmap(int(m.fd.Fd()), 0, int(length), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	m.data = data
+	return nil
+}
+
+func (m *WritableMMap) Read(b []byte, offset int64) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if offset >= m.size {
+		return 0, io.EOF
+	}
+	n := copy(b, m.data[offset:m.size])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Write 追加写入数据，映射的空间不够时按照两倍扩容
+func (m *WritableMMap) Write(b []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.writeAt(b, m.size)
+}
+
+// WriteAt 在指定的位置写入数据，写入的位置超过实际写入的长度时长度随之增长
+func (m *WritableMMap) WriteAt(b []byte, offset int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.writeAt(b, offset)
+}
+
+// writeAt 调用时必须持有写锁
+func (m *WritableMMap) writeAt(b []byte, offset int64) (int, error) {
+	if need := offset + int64(len(b)); need > int64(len(m.data)) {
+		if err := m.remap(max(need, 2*int64(len(m.data)))); err != nil {
+			return 0, err
+		}
+	}
+	copy(m.data[offset:], b)
+	m.size = max(m.size, offset+int64(len(b)))
+	return len(b), nil
+}
+
+// Sync 将映射的内存刷到磁盘中
+func (m *WritableMMap) Sync() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return unix.Msync(m.data, unix.MS_SYNC)
+}
+
+// Close 解除映射，并将文件截断到实际写入的长度
+func (m *WritableMMap) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := unix.Munmap(m.data); err != nil {
+		return err
+	}
+	m.data = nil
+	if err := m.fd.Truncate(m.size); err != nil {
+		return err
+	}
+	return m.fd.Close()
+}
+
+// Size 返回实际写入的数据长度（不包括预分配的部分）
+func (m *WritableMMap) Size() (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.size, nil
+}
+
+// Truncate 截断实际写入的数据，截掉的部分重新置为 0，保证预分配的部分一直都是 0
+func (m *WritableMMap) Truncate(size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if size > int64(len(m.data)) {
+		if err := m.remap(size); err != nil {
+			return err
+		}
+	}
+	if size < m.size {
+		clear(m.data[size:m.size])
+	}
+	m.size = size
+	return nil
+}
+
+// Preallocate 预先将文件扩展并映射到 size 大小，之后的写入不需要再重新映射
+func (m *WritableMMap) Preallocate(size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if size <= int64(len(m.data)) {
+		return nil
+	}
+	return m.remap(size)
+}
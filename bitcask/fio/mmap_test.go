@@ -42,4 +42,9 @@ func TestMMap_Read(t *testing.T) {
 	n2, err := mmapIO2.Read(b2, 0)
 	assert.Nil(t, err)
 	assert.Equal(t, 2, n2)
+
+	// 内存映射是只读的
+	_, err = mmapIO2.Write([]byte("dd"))
+	assert.Equal(t, ErrReadOnlyIOManager, err)
+	assert.Equal(t, ErrReadOnlyIOManager, mmapIO2.Sync())
 }
@@ -0,0 +1,17 @@
+package fio
+
+// ReadRequest 批量读取中的一个请求，读取完成之后 N 和 Err 保存读取的结果（和 IOManager.Read 的返回值一致）
+type ReadRequest struct {
+	File   IOManager
+	Buf    []byte
+	Offset int64
+	N      int
+	Err    error
+}
+
+// ReadBatch 批量读取：使用 io_uring 的文件在一次提交中全部完成，其他类型的文件逐个读取
+func ReadBatch(reqs []*ReadRequest) {
+	for _, req := range readBatchPlatform(reqs) {
+		req.N, req.Err = req.File.Read(req.Buf, req.Offset)
+	}
+}
@@ -0,0 +1,384 @@
+//go:build linux
+
+package fio
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// io_uring 相关的系统调用号和常量（见 linux/io_uring.h）
+const (
+	sysIOURingSetup = 425
+	sysIOURingEnter = 426
+
+	ioringOffSQRing = 0
+	ioringOffCQRing = 0x8000000
+	ioringOffSQEs   = 0x10000000
+
+	ioringEnterGetEvents = 1
+
+	ioringOpFsync = 3
+	ioringOpRead  = 22
+	ioringOpWrite = 23
+
+	// uringEntries 提交队列的大小，一次批量读取超过这个数量时分多次提交
+	uringEntries = 256
+)
+
+// uringParams 对应 struct io_uring_params
+type uringParams struct {
+	sqEntries    uint32
+	cqEntries    uint32
+	flags        uint32
+	sqThreadCPU  uint32
+	sqThreadIdle uint32
+	features     uint32
+	wqFd         uint32
+	resv         [3]uint32
+	sqOff        struct {
+		head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+		userAddr                                                        uint64
+	}
+	cqOff struct {
+		head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+		userAddr                                                        uint64
+	}
+}
+
+// uringSQE 对应 struct io_uring_sqe
+type uringSQE struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	opFlags     uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFdIn  int32
+	addr3       uint64
+	pad         uint64
+}
+
+// uringCQE 对应 struct io_uring_cqe
+type uringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// uring 整个进程共享的一个 io_uring 实例，提交和收割都在锁的保护下进行
+type uring struct {
+	mu     *sync.Mutex
+	fd     int
+	sqRing []byte
+	cqRing []byte
+	sqes   []uringSQE
+
+	sqHead, sqTail, sqMask *uint32
+	sqArray                []uint32
+	cqHead, cqTail, cqMask *uint32
+	cqes                   []uringCQE
+}
+
+// uringOp 一次提交的 IO 操作，res 为内核返回的结果（负数为 -errno）
+type uringOp struct {
+	opcode uint8
+	fd     int32
+	buf    []byte
+	offset int64
+	flags  uint32
+	res    int32
+}
+
+var (
+	sharedURing     *uring
+	sharedURingErr  error
+	sharedURingOnce sync.Once
+)
+
+// getURing 返回进程共享的 io_uring 实例，内核不支持时返回错误
+func getURing() (*uring, error) {
+	sharedURingOnce.Do(func() {
+		sharedURing, sharedURingErr = newURing(uringEntries)
+	})
+	return sharedURing, sharedURingErr
+}
+
+func newURing(entries uint32) (*uring, error) {
+	var params uringParams
+	fd, _, errno := unix.Syscall(sysIOURingSetup, uintptr(entries), uintptr(unsafe.Pointer(&params)), 0)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	r := &uring{mu: new(sync.Mutex), fd: int(fd)}
+	sqRingSize := int(params.sqOff.array + params.sqEntries*4)
+	cqRingSize := int(params.cqOff.cqes + params.cqEntries*uint32(unsafe.Sizeof(uringCQE{})))
+
+	var err error
+	if r.sqRing, err = unix.Mmap(r.fd, ioringOffSQRing, sqRingSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE); err != nil {
+		_ = unix.Close(r.fd)
+		return nil, err
+	}
+	if r.cqRing, err = unix.Mmap(r.fd, ioringOffCQRing, cqRingSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE); err != nil {
+		_ = unix.Munmap(r.sqRing)
+		_ = unix.Close(r.fd)
+		return nil, err
+	}
+	sqesSize := int(params.sqEntries) * int(unsafe.Sizeof(uringSQE{}))
+	sqes, err := unix.Mmap(r.fd, ioringOffSQEs, sqesSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		_ = unix.Munmap(r.sqRing)
+		_ = unix.Munmap(r.cqRing)
+		_ = unix.Close(r.fd)
+		return nil, err
+	}
+
+	r.sqes = unsafe.Slice((*uringSQE)(unsafe.Pointer(&sqes[0])), params.sqEntries)
+	r.sqHead = (*uint32)(unsafe.Pointer(&r.sqRing[params.sqOff.head]))
+	r.sqTail = (*uint32)(unsafe.Pointer(&r.sqRing[params.sqOff.tail]))
+	r.sqMask = (*uint32)(unsafe.Pointer(&r.sqRing[params.sqOff.ringMask]))
+	r.sqArray = unsafe.Slice((*uint32)(unsafe.Pointer(&r.sqRing[params.sqOff.array])), params.sqEntries)
+	r.cqHead = (*uint32)(unsafe.Pointer(&r.cqRing[params.cqOff.head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&r.cqRing[params.cqOff.tail]))
+	r.cqMask = (*uint32)(unsafe.Pointer(&r.cqRing[params.cqOff.ringMask]))
+	r.cqes = unsafe.Slice((*uringCQE)(unsafe.Pointer(&r.cqRing[params.cqOff.cqes])), params.cqEntries)
+	return r, nil
+}
+
+// submit 提交所有的操作并等待它们全部完成，每个操作的结果保存在 res 中
+func (r *uring) submit(ops []*uringOp) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for len(ops) > 0 {
+		batch := ops[:min(len(ops), len(r.sqes))]
+		ops = ops[len(batch):]
+
+		// 填充提交队列
+		tail := atomic.LoadUint32(r.sqTail)
+		mask := *r.sqMask
+		for i, op := range batch {
+			index := tail & mask
+			sqe := &r.sqes[index]
+			*sqe = uringSQE{
+				opcode:   op.opcode,
+				fd:       op.fd,
+				off:      uint64(op.offset),
+				len:      uint32(len(op.buf)),
+				opFlags:  op.flags,
+				userData: uint64(i),
+			}
+			if len(op.buf) > 0 {
+				sqe.addr = uint64(uintptr(unsafe.Pointer(&op.buf[0])))
+			}
+			r.sqArray[index] = index
+			tail++
+		}
+		atomic.StoreUint32(r.sqTail, tail)
+
+		// 提交并等待全部完成
+		toSubmit, completed := uint32(len(batch)), 0
+		for completed < len(batch) {
+			_, _, errno := unix.Syscall6(sysIOURingEnter, uintptr(r.fd), uintptr(toSubmit),
+				uintptr(len(batch)-completed), ioringEnterGetEvents, 0, 0)
+			if errno != 0 && errno != syscall.EINTR && errno != syscall.EAGAIN {
+				return errno
+			}
+			if errno == 0 {
+				toSubmit = 0
+			}
+
+			head := atomic.LoadUint32(r.cqHead)
+			cqTail := atomic.LoadUint32(r.cqTail)
+			for ; head != cqTail; head++ {
+				cqe := &r.cqes[head&*r.cqMask]
+				batch[cqe.userData].res = cqe.res
+				completed++
+			}
+			atomic.StoreUint32(r.cqHead, head)
+		}
+		runtime.KeepAlive(batch)
+	}
+	return nil
+}
+
+// URingFile 使用 io_uring 进行读写和持久化的文件
+type URingFile struct {
+	mu   *sync.RWMutex
+	fd   *os.File
+	ring *uring
+	size int64
+}
+
+// NewURingIOManager 初始化 io_uring 文件 IO，内核不支持 io_uring 时退化为标准文件 IO
+func NewURingIOManager(fileName string) (IOManager, error) {
+	ring, err := getURing()
+	if err != nil {
+		return NewFileIOManager(fileName)
+	}
+
+	fd, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, DataFilePerm)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+	return &URingFile{mu: new(sync.RWMutex), fd: fd, ring: ring, size: stat.Size()}, nil
+}
+
+func (f *URingFile) Read(b []byte, offset int64) (int, error) {
+	req := &ReadRequest{File: f, Buf: b, Offset: offset}
+	f.readBatch([]*ReadRequest{req})
+	return req.N, req.Err
+}
+
+// readBatch 在一次提交中完成所有的读取请求（请求的文件都必须是 URingFile）
+func (f *URingFile) readBatch(reqs []*ReadRequest) {
+	ops := make([]*uringOp, 0, len(reqs))
+	opReqs := make([]*ReadRequest, 0, len(reqs))
+	for _, req := range reqs {
+		file := req.File.(*URingFile)
+		file.mu.RLock()
+		size := file.size
+		file.mu.RUnlock()
+
+		if len(req.Buf) == 0 {
+			continue
+		}
+		if req.Offset >= size {
+			req.Err = io.EOF
+			continue
+		}
+		ops = append(ops, &uringOp{opcode: ioringOpRead, fd: int32(file.fd.Fd()), buf: req.Buf, offset: req.Offset})
+		opReqs = append(opReqs, req)
+	}
+	if len(ops) == 0 {
+		return
+	}
+
+	if err := f.ring.submit(ops); err != nil {
+		for _, req := range opReqs {
+			req.Err = err
+		}
+		return
+	}
+	for i, op := range ops {
+		req := opReqs[i]
+		if op.res < 0 {
+			req.Err = syscall.Errno(-op.res)
+			continue
+		}
+		req.N = int(op.res)
+		if req.N < len(req.Buf) {
+			req.Err = io.EOF
+		}
+	}
+}
+
+// Write 在文件末尾追加写入，内核只写入了一部分时继续提交剩下的部分
+func (f *URingFile) Write(b []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n, err := f.writeAt(b, f.size)
+	f.size += int64(n)
+	return n, err
+}
+
+// WriteAt 在指定的位置写入数据，不持有锁提交，不同位置的写入可以并发执行
+func (f *URingFile) WriteAt(b []byte, offset int64) (int, error) {
+	n, err := f.writeAt(b, offset)
+
+	f.mu.Lock()
+	f.size = max(f.size, offset+int64(n))
+	f.mu.Unlock()
+	return n, err
+}
+
+func (f *URingFile) writeAt(b []byte, offset int64) (int, error) {
+	var written int
+	for written < len(b) {
+		op := &uringOp{opcode: ioringOpWrite, fd: int32(f.fd.Fd()), buf: b[written:], offset: offset + int64(written)}
+		if err := f.ring.submit([]*uringOp{op}); err != nil {
+			return written, err
+		}
+		if op.res < 0 {
+			return written, syscall.Errno(-op.res)
+		}
+		if op.res == 0 {
+			return written, io.ErrShortWrite
+		}
+		written += int(op.res)
+	}
+	return written, nil
+}
+
+func (f *URingFile) Sync() error {
+	op := &uringOp{opcode: ioringOpFsync, fd: int32(f.fd.Fd())}
+	if err := f.ring.submit([]*uringOp{op}); err != nil {
+		return err
+	}
+	if op.res < 0 {
+		return syscall.Errno(-op.res)
+	}
+	return nil
+}
+
+func (f *URingFile) Close() error {
+	return f.fd.Close()
+}
+
+func (f *URingFile) Size() (int64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.size, nil
+}
+
+func (f *URingFile) Truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.fd.Truncate(size); err != nil {
+		return err
+	}
+	f.size = size
+	return nil
+}
+
+// URingSupported 当前内核是否支持 io_uring
+func URingSupported() bool {
+	_, err := getURing()
+	return err == nil
+}
+
+// readBatchPlatform 将使用 io_uring 的请求在一次提交中完成，返回剩下需要逐个读取的请求
+func readBatchPlatform(reqs []*ReadRequest) []*ReadRequest {
+	var uringReqs, rest []*ReadRequest
+	for _, req := range reqs {
+		if _, ok := req.File.(*URingFile); ok {
+			uringReqs = append(uringReqs, req)
+		} else {
+			rest = append(rest, req)
+		}
+	}
+	if len(uringReqs) > 0 {
+		uringReqs[0].File.(*URingFile).readBatch(uringReqs)
+	}
+	return rest
+}
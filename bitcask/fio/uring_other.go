@@ -0,0 +1,17 @@
+//go:build !linux
+
+package fio
+
+// NewURingIOManager 只有 Linux 支持 io_uring，其他平台使用标准文件 IO
+func NewURingIOManager(fileName string) (IOManager, error) {
+	return NewFileIOManager(fileName)
+}
+
+// URingSupported 当前平台是否支持 io_uring
+func URingSupported() bool {
+	return false
+}
+
+func readBatchPlatform(reqs []*ReadRequest) []*ReadRequest {
+	return reqs
+}
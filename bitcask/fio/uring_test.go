@@ -0,0 +1,83 @@
+//go:build linux
+
+package fio
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURingFile_ReadWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uring.data")
+	f, err := NewIOManager(path, URing)
+	assert.Nil(t, err)
+	defer f.Close()
+	if !URingSupported() {
+		// 内核不支持时退化为标准文件 IO
+		_, ok := f.(*FileID)
+		assert.True(t, ok)
+		return
+	}
+
+	_, err = f.Write([]byte("key-a"))
+	assert.Nil(t, err)
+	_, err = f.Write([]byte("key-b"))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Sync())
+	size, _ := f.Size()
+	assert.Equal(t, int64(10), size)
+
+	b := make([]byte, 8)
+	n, err := f.Read(b, 5)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "key-b", string(b[:n]))
+	n, err = f.Read(b, 10)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, io.EOF, err)
+
+	assert.Nil(t, f.Truncate(3))
+	_, err = f.Write([]byte("c"))
+	assert.Nil(t, err)
+	n, err = f.Read(b[:4], 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "keyc", string(b[:n]))
+}
+
+func TestReadBatch(t *testing.T) {
+	dir := t.TempDir()
+	files := make([]IOManager, 3)
+	for i := range files {
+		ioType := URing
+		if i == 2 {
+			ioType = StandardFIO
+		}
+		file, err := NewIOManager(filepath.Join(dir, fmt.Sprintf("%d.data", i)), ioType)
+		assert.Nil(t, err)
+		defer file.Close()
+		for j := 0; j < 300; j++ {
+			_, err := file.Write([]byte(fmt.Sprintf("%d-%04d", i, j)))
+			assert.Nil(t, err)
+		}
+		files[i] = file
+	}
+
+	// 请求数量超过提交队列的大小，需要分多次提交
+	var reqs []*ReadRequest
+	for j := 0; j < 300; j++ {
+		for i := range files {
+			reqs = append(reqs, &ReadRequest{File: files[i], Buf: make([]byte, 6), Offset: int64(j * 6)})
+		}
+	}
+	reqs = append(reqs, &ReadRequest{File: files[0], Buf: make([]byte, 6), Offset: 300 * 6})
+	ReadBatch(reqs)
+
+	for k, req := range reqs[:len(reqs)-1] {
+		assert.Nil(t, req.Err)
+		assert.Equal(t, fmt.Sprintf("%d-%04d", k%3, k/3), string(req.Buf[:req.N]))
+	}
+	assert.Equal(t, io.EOF, reqs[len(reqs)-1].Err)
+}
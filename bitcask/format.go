@@ -0,0 +1,173 @@
+package bitcask
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"bitcask.go/data"
+	"bitcask.go/utils"
+)
+
+const (
+	// FormatManifestFileName 记录数据目录格式版本和布局的文件
+	FormatManifestFileName = "MANIFEST"
+
+	// FormatVersion 当前的数据目录格式版本
+	// 版本 0：没有 MANIFEST 文件的数据目录
+	// 版本 1：增加 MANIFEST 文件
+	FormatVersion = 1
+
+	// formatCompressionNone 数据没有压缩，目前唯一支持的压缩方式
+	formatCompressionNone = "none"
+)
+
+// FormatManifest 数据目录的格式版本、影响文件布局的配置项以及当前所有的数据文件
+type FormatManifest struct {
+	FormatVersion int         `json:"format_version"`
+	IndexType     IndexerType `json:"index_type"`
+	DataFileSize  int64       `json:"data_file_size"`
+	Compression   string      `json:"compression"` // 数据的压缩方式，目前只有 none
+	Files         []string    `json:"files"`       // 当前所有的数据文件
+}
+
+// formatUpgrade 将数据目录从一个版本升级到下一个版本
+type formatUpgrade func(dirPath string, manifest *FormatManifest) error
+
+// formatUpgrades formatUpgrades[v] 将版本 v 的数据目录升级到版本 v+1
+var formatUpgrades = map[int]formatUpgrade{
+	// 版本 0 和版本 1 的文件布局相同，只需要补充 MANIFEST 文件
+	0: func(string, *FormatManifest) error { return nil },
+}
+
+// registerFormatUpgrade 注册版本 from 升级到 from+1 的步骤
+func registerFormatUpgrade(from int, upgrade formatUpgrade) {
+	formatUpgrades[from] = upgrade
+}
+
+// ReadFormatManifest 读取数据目录中的 MANIFEST 文件
+func ReadFormatManifest(dirPath string) (*FormatManifest, error) {
+	buf, err := os.ReadFile(filepath.Join(dirPath, FormatManifestFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &FormatManifest{}
+	if err := json.Unmarshal(buf, manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDataDirectoryCorrupted, err)
+	}
+	return manifest, nil
+}
+
+// loadFormatManifest 打开数据库时校验数据目录的格式，需要的话依次执行升级的步骤，之后再重写 MANIFEST
+// mergeLoaded 标识刚刚加载了 merge 的数据，此时 MANIFEST 中记录的数据文件可能已经被替换
+// MANIFEST 中的每一项：FormatVersion、Compression、Files 必须和当前的实现一致；
+// IndexType 只在切换到 B+ 树索引时校验（内存索引每次都从数据文件重建）；
+// DataFileSize 只决定什么时候切换新的活跃文件，已有的数据文件大小不受影响，允许每次打开时修改，不做校验
+func (db *DB) loadFormatManifest(mergeLoaded bool) error {
+	manifest, err := ReadFormatManifest(db.option.DirPath)
+	if os.IsNotExist(err) {
+		// 新的数据目录直接使用当前的版本，否则是没有 MANIFEST 文件的旧版本
+		manifest = &FormatManifest{IndexType: db.option.IndexType}
+		if db.isNewInitial {
+			manifest.FormatVersion = FormatVersion
+		}
+		mergeLoaded = true
+	} else if err != nil {
+		return err
+	}
+
+	if manifest.FormatVersion > FormatVersion {
+		return fmt.Errorf("%w: directory format version %d, supported version %d",
+			ErrIncompatibleFormatVersion, manifest.FormatVersion, FormatVersion)
+	}
+
+	// 数据都是按照没有压缩的格式读取的
+	if manifest.Compression != "" && manifest.Compression != formatCompressionNone {
+		return fmt.Errorf("%w: unsupported compression %s", ErrIncompatibleFormatVersion, manifest.Compression)
+	}
+
+	// B+ 树的索引保存在磁盘上，其他的索引类型写入的数据不在里面，切换过来之后会丢失数据
+	if db.option.IndexType == BPlusTree && manifest.IndexType != BPlusTree && len(manifest.Files) > 0 {
+		return fmt.Errorf("%w: directory index type %d", ErrIndexTypeMismatch, manifest.IndexType)
+	}
+
+	// MANIFEST 中记录的数据文件都应该存在
+	if !mergeLoaded {
+		exists := make(map[string]bool)
+		for _, fid := range db.fileIDs {
+			exists[filepath.Base(data.GetDataFileName(db.option.DirPath, uint32(fid)))] = true
+		}
+		for _, name := range manifest.Files {
+			if !exists[name] {
+				return fmt.Errorf("%w: data file %s is missing", ErrDataDirectoryCorrupted, name)
+			}
+		}
+	}
+
+	// 只读模式下不能修改数据目录，按照当前的布局读取
+	if db.option.ReadOnly {
+		return nil
+	}
+
+	// 每一步升级完成之后才进入下一个版本，全部完成之后才写入当前版本的 MANIFEST，
+	// 中途崩溃时 MANIFEST 还是旧的版本，下次打开时重新执行升级
+	for manifest.FormatVersion < FormatVersion {
+		upgrade, ok := formatUpgrades[manifest.FormatVersion]
+		if !ok {
+			return fmt.Errorf("%w: no upgrade from format version %d",
+				ErrIncompatibleFormatVersion, manifest.FormatVersion)
+		}
+		if err := upgrade(db.option.DirPath, manifest); err != nil {
+			return err
+		}
+		manifest.FormatVersion++
+	}
+	return db.writeFormatManifest()
+}
+
+// writeFormatManifest 将当前的配置和数据文件写入 MANIFEST 文件
+// 先写入临时文件再重命名，崩溃时不会留下写了一半的 MANIFEST，重命名之后同步目录，保证新的 MANIFEST 持久化
+func (db *DB) writeFormatManifest() error {
+	manifest := &FormatManifest{
+		FormatVersion: FormatVersion,
+		IndexType:     db.option.IndexType,
+		DataFileSize:  db.option.DataFileSize,
+		Compression:   formatCompressionNone,
+	}
+	for fileID := range db.oldFiles {
+		manifest.Files = append(manifest.Files, filepath.Base(data.GetDataFileName(db.option.DirPath, fileID)))
+	}
+	if db.activeFile != nil {
+		manifest.Files = append(manifest.Files, filepath.Base(data.GetDataFileName(db.option.DirPath, db.activeFile.FileID)))
+	}
+	sort.Strings(manifest.Files)
+
+	buf, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fileName := filepath.Join(db.option.DirPath, FormatManifestFileName)
+	tmpFile, err := os.OpenFile(fileName+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer tmpFile.Close()
+
+	if _, err := tmpFile.Write(buf); err != nil {
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(fileName+".tmp", fileName); err != nil {
+		return err
+	}
+	return utils.SyncDir(db.option.DirPath)
+}
@@ -0,0 +1,118 @@
+package bitcask
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bitcask.go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestFormatManifest(t *testing.T, dir string, manifest *FormatManifest) {
+	buf, err := json.Marshal(manifest)
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, FormatManifestFileName), buf, 0644))
+}
+
+func TestOpen_FormatManifest(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-format")
+	defer os.RemoveAll(dir)
+	opts.DirPath = dir
+	opts.DataFileSize = 64
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	assert.Nil(t, db.Close())
+
+	manifest, err := ReadFormatManifest(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, FormatVersion, manifest.FormatVersion)
+	assert.Equal(t, BTree, manifest.IndexType)
+	assert.Equal(t, int64(64), manifest.DataFileSize)
+	assert.Equal(t, len(db.oldFiles)+1, len(manifest.Files))
+
+	// 没有 MANIFEST 的旧版本数据目录，打开时执行升级的步骤
+	var upgraded int
+	upgradeV0 := formatUpgrades[0]
+	registerFormatUpgrade(0, func(dirPath string, manifest *FormatManifest) error {
+		upgraded++
+		assert.Equal(t, dir, dirPath)
+		assert.Equal(t, 0, manifest.FormatVersion)
+		return upgradeV0(dirPath, manifest)
+	})
+	defer registerFormatUpgrade(0, upgradeV0)
+	assert.Nil(t, os.Remove(filepath.Join(dir, FormatManifestFileName)))
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, upgraded)
+	assert.Equal(t, 10, len(db.ListKeys()))
+	assert.Nil(t, db.Close())
+	manifest, err = ReadFormatManifest(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, FormatVersion, manifest.FormatVersion)
+
+	// 已经是当前版本的数据目录不会再执行升级
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+	assert.Equal(t, 1, upgraded)
+
+	// 升级失败时不会写入新版本的 MANIFEST
+	assert.Nil(t, os.Remove(filepath.Join(dir, FormatManifestFileName)))
+	errUpgrade := errors.New("upgrade failed")
+	registerFormatUpgrade(0, func(string, *FormatManifest) error { return errUpgrade })
+	_, err = Open(opts)
+	assert.Equal(t, errUpgrade, err)
+	_, err = ReadFormatManifest(dir)
+	assert.True(t, os.IsNotExist(err))
+	registerFormatUpgrade(0, upgradeV0)
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+	manifest, err = ReadFormatManifest(dir)
+	assert.Nil(t, err)
+
+	// 之后的版本无法打开
+	newer := *manifest
+	newer.FormatVersion = FormatVersion + 1
+	writeTestFormatManifest(t, dir, &newer)
+	_, err = Open(opts)
+	assert.True(t, errors.Is(err, ErrIncompatibleFormatVersion))
+
+	// 不支持的压缩方式
+	compressed := *manifest
+	compressed.Compression = "snappy"
+	writeTestFormatManifest(t, dir, &compressed)
+	_, err = Open(opts)
+	assert.True(t, errors.Is(err, ErrIncompatibleFormatVersion))
+
+	// 修改 DataFileSize 之后可以正常打开
+	resized := opts
+	resized.DataFileSize = 128
+	writeTestFormatManifest(t, dir, manifest)
+	db, err = Open(resized)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+	manifest, err = ReadFormatManifest(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(128), manifest.DataFileSize)
+
+	// 内存索引写入的数据不能使用 B+ 树索引打开
+	writeTestFormatManifest(t, dir, manifest)
+	bptOpts := opts
+	bptOpts.IndexType = BPlusTree
+	_, err = Open(bptOpts)
+	assert.True(t, errors.Is(err, ErrIndexTypeMismatch))
+
+	// 记录的数据文件不存在
+	assert.Nil(t, os.Remove(filepath.Join(dir, manifest.Files[0])))
+	_, err = Open(opts)
+	assert.True(t, errors.Is(err, ErrDataDirectoryCorrupted))
+}
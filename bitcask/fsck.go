@@ -0,0 +1,471 @@
+package bitcask
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"bitcask.go/data"
+	"bitcask.go/fio"
+)
+
+// FsckIssue 离线检查时发现的一个问题
+type FsckIssue struct {
+	FileName string // 出问题的文件
+	Offset   int64  // 出问题的位置，-1 表示和具体位置无关
+	Reason   string // 问题的描述
+}
+
+func (issue FsckIssue) String() string {
+	if issue.Offset < 0 {
+		return fmt.Sprintf("%s: %s", issue.FileName, issue.Reason)
+	}
+	return fmt.Sprintf("%s@%d: %s", issue.FileName, issue.Offset, issue.Reason)
+}
+
+// FsckReport 离线检查数据目录的结果
+type FsckReport struct {
+	DataFiles   int         // 检查过的数据文件数量
+	Records     int         // 数据文件中有效记录的数量
+	HintRecords int         // hint 文件中有效记录的数量
+	Issues      []FsckIssue // 发现的所有问题
+}
+
+// OK 没有发现任何问题
+func (r *FsckReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// Fsck 离线检查数据目录中所有文件的完整性，不会修改目录中的任何文件
+// 检查的内容包括：所有记录的 CRC、hint 文件中的索引是否指向有效的记录、没有完成标识的事务、残留的 merge 目录
+// 不要在数据库打开的时候对同一个目录进行检查
+func Fsck(dirPath string) (*FsckReport, error) {
+	c := &fsckChecker{
+		dirPath: dirPath,
+		report:  &FsckReport{},
+	}
+	return c.run()
+}
+
+// Repair 检查数据目录，并将所有有效的数据重写到一个新的目录 destPath 当中，原目录不会被修改
+// 损坏的记录和没有提交成功的事务都会被丢弃，注意 B+ 树的索引文件不会被拷贝，需要重新构建
+func Repair(dirPath, destPath string) (*FsckReport, error) {
+	if entries, err := os.ReadDir(destPath); err == nil && len(entries) > 0 {
+		return nil, ErrDirIsNotEmpty
+	}
+	if err := os.MkdirAll(destPath, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	c := &fsckChecker{
+		dirPath:    dirPath,
+		destPath:   destPath,
+		report:     &FsckReport{},
+		newOffsets: make(map[uint32]map[int64]int64),
+	}
+	return c.run()
+}
+
+// fsckChecker 离线检查（和修复）一个数据目录
+type fsckChecker struct {
+	dirPath   string
+	report    *FsckReport
+	dataFiles map[uint32]*data.DataFile // 只读打开的数据文件，用于校验 hint 文件中的索引
+	txns      map[uint64]*fsckTxn       // 还没有看到完成标识的事务
+
+	// 以下字段只在修复的时候使用
+	destPath   string
+	destFile   *data.DataFile             // 正在写入的新数据文件
+	newOffsets map[uint32]map[int64]int64 // 记录在新数据文件中的位置: 文件ID -> 旧偏移量 -> 新偏移量
+}
+
+// fsckTxn 缓存一个事务中的记录，等看到事务完成标识之后再写入
+type fsckTxn struct {
+	fileName string
+	offset   int64
+	num      int
+	records  []*data.LogRecord
+}
+
+func (c *fsckChecker) repairing() bool {
+	return c.destPath != ""
+}
+
+func (c *fsckChecker) addIssue(fileName string, offset int64, format string, args ...interface{}) {
+	c.report.Issues = append(c.report.Issues, FsckIssue{
+		FileName: fileName,
+		Offset:   offset,
+		Reason:   fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *fsckChecker) run() (*FsckReport, error) {
+	if _, err := os.Stat(c.dirPath); err != nil {
+		return nil, err
+	}
+
+	c.dataFiles = make(map[uint32]*data.DataFile)
+	c.txns = make(map[uint64]*fsckTxn)
+	defer func() {
+		for _, dataFile := range c.dataFiles {
+			_ = dataFile.Close()
+		}
+	}()
+
+	if err := c.checkDataFiles(); err != nil {
+		return nil, err
+	}
+	if err := c.checkHintFile(); err != nil {
+		return nil, err
+	}
+	if err := c.checkMergeFinishedFile(); err != nil {
+		return nil, err
+	}
+	if err := c.checkSeqNumFile(); err != nil {
+		return nil, err
+	}
+	if err := c.checkNamespacesFile(); err != nil {
+		return nil, err
+	}
+	c.checkMergeDir()
+
+	return c.report, nil
+}
+
+// scanFile 遍历一个文件中的所有记录，损坏的记录会被记录下来并跳过
+func (c *fsckChecker) scanFile(dataFile *data.DataFile, fileName string,
+	fn func(logRecord *data.LogRecord, offset int64, size int64) error) error {
+	fileSize, err := dataFile.IOManager.Size()
+	if err != nil {
+		return err
+	}
+
+	var offset int64 = 0
+	for {
+		logRecord, size, err := dataFile.ReadLogRecord(offset)
+		if err == io.EOF {
+			break
+		}
+		if err == data.ErrInvalidCRC {
+			c.addIssue(fileName, offset, "crc mismatch, %d bytes skipped", size)
+			offset += size
+			continue
+		}
+		if err == data.ErrIncompleteLogRecord {
+			// 长度字段损坏时后面还有完整的记录，跳过损坏的部分继续检查
+			next, err := findNextLogRecord(dataFile, offset+1)
+			if err != nil {
+				return err
+			}
+			if next < 0 {
+				c.addIssue(fileName, offset, "incomplete log record, %d bytes to the end of file", fileSize-offset)
+				return nil
+			}
+			c.addIssue(fileName, offset, "corrupted log record length, %d bytes skipped", next-offset)
+			offset = next
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := fn(logRecord, offset, size); err != nil {
+			return err
+		}
+		offset += size
+	}
+
+	if offset < fileSize {
+		c.addIssue(fileName, offset, "%d invalid bytes at the end of file", fileSize-offset)
+	}
+	return nil
+}
+
+// checkDataFiles 检查所有的数据文件
+func (c *fsckChecker) checkDataFiles() error {
+	fileIDs, err := getDataFileIDs(c.dirPath)
+	if err != nil {
+		return err
+	}
+
+	for _, fid := range fileIDs {
+		fileID := uint32(fid)
+		dataFile, err := data.OpenReadOnlyFile(data.GetDataFileName(c.dirPath, fileID), fileID)
+		if err != nil {
+			return err
+		}
+		c.dataFiles[fileID] = dataFile
+		c.report.DataFiles++
+
+		if c.repairing() {
+			if err := c.openDestFile(fileID); err != nil {
+				return err
+			}
+		}
+
+		fileName := filepath.Base(data.GetDataFileName(c.dirPath, fileID))
+		err = c.scanFile(dataFile, fileName, func(logRecord *data.LogRecord, offset int64, size int64) error {
+			c.report.Records++
+
+			_, seqNum := parseLogRecordKey(logRecord.Key)
+
+			//非事务的记录直接写入
+			if seqNum == nonTransactionSeqNum {
+				return c.writeRecord(fileID, offset, logRecord)
+			}
+
+			txn := c.txns[seqNum]
+			if txn == nil {
+				txn = &fsckTxn{fileName: fileName, offset: offset}
+				c.txns[seqNum] = txn
+			}
+
+			// 事务完成之后，将事务中的记录和完成标识一起写入
+			if logRecord.Type == data.LogRecordTxnFinished {
+				for _, record := range txn.records {
+					if err := c.writeRecord(fileID, -1, record); err != nil {
+						return err
+					}
+				}
+				delete(c.txns, seqNum)
+				return c.writeRecord(fileID, -1, logRecord)
+			}
+
+			txn.num++
+			if c.repairing() {
+				txn.records = append(txn.records, logRecord)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := c.closeDestFile(); err != nil {
+		return err
+	}
+
+	// 剩下的事务都没有完成标识
+	for seqNum, txn := range c.txns {
+		c.addIssue(txn.fileName, txn.offset,
+			"transaction %d has %d records without a finished marker", seqNum, txn.num)
+	}
+	return nil
+}
+
+// checkHintFile 检查 hint 文件，并校验其中的索引是否指向数据文件中对应 Key 的有效记录
+func (c *fsckChecker) checkHintFile() error {
+	hintFileName := filepath.Join(c.dirPath, data.HintFilename)
+	if _, err := os.Stat(hintFileName); os.IsNotExist(err) {
+		return nil
+	}
+
+	hintFile, err := data.OpenReadOnlyFile(hintFileName, 0)
+	if err != nil {
+		return err
+	}
+	defer hintFile.Close()
+
+	var destHintFile *data.DataFile
+	if c.repairing() {
+		if destHintFile, err = data.OpenHintFile(c.destPath); err != nil {
+			return err
+		}
+		defer destHintFile.Close()
+	}
+
+	err = c.scanFile(hintFile, data.HintFilename, func(logRecord *data.LogRecord, offset int64, _ int64) error {
+		pos := data.DecodeLogRecordPos(logRecord.Value)
+
+		dataFile := c.dataFiles[pos.Fid]
+		if dataFile == nil {
+			c.addIssue(data.HintFilename, offset, "key %q points to missing data file %d", logRecord.Key, pos.Fid)
+			return nil
+		}
+		record, size, err := dataFile.ReadLogRecord(pos.Offset)
+		if err != nil {
+			c.addIssue(data.HintFilename, offset, "key %q points to an invalid record in data file %d at %d",
+				logRecord.Key, pos.Fid, pos.Offset)
+			return nil
+		}
+		if realKey, _ := parseLogRecordKey(record.Key); !bytes.Equal(realKey, logRecord.Key) ||
+			record.Namespace != logRecord.Namespace || size != int64(pos.Size) {
+			c.addIssue(data.HintFilename, offset, "key %q does not match the record in data file %d at %d",
+				logRecord.Key, pos.Fid, pos.Offset)
+			return nil
+		}
+		c.report.HintRecords++
+
+		// 修复的时候需要把索引指向记录在新数据文件中的位置
+		if c.repairing() {
+			newOffset, ok := c.newOffsets[pos.Fid][pos.Offset]
+			if !ok {
+				return nil
+			}
+			return destHintFile.WriteNamespaceHintRecord(logRecord.Namespace, logRecord.Key, &data.LogRecordPos{
+				Fid:    pos.Fid,
+				Offset: newOffset,
+				Size:   pos.Size,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if destHintFile != nil {
+		return destHintFile.Sync()
+	}
+	return nil
+}
+
+// checkMergeFinishedFile 检查 merge 完成的标识文件
+func (c *fsckChecker) checkMergeFinishedFile() error {
+	return c.checkSingleRecordFile(data.MergeFinishedFilename, data.OpenMergeFinishedFile,
+		func(record *data.LogRecord) error {
+			_, err := strconv.Atoi(string(record.Value))
+			return err
+		})
+}
+
+// checkSeqNumFile 检查保存事务序列号的文件
+func (c *fsckChecker) checkSeqNumFile() error {
+	return c.checkSingleRecordFile(data.SeqNumFileName, data.OpenSeqNUmFile,
+		func(record *data.LogRecord) error {
+			_, err := strconv.ParseUint(string(record.Value), 10, 64)
+			return err
+		})
+}
+
+// checkNamespacesFile 检查 NAMESPACES 文件，修复的时候原样拷贝，否则所有命名空间中的数据都会丢失
+func (c *fsckChecker) checkNamespacesFile() error {
+	buf, err := os.ReadFile(filepath.Join(c.dirPath, NamespacesFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(buf, &namespaceRegistry{}); err != nil {
+		c.addIssue(NamespacesFileName, -1, "invalid namespaces file: %v", err)
+		return nil
+	}
+	if !c.repairing() {
+		return nil
+	}
+	return os.WriteFile(filepath.Join(c.destPath, NamespacesFileName), buf, 0644)
+}
+
+// checkSingleRecordFile 检查只保存了一条记录的文件，修复的时候原样拷贝有效的记录
+func (c *fsckChecker) checkSingleRecordFile(name string, openDest func(string) (*data.DataFile, error),
+	validate func(record *data.LogRecord) error) error {
+	fileName := filepath.Join(c.dirPath, name)
+	if _, err := os.Stat(fileName); os.IsNotExist(err) {
+		return nil
+	}
+
+	file, err := data.OpenReadOnlyFile(fileName, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	record, _, err := file.ReadLogRecord(0)
+	if err != nil {
+		c.addIssue(name, 0, "invalid record: %v", err)
+		return nil
+	}
+	if err := validate(record); err != nil {
+		c.addIssue(name, 0, "invalid value %q", record.Value)
+		return nil
+	}
+
+	if !c.repairing() {
+		return nil
+	}
+	destFile, err := openDest(c.destPath)
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	encRecord, _ := data.EncodeLogRecord(record)
+	if err := destFile.Write(encRecord); err != nil {
+		return err
+	}
+	return destFile.Sync()
+}
+
+// checkMergeDir 检查是否有残留的 merge 目录
+func (c *fsckChecker) checkMergeDir() {
+	mergePath := mergeDirPath(c.dirPath)
+	if _, err := os.Stat(mergePath); err != nil {
+		return
+	}
+
+	name := filepath.Base(mergePath)
+	if _, err := os.Stat(filepath.Join(mergePath, data.MergeFinishedFilename)); err == nil {
+		c.addIssue(name, -1, "finished merge directory is left over, it will be applied on next open")
+	} else {
+		c.addIssue(name, -1, "unfinished merge directory is left over, it will be removed on next open")
+	}
+}
+
+// openDestFile 修复时打开对应的新数据文件
+func (c *fsckChecker) openDestFile(fileID uint32) error {
+	if err := c.closeDestFile(); err != nil {
+		return err
+	}
+
+	destFile, err := data.OpenDataFile(c.destPath, fileID, fio.StandardFIO)
+	if err != nil {
+		return err
+	}
+	c.destFile = destFile
+	c.newOffsets[fileID] = make(map[int64]int64)
+	return nil
+}
+
+func (c *fsckChecker) closeDestFile() error {
+	if c.destFile == nil {
+		return nil
+	}
+	if err := c.destFile.Sync(); err != nil {
+		return err
+	}
+	if err := c.destFile.Close(); err != nil {
+		return err
+	}
+	c.destFile = nil
+	return nil
+}
+
+// writeRecord 修复时将有效的记录写入新的数据文件，offset 为记录在原数据文件中的位置(-1 表示不需要记录)
+func (c *fsckChecker) writeRecord(fileID uint32, offset int64, logRecord *data.LogRecord) error {
+	if !c.repairing() {
+		return nil
+	}
+
+	if offset >= 0 {
+		c.newOffsets[fileID][offset] = c.destFile.Offsetnow
+	}
+	// 合并操作数引用的前一条记录在新的数据文件中的位置变了，前一条记录损坏被丢弃时只保留操作数
+	if logRecord.Type == data.LogRecordMerge {
+		if prevOffset, operand := data.DecodeMergeOperand(logRecord.Value); prevOffset >= 0 {
+			newPrevOffset, ok := c.newOffsets[fileID][prevOffset]
+			if !ok {
+				newPrevOffset = -1
+			}
+			logRecord.Value = data.EncodeMergeOperand(newPrevOffset, operand)
+		}
+	}
+	encRecord, _ := data.EncodeLogRecord(logRecord)
+	return c.destFile.Write(encRecord)
+}
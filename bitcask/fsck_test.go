@@ -0,0 +1,115 @@
+package bitcask
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bitcask.go/data"
+	"bitcask.go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsck(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-fsck")
+	defer os.RemoveAll(dir)
+	opts.DirPath = dir
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put(utils.GetTestKey(10), utils.RandomValue(24)))
+	assert.Nil(t, wb.Put(utils.GetTestKey(11), utils.RandomValue(24)))
+	assert.Nil(t, wb.Commit())
+	assert.Nil(t, db.Close())
+
+	// 1.完好的数据目录
+	report, err := Fsck(dir)
+	assert.Nil(t, err)
+	assert.True(t, report.OK())
+	assert.Equal(t, 1, report.DataFiles)
+	assert.Equal(t, 13, report.Records)
+
+	// 2.中间的记录损坏，并且末尾有一个没有提交的事务
+	fileName := data.GetDataFileName(dir, 0)
+	buf, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	buf[10] ^= 0xff
+	encRecord, _ := data.EncodeLogRecord(&data.LogRecord{
+		Key:   logRecordKeyWithSeqNum(utils.GetTestKey(12), 100),
+		Value: utils.RandomValue(24),
+	})
+	buf = append(buf, encRecord...)
+	assert.Nil(t, os.WriteFile(fileName, buf, 0644))
+
+	report, err = Fsck(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(report.Issues))
+	assert.Equal(t, int64(0), report.Issues[0].Offset)
+
+	// 3.修复到新的目录
+	destDir := dir + "-repaired"
+	defer os.RemoveAll(destDir)
+	report, err = Repair(dir, destDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(report.Issues))
+
+	report, err = Fsck(destDir)
+	assert.Nil(t, err)
+	assert.True(t, report.OK())
+
+	opts.DirPath = destDir
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 11, len(db2.ListKeys()))
+	_, err = db2.Get(utils.GetTestKey(0))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db2.Get(utils.GetTestKey(11))
+	assert.Nil(t, err)
+	_, err = db2.Get(utils.GetTestKey(12))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, db2.Close())
+
+	// 修复的目标目录不为空
+	_, err = Repair(dir, destDir)
+	assert.Equal(t, ErrDirIsNotEmpty, err)
+}
+
+func TestFsck_Merge(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-fsck-merge")
+	defer os.RemoveAll(dir)
+	opts.DirPath = dir
+	opts.DataFileMergeRatio = 0
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, db.Delete(utils.GetTestKey(i)))
+	}
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+
+	// merge 完成之后还没有重启，merge 目录还在
+	report, err := Fsck(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(report.Issues))
+	assert.Equal(t, filepath.Base(mergeDirPath(dir)), report.Issues[0].FileName)
+
+	// 重启之后 merge 目录被应用，hint 文件中的索引都是有效的
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db2.Close())
+
+	report, err = Fsck(dir)
+	assert.Nil(t, err)
+	assert.True(t, report.OK())
+	assert.Equal(t, 50, report.HintRecords)
+}
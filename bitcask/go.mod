@@ -12,6 +12,7 @@ require (
 	github.com/tidwall/redcon v1.6.2
 	go.etcd.io/bbolt v1.3.10
 	golang.org/x/exp v0.0.0-20240531132922-fd00a4e0eefc
+	golang.org/x/sys v0.19.0
 )
 
 require (
@@ -24,6 +25,5 @@ require (
 	github.com/tklauser/go-sysconf v0.3.14 // indirect
 	github.com/tklauser/numcpus v0.8.0 // indirect
 	github.com/yusufpapurcu/wmi v1.2.4 // indirect
-	golang.org/x/sys v0.19.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 
 	bitcask "bitcask.go"
 )
@@ -32,12 +33,18 @@ func main() {
 	http.HandleFunc("/bitcask/put", handlePut)
 	// GET
 	http.HandleFunc("/bitcask/get", handleGet)
+	// MGET
+	http.HandleFunc("/bitcask/mget", handleMultiGet)
 	// DELETE
 	http.HandleFunc("/bitcask/delete", handleDelete)
 	// LISTKEYS
 	http.HandleFunc("/bitcask/listkeys", handleListKeys)
 	// STAT
 	http.HandleFunc("/bitcask/listkeys/statinfo", handleStat)
+	// EXPORT
+	http.HandleFunc("/bitcask/export", handleExport)
+	// IMPORT
+	http.HandleFunc("/bitcask/import", handleImport)
 
 	// 启动 HTTP 服务
 	_ = http.ListenAndServe("localhost:8080", nil)
@@ -60,17 +67,63 @@ func handlePut(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	// 遍历处理解析到的参数
+	// 将解析到的参数在一次批量写入中完成
+	keys := make([][]byte, 0, len(data))
+	values := make([][]byte, 0, len(data))
 	for key, value := range data {
-		if err := db.Put([]byte(key), []byte(value)); err != nil {
-			//这里出错的话就是程序内部出错了，对用户显示内部错误
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-			log.Printf("failed to put value in database,err:%#v\n", err)
+		keys = append(keys, []byte(key))
+		values = append(values, []byte(value))
+	}
+	if err := db.MultiPut(keys, values); err != nil {
+		if err == bitcask.ErrKeyIsEmpty {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
 			return
 		}
+		//这里出错的话就是程序内部出错了，对用户显示内部错误
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		log.Printf("failed to put value in database,err:%#v\n", err)
+		return
 	}
 }
 
+// handleMultiGet HTTP 批量读取，请求体为 Key 的 JSON 数组，返回 Key 到 Value 的 JSON 对象（不存在的 Key 为 null）
+func handleMultiGet(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var keys []string
+	if err := json.NewDecoder(request.Body).Decode(&keys); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	byteKeys := make([][]byte, len(keys))
+	for i, key := range keys {
+		byteKeys[i] = []byte(key)
+	}
+	values, errs := db.MultiGet(byteKeys)
+
+	res := make(map[string]*string, len(keys))
+	for i, key := range keys {
+		if errs[i] != nil && errs[i] != bitcask.ErrKeyNotFound && errs[i] != bitcask.ErrKeyIsEmpty {
+			http.Error(writer, errs[i].Error(), http.StatusInternalServerError)
+			log.Printf("failed to get value from database,err:%#v\n", errs[i])
+			return
+		}
+		if errs[i] == nil {
+			value := string(values[i])
+			res[key] = &value
+		} else {
+			res[key] = nil
+		}
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(writer).Encode(res)
+}
+
 // HTTP GET 方法
 func handleGet(writer http.ResponseWriter, request *http.Request) {
 	//如果不是GET类型直接返回错误，不执行请求
@@ -149,6 +202,82 @@ func handleStat(writer http.ResponseWriter, request *http.Request) {
 	_ = json.NewEncoder(writer).Encode(statinfo)
 }
 
+// handleExport 以流的方式导出数据，参数 format（jsonl、csv、binary）和 prefix
+func handleExport(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format, err := parseExportFormat(request)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	options := bitcask.DefaultIteratorOptions
+	options.Prefix = []byte(request.URL.Query().Get("prefix"))
+	writer.Header().Set("Content-Type", "application/octet-stream")
+	//数据已经开始写入响应，出错时只能记录日志
+	if err := db.Export(writer, format, options); err != nil {
+		log.Printf("failed to export data,err:%#v\n", err)
+	}
+}
+
+// handleImport 以流的方式导入请求体中的数据，参数 format、overwrite 和 batch_size
+func handleImport(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format, err := parseExportFormat(request)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	options := bitcask.DefaultImportOptions
+	query := request.URL.Query()
+	if overwrite := query.Get("overwrite"); overwrite != "" {
+		if options.Overwrite, err = strconv.ParseBool(overwrite); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if batchSize := query.Get("batch_size"); batchSize != "" {
+		size, err := strconv.ParseUint(batchSize, 10, 32)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		options.BatchSize = uint(size)
+	}
+
+	imported, err := db.Import(request.Body, format, options)
+	if err == bitcask.ErrInvalidExportData {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		log.Printf("failed to import data,err:%#v\n", err)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(writer).Encode(map[string]int{"imported": imported})
+}
+
+// parseExportFormat 解析请求中的 format 参数，默认为 jsonl
+func parseExportFormat(request *http.Request) (bitcask.ExportFormat, error) {
+	format := request.URL.Query().Get("format")
+	if format == "" {
+		return bitcask.ExportJSONL, nil
+	}
+	return bitcask.ParseExportFormat(format)
+}
+
 
 
 
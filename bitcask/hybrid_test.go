@@ -0,0 +1,75 @@
+package bitcask
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bitcask.go/index"
+	"bitcask.go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_HybridIndex(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-hybrid")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	opts.IndexType = Hybrid
+	opts.IndexMemoryBudget = 16 * 1024
+	opts.DataFileMergeRatio = 0
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	for i := 0; i < 2000; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(32)))
+	}
+	for i := 0; i < 2000; i += 4 {
+		assert.Nil(t, db.Delete(utils.GetTestKey(i)))
+	}
+	value, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	keys := db.ListKeys()
+	assert.Equal(t, 1500, len(keys))
+	for i := 1; i < len(keys); i++ {
+		assert.Less(t, string(keys[i-1]), string(keys[i]))
+	}
+
+	// 关闭时删除冷数据文件，重新打开之后从数据文件重建
+	assert.Nil(t, db.Close())
+	_, err = os.Stat(filepath.Join(dir, index.HybridIndexFileName))
+	assert.True(t, os.IsNotExist(err))
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+	reopened, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, value, reopened)
+	assert.Equal(t, keys, db.ListKeys())
+	assert.Nil(t, db.Merge())
+	assert.Equal(t, uint(1500), db.Stat().KeyNum)
+
+	opts.IndexMemoryBudget = 0
+	_, err = Open(opts)
+	assert.Equal(t, ErrInvalidIndexMemoryBudget, err)
+}
+
+func TestDB_HybridIndexOpenError(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-hybrid")
+	defer os.RemoveAll(dir)
+	opts.DirPath = dir
+	opts.IndexType = Hybrid
+
+	// 冷数据文件的位置被一个非空的目录占用，打开时返回错误而不是 panic
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, index.HybridIndexFileName, "sub"), os.ModePerm))
+	_, err := Open(opts)
+	assert.NotNil(t, err)
+
+	// 释放了文件锁，可以再次打开
+	assert.Nil(t, os.RemoveAll(filepath.Join(dir, index.HybridIndexFileName)))
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+}
@@ -1,7 +1,6 @@
 package index
 
 import (
-	"bytes"
 	"sort"
 	"sync"
 
@@ -16,12 +15,19 @@ type AdaptiveRadixTree struct {
 	tree goart.Tree
 
 	lock *sync.RWMutex
+	cmp  Comparator // 迭代时 Key 的顺序，为空时按照字节序（ART 本身只能按照字节序保存）
 }
 
 func NewART() *AdaptiveRadixTree {
+	return NewARTWithComparator(nil)
+}
+
+// NewARTWithComparator 初始化迭代时按照 cmp 排序的 ART 索引
+func NewARTWithComparator(cmp Comparator) *AdaptiveRadixTree {
 	return &AdaptiveRadixTree{
 		tree: goart.New(),
 		lock: new(sync.RWMutex),
+		cmp:  cmp,
 	}
 }
 
@@ -86,7 +92,35 @@ func (art *AdaptiveRadixTree) Iterator(reverse bool) Iterator {
 	art.lock.RLock()
 	defer art.lock.RUnlock()
 
-	return newArtIterator(art.tree, reverse)
+	return newArtIterator(art.tree, reverse, art.cmp)
+}
+
+// PutBatch 只加一次锁插入所有的 Key
+func (art *AdaptiveRadixTree) PutBatch(keys [][]byte, positions []*data.LogRecordPos) []*data.LogRecordPos {
+	oldPositions := make([]*data.LogRecordPos, len(keys))
+
+	art.lock.Lock()
+	defer art.lock.Unlock()
+	for i, key := range keys {
+		if oldValue, _ := art.tree.Insert(key, positions[i]); oldValue != nil {
+			oldPositions[i] = oldValue.(*data.LogRecordPos)
+		}
+	}
+	return oldPositions
+}
+
+// DeleteBatch 只加一次锁删除所有的 Key
+func (art *AdaptiveRadixTree) DeleteBatch(keys [][]byte) []*data.LogRecordPos {
+	oldPositions := make([]*data.LogRecordPos, len(keys))
+
+	art.lock.Lock()
+	defer art.lock.Unlock()
+	for i, key := range keys {
+		if oldValue, _ := art.tree.Delete(key); oldValue != nil {
+			oldPositions[i] = oldValue.(*data.LogRecordPos)
+		}
+	}
+	return oldPositions
 }
 
 func (art *AdaptiveRadixTree) Close() error {
@@ -98,11 +132,11 @@ type artIterator struct {
 	curindex int     // 当前遍历到哪个位置了
 	reverse  bool    // 是否反向遍历，默认为false
 	values   []*Item // 存放从索引中拿出来的对应的Key和索引信息
-
+	cmp      Comparator
 }
 
 // newArtIterator 实例化索引迭代器
-func newArtIterator(tree goart.Tree, reverse bool) *artIterator {
+func newArtIterator(tree goart.Tree, reverse bool, cmp Comparator) *artIterator {
 	var index int // 数组的索引
 
 	if reverse {
@@ -130,10 +164,21 @@ func newArtIterator(tree goart.Tree, reverse bool) *artIterator {
 	//完整遍历数据
 	tree.ForEach(saveValues)
 
+	//ART 按照字节序遍历，使用自定义的比较函数时需要重新排序
+	if cmp != nil {
+		sort.Slice(values, func(i, j int) bool {
+			if reverse {
+				return cmp(values[i].key, values[j].key) > 0
+			}
+			return cmp(values[i].key, values[j].key) < 0
+		})
+	}
+
 	return &artIterator{
 		curindex: 0,
 		reverse:  reverse,
 		values:   values,
+		cmp:      cmp,
 	}
 }
 
@@ -161,11 +206,11 @@ func (ai *artIterator) Seek(key []byte) {
 	if ai.reverse { //逆序实现
 		// ai.curindex 每次都在查找到的Index处，然后从这个位置开始遍历
 		ai.curindex = sort.Search(len(ai.values), func(i int) bool {
-			return bytes.Compare(ai.values[i].key, key) <= 0
+			return ai.cmp.compare(ai.values[i].key, key) <= 0
 		})
 	} else { //正序则实现原理相反
 		ai.curindex = sort.Search(len(ai.values), func(i int) bool {
-			return bytes.Compare(ai.values[i].key, key) >= 0
+			return ai.cmp.compare(ai.values[i].key, key) >= 0
 		})
 	}
 }
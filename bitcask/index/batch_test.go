@@ -0,0 +1,65 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"bitcask.go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexer_Batch(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-index-batch")
+	defer os.RemoveAll(dir)
+
+	sharded, err := NewShardedIndex(BTRee, 4, DefaultIndexerOptions)
+	assert.Nil(t, err)
+	hybrid, err := NewIndexerWithOptions(Hybrid, IndexerOptions{DirPath: dir, MemoryBudget: 4 * 1024}) // 没有实现 BatchIndexer，逐个更新
+	assert.Nil(t, err)
+	indexers := map[string]Indexer{
+		"btree":   NewBtree(),
+		"art":     NewART(),
+		"hash":    NewHashIndex(),
+		"compact": NewCompactIndex(true, nil),
+		"sharded": sharded,
+		"bptree":  NewBPlusTree(dir, false),
+		"hybrid":  hybrid,
+	}
+	for name, indexer := range indexers {
+		t.Run(name, func(t *testing.T) {
+			defer indexer.Close()
+
+			n := 1000
+			keys := make([][]byte, n)
+			positions := make([]*data.LogRecordPos, n)
+			for i := range keys {
+				keys[i] = []byte(fmt.Sprintf("key-%d", i))
+				positions[i] = &data.LogRecordPos{Fid: 1, Offset: int64(i), Size: 10}
+			}
+			indexer.Put(keys[0], &data.LogRecordPos{Fid: 0, Offset: 100})
+
+			oldPositions := PutBatch(indexer, keys, positions)
+			assert.Equal(t, n, len(oldPositions))
+			assert.Equal(t, int64(100), oldPositions[0].Offset)
+			for i := 1; i < n; i++ {
+				assert.Nil(t, oldPositions[i])
+			}
+			assert.Equal(t, n, indexer.Size())
+			assert.Equal(t, int64(n-1), indexer.Get(keys[n-1]).Offset)
+
+			// 删除一半的 Key，再加上一个不存在的 Key
+			deleteKeys := append(keys[:n/2:n/2], []byte("not exist"))
+			oldPositions = DeleteBatch(indexer, deleteKeys)
+			for i := 0; i < n/2; i++ {
+				assert.Equal(t, int64(i), oldPositions[i].Offset)
+			}
+			assert.Nil(t, oldPositions[n/2])
+			assert.Equal(t, n/2, indexer.Size())
+			assert.Nil(t, indexer.Get(keys[0]))
+
+			assert.Nil(t, PutBatch(indexer, nil, nil))
+			assert.Nil(t, DeleteBatch(indexer, nil))
+		})
+	}
+}
@@ -7,7 +7,7 @@ import (
 	"go.etcd.io/bbolt"
 )
 
-const bptreeIndexFileName = "bptree-index"
+const BPlusTreeIndexFileName = "bptree-index"
 
 var indexBucketName = []byte("bitcask-index")
 
@@ -25,7 +25,7 @@ func NewBPlusTree(dirPath string, syncWrites bool) *BPlusTree {
 	options.NoSync = !syncWrites //取反操作，保持一致
 
 	//打开实例
-	bptree, err := bbolt.Open(filepath.Join(dirPath, bptreeIndexFileName), 0644, options) // 0644:（用户读写，其他用户只读）
+	bptree, err := bbolt.Open(filepath.Join(dirPath, BPlusTreeIndexFileName), 0644, options) // 0644:（用户读写，其他用户只读）
 	if err != nil {
 		panic("failed to open bptree")
 	}
@@ -123,8 +123,64 @@ func (bpt *BPlusTree) Size() int {
 	return size
 }
 
+// PutBatch 在同一个事务中写入所有的 Key，开启了同步写入时整个批次只需要持久化一次
+func (bpt *BPlusTree) PutBatch(keys [][]byte, positions []*data.LogRecordPos) []*data.LogRecordPos {
+	oldPositions := make([]*data.LogRecordPos, len(keys))
+
+	if err := bpt.tree.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(indexBucketName)
+		for i, key := range keys {
+			// bbolt 返回的数据只在事务中有效，需要在事务中解码
+			if oldValue := bucket.Get(key); len(oldValue) != 0 {
+				oldPositions[i] = data.DecodeLogRecordPos(oldValue)
+			}
+			if err := bucket.Put(key, data.EncodeLogRecordPos(positions[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		panic("failed to put values in bptree")
+	}
+	return oldPositions
+}
+
+// DeleteBatch 在同一个事务中删除所有的 Key
+func (bpt *BPlusTree) DeleteBatch(keys [][]byte) []*data.LogRecordPos {
+	oldPositions := make([]*data.LogRecordPos, len(keys))
+
+	if err := bpt.tree.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(indexBucketName)
+		for i, key := range keys {
+			oldValue := bucket.Get(key)
+			if len(oldValue) == 0 {
+				continue
+			}
+			oldPositions[i] = data.DecodeLogRecordPos(oldValue)
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		panic("failed to delete values in bptree")
+	}
+	return oldPositions
+}
+
 func (bpt *BPlusTree) Close() error {
-	return bpt.Close()
+	return bpt.tree.Close()
+}
+
+// Sync 将索引文件持久化到磁盘，关闭了同步写入时使用
+func (bpt *BPlusTree) Sync() error {
+	return bpt.tree.Sync()
+}
+
+// Snapshot 开启一个只读事务作为当前索引的一致性快照，可以在不阻塞写入的情况下拷贝索引
+// 使用完之后需要调用 Rollback 释放
+func (bpt *BPlusTree) Snapshot() (*bbolt.Tx, error) {
+	return bpt.tree.Begin(false)
 }
 
 // Iterator 返回迭代器
@@ -1,7 +1,6 @@
 package index
 
 import (
-	"bytes"
 	"sort"
 	"sync"
 
@@ -11,15 +10,26 @@ import (
 
 // 引用了 google 的 Btree
 type Btree struct {
-	tree *btree.BTree
+	tree *btree.BTreeG[*Item]
 	lock *sync.RWMutex //加锁，避免用户多线程访问时冲突
+	cmp  Comparator    //Key 的比较函数，为空时按照字节序
 }
 
 // NewBtree 初始化 Btree 索引结构
 func NewBtree() *Btree {
+	return NewBtreeWithComparator(nil)
+}
+
+// NewBtreeWithComparator 初始化按照 cmp 排序的 Btree 索引结构
+func NewBtreeWithComparator(cmp Comparator) *Btree {
+	// 比较函数整棵树只保存一份，不需要放在每个 Item 中
+	less := func(a, b *Item) bool {
+		return cmp.compare(a.key, b.key) < 0
+	}
 	return &Btree{
-		tree: btree.New(32), //控制叶子节点数量（可以让用户进行选择）
+		tree: btree.NewG(32, less), //控制叶子节点数量（可以让用户进行选择）
 		lock: new(sync.RWMutex),
+		cmp:  cmp,
 	}
 }
 
@@ -28,29 +38,33 @@ func (bt *Btree) Put(key []byte, pos *data.LogRecordPos) *data.LogRecordPos {
 
 	bt.lock.Lock() //进行存储操作之前加锁
 
-	oldItem := bt.tree.ReplaceOrInsert(it)
+	oldItem, ok := bt.tree.ReplaceOrInsert(it)
 
 	bt.lock.Unlock() //解锁
 
-	if oldItem == nil {
+	if !ok {
 		return nil
 	}
 
-	return oldItem.(*Item).pos
+	return oldItem.pos
 }
 
 func (bt *Btree) Get(key []byte) *data.LogRecordPos {
 	it := &Item{key: key}
-	btreeItem := bt.tree.Get(it)
+	bt.lock.RLock() //并发写入时 google btree 的读取也需要加锁
+	btreeItem, ok := bt.tree.Get(it)
+	bt.lock.RUnlock()
 	//如果拿到的为空，直接返回:
-	if btreeItem == nil {
+	if !ok {
 		return nil
 	}
-	return btreeItem.(*Item).pos //转换为对应类型的数据
+	return btreeItem.pos
 }
 
 func (bt *Btree) Size() int {
 	//使用Btree中的Len函数
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
 	return bt.tree.Len()
 }
 
@@ -65,21 +79,49 @@ func (bt *Btree) Iterator(reverse bool) Iterator {
 	// 加锁，避免用户多线程访问时冲突
 	bt.lock.RLock()
 	defer bt.lock.RUnlock() // 读解锁，允许多个 goroutine 同时进行读取操作,但进行写入操作时会阻塞其他读写操作
-	return newBtreeIterator(bt.tree, reverse)
+	return newBtreeIterator(bt.tree, reverse, bt.cmp)
 }
 
 func (bt *Btree) Delete(key []byte) (*data.LogRecordPos, bool) {
 	it := &Item{key: key}
 	bt.lock.Lock() //进行存储操作之前加锁
-	oldItem := bt.tree.Delete(it)
+	oldItem, ok := bt.tree.Delete(it)
 	bt.lock.Unlock() //释放
 
 	//为空说明我们删除操作无效，反之成功
-	if oldItem == nil {
+	if !ok {
 		return nil, false
 	}
 
-	return oldItem.(*Item).pos, true
+	return oldItem.pos, true
+}
+
+// PutBatch 只加一次锁插入所有的 Key
+func (bt *Btree) PutBatch(keys [][]byte, positions []*data.LogRecordPos) []*data.LogRecordPos {
+	oldPositions := make([]*data.LogRecordPos, len(keys))
+
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
+	for i, key := range keys {
+		if oldItem, ok := bt.tree.ReplaceOrInsert(&Item{key: key, pos: positions[i]}); ok {
+			oldPositions[i] = oldItem.pos
+		}
+	}
+	return oldPositions
+}
+
+// DeleteBatch 只加一次锁删除所有的 Key
+func (bt *Btree) DeleteBatch(keys [][]byte) []*data.LogRecordPos {
+	oldPositions := make([]*data.LogRecordPos, len(keys))
+
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
+	for i, key := range keys {
+		if oldItem, ok := bt.tree.Delete(&Item{key: key}); ok {
+			oldPositions[i] = oldItem.pos
+		}
+	}
+	return oldPositions
 }
 
 func (bt *Btree) Close() error {
@@ -91,17 +133,17 @@ type btreeIterator struct {
 	curindex int     // 当前遍历到哪个位置了
 	reverse  bool    // 是否反向遍历，默认为false
 	values   []*Item // 存放从索引中拿出来的对应的Key和索引信息
-
+	cmp      Comparator
 }
 
 // newBtreeIterator 实例化索引迭代器
-func newBtreeIterator(tree *btree.BTree, reverse bool) *btreeIterator {
+func newBtreeIterator(tree *btree.BTreeG[*Item], reverse bool, cmp Comparator) *btreeIterator {
 	var index int // 数组的索引
 	values := make([]*Item, tree.Len())
 
 	//将所有数据存放到 savevalues 数组中
-	savevalues := func(bti btree.Item) bool {
-		values[index] = bti.(*Item)
+	savevalues := func(bti *Item) bool {
+		values[index] = bti
 		index++
 		return true //表示一直向下遍历
 	}
@@ -118,6 +160,7 @@ func newBtreeIterator(tree *btree.BTree, reverse bool) *btreeIterator {
 		curindex: 0,
 		reverse:  reverse,
 		values:   values,
+		cmp:      cmp,
 	}
 }
 
@@ -145,11 +188,11 @@ func (bti *btreeIterator) Seek(key []byte) {
 	if bti.reverse { //逆序实现
 		// bti.curindex 每次都在查找到的Index处，然后从这个位置开始遍历
 		bti.curindex = sort.Search(len(bti.values), func(i int) bool {
-			return bytes.Compare(bti.values[i].key, key) <= 0
+			return bti.cmp.compare(bti.values[i].key, key) <= 0
 		})
 	} else { //正序则实现原理相反
 		bti.curindex = sort.Search(len(bti.values), func(i int) bool {
-			return bytes.Compare(bti.values[i].key, key) >= 0
+			return bti.cmp.compare(bti.values[i].key, key) >= 0
 		})
 	}
 }
@@ -0,0 +1,449 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"sync"
+
+	"bitcask.go/data"
+)
+
+// compactBlockEntries 每个块最多保存的 Key 数量，超过之后分裂成两个块
+const compactBlockEntries = 64
+
+// CompactIndex 紧凑编码的内存索引：所有的 Key 按照顺序分成若干个块，每个块是一段连续的字节，
+// 依次保存每个 Key（开启前缀压缩时只保存和前一个 Key 不同的部分）以及 varint 编码的 Fid、Offset、Size
+// 没有 BTree/ART 中每个 Key 单独分配的节点、Key 切片和 *data.LogRecordPos，每个 Key 只有十几个字节的额外开销，
+// GC 需要扫描的对象也只有每个块一个
+// 修改块时先解码到复用的缓冲区中，修改之后重新编码写回原来的空间；迭代器共享创建时所有的块，之后修改这些块时先复制（写时复制）
+type CompactIndex struct {
+	lock   *sync.RWMutex
+	blocks []*compactBlock
+	size   int
+	prefix bool       // 是否对相邻的 Key 使用前缀压缩
+	cmp    Comparator // Key 的比较函数，为空时按照字节序
+	gen    uint64     // 每次创建迭代器时递增，gen 小于它的块被迭代器共享着，不能原地修改
+
+	// 修改块时复用的缓冲区，只在持有写锁时使用
+	entries []compactEntry
+	keyBuf  []byte
+	encBuf  []byte
+	cur     []byte
+}
+
+// compactBlock 一个编码之后的块
+type compactBlock struct {
+	first []byte // 块中的第一个 Key，只会整体替换，不会原地修改
+	data  []byte
+	count int
+	gen   uint64
+}
+
+// compactEntry 解码到缓冲区中的一条记录，Key 保存在 keyBuf[start:end] 中，off 是它在块中编码之后的位置
+type compactEntry struct {
+	start, end int
+	off        int
+	pos        data.LogRecordPos
+}
+
+// NewCompactIndex 初始化紧凑编码的索引，prefix 决定是否使用前缀压缩（Key 有较长的公共前缀时效果明显）
+func NewCompactIndex(prefix bool, cmp Comparator) *CompactIndex {
+	return &CompactIndex{
+		lock:   new(sync.RWMutex),
+		prefix: prefix,
+		cmp:    cmp,
+	}
+}
+
+// appendCompactEntry 将一条记录编码到 dst 的末尾，prev 为块中的前一个 Key
+func appendCompactEntry(dst, prev, key []byte, pos *data.LogRecordPos, prefix bool) []byte {
+	var shared int
+	if prefix {
+		for shared < len(prev) && shared < len(key) && prev[shared] == key[shared] {
+			shared++
+		}
+	}
+	dst = binary.AppendUvarint(dst, uint64(shared))
+	dst = binary.AppendUvarint(dst, uint64(len(key)-shared))
+	dst = append(dst, key[shared:]...)
+	dst = binary.AppendUvarint(dst, uint64(pos.Fid))
+	dst = binary.AppendUvarint(dst, uint64(pos.Offset))
+	return binary.AppendUvarint(dst, uint64(pos.Size))
+}
+
+// decodeCompactEntry 解码 b 开头的一条记录，把完整的 Key 写入 prev 共享的前缀之后（会覆盖 prev 后面的内容），
+// 返回 Key、位置信息和这条记录占用的字节数
+func decodeCompactEntry(b, prev []byte) ([]byte, data.LogRecordPos, int) {
+	shared, n := binary.Uvarint(b)
+	suffixLen, i := binary.Uvarint(b[n:])
+	n += i
+	key := append(prev[:shared], b[n:n+int(suffixLen)]...)
+	n += int(suffixLen)
+
+	fid, i := binary.Uvarint(b[n:])
+	n += i
+	offset, i := binary.Uvarint(b[n:])
+	n += i
+	size, i := binary.Uvarint(b[n:])
+	n += i
+	return key, data.LogRecordPos{Fid: uint32(fid), Offset: int64(offset), Size: uint32(size)}, n
+}
+
+// findCompactBlock Key 所在的块：最后一个第一个 Key 小于等于 key 的块，key 比所有的 Key 都小时返回 0
+func findCompactBlock(blocks []*compactBlock, key []byte, cmp Comparator) int {
+	i := sort.Search(len(blocks), func(i int) bool {
+		return cmp.compare(blocks[i].first, key) > 0
+	})
+	if i == 0 {
+		return 0
+	}
+	return i - 1
+}
+
+// load 将块中的记录解码追加到 entries 和 keyBuf 中，调用时必须持有写锁
+func (ci *CompactIndex) load(b *compactBlock) {
+	ci.cur = ci.cur[:0]
+	for off := 0; off < len(b.data); {
+		var pos data.LogRecordPos
+		var n int
+		start := len(ci.keyBuf)
+		ci.cur, pos, n = decodeCompactEntry(b.data[off:], ci.cur)
+		ci.keyBuf = append(ci.keyBuf, ci.cur...)
+		ci.entries = append(ci.entries, compactEntry{start: start, end: len(ci.keyBuf), off: off, pos: pos})
+		off += n
+	}
+}
+
+// offsetOf 块中第 i 条记录编码之后的位置，i 等于记录数量时为块的末尾，调用时必须持有写锁
+func (ci *CompactIndex) offsetOf(b *compactBlock, i int) int {
+	if i < len(ci.entries) {
+		return ci.entries[i].off
+	}
+	return len(b.data)
+}
+
+func (ci *CompactIndex) keyOf(e *compactEntry) []byte {
+	return ci.keyBuf[e.start:e.end]
+}
+
+// search 在解码之后的记录中二分查找 key，返回第一个大于等于 key 的位置
+func (ci *CompactIndex) search(key []byte) (int, bool) {
+	i := sort.Search(len(ci.entries), func(i int) bool {
+		return ci.cmp.compare(ci.keyOf(&ci.entries[i]), key) >= 0
+	})
+	return i, i < len(ci.entries) && ci.cmp.compare(ci.keyOf(&ci.entries[i]), key) == 0
+}
+
+// store 将 entries 写入块中：entries[:from] 和块中前 keep 个字节的编码相同，保留不动，只重新编码之后的记录
+// 块没有被迭代器共享并且空间足够时原地写入，否则分配新的空间
+func (ci *CompactIndex) store(b *compactBlock, entries []compactEntry, from, keep int) {
+	ci.encBuf = ci.encBuf[:0]
+	var prev []byte
+	if from > 0 {
+		prev = ci.keyOf(&entries[from-1])
+	}
+	for i := from; i < len(entries); i++ {
+		key := ci.keyOf(&entries[i])
+		ci.encBuf = appendCompactEntry(ci.encBuf, prev, key, &entries[i].pos, ci.prefix)
+		prev = key
+	}
+
+	if size := keep + len(ci.encBuf); b.gen == ci.gen && cap(b.data) >= size {
+		b.data = append(b.data[:keep], ci.encBuf...)
+	} else {
+		// 预留一些空间，之后的写入大多可以原地完成
+		buf := make([]byte, 0, size+size/4)
+		buf = append(buf, b.data[:keep]...)
+		b.data = append(buf, ci.encBuf...)
+		b.gen = ci.gen
+	}
+	if first := ci.keyOf(&entries[0]); b.count == 0 || !bytes.Equal(b.first, first) {
+		b.first = append([]byte{}, first...)
+	}
+	b.count = len(entries)
+}
+
+func (ci *CompactIndex) Put(key []byte, pos *data.LogRecordPos) *data.LogRecordPos {
+	ci.lock.Lock()
+	defer ci.lock.Unlock()
+	return ci.put(key, pos)
+}
+
+// PutBatch 只加一次锁插入所有的 Key
+func (ci *CompactIndex) PutBatch(keys [][]byte, positions []*data.LogRecordPos) []*data.LogRecordPos {
+	oldPositions := make([]*data.LogRecordPos, len(keys))
+
+	ci.lock.Lock()
+	defer ci.lock.Unlock()
+	for i, key := range keys {
+		oldPositions[i] = ci.put(key, positions[i])
+	}
+	return oldPositions
+}
+
+// put 插入或者更新 Key，调用时必须持有写锁
+func (ci *CompactIndex) put(key []byte, pos *data.LogRecordPos) *data.LogRecordPos {
+	ci.entries, ci.keyBuf = ci.entries[:0], ci.keyBuf[:0]
+	bi := findCompactBlock(ci.blocks, key, ci.cmp)
+	if len(ci.blocks) == 0 {
+		ci.blocks = append(ci.blocks, &compactBlock{gen: ci.gen})
+	} else {
+		ci.load(ci.blocks[bi])
+	}
+
+	b := ci.blocks[bi]
+	i, found := ci.search(key)
+	keep := ci.offsetOf(b, i)
+	if found {
+		oldPos := ci.entries[i].pos
+		ci.entries[i].pos = *pos
+		ci.store(b, ci.entries, i, keep)
+		return &oldPos
+	}
+
+	start := len(ci.keyBuf)
+	ci.keyBuf = append(ci.keyBuf, key...)
+	ci.entries = append(ci.entries, compactEntry{})
+	copy(ci.entries[i+1:], ci.entries[i:])
+	ci.entries[i] = compactEntry{start: start, end: len(ci.keyBuf), pos: *pos}
+	ci.size++
+
+	if len(ci.entries) <= compactBlockEntries {
+		ci.store(b, ci.entries, i, keep)
+		return nil
+	}
+
+	// 块中的 Key 太多了，分裂成两个块，前一半中插入位置之前的记录保持不变
+	half := len(ci.entries) / 2
+	next := &compactBlock{gen: ci.gen}
+	ci.store(next, ci.entries[half:], 0, 0)
+	if i <= half {
+		ci.store(b, ci.entries[:half], i, keep)
+	} else {
+		ci.store(b, ci.entries[:half], half, ci.entries[half].off)
+	}
+	ci.blocks = append(ci.blocks, nil)
+	copy(ci.blocks[bi+2:], ci.blocks[bi+1:])
+	ci.blocks[bi+1] = next
+	return nil
+}
+
+func (ci *CompactIndex) Get(key []byte) *data.LogRecordPos {
+	ci.lock.RLock()
+	defer ci.lock.RUnlock()
+
+	if len(ci.blocks) == 0 {
+		return nil
+	}
+
+	// 块中的 Key 是有序的，顺序解码直到遇到大于等于 key 的 Key
+	b := ci.blocks[findCompactBlock(ci.blocks, key, ci.cmp)]
+	var cur []byte
+	for off := 0; off < len(b.data); {
+		k, pos, n := decodeCompactEntry(b.data[off:], cur)
+		c := ci.cmp.compare(k, key)
+		if c == 0 {
+			return &pos
+		}
+		if c > 0 {
+			return nil
+		}
+		cur = k
+		off += n
+	}
+	return nil
+}
+
+// Delete 删除之后块变空时直接移除，Key 太少时和后一个块合并，避免产生大量很小的块
+func (ci *CompactIndex) Delete(key []byte) (*data.LogRecordPos, bool) {
+	ci.lock.Lock()
+	defer ci.lock.Unlock()
+	return ci.delete(key)
+}
+
+// DeleteBatch 只加一次锁删除所有的 Key
+func (ci *CompactIndex) DeleteBatch(keys [][]byte) []*data.LogRecordPos {
+	oldPositions := make([]*data.LogRecordPos, len(keys))
+
+	ci.lock.Lock()
+	defer ci.lock.Unlock()
+	for i, key := range keys {
+		oldPositions[i], _ = ci.delete(key)
+	}
+	return oldPositions
+}
+
+// delete 删除 Key，调用时必须持有写锁
+func (ci *CompactIndex) delete(key []byte) (*data.LogRecordPos, bool) {
+	if len(ci.blocks) == 0 {
+		return nil, false
+	}
+
+	ci.entries, ci.keyBuf = ci.entries[:0], ci.keyBuf[:0]
+	bi := findCompactBlock(ci.blocks, key, ci.cmp)
+	b := ci.blocks[bi]
+	ci.load(b)
+	i, found := ci.search(key)
+	if !found {
+		return nil, false
+	}
+	oldPos, keep := ci.entries[i].pos, ci.entries[i].off
+	ci.entries = append(ci.entries[:i], ci.entries[i+1:]...)
+	ci.size--
+
+	if next := bi + 1; len(ci.entries) < compactBlockEntries/4 && next < len(ci.blocks) &&
+		len(ci.entries)+ci.blocks[next].count <= compactBlockEntries {
+		ci.load(ci.blocks[next])
+		ci.blocks = append(ci.blocks[:next], ci.blocks[next+1:]...)
+	}
+	if len(ci.entries) == 0 {
+		ci.blocks = append(ci.blocks[:bi], ci.blocks[bi+1:]...)
+	} else {
+		ci.store(b, ci.entries, i, keep)
+	}
+	return &oldPos, true
+}
+
+func (ci *CompactIndex) Size() int {
+	ci.lock.RLock()
+	defer ci.lock.RUnlock()
+	return ci.size
+}
+
+// Iterator 迭代器共享当前所有的块（之后对这些块的修改都会先复制），遍历时再逐个块解码
+func (ci *CompactIndex) Iterator(reverse bool) Iterator {
+	ci.lock.Lock()
+	defer ci.lock.Unlock()
+
+	blocks := make([]compactBlock, len(ci.blocks))
+	for i, b := range ci.blocks {
+		blocks[i] = *b
+	}
+	ci.gen++
+
+	it := &compactIterator{blocks: blocks, reverse: reverse, cmp: ci.cmp, loaded: -1}
+	it.Rewind()
+	return it
+}
+
+func (ci *CompactIndex) Close() error {
+	return nil
+}
+
+// compactIterator 紧凑索引的迭代器，只解码当前所在的块
+type compactIterator struct {
+	blocks  []compactBlock
+	reverse bool
+	cmp     Comparator
+
+	bi     int // 当前所在的块，超出范围时表示遍历结束
+	ei     int // 当前块中的第几条记录
+	loaded int // keys 和 positions 是哪个块解码出来的
+	keys   [][]byte
+	values []data.LogRecordPos
+}
+
+// load 解码第 bi 个块，每个 Key 都是新分配的，迭代器移动之后仍然可以使用
+func (it *compactIterator) load(bi int) {
+	it.bi = bi
+	if bi < 0 || bi >= len(it.blocks) || it.loaded == bi {
+		return
+	}
+
+	b := &it.blocks[bi]
+	it.keys = make([][]byte, 0, b.count)
+	it.values = make([]data.LogRecordPos, 0, b.count)
+	var cur []byte
+	for off := 0; off < len(b.data); {
+		var pos data.LogRecordPos
+		var n int
+		cur, pos, n = decodeCompactEntry(b.data[off:], cur)
+		it.keys = append(it.keys, append([]byte{}, cur...))
+		it.values = append(it.values, pos)
+		off += n
+	}
+	it.loaded = bi
+}
+
+// first 定位到第 bi 个块中遍历顺序的第一条记录
+func (it *compactIterator) first(bi int) {
+	it.load(bi)
+	it.ei = 0
+	if it.reverse && it.Valid() {
+		it.ei = len(it.keys) - 1
+	}
+}
+
+func (it *compactIterator) Rewind() {
+	if it.reverse {
+		it.first(len(it.blocks) - 1)
+	} else {
+		it.first(0)
+	}
+}
+
+func (it *compactIterator) Next() {
+	if it.reverse {
+		if it.ei--; it.ei < 0 {
+			it.first(it.bi - 1)
+		}
+		return
+	}
+	if it.ei++; it.ei >= len(it.keys) {
+		it.first(it.bi + 1)
+	}
+}
+
+func (it *compactIterator) Seek(key []byte) {
+	if len(it.blocks) == 0 {
+		return
+	}
+
+	bi := sort.Search(len(it.blocks), func(i int) bool {
+		return it.cmp.compare(it.blocks[i].first, key) > 0
+	}) - 1
+	if bi < 0 {
+		// key 比所有的 Key 都小：正向从头开始，反向遍历结束
+		if it.reverse {
+			it.bi = -1
+		} else {
+			it.first(0)
+		}
+		return
+	}
+
+	it.load(bi)
+	i := sort.Search(len(it.keys), func(i int) bool {
+		return it.cmp.compare(it.keys[i], key) >= 0
+	})
+	if it.reverse {
+		// 第一个小于等于 key 的位置，块的第一个 Key 小于等于 key，因此一定在这个块中
+		if i == len(it.keys) || it.cmp.compare(it.keys[i], key) > 0 {
+			i--
+		}
+		it.ei = i
+		return
+	}
+	if i == len(it.keys) {
+		it.first(bi + 1)
+		return
+	}
+	it.ei = i
+}
+
+func (it *compactIterator) Valid() bool {
+	return it.bi >= 0 && it.bi < len(it.blocks)
+}
+
+func (it *compactIterator) Key() []byte {
+	return it.keys[it.ei]
+}
+
+func (it *compactIterator) Value() *data.LogRecordPos {
+	return &it.values[it.ei]
+}
+
+func (it *compactIterator) Close() {
+	it.blocks, it.keys, it.values = nil, nil, nil
+}
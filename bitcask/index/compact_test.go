@@ -0,0 +1,152 @@
+package index
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"bitcask.go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompactIndex_PutGetDelete(t *testing.T) {
+	for _, prefix := range []bool{true, false} {
+		ci := NewCompactIndex(prefix, nil)
+		assert.Nil(t, ci.Get([]byte("not exist")))
+		_, ok := ci.Delete([]byte("not exist"))
+		assert.False(t, ok)
+
+		// 乱序写入，和 map 中的结果比较
+		n := 10000
+		expected := make(map[string]int64)
+		for _, i := range rand.Perm(n) {
+			key := fmt.Sprintf("key-%d", i)
+			assert.Nil(t, ci.Put([]byte(key), &data.LogRecordPos{Fid: 1, Offset: int64(i), Size: 10}))
+			expected[key] = int64(i)
+		}
+		assert.Equal(t, n, ci.Size())
+
+		oldPos := ci.Put([]byte("key-10"), &data.LogRecordPos{Fid: 2, Offset: 1 << 40, Size: 20})
+		assert.Equal(t, &data.LogRecordPos{Fid: 1, Offset: 10, Size: 10}, oldPos)
+		assert.Equal(t, &data.LogRecordPos{Fid: 2, Offset: 1 << 40, Size: 20}, ci.Get([]byte("key-10")))
+		expected["key-10"] = 1 << 40
+
+		// 删除大部分的 Key，空的块会被移除，很小的块会被合并
+		for _, i := range rand.Perm(n) {
+			if i%10 == 0 {
+				continue
+			}
+			key := fmt.Sprintf("key-%d", i)
+			pos, ok := ci.Delete([]byte(key))
+			assert.True(t, ok)
+			assert.Equal(t, expected[key], pos.Offset)
+			delete(expected, key)
+		}
+		assert.Equal(t, len(expected), ci.Size())
+		assert.Less(t, len(ci.blocks), n/10/(compactBlockEntries/4))
+		for i := 0; i < n; i++ {
+			key := fmt.Sprintf("key-%d", i)
+			if offset, ok := expected[key]; ok {
+				assert.Equal(t, offset, ci.Get([]byte(key)).Offset)
+			} else {
+				assert.Nil(t, ci.Get([]byte(key)))
+			}
+		}
+	}
+}
+
+func TestCompactIndex_Iterator(t *testing.T) {
+	ci := NewCompactIndex(true, nil)
+	n := 1000
+	for _, i := range rand.Perm(n) {
+		ci.Put([]byte(fmt.Sprintf("key-%04d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+
+	it := ci.Iterator(false)
+	var count int
+	for it.Rewind(); it.Valid(); it.Next() {
+		assert.Equal(t, fmt.Sprintf("key-%04d", count), string(it.Key()))
+		assert.Equal(t, int64(count), it.Value().Offset)
+		count++
+	}
+	assert.Equal(t, n, count)
+	it.Seek([]byte("key-0499a"))
+	assert.Equal(t, "key-0500", string(it.Key()))
+	it.Seek([]byte("a"))
+	assert.Equal(t, "key-0000", string(it.Key()))
+	it.Seek([]byte("z"))
+	assert.False(t, it.Valid())
+	it.Close()
+
+	it = ci.Iterator(true)
+	it.Rewind()
+	assert.Equal(t, "key-0999", string(it.Key()))
+	it.Seek([]byte("key-0499a"))
+	assert.Equal(t, "key-0499", string(it.Key()))
+	it.Next()
+	assert.Equal(t, "key-0498", string(it.Key()))
+	it.Seek([]byte("z"))
+	assert.Equal(t, "key-0999", string(it.Key()))
+	it.Seek([]byte("a"))
+	assert.False(t, it.Valid())
+	it.Close()
+}
+
+func TestCompactIndex_IteratorSnapshot(t *testing.T) {
+	ci := NewCompactIndex(true, nil)
+	for i := 0; i < 200; i++ {
+		ci.Put([]byte(fmt.Sprintf("key-%04d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+
+	// 迭代器创建之后的修改不会影响迭代器看到的数据
+	it := ci.Iterator(false)
+	for i := 0; i < 200; i++ {
+		if i%2 == 0 {
+			ci.Delete([]byte(fmt.Sprintf("key-%04d", i)))
+		} else {
+			ci.Put([]byte(fmt.Sprintf("key-%04d", i)), &data.LogRecordPos{Fid: 2, Offset: int64(i)})
+		}
+	}
+	var count int
+	for it.Rewind(); it.Valid(); it.Next() {
+		assert.Equal(t, uint32(1), it.Value().Fid)
+		count++
+	}
+	assert.Equal(t, 200, count)
+	it.Close()
+	assert.Equal(t, 100, ci.Size())
+}
+
+func TestCompactIndex_Comparator(t *testing.T) {
+	ci := NewCompactIndex(true, ReverseComparator)
+	for _, key := range []string{"c", "a", "e", "b", "d"} {
+		ci.Put([]byte(key), &data.LogRecordPos{Fid: 1})
+	}
+	assert.NotNil(t, ci.Get([]byte("c")))
+
+	it := ci.Iterator(false)
+	var keys []string
+	for it.Rewind(); it.Valid(); it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	assert.Equal(t, []string{"e", "d", "c", "b", "a"}, keys)
+	it.Close()
+}
+
+func TestCompactIndex_Options(t *testing.T) {
+	indexer, err := NewIndexer(Compact, "", false)
+	assert.Nil(t, err)
+	assert.True(t, indexer.(*CompactIndex).prefix)
+
+	// 关闭前缀压缩的配置需要传递到每个分片
+	opts := DefaultIndexerOptions
+	opts.PrefixCompression = false
+	indexer, err = NewIndexerWithOptions(Compact, opts)
+	assert.Nil(t, err)
+	assert.False(t, indexer.(*CompactIndex).prefix)
+	si, err := NewShardedIndex(Compact, 4, opts)
+	assert.Nil(t, err)
+	for _, shard := range si.shards {
+		assert.False(t, shard.(*CompactIndex).prefix)
+	}
+}
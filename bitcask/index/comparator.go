@@ -0,0 +1,59 @@
+package index
+
+import "bytes"
+
+// ReverseComparator 按照字节序的逆序排列 Key
+func ReverseComparator(a, b []byte) int {
+	return bytes.Compare(b, a)
+}
+
+// NaturalComparator 按照自然顺序排列 Key：Key 中连续的数字作为整数比较，例如 key-2 排在 key-10 之前
+// 数值相同但是写法不同的 Key（例如前导 0）最后按照字节序区分，保证只有相同的 Key 才相等
+func NaturalComparator(a, b []byte) int {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if !isDigit(a[i]) || !isDigit(b[j]) {
+			if a[i] != b[j] {
+				if a[i] < b[j] {
+					return -1
+				}
+				return 1
+			}
+			i++
+			j++
+			continue
+		}
+
+		// 取出两边完整的数字，去掉前导 0 之后位数多的更大，位数相同时按照字节比较
+		si, sj := i, j
+		for i < len(a) && isDigit(a[i]) {
+			i++
+		}
+		for j < len(b) && isDigit(b[j]) {
+			j++
+		}
+		na, nb := bytes.TrimLeft(a[si:i], "0"), bytes.TrimLeft(b[sj:j], "0")
+		if len(na) != len(nb) {
+			if len(na) < len(nb) {
+				return -1
+			}
+			return 1
+		}
+		if c := bytes.Compare(na, nb); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case i < len(a):
+		return 1
+	case j < len(b):
+		return -1
+	default:
+		return bytes.Compare(a, b)
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,63 @@
+package index
+
+import (
+	"testing"
+
+	"bitcask.go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNaturalComparator(t *testing.T) {
+	assert.True(t, NaturalComparator([]byte("key-2"), []byte("key-10")) < 0)
+	assert.True(t, NaturalComparator([]byte("key-10"), []byte("key-9")) > 0)
+	assert.True(t, NaturalComparator([]byte("a1b2"), []byte("a1b10")) < 0)
+	assert.True(t, NaturalComparator([]byte("key"), []byte("key-1")) < 0)
+	assert.True(t, NaturalComparator([]byte("b"), []byte("a100")) > 0)
+	assert.Equal(t, 0, NaturalComparator([]byte("key-10"), []byte("key-10")))
+
+	// 数值相同的不同 Key 不能相等
+	assert.NotEqual(t, 0, NaturalComparator([]byte("key-01"), []byte("key-1")))
+	assert.Equal(t, -NaturalComparator([]byte("key-01"), []byte("key-1")), NaturalComparator([]byte("key-1"), []byte("key-01")))
+}
+
+func collectKeys(it Iterator) []string {
+	var res []string
+	for ; it.Valid(); it.Next() {
+		res = append(res, string(it.Key()))
+	}
+	return res
+}
+
+func TestIndexer_Comparator(t *testing.T) {
+	keys := []string{"key-1", "key-10", "key-2", "key-100", "key-20"}
+	sorted := []string{"key-1", "key-2", "key-10", "key-20", "key-100"}
+
+	for _, indexer := range []Indexer{NewBtreeWithComparator(NaturalComparator), NewARTWithComparator(NaturalComparator)} {
+		for i, key := range keys {
+			indexer.Put([]byte(key), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+		}
+		assert.NotNil(t, indexer.Get([]byte("key-10")))
+
+		it := indexer.Iterator(false)
+		it.Rewind()
+		assert.Equal(t, sorted, collectKeys(it))
+		it.Seek([]byte("key-3"))
+		assert.Equal(t, sorted[2:], collectKeys(it))
+		it.Close()
+
+		it = indexer.Iterator(true)
+		it.Rewind()
+		assert.Equal(t, []string{"key-100", "key-20", "key-10", "key-2", "key-1"}, collectKeys(it))
+		it.Seek([]byte("key-15"))
+		assert.Equal(t, []string{"key-10", "key-2", "key-1"}, collectKeys(it))
+		it.Close()
+	}
+
+	// 逆序的比较函数
+	reverse := NewBtreeWithComparator(ReverseComparator)
+	reverse.Put([]byte("a"), &data.LogRecordPos{})
+	reverse.Put([]byte("b"), &data.LogRecordPos{})
+	it := reverse.Iterator(false)
+	assert.Equal(t, []string{"b", "a"}, collectKeys(it))
+	it.Close()
+}
@@ -0,0 +1,274 @@
+package index
+
+import (
+	"bytes"
+	"hash/maphash"
+	"sort"
+	"sync"
+
+	"bitcask.go/data"
+)
+
+// hashMinSlots 哈希表最少的槽位数量
+const hashMinSlots = 8
+
+// HashIndex 开放寻址（线性探测）的哈希表索引，适合只有点查、不需要遍历的场景
+// 所有记录紧凑地保存在 entries 数组中，位置信息直接内嵌在记录里，每个 Key 不需要像 BTree 那样单独分配节点和位置信息，
+// slots 只保存记录在 entries 中的下标，因此每个 Key 占用的内存比 BTree 和 ART 少很多
+// 迭代器需要拷贝所有的 Key 再排序，代价比有序的索引高得多
+type HashIndex struct {
+	lock    *sync.RWMutex
+	seed    maphash.Seed
+	entries []hashEntry
+	slots   []uint32   // 记录在 entries 中的下标 + 1，0 表示空槽位，长度总是 2 的幂
+	cmp     Comparator // 迭代器中 Key 的顺序，为空时按照字节序
+}
+
+// hashEntry 哈希表中的一条记录，保存 Key 的哈希值，扩容和删除时不需要重新计算
+type hashEntry struct {
+	key    []byte
+	offset int64
+	fid    uint32
+	size   uint32
+	hash   uint32
+}
+
+func (e *hashEntry) pos() *data.LogRecordPos {
+	return &data.LogRecordPos{Fid: e.fid, Offset: e.offset, Size: e.size}
+}
+
+// NewHashIndex 初始化哈希表索引
+func NewHashIndex() *HashIndex {
+	return NewHashIndexWithComparator(nil)
+}
+
+// NewHashIndexWithComparator 初始化哈希表索引，cmp 只决定迭代器遍历 Key 的顺序
+func NewHashIndexWithComparator(cmp Comparator) *HashIndex {
+	return &HashIndex{
+		lock:  new(sync.RWMutex),
+		seed:  maphash.MakeSeed(),
+		slots: make([]uint32, hashMinSlots),
+		cmp:   cmp,
+	}
+}
+
+func (hi *HashIndex) hash(key []byte) uint32 {
+	return uint32(maphash.Bytes(hi.seed, key))
+}
+
+// find 查找 Key 所在的槽位，Key 不存在时返回应该插入的空槽位，调用时必须持有锁
+func (hi *HashIndex) find(key []byte, hash uint32) (int, bool) {
+	mask := uint32(len(hi.slots) - 1)
+	for i := hash & mask; ; i = (i + 1) & mask {
+		slot := hi.slots[i]
+		if slot == 0 {
+			return int(i), false
+		}
+		if e := &hi.entries[slot-1]; e.hash == hash && bytes.Equal(e.key, key) {
+			return int(i), true
+		}
+	}
+}
+
+// resize 将哈希表调整为 n 个槽位，重新放置所有的记录，调用时必须持有写锁
+func (hi *HashIndex) resize(n int) {
+	hi.slots = make([]uint32, n)
+	mask := uint32(n - 1)
+	for idx := range hi.entries {
+		i := hi.entries[idx].hash & mask
+		for hi.slots[i] != 0 {
+			i = (i + 1) & mask
+		}
+		hi.slots[i] = uint32(idx + 1)
+	}
+}
+
+func (hi *HashIndex) Put(key []byte, pos *data.LogRecordPos) *data.LogRecordPos {
+	hash := hi.hash(key)
+
+	hi.lock.Lock()
+	defer hi.lock.Unlock()
+	return hi.put(key, hash, pos)
+}
+
+// PutBatch 只加一次锁插入所有的 Key，并且预先扩容到能够放下所有的 Key，避免插入的过程中多次扩容
+func (hi *HashIndex) PutBatch(keys [][]byte, positions []*data.LogRecordPos) []*data.LogRecordPos {
+	oldPositions := make([]*data.LogRecordPos, len(keys))
+
+	hi.lock.Lock()
+	defer hi.lock.Unlock()
+
+	n := len(hi.slots)
+	for (len(hi.entries)+len(keys))*8 > n*7 {
+		n *= 2
+	}
+	if n != len(hi.slots) {
+		hi.resize(n)
+	}
+	for i, key := range keys {
+		oldPositions[i] = hi.put(key, hi.hash(key), positions[i])
+	}
+	return oldPositions
+}
+
+// put 插入或者更新 Key，调用时必须持有写锁
+func (hi *HashIndex) put(key []byte, hash uint32, pos *data.LogRecordPos) *data.LogRecordPos {
+	// 负载因子超过 7/8 时扩容一倍
+	if (len(hi.entries)+1)*8 > len(hi.slots)*7 {
+		hi.resize(len(hi.slots) * 2)
+	}
+
+	i, found := hi.find(key, hash)
+	if found {
+		e := &hi.entries[hi.slots[i]-1]
+		oldPos := e.pos()
+		e.fid, e.offset, e.size = pos.Fid, pos.Offset, pos.Size
+		return oldPos
+	}
+
+	hi.entries = append(hi.entries, hashEntry{key: key, offset: pos.Offset, fid: pos.Fid, size: pos.Size, hash: hash})
+	hi.slots[i] = uint32(len(hi.entries))
+	return nil
+}
+
+func (hi *HashIndex) Get(key []byte) *data.LogRecordPos {
+	hash := hi.hash(key)
+
+	hi.lock.RLock()
+	defer hi.lock.RUnlock()
+
+	i, found := hi.find(key, hash)
+	if !found {
+		return nil
+	}
+	return hi.entries[hi.slots[i]-1].pos()
+}
+
+// Delete 删除 Key 之后把后面探测链上的槽位向前移动（不使用墓碑标记），
+// 再把 entries 中最后一条记录移动到被删除的位置，保持 entries 紧凑
+func (hi *HashIndex) Delete(key []byte) (*data.LogRecordPos, bool) {
+	hash := hi.hash(key)
+
+	hi.lock.Lock()
+	defer hi.lock.Unlock()
+	return hi.delete(key, hash)
+}
+
+// DeleteBatch 只加一次锁删除所有的 Key
+func (hi *HashIndex) DeleteBatch(keys [][]byte) []*data.LogRecordPos {
+	oldPositions := make([]*data.LogRecordPos, len(keys))
+
+	hi.lock.Lock()
+	defer hi.lock.Unlock()
+	for i, key := range keys {
+		oldPositions[i], _ = hi.delete(key, hi.hash(key))
+	}
+	return oldPositions
+}
+
+// delete 删除 Key，调用时必须持有写锁
+func (hi *HashIndex) delete(key []byte, hash uint32) (*data.LogRecordPos, bool) {
+	i, found := hi.find(key, hash)
+	if !found {
+		return nil, false
+	}
+	idx := hi.slots[i] - 1
+	oldPos := hi.entries[idx].pos()
+
+	mask := len(hi.slots) - 1
+	for j := (i + 1) & mask; hi.slots[j] != 0; j = (j + 1) & mask {
+		// 槽位 j 中的记录原本应该放在 home，home 不在 (i, j] 之间时，可以移动到空出来的槽位 i
+		home := int(hi.entries[hi.slots[j]-1].hash) & mask
+		if (i < j && (home <= i || home > j)) || (i > j && home <= i && home > j) {
+			hi.slots[i] = hi.slots[j]
+			i = j
+		}
+	}
+	hi.slots[i] = 0
+
+	last := uint32(len(hi.entries) - 1)
+	if idx != last {
+		hi.entries[idx] = hi.entries[last]
+		j, _ := hi.find(hi.entries[idx].key, hi.entries[idx].hash)
+		hi.slots[j] = idx + 1
+	}
+	hi.entries[last] = hashEntry{}
+	hi.entries = hi.entries[:last]
+
+	// 大量删除之后缩小哈希表，释放内存
+	if len(hi.slots) > hashMinSlots && len(hi.entries)*8 < len(hi.slots) {
+		hi.entries = append([]hashEntry(nil), hi.entries...)
+		hi.resize(len(hi.slots) / 2)
+	}
+	return oldPos, true
+}
+
+func (hi *HashIndex) Size() int {
+	hi.lock.RLock()
+	defer hi.lock.RUnlock()
+	return len(hi.entries)
+}
+
+// Iterator 拷贝所有的 Key 并按照 cmp 排序之后遍历，之后的修改不会影响迭代器
+func (hi *HashIndex) Iterator(reverse bool) Iterator {
+	hi.lock.RLock()
+	values := make([]*Item, len(hi.entries))
+	for idx := range hi.entries {
+		values[idx] = &Item{key: hi.entries[idx].key, pos: hi.entries[idx].pos()}
+	}
+	hi.lock.RUnlock()
+
+	sort.Slice(values, func(i, j int) bool {
+		if reverse {
+			return hi.cmp.compare(values[i].key, values[j].key) > 0
+		}
+		return hi.cmp.compare(values[i].key, values[j].key) < 0
+	})
+	return &hashIterator{reverse: reverse, values: values, cmp: hi.cmp}
+}
+
+func (hi *HashIndex) Close() error {
+	return nil
+}
+
+// 哈希表索引迭代器，遍历排好序的快照
+type hashIterator struct {
+	curindex int     // 当前遍历到哪个位置了
+	reverse  bool    // 是否反向遍历
+	values   []*Item // 排好序的 Key 和索引信息
+	cmp      Comparator
+}
+
+func (hi *hashIterator) Key() []byte {
+	return hi.values[hi.curindex].key
+}
+
+func (hi *hashIterator) Value() *data.LogRecordPos {
+	return hi.values[hi.curindex].pos
+}
+
+func (hi *hashIterator) Next() {
+	hi.curindex++
+}
+
+// Seek 在排好序的快照中二分查找第一个大于（反向时小于）等于 key 的位置
+func (hi *hashIterator) Seek(key []byte) {
+	hi.curindex = sort.Search(len(hi.values), func(i int) bool {
+		if hi.reverse {
+			return hi.cmp.compare(hi.values[i].key, key) <= 0
+		}
+		return hi.cmp.compare(hi.values[i].key, key) >= 0
+	})
+}
+
+func (hi *hashIterator) Rewind() {
+	hi.curindex = 0
+}
+
+func (hi *hashIterator) Valid() bool {
+	return hi.curindex < len(hi.values)
+}
+
+func (hi *hashIterator) Close() {
+	hi.values = nil
+}
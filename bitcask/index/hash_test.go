@@ -0,0 +1,76 @@
+package index
+
+import (
+	"fmt"
+	"testing"
+
+	"bitcask.go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashIndex_PutGetDelete(t *testing.T) {
+	hi := NewHashIndex()
+	assert.Nil(t, hi.Get([]byte("not exist")))
+
+	n := 10000
+	for i := 0; i < n; i++ {
+		assert.Nil(t, hi.Put([]byte(fmt.Sprintf("key-%d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i), Size: 10}))
+	}
+	assert.Equal(t, n, hi.Size())
+
+	oldPos := hi.Put([]byte("key-10"), &data.LogRecordPos{Fid: 2, Offset: 100, Size: 20})
+	assert.Equal(t, &data.LogRecordPos{Fid: 1, Offset: 10, Size: 10}, oldPos)
+	assert.Equal(t, &data.LogRecordPos{Fid: 2, Offset: 100, Size: 20}, hi.Get([]byte("key-10")))
+
+	// 删除一半的 Key，剩下的 Key 都能找到
+	for i := 0; i < n; i += 2 {
+		pos, ok := hi.Delete([]byte(fmt.Sprintf("key-%d", i)))
+		assert.True(t, ok)
+		assert.NotNil(t, pos)
+	}
+	_, ok := hi.Delete([]byte("key-0"))
+	assert.False(t, ok)
+	assert.Equal(t, n/2, hi.Size())
+	for i := 0; i < n; i++ {
+		pos := hi.Get([]byte(fmt.Sprintf("key-%d", i)))
+		if i%2 == 0 {
+			assert.Nil(t, pos)
+		} else {
+			assert.Equal(t, int64(i), pos.Offset)
+		}
+	}
+
+	// 全部删除之后哈希表会缩小
+	for i := 1; i < n; i += 2 {
+		_, ok := hi.Delete([]byte(fmt.Sprintf("key-%d", i)))
+		assert.True(t, ok)
+	}
+	assert.Equal(t, 0, hi.Size())
+	assert.Equal(t, hashMinSlots, len(hi.slots))
+}
+
+func TestHashIndex_Iterator(t *testing.T) {
+	hi := NewHashIndex()
+	for _, key := range []string{"c", "a", "e", "b", "d"} {
+		hi.Put([]byte(key), &data.LogRecordPos{Fid: 1})
+	}
+
+	it := hi.Iterator(false)
+	var keys []string
+	for it.Rewind(); it.Valid(); it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, keys)
+	it.Seek([]byte("bb"))
+	assert.Equal(t, "c", string(it.Key()))
+	it.Close()
+
+	it = hi.Iterator(true)
+	it.Seek([]byte("bb"))
+	assert.Equal(t, "b", string(it.Key()))
+	it.Next()
+	assert.Equal(t, "a", string(it.Key()))
+	it.Next()
+	assert.False(t, it.Valid())
+	it.Close()
+}
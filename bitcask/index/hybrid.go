@@ -0,0 +1,543 @@
+package index
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"bitcask.go/data"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// HybridIndexFileName 混合索引保存冷数据的文件，索引关闭时删除
+	HybridIndexFileName = "hybrid-index"
+
+	// DefaultHybridMemoryBudget 混合索引中热数据默认的内存上限
+	DefaultHybridMemoryBudget = 256 * 1024 * 1024
+
+	// hybridEntryOverhead 估算的热数据中每个 Key 除了 Key 本身之外占用的内存（记录、map 的槽位等）
+	hybridEntryOverhead = 96
+
+	// hybridBatchSize 待提升或删除的冷数据 Key 攒够这么多时，批量写入 bbolt
+	hybridBatchSize = 256
+)
+
+// HybridIndex 内存大小受限的混合索引：最近使用的 Key 保存在内存中（热数据），
+// 热数据占用的内存超过 budget 时，按照 LRU 把最久没有使用的一批 Key 降级到磁盘上的 B+ 树（冷数据），
+// 写入冷数据中的 Key 时把它提升回内存，读取到的冷数据 Key 先记录下来，由之后的写入操作批量提升。
+// 每个 Key 只会在其中一层，遍历时按照 Key 的顺序归并两层的数据
+// 和 BPlusTree 不同，冷数据只是内存的延伸，每次打开数据库都重新从数据文件构建，因此 bbolt 不需要持久化
+//
+// 冷数据的修改（提升、删除和降级）都攒成一批，在一个 bbolt 写事务中完成，写事务期间只持有 writeLock，
+// 不持有 lock，因此写事务等待迭代器的只读事务时不会阻塞热数据的读取
+type HybridIndex struct {
+	writeLock *sync.Mutex // 串行化所有的写入操作，冷数据只会被持有它的操作修改
+	lock      *sync.Mutex // 保护内存中的数据，读取也会调整 LRU 的顺序，所有的操作都需要互斥锁
+	budget    int64
+	used      int64                   // 热数据估算占用的内存
+	hot       map[string]*hybridEntry // 热数据
+	head      *hybridEntry            // LRU 链表的头部，最近使用的 Key
+	tail      *hybridEntry            // LRU 链表的尾部，最久没有使用的 Key
+
+	// 已经提升或删除、还没有从 bbolt 中删除的 Key，bbolt 中的这些 Key 都已经失效
+	removed map[string]struct{}
+	// 读取到的冷数据 Key，等待批量提升
+	promotions map[string]struct{}
+	// 每次提交冷数据的修改之后递增，锁外读取冷数据的期间有修改提交时需要重新读取
+	gen uint64
+
+	cold     *bbolt.DB // 冷数据
+	coldSize int       // 冷数据中有效的 Key 的数量
+	path     string
+}
+
+// hybridEntry 热数据中的一个 Key，同时是 LRU 双向链表的节点
+type hybridEntry struct {
+	key        string
+	pos        data.LogRecordPos
+	prev, next *hybridEntry
+}
+
+// NewHybridIndex 初始化混合索引，冷数据保存在 dirPath 目录中（之前遗留的冷数据文件会被删除）
+func NewHybridIndex(dirPath string, budget int64) (*HybridIndex, error) {
+	path := filepath.Join(dirPath, HybridIndexFileName)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// 冷数据每次都会重建，不需要持久化
+	options := *bbolt.DefaultOptions
+	options.NoSync = true
+	options.NoFreelistSync = true
+	cold, err := bbolt.Open(path, 0644, &options)
+	if err != nil {
+		return nil, err
+	}
+	if err := cold.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(indexBucketName)
+		return err
+	}); err != nil {
+		_ = cold.Close()
+		return nil, err
+	}
+
+	return &HybridIndex{
+		writeLock:  new(sync.Mutex),
+		lock:       new(sync.Mutex),
+		budget:     budget,
+		hot:        make(map[string]*hybridEntry),
+		removed:    make(map[string]struct{}),
+		promotions: make(map[string]struct{}),
+		cold:       cold,
+		path:       path,
+	}, nil
+}
+
+func (hi *HybridIndex) Put(key []byte, pos *data.LogRecordPos) *data.LogRecordPos {
+	hi.writeLock.Lock()
+	defer hi.writeLock.Unlock()
+
+	hi.lock.Lock()
+	if e, ok := hi.hot[string(key)]; ok {
+		oldPos := e.pos
+		e.pos = *pos
+		hi.moveToFront(e)
+		hi.lock.Unlock()
+		return &oldPos
+	}
+	hi.lock.Unlock()
+
+	// Key 在冷数据中时，写入之后成为热数据，冷数据中的记录留到下一批修改时删除
+	oldPos, err := hi.lookupCold(key)
+	hi.lock.Lock()
+	hi.addHot(string(key), *pos)
+	if oldPos != nil || err != nil {
+		hi.removeCold(key, oldPos)
+	}
+	hi.lock.Unlock()
+
+	hi.maintain()
+	return oldPos
+}
+
+// Get 读取冷数据时不会修改 bbolt，读取到的 Key 由之后的写入操作批量提升为热数据
+func (hi *HybridIndex) Get(key []byte) *data.LogRecordPos {
+	for {
+		hi.lock.Lock()
+		if e, ok := hi.hot[string(key)]; ok {
+			hi.moveToFront(e)
+			pos := e.pos
+			hi.lock.Unlock()
+			return &pos
+		}
+		if _, ok := hi.removed[string(key)]; ok || hi.coldSize == 0 {
+			hi.lock.Unlock()
+			return nil
+		}
+		gen := hi.gen
+		hi.lock.Unlock()
+
+		// 在锁外面读取冷数据，不会阻塞热数据的读写
+		pos, err := hi.getCold(key)
+
+		hi.lock.Lock()
+		// 读取期间提交了一批冷数据的修改，Key 可能已经提升为热数据了，需要重新查找
+		if hi.gen != gen {
+			hi.lock.Unlock()
+			continue
+		}
+		if err != nil {
+			log.Printf("bitcask: failed to get value in hybrid index,err:%v\n", err)
+		}
+		if pos != nil && len(hi.promotions) < hybridBatchSize {
+			hi.promotions[string(key)] = struct{}{}
+		}
+		hi.lock.Unlock()
+		return pos
+	}
+}
+
+func (hi *HybridIndex) Delete(key []byte) (*data.LogRecordPos, bool) {
+	hi.writeLock.Lock()
+	defer hi.writeLock.Unlock()
+
+	hi.lock.Lock()
+	if e, ok := hi.hot[string(key)]; ok {
+		hi.removeHot(e)
+		hi.lock.Unlock()
+		return &e.pos, true
+	}
+	hi.lock.Unlock()
+
+	pos, err := hi.lookupCold(key)
+	if pos != nil || err != nil {
+		hi.lock.Lock()
+		hi.removeCold(key, pos)
+		hi.lock.Unlock()
+	}
+
+	hi.maintain()
+	return pos, pos != nil
+}
+
+func (hi *HybridIndex) Size() int {
+	hi.lock.Lock()
+	defer hi.lock.Unlock()
+	return len(hi.hot) + hi.coldSize
+}
+
+// Close 关闭并删除冷数据文件
+func (hi *HybridIndex) Close() error {
+	if err := hi.cold.Close(); err != nil {
+		return err
+	}
+	return os.Remove(hi.path)
+}
+
+// getCold 从 bbolt 中读取 Key 的位置信息，不存在时返回 nil，不检查 Key 是否已经失效
+func (hi *HybridIndex) getCold(key []byte) (*data.LogRecordPos, error) {
+	var pos *data.LogRecordPos
+	err := hi.cold.View(func(tx *bbolt.Tx) error {
+		if value := tx.Bucket(indexBucketName).Get(key); len(value) != 0 {
+			pos = data.DecodeLogRecordPos(value)
+		}
+		return nil
+	})
+	return pos, err
+}
+
+// lookupCold 查找冷数据中有效的 Key 的位置信息，调用时必须持有 writeLock
+func (hi *HybridIndex) lookupCold(key []byte) (*data.LogRecordPos, error) {
+	hi.lock.Lock()
+	_, removed := hi.removed[string(key)]
+	empty := hi.coldSize == 0
+	hi.lock.Unlock()
+	if removed || empty {
+		return nil, nil
+	}
+
+	pos, err := hi.getCold(key)
+	if err != nil {
+		log.Printf("bitcask: failed to get value in hybrid index,err:%v\n", err)
+	}
+	return pos, err
+}
+
+// removeCold 标记冷数据中的 Key 已经失效，下一批修改时从 bbolt 中删除，调用时必须持有 writeLock 和 lock
+// 读取冷数据失败时也需要标记，避免 bbolt 中可能存在的旧记录在之后被当作有效的数据
+func (hi *HybridIndex) removeCold(key []byte, pos *data.LogRecordPos) {
+	hi.removed[string(key)] = struct{}{}
+	delete(hi.promotions, string(key))
+	if pos != nil {
+		hi.coldSize--
+	}
+}
+
+// maintain 待处理的冷数据修改攒够一批，或者热数据超过内存上限时，批量提升读取到的冷数据 Key，
+// 删除已经失效的 Key，并把最久没有使用的热数据降级到冷数据，直到只占用上限的 7/8
+// 所有的修改在同一个 bbolt 写事务中完成，失败时保留待处理的修改，下一次写入时重试，调用时必须持有 writeLock
+func (hi *HybridIndex) maintain() {
+	hi.lock.Lock()
+	if hi.used <= hi.budget && len(hi.removed) < hybridBatchSize && len(hi.promotions) < hybridBatchSize {
+		hi.lock.Unlock()
+		return
+	}
+	promotions := hi.promotions
+	hi.promotions = make(map[string]struct{})
+	hi.lock.Unlock()
+
+	hi.promote(promotions)
+
+	// 只有持有 writeLock 的操作才会修改热数据的 Key 和位置信息，写事务期间可以直接读取
+	hi.lock.Lock()
+	removed := make([][]byte, 0, len(hi.removed))
+	for key := range hi.removed {
+		removed = append(removed, []byte(key))
+	}
+	var entries []*hybridEntry
+	if hi.used > hi.budget {
+		used := hi.used
+		for e := hi.tail; e != nil && used > hi.budget/8*7; e = e.prev {
+			entries = append(entries, e)
+			used -= int64(len(e.key)) + hybridEntryOverhead
+		}
+	}
+	hi.lock.Unlock()
+
+	// 先删除失效的 Key 再写入降级的 Key，重新降级的 Key 不会被删除
+	// 降级的 Key 在事务提交之前仍然是热数据，读取时不会找不到
+	if err := hi.cold.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(indexBucketName)
+		for _, key := range removed {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		for _, e := range entries {
+			if err := bucket.Put([]byte(e.key), data.EncodeLogRecordPos(&e.pos)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		log.Printf("bitcask: failed to update hybrid index,err:%v\n", err)
+		return
+	}
+
+	hi.lock.Lock()
+	defer hi.lock.Unlock()
+	for _, key := range removed {
+		delete(hi.removed, string(key))
+	}
+	for _, e := range entries {
+		hi.removeHot(e)
+	}
+	hi.coldSize += len(entries)
+	hi.gen++
+}
+
+// promote 把读取到的冷数据 Key 提升为热数据，冷数据中的记录和其他失效的 Key 一起删除，调用时必须持有 writeLock
+func (hi *HybridIndex) promote(keys map[string]struct{}) {
+	if len(keys) == 0 {
+		return
+	}
+
+	positions := make(map[string]*data.LogRecordPos, len(keys))
+	if err := hi.cold.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(indexBucketName)
+		for key := range keys {
+			if value := bucket.Get([]byte(key)); len(value) != 0 {
+				positions[key] = data.DecodeLogRecordPos(value)
+			}
+		}
+		return nil
+	}); err != nil {
+		log.Printf("bitcask: failed to get values in hybrid index,err:%v\n", err)
+		return
+	}
+
+	hi.lock.Lock()
+	defer hi.lock.Unlock()
+	for key, pos := range positions {
+		// 读取之后已经写入或者删除的 Key 不需要再提升
+		if _, ok := hi.hot[key]; ok {
+			continue
+		}
+		if _, ok := hi.removed[key]; ok {
+			continue
+		}
+		hi.addHot(key, *pos)
+		hi.removeCold([]byte(key), pos)
+	}
+}
+
+// addHot 添加一个热数据 Key 到 LRU 链表的头部，调用时必须持有锁
+func (hi *HybridIndex) addHot(key string, pos data.LogRecordPos) {
+	e := &hybridEntry{key: key, pos: pos}
+	hi.hot[key] = e
+	hi.pushFront(e)
+	hi.used += int64(len(key)) + hybridEntryOverhead
+}
+
+// removeHot 从热数据中移除一个 Key，调用时必须持有锁
+func (hi *HybridIndex) removeHot(e *hybridEntry) {
+	delete(hi.hot, e.key)
+	hi.unlink(e)
+	hi.used -= int64(len(e.key)) + hybridEntryOverhead
+}
+
+func (hi *HybridIndex) moveToFront(e *hybridEntry) {
+	if hi.head == e {
+		return
+	}
+	hi.unlink(e)
+	hi.pushFront(e)
+}
+
+func (hi *HybridIndex) pushFront(e *hybridEntry) {
+	e.prev, e.next = nil, hi.head
+	if hi.head != nil {
+		hi.head.prev = e
+	}
+	hi.head = e
+	if hi.tail == nil {
+		hi.tail = e
+	}
+}
+
+func (hi *HybridIndex) unlink(e *hybridEntry) {
+	if e.prev != nil {
+		e.prev.next = e.next
+	} else {
+		hi.head = e.next
+	}
+	if e.next != nil {
+		e.next.prev = e.prev
+	} else {
+		hi.tail = e.prev
+	}
+	e.prev, e.next = nil, nil
+}
+
+// Iterator 热数据拷贝一份排好序的快照，冷数据开启一个只读事务，两者是同一时刻的一致性快照
+// 注意：和 BPlusTree 一样，迭代器关闭之前冷数据文件无法扩容，需要扩容的降级操作会等待迭代器关闭，
+// 等待期间只会阻塞写入操作，热数据的读取不受影响
+func (hi *HybridIndex) Iterator(reverse bool) Iterator {
+	// 冷数据只会被持有 writeLock 的操作修改，持有它时两层的数据不会变化
+	hi.writeLock.Lock()
+	defer hi.writeLock.Unlock()
+
+	hi.lock.Lock()
+	hot := make([]*Item, 0, len(hi.hot))
+	for _, e := range hi.hot {
+		pos := e.pos
+		hot = append(hot, &Item{key: []byte(e.key), pos: &pos})
+	}
+	removed := make(map[string]struct{}, len(hi.removed))
+	for key := range hi.removed {
+		removed[key] = struct{}{}
+	}
+	hi.lock.Unlock()
+	sort.Slice(hot, func(i, j int) bool {
+		if reverse {
+			return bytes.Compare(hot[i].key, hot[j].key) > 0
+		}
+		return bytes.Compare(hot[i].key, hot[j].key) < 0
+	})
+
+	it := &hybridIterator{hot: hot, removed: removed, reverse: reverse}
+	tx, err := hi.cold.Begin(false)
+	if err != nil {
+		// 无法读取冷数据时只遍历热数据
+		log.Printf("bitcask: failed to begin a transaction in hybrid index,err:%v\n", err)
+	} else {
+		it.tx, it.cursor = tx, tx.Bucket(indexBucketName).Cursor()
+	}
+	it.Rewind()
+	return it
+}
+
+// hybridIterator 按照 Key 的顺序归并热数据的快照和冷数据的游标（跳过失效的冷数据之后，两层中的 Key 不会重复）
+type hybridIterator struct {
+	hot      []*Item
+	curindex int
+	reverse  bool
+
+	removed   map[string]struct{} // 创建迭代器时已经失效的冷数据 Key
+	tx        *bbolt.Tx
+	cursor    *bbolt.Cursor
+	coldKey   []byte
+	coldValue []byte
+}
+
+// before 热数据当前的 Key 是否应该排在冷数据当前的 Key 前面
+func (it *hybridIterator) before() bool {
+	if it.curindex >= len(it.hot) {
+		return false
+	}
+	if it.coldKey == nil {
+		return true
+	}
+	c := bytes.Compare(it.hot[it.curindex].key, it.coldKey)
+	return (!it.reverse && c < 0) || (it.reverse && c > 0)
+}
+
+func (it *hybridIterator) Key() []byte {
+	if it.before() {
+		return it.hot[it.curindex].key
+	}
+	return it.coldKey
+}
+
+func (it *hybridIterator) Value() *data.LogRecordPos {
+	if it.before() {
+		return it.hot[it.curindex].pos
+	}
+	return data.DecodeLogRecordPos(it.coldValue)
+}
+
+func (it *hybridIterator) Next() {
+	if it.before() {
+		it.curindex++
+		return
+	}
+	it.nextCold()
+}
+
+func (it *hybridIterator) Seek(key []byte) {
+	it.curindex = sort.Search(len(it.hot), func(i int) bool {
+		if it.reverse {
+			return bytes.Compare(it.hot[i].key, key) <= 0
+		}
+		return bytes.Compare(it.hot[i].key, key) >= 0
+	})
+
+	if it.cursor == nil {
+		return
+	}
+	coldKey, coldValue := it.cursor.Seek(key)
+	// 反向遍历时需要第一个小于等于 key 的位置
+	if it.reverse {
+		if coldKey == nil {
+			coldKey, coldValue = it.cursor.Last()
+		} else if bytes.Compare(coldKey, key) > 0 {
+			coldKey, coldValue = it.cursor.Prev()
+		}
+	}
+	it.setCold(coldKey, coldValue)
+}
+
+func (it *hybridIterator) Rewind() {
+	it.curindex = 0
+	if it.cursor == nil {
+		return
+	}
+	if it.reverse {
+		it.setCold(it.cursor.Last())
+	} else {
+		it.setCold(it.cursor.First())
+	}
+}
+
+// nextCold 冷数据的游标移动到下一个 Key
+func (it *hybridIterator) nextCold() {
+	if it.reverse {
+		it.setCold(it.cursor.Prev())
+	} else {
+		it.setCold(it.cursor.Next())
+	}
+}
+
+// setCold 拷贝游标当前的 Key：bbolt 返回的数据指向内存映射，迭代器关闭之后就不能再访问了
+// 游标指向失效的 Key 时继续向后移动
+func (it *hybridIterator) setCold(key, value []byte) {
+	for key != nil {
+		if _, ok := it.removed[string(key)]; !ok {
+			break
+		}
+		if it.reverse {
+			key, value = it.cursor.Prev()
+		} else {
+			key, value = it.cursor.Next()
+		}
+	}
+	if key != nil {
+		key = append([]byte{}, key...)
+	}
+	it.coldKey, it.coldValue = key, value
+}
+
+func (it *hybridIterator) Valid() bool {
+	return it.curindex < len(it.hot) || it.coldKey != nil
+}
+
+func (it *hybridIterator) Close() {
+	if it.tx != nil {
+		_ = it.tx.Rollback()
+	}
+	it.hot = nil
+}
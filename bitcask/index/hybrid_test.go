@@ -0,0 +1,190 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"bitcask.go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHybridIndex_PutGetDelete(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-hybrid")
+	defer os.RemoveAll(dir)
+
+	// 内存中最多只能保存 100 个左右的 Key
+	hi, err := NewHybridIndex(dir, 100*(hybridEntryOverhead+8))
+	assert.Nil(t, err)
+	n := 1000
+	for i := 0; i < n; i++ {
+		assert.Nil(t, hi.Put([]byte(fmt.Sprintf("key-%04d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)}))
+	}
+	assert.Equal(t, n, hi.Size())
+	assert.LessOrEqual(t, len(hi.hot), 100)
+	assert.Equal(t, n-len(hi.hot), hi.coldSize)
+
+	// 冷数据也能读取、更新和删除
+	for i := 0; i < n; i++ {
+		pos := hi.Get([]byte(fmt.Sprintf("key-%04d", i)))
+		assert.Equal(t, int64(i), pos.Offset)
+	}
+	oldPos := hi.Put([]byte("key-0000"), &data.LogRecordPos{Fid: 2, Offset: 10})
+	assert.Equal(t, int64(0), oldPos.Offset)
+	assert.Equal(t, uint32(2), hi.Get([]byte("key-0000")).Fid)
+
+	for i := 0; i < n; i += 2 {
+		pos, ok := hi.Delete([]byte(fmt.Sprintf("key-%04d", i)))
+		assert.True(t, ok)
+		assert.NotNil(t, pos)
+	}
+	_, ok := hi.Delete([]byte("key-0000"))
+	assert.False(t, ok)
+	assert.Nil(t, hi.Get([]byte("key-0000")))
+	assert.Equal(t, n/2, hi.Size())
+
+	assert.Nil(t, hi.Close())
+	_, err = os.Stat(hi.path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestHybridIndex_Iterator(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-hybrid")
+	defer os.RemoveAll(dir)
+
+	hi, err := NewHybridIndex(dir, 50*(hybridEntryOverhead+8))
+	assert.Nil(t, err)
+	defer hi.Close()
+	bt := NewBtree()
+	for i := 0; i < 500; i += 2 {
+		key := []byte(fmt.Sprintf("key-%04d", i))
+		hi.Put(key, &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+		bt.Put(key, &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+	// 随机访问一部分 Key，让冷热数据交错
+	for i := 0; i < 500; i += 14 {
+		hi.Get([]byte(fmt.Sprintf("key-%04d", i)))
+	}
+	assert.Greater(t, hi.coldSize, 0)
+
+	for _, reverse := range []bool{false, true} {
+		it1, it2 := hi.Iterator(reverse), bt.Iterator(reverse)
+		for it1.Rewind(); it2.Valid(); it2.Next() {
+			assert.True(t, it1.Valid())
+			assert.Equal(t, it2.Key(), it1.Key())
+			assert.Equal(t, it2.Value(), it1.Value())
+			it1.Next()
+		}
+		assert.False(t, it1.Valid())
+
+		for _, key := range []string{"key-0101", "key-0250", "a", "z"} {
+			it1.Seek([]byte(key))
+			it2.Seek([]byte(key))
+			assert.Equal(t, it2.Valid(), it1.Valid())
+			if it2.Valid() {
+				assert.Equal(t, it2.Key(), it1.Key())
+			}
+		}
+		it1.Close()
+		it2.Close()
+	}
+}
+
+func TestHybridIndex_LazyPromotion(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-hybrid")
+	defer os.RemoveAll(dir)
+
+	hi, err := NewHybridIndex(dir, 1000*(hybridEntryOverhead+8))
+	assert.Nil(t, err)
+	defer hi.Close()
+	n := 5000
+	for i := 0; i < n; i++ {
+		hi.Put([]byte(fmt.Sprintf("key-%04d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+
+	// 读取冷数据不会立即提升为热数据
+	for i := 0; i < hybridBatchSize; i++ {
+		key := fmt.Sprintf("key-%04d", i)
+		assert.Equal(t, int64(i), hi.Get([]byte(key)).Offset)
+		assert.NotContains(t, hi.hot, key)
+	}
+	assert.Equal(t, hybridBatchSize, len(hi.promotions))
+
+	// 之后的写入批量提升读取到的 Key
+	hi.Put([]byte("key-new"), &data.LogRecordPos{Fid: 1})
+	assert.Empty(t, hi.promotions)
+	assert.Empty(t, hi.removed)
+	for i := 0; i < hybridBatchSize; i++ {
+		assert.Contains(t, hi.hot, fmt.Sprintf("key-%04d", i))
+	}
+	assert.Equal(t, n+1, hi.Size())
+	assert.Equal(t, n+1-len(hi.hot), hi.coldSize)
+
+	// 被删除的冷数据 Key 在批量删除之前也不会被读取或者遍历到
+	pos, ok := hi.Delete([]byte("key-1000"))
+	assert.True(t, ok)
+	assert.Equal(t, int64(1000), pos.Offset)
+	assert.Contains(t, hi.removed, "key-1000")
+	assert.Nil(t, hi.Get([]byte("key-1000")))
+	for _, reverse := range []bool{false, true} {
+		it := hi.Iterator(reverse)
+		it.Seek([]byte("key-1000"))
+		if reverse {
+			assert.Equal(t, "key-0999", string(it.Key()))
+		} else {
+			assert.Equal(t, "key-1001", string(it.Key()))
+		}
+		it.Close()
+	}
+
+	for i := 0; i < n; i++ {
+		pos := hi.Get([]byte(fmt.Sprintf("key-%04d", i)))
+		if i == 1000 {
+			assert.Nil(t, pos)
+		} else {
+			assert.Equal(t, int64(i), pos.Offset)
+		}
+	}
+	assert.Equal(t, n, hi.Size())
+}
+
+func TestHybridIndex_IteratorDoesNotBlockGet(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-hybrid")
+	defer os.RemoveAll(dir)
+
+	hi, err := NewHybridIndex(dir, 100*(hybridEntryOverhead+8))
+	assert.Nil(t, err)
+	defer hi.Close()
+
+	// 迭代器持有只读事务时，降级需要扩容冷数据文件，写入会等待迭代器关闭
+	it := hi.Iterator(false)
+	var written atomic.Int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20000; i++ {
+			hi.Put([]byte(fmt.Sprintf("key-%05d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+			written.Store(int64(i))
+		}
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	// 等待期间仍然可以读取热数据
+	got := make(chan *data.LogRecordPos)
+	last := written.Load()
+	go func() {
+		got <- hi.Get([]byte(fmt.Sprintf("key-%05d", last)))
+	}()
+	select {
+	case pos := <-got:
+		assert.Equal(t, last, pos.Offset)
+	case <-time.After(2 * time.Second):
+		t.Error("get is blocked by the demotion waiting for the iterator")
+	}
+
+	it.Close()
+	<-done
+	assert.Equal(t, 20000, hi.Size())
+}
@@ -2,9 +2,17 @@ package index
 
 import (
 	"bytes"
+	"errors"
 
 	"bitcask.go/data"
-	"github.com/google/btree"
+)
+
+var (
+	// ErrUnsupportedIndexType 不支持的索引类型
+	ErrUnsupportedIndexType = errors.New("unsupported index type")
+
+	// ErrComparatorNotSupported B+ 树和混合索引按照字节序保存 Key，不支持自定义的比较函数
+	ErrComparatorNotSupported = errors.New("custom comparator is not supported with the b+ tree or hybrid index")
 )
 
 // 定义了一个索引的抽象接口，放入一些数据结构（后续可添加）
@@ -28,6 +36,48 @@ type Indexer interface {
 	Close() error
 }
 
+// BatchIndexer 可以一次更新多个 Key 的索引（可选实现）：整个批次只加一次锁或者只开启一个事务，
+// 结果和逐个调用 Put、Delete 相同
+type BatchIndexer interface {
+	// PutBatch 存储 keys[i] 对应数据的位置 positions[i]，返回每个 Key 之前的位置信息（不存在时为 nil）
+	PutBatch(keys [][]byte, positions []*data.LogRecordPos) []*data.LogRecordPos
+
+	// DeleteBatch 删除 keys 对应的位置信息，返回每个 Key 被删除的位置信息（不存在时为 nil）
+	DeleteBatch(keys [][]byte) []*data.LogRecordPos
+}
+
+// PutBatch 批量更新索引，indexer 没有实现 BatchIndexer 时逐个调用 Put
+func PutBatch(indexer Indexer, keys [][]byte, positions []*data.LogRecordPos) []*data.LogRecordPos {
+	if len(keys) == 0 {
+		return nil
+	}
+	if bi, ok := indexer.(BatchIndexer); ok {
+		return bi.PutBatch(keys, positions)
+	}
+
+	oldPositions := make([]*data.LogRecordPos, len(keys))
+	for i, key := range keys {
+		oldPositions[i] = indexer.Put(key, positions[i])
+	}
+	return oldPositions
+}
+
+// DeleteBatch 批量删除索引，indexer 没有实现 BatchIndexer 时逐个调用 Delete
+func DeleteBatch(indexer Indexer, keys [][]byte) []*data.LogRecordPos {
+	if len(keys) == 0 {
+		return nil
+	}
+	if bi, ok := indexer.(BatchIndexer); ok {
+		return bi.DeleteBatch(keys)
+	}
+
+	oldPositions := make([]*data.LogRecordPos, len(keys))
+	for i, key := range keys {
+		oldPositions[i], _ = indexer.Delete(key)
+	}
+	return oldPositions
+}
+
 // 定义索引类型的枚举
 type IndexType = int8
 
@@ -40,32 +90,109 @@ const (
 
 	// B+树 索引类型
 	BpTree
+
+	// 哈希表索引类型，只适合点查
+	Hash
+
+	// 混合索引类型，内存中的热数据超过上限之后降级到磁盘上
+	Hybrid
+
+	// 紧凑编码的索引类型，Key 和位置信息连续保存在有序的块中
+	Compact
 )
 
+// IndexerOptions 创建索引时的配置，每种索引只使用和自己相关的字段
+type IndexerOptions struct {
+	// B+ 树和混合索引保存数据的目录
+	DirPath string
+
+	// B+ 树每次写入之后是否持久化
+	Sync bool
+
+	// Key 的比较函数，为空时按照字节序
+	Comparator Comparator
+
+	// 紧凑索引是否对同一个块中相邻的 Key 做前缀压缩
+	PrefixCompression bool
+
+	// 混合索引中热数据的内存上限，不大于 0 时使用 DefaultHybridMemoryBudget
+	MemoryBudget int64
+}
+
+// DefaultIndexerOptions 默认的索引配置
+var DefaultIndexerOptions = IndexerOptions{
+	PrefixCompression: true,
+	MemoryBudget:      DefaultHybridMemoryBudget,
+}
+
 // NewIndexer 初始化索引接口实例
-func NewIndexer(typ IndexType, dirPath string, sync bool) Indexer {
+func NewIndexer(typ IndexType, dirPath string, sync bool) (Indexer, error) {
+	return NewIndexerWithComparator(typ, dirPath, sync, nil)
+}
+
+// NewIndexerWithComparator 初始化使用 cmp 决定 Key 顺序的索引，cmp 为空时按照字节序
+func NewIndexerWithComparator(typ IndexType, dirPath string, sync bool, cmp Comparator) (Indexer, error) {
+	opts := DefaultIndexerOptions
+	opts.DirPath = dirPath
+	opts.Sync = sync
+	opts.Comparator = cmp
+	return NewIndexerWithOptions(typ, opts)
+}
+
+// NewIndexerWithOptions 按照 opts 初始化 typ 类型的索引
+// B+ 树和混合索引按照字节序保存 Key，不支持自定义的比较函数，返回 ErrComparatorNotSupported；
+// 混合索引打开冷数据文件失败时返回对应的错误
+func NewIndexerWithOptions(typ IndexType, opts IndexerOptions) (Indexer, error) {
+	cmp := opts.Comparator
 	switch typ {
 	case BTRee:
-		return NewBtree()
+		return NewBtreeWithComparator(cmp), nil
 	case ART:
-		return NewART()
+		return NewARTWithComparator(cmp), nil
+	case Hash:
+		return NewHashIndexWithComparator(cmp), nil
+	case Compact:
+		return NewCompactIndex(opts.PrefixCompression, cmp), nil
+	case Hybrid:
+		if cmp != nil {
+			return nil, ErrComparatorNotSupported
+		}
+		budget := opts.MemoryBudget
+		if budget <= 0 {
+			budget = DefaultHybridMemoryBudget
+		}
+		hybrid, err := NewHybridIndex(opts.DirPath, budget)
+		if err != nil {
+			return nil, err
+		}
+		return hybrid, nil
 	case BpTree:
-		return NewBPlusTree(dirPath, sync)
+		if cmp != nil {
+			return nil, ErrComparatorNotSupported
+		}
+		return NewBPlusTree(opts.DirPath, opts.Sync), nil
 	default:
-		panic("unsupported index data type") //不支持这种索引结构
+		return nil, ErrUnsupportedIndexType //不支持这种索引结构
 	}
 }
 
+// Comparator 比较两个 Key 的大小：a 小于 b 返回负数，相等返回 0，大于返回正数
+// 注意：只有两个 Key 的字节完全相同时才能返回 0，否则不同的 Key 会被 BTree 当作同一个 Key
+type Comparator func(a, b []byte) int
+
+// compare 使用 cmp 比较两个 Key，cmp 为空时按照字节序比较
+func (cmp Comparator) compare(a, b []byte) int {
+	if cmp == nil {
+		return bytes.Compare(a, b)
+	}
+	return cmp(a, b)
+}
+
 type Item struct {
 	key []byte
 	pos *data.LogRecordPos
 }
 
-// Less 判断key值，传入 bi 的 key 大于已有的 ai 的 key 保证文件读写顺序
-func (ai *Item) Less(bi btree.Item) bool {
-	return bytes.Compare(ai.key, bi.(*Item).key) == -1
-}
-
 // Iterator 抽象通用索引迭代器的接口
 type Iterator interface {
 	// 获取当前遍历位置的 Key 数据
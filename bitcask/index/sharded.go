@@ -0,0 +1,193 @@
+package index
+
+import "bitcask.go/data"
+
+// ShardedIndex 按照 Key 的哈希值把索引分成多个分片，每个分片是一个独立的内存索引，有自己的锁
+// 不同分片上的读写互不阻塞；遍历时再把所有分片的迭代器按照 Key 的顺序归并起来
+type ShardedIndex struct {
+	shards []Indexer
+	cmp    Comparator // Key 的比较函数，为空时按照字节序
+}
+
+// NewShardedIndex 初始化 n 个分片的索引，每个分片都是按照 opts 创建的 typ 类型的索引
+// 只支持内存索引，typ 为 B+ 树或者混合索引时返回 ErrUnsupportedIndexType
+func NewShardedIndex(typ IndexType, n int, opts IndexerOptions) (*ShardedIndex, error) {
+	if typ == BpTree || typ == Hybrid {
+		return nil, ErrUnsupportedIndexType
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	shards := make([]Indexer, n)
+	for i := range shards {
+		shard, err := NewIndexerWithOptions(typ, opts)
+		if err != nil {
+			return nil, err
+		}
+		shards[i] = shard
+	}
+	return &ShardedIndex{shards: shards, cmp: opts.Comparator}, nil
+}
+
+// shard 使用 FNV-1a 哈希选择 Key 所在的分片
+func (si *ShardedIndex) shard(key []byte) Indexer {
+	return si.shards[si.shardIndex(key)]
+}
+
+func (si *ShardedIndex) shardIndex(key []byte) int {
+	hash := uint32(2166136261)
+	for _, b := range key {
+		hash ^= uint32(b)
+		hash *= 16777619
+	}
+	return int(hash % uint32(len(si.shards)))
+}
+
+// group 按照所在的分片把 Key 分组，返回每个分片中的 Key 在 keys 中的下标
+func (si *ShardedIndex) group(keys [][]byte) [][]int {
+	groups := make([][]int, len(si.shards))
+	for i, key := range keys {
+		s := si.shardIndex(key)
+		groups[s] = append(groups[s], i)
+	}
+	return groups
+}
+
+func (si *ShardedIndex) Put(key []byte, pos *data.LogRecordPos) *data.LogRecordPos {
+	return si.shard(key).Put(key, pos)
+}
+
+func (si *ShardedIndex) Get(key []byte) *data.LogRecordPos {
+	return si.shard(key).Get(key)
+}
+
+func (si *ShardedIndex) Delete(key []byte) (*data.LogRecordPos, bool) {
+	return si.shard(key).Delete(key)
+}
+
+// PutBatch 按照分片把 Key 分组，每个分片批量更新
+func (si *ShardedIndex) PutBatch(keys [][]byte, positions []*data.LogRecordPos) []*data.LogRecordPos {
+	oldPositions := make([]*data.LogRecordPos, len(keys))
+	for s, group := range si.group(keys) {
+		shardKeys := make([][]byte, len(group))
+		shardPositions := make([]*data.LogRecordPos, len(group))
+		for j, i := range group {
+			shardKeys[j], shardPositions[j] = keys[i], positions[i]
+		}
+		for j, oldPos := range PutBatch(si.shards[s], shardKeys, shardPositions) {
+			oldPositions[group[j]] = oldPos
+		}
+	}
+	return oldPositions
+}
+
+// DeleteBatch 按照分片把 Key 分组，每个分片批量删除
+func (si *ShardedIndex) DeleteBatch(keys [][]byte) []*data.LogRecordPos {
+	oldPositions := make([]*data.LogRecordPos, len(keys))
+	for s, group := range si.group(keys) {
+		shardKeys := make([][]byte, len(group))
+		for j, i := range group {
+			shardKeys[j] = keys[i]
+		}
+		for j, oldPos := range DeleteBatch(si.shards[s], shardKeys) {
+			oldPositions[group[j]] = oldPos
+		}
+	}
+	return oldPositions
+}
+
+func (si *ShardedIndex) Size() int {
+	var size int
+	for _, shard := range si.shards {
+		size += shard.Size()
+	}
+	return size
+}
+
+func (si *ShardedIndex) Iterator(reverse bool) Iterator {
+	iters := make([]Iterator, len(si.shards))
+	for i, shard := range si.shards {
+		iters[i] = shard.Iterator(reverse)
+	}
+	it := &shardedIterator{iters: iters, reverse: reverse, cmp: si.cmp}
+	it.pick()
+	return it
+}
+
+func (si *ShardedIndex) Close() error {
+	for _, shard := range si.shards {
+		if err := shard.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shardedIterator 归并所有分片的迭代器，每次取出所有分片当前 Key 中最小（反向时最大）的一个
+// 分片的数量一般很少，直接线性比较就足够了
+type shardedIterator struct {
+	iters   []Iterator
+	reverse bool
+	cmp     Comparator
+	cur     int // 当前 Key 所在的分片迭代器，-1 表示已经遍历完了
+}
+
+// pick 选出当前 Key 所在的分片迭代器
+func (it *shardedIterator) pick() {
+	it.cur = -1
+	for i, iter := range it.iters {
+		if !iter.Valid() {
+			continue
+		}
+		if it.cur < 0 {
+			it.cur = i
+			continue
+		}
+		c := it.cmp.compare(iter.Key(), it.iters[it.cur].Key())
+		if (!it.reverse && c < 0) || (it.reverse && c > 0) {
+			it.cur = i
+		}
+	}
+}
+
+func (it *shardedIterator) Rewind() {
+	for _, iter := range it.iters {
+		iter.Rewind()
+	}
+	it.pick()
+}
+
+func (it *shardedIterator) Seek(key []byte) {
+	for _, iter := range it.iters {
+		iter.Seek(key)
+	}
+	it.pick()
+}
+
+// Next 同一个 Key 只会在一个分片中，推进当前的分片迭代器之后重新选择即可
+func (it *shardedIterator) Next() {
+	if it.cur < 0 {
+		return
+	}
+	it.iters[it.cur].Next()
+	it.pick()
+}
+
+func (it *shardedIterator) Valid() bool {
+	return it.cur >= 0
+}
+
+func (it *shardedIterator) Key() []byte {
+	return it.iters[it.cur].Key()
+}
+
+func (it *shardedIterator) Value() *data.LogRecordPos {
+	return it.iters[it.cur].Value()
+}
+
+func (it *shardedIterator) Close() {
+	for _, iter := range it.iters {
+		iter.Close()
+	}
+}
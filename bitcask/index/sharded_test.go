@@ -0,0 +1,111 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bitcask.go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardedIndex_PutGetDelete(t *testing.T) {
+	si, err := NewShardedIndex(BTRee, 4, DefaultIndexerOptions)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, si.Put([]byte(fmt.Sprintf("key-%03d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)}))
+	}
+	assert.Equal(t, 100, si.Size())
+
+	oldPos := si.Put([]byte("key-010"), &data.LogRecordPos{Fid: 2, Offset: 10})
+	assert.Equal(t, int64(10), oldPos.Offset)
+	assert.Equal(t, uint32(2), si.Get([]byte("key-010")).Fid)
+
+	oldPos, ok := si.Delete([]byte("key-020"))
+	assert.True(t, ok)
+	assert.Equal(t, int64(20), oldPos.Offset)
+	assert.Nil(t, si.Get([]byte("key-020")))
+	assert.Equal(t, 99, si.Size())
+
+	// 数据应该分散到了不同的分片中
+	for _, shard := range si.shards {
+		assert.Greater(t, shard.Size(), 0)
+	}
+	assert.Nil(t, si.Close())
+}
+
+func TestShardedIndex_Iterator(t *testing.T) {
+	for _, typ := range []IndexType{BTRee, ART} {
+		si, err := NewShardedIndex(typ, 8, DefaultIndexerOptions)
+		assert.Nil(t, err)
+		bt := NewBtree()
+		for i := 0; i < 200; i += 2 {
+			key := []byte(fmt.Sprintf("key-%03d", i))
+			si.Put(key, &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+			bt.Put(key, &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+		}
+
+		for _, reverse := range []bool{false, true} {
+			it1, it2 := si.Iterator(reverse), bt.Iterator(reverse)
+			for it1.Rewind(); it2.Valid(); it2.Next() {
+				assert.True(t, it1.Valid())
+				assert.Equal(t, it2.Key(), it1.Key())
+				assert.Equal(t, it2.Value(), it1.Value())
+				it1.Next()
+			}
+			assert.False(t, it1.Valid())
+
+			it1.Seek([]byte("key-101"))
+			it2.Seek([]byte("key-101"))
+			assert.Equal(t, it2.Key(), it1.Key())
+			it1.Close()
+			it2.Close()
+		}
+	}
+}
+
+func TestShardedIndex_IteratorComparator(t *testing.T) {
+	opts := DefaultIndexerOptions
+	opts.Comparator = ReverseComparator
+	si, err := NewShardedIndex(BTRee, 4, opts)
+	assert.Nil(t, err)
+	for _, key := range []string{"a", "c", "e", "b", "d"} {
+		si.Put([]byte(key), &data.LogRecordPos{Fid: 1})
+	}
+
+	var keys []string
+	it := si.Iterator(false)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	assert.Equal(t, []string{"e", "d", "c", "b", "a"}, keys)
+
+	it.Seek([]byte("bb"))
+	assert.Equal(t, "b", string(it.Key()))
+}
+
+func TestNewIndexerWithOptions_Errors(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-index-errors")
+	defer os.RemoveAll(dir)
+
+	// B+ 树和混合索引不支持自定义的比较函数
+	opts := DefaultIndexerOptions
+	opts.DirPath = dir
+	opts.Comparator = ReverseComparator
+	_, err := NewIndexerWithOptions(BpTree, opts)
+	assert.Equal(t, ErrComparatorNotSupported, err)
+	_, err = NewIndexerWithOptions(Hybrid, opts)
+	assert.Equal(t, ErrComparatorNotSupported, err)
+
+	// 混合索引的冷数据文件无法打开
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, HybridIndexFileName, "sub"), os.ModePerm))
+	_, err = NewIndexerWithOptions(Hybrid, IndexerOptions{DirPath: dir})
+	assert.NotNil(t, err)
+
+	_, err = NewIndexerWithOptions(IndexType(100), DefaultIndexerOptions)
+	assert.Equal(t, ErrUnsupportedIndexType, err)
+	_, err = NewShardedIndex(Hybrid, 4, DefaultIndexerOptions)
+	assert.Equal(t, ErrUnsupportedIndexType, err)
+}
@@ -0,0 +1,71 @@
+package bitcask
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bitcask.go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_InMemory(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(os.TempDir(), "bitcask-go-in-memory")
+	opts.InMemory = true
+	opts.DataFileSize = 32 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.IndexType = BPlusTree
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	for i := 0; i < 2000; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(64)))
+	}
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, db.Delete(utils.GetTestKey(i)))
+	}
+	assert.Nil(t, db.Put(utils.GetTestKey(1500), []byte("latest")))
+	assert.True(t, db.Stat().DataFileNum > 1)
+
+	// merge 之后无效数据被回收，有效数据都还在
+	sizeBefore := db.Stat().DiskSize
+	assert.Nil(t, db.Merge())
+	assert.True(t, db.Stat().DiskSize < sizeBefore)
+	assert.Equal(t, 1000, len(db.ListKeys()))
+	_, err = db.Get(utils.GetTestKey(10))
+	assert.Equal(t, ErrKeyNotFound, err)
+	val, err := db.Get(utils.GetTestKey(1500))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("latest"), val)
+	for i := 1000; i < 2000; i++ {
+		_, err := db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+
+	// merge 之后继续写入和再次 merge
+	for i := 1000; i < 1500; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), []byte("new")))
+	}
+	assert.Nil(t, db.Merge())
+	val, err = db.Get(utils.GetTestKey(1200))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new"), val)
+
+	_, err = db.Checkpoint(filepath.Join(os.TempDir(), "bitcask-go-in-memory-checkpoint"))
+	assert.Equal(t, ErrNotSupportedInMemory, err)
+	assert.Nil(t, db.Close())
+
+	// 没有创建任何目录
+	_, err = os.Stat(opts.DirPath)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(mergeDirPath(opts.DirPath))
+	assert.True(t, os.IsNotExist(err))
+
+	// 内存模式下不需要目录
+	opts.DirPath = ""
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db2.Put([]byte("k"), []byte("v")))
+	assert.Nil(t, db2.Close())
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"testing"
 
+	"bitcask.go/index"
 	"bitcask.go/utils"
 	"github.com/stretchr/testify/assert"
 )
@@ -100,3 +101,30 @@ func TestDB_Iterator_Multi_Values(t *testing.T) {
 	}
 	iter3.Close()
 }
+
+func TestIterator_Comparator(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-iterator-comparator")
+	opts.DirPath = dir
+	opts.Comparator = index.NaturalComparator
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for _, key := range []string{"item-10", "item-9", "item-100", "item-1"} {
+		assert.Nil(t, db.Put([]byte(key), []byte(key)))
+	}
+
+	iterator := db.NewIterator(DefaultIteratorOptions)
+	var keys []string
+	for iterator.Seek([]byte("item-5")); iterator.Valid(); iterator.Next() {
+		keys = append(keys, string(iterator.Key()))
+	}
+	iterator.Close()
+	assert.Equal(t, []string{"item-9", "item-10", "item-100"}, keys)
+
+	// B+ 树按照字节序保存 Key，不支持自定义的比较函数
+	opts.IndexType = BPlusTree
+	_, err = Open(opts)
+	assert.Equal(t, ErrComparatorNotSupported, err)
+}
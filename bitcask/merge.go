@@ -9,20 +9,28 @@ import (
 	"strconv"
 
 	"bitcask.go/data"
+	"bitcask.go/index"
 	"bitcask.go/utils"
 )
 
 const (
 	mergeFileName    = "-merge"
 	mergeFinishedKey = "merge.finished"
+
+	// hintLoadBatchSize 从 hint 文件加载索引时每一批更新的 Key 数量
+	hintLoadBatchSize = 1024
 )
 
 func (db *DB) Merge() error {
+	if db.option.ReadOnly {
+		return ErrReadOnly
+	}
 	if db.activeFile == nil {
 		return nil
 	}
 
 	db.rwmu.Lock()
+	db.waitPendingWrites()
 	if db.isMerging {
 		//勿忘解锁后返回所悟
 		db.rwmu.Unlock()
@@ -30,7 +38,7 @@ func (db *DB) Merge() error {
 	}
 
 	//查看当前无效数据是否达到用户设置的merge ratio 阈值
-	totalSize, err := utils.DirSize(db.option.DirPath)
+	totalSize, err := db.dataSize()
 	if err != nil {
 		//注意，要解锁
 		db.rwmu.Unlock()
@@ -43,16 +51,18 @@ func (db *DB) Merge() error {
 		return ErrUnderMergeRatio
 	}
 
-	//查看剩余空间容量是否可以装下Merge后的数据量
-	availableDiskSize, err := utils.AvailableDiskSize()
-	if err != nil {
-		db.rwmu.Unlock()
-		return err
-	}
-	//如果超过了磁盘的容量直接返回错误
-	if uint64(totalSize-db.reclaimSize) >= availableDiskSize {
-		db.rwmu.Unlock()
-		return ErrNotEnoughSpaceToMerge
+	//查看剩余空间容量是否可以装下Merge后的数据量（内存模式下不占用磁盘空间）
+	if !db.option.InMemory {
+		availableDiskSize, err := utils.AvailableDiskSize()
+		if err != nil {
+			db.rwmu.Unlock()
+			return err
+		}
+		//如果超过了磁盘的容量直接返回错误
+		if uint64(totalSize-db.reclaimSize) >= availableDiskSize {
+			db.rwmu.Unlock()
+			return ErrNotEnoughSpaceToMerge
+		}
 	}
 
 	//如果没有在Merge,我们开始进行Merge操作
@@ -64,7 +74,7 @@ func (db *DB) Merge() error {
 	//对当前的活跃文件持久化处理
 	if err := db.activeFile.Sync(); err != nil {
 		db.rwmu.Unlock()
-		return nil
+		return err
 	}
 
 	//将当前的活跃文件转化为旧的文件
@@ -73,10 +83,12 @@ func (db *DB) Merge() error {
 	// 生成一个新的活跃文件
 	if err := db.setActiveFile(); err != nil {
 		db.rwmu.Unlock()
-		return nil
+		return err
 	}
 	// 这个文件没有参与Merge操作
 	nonMergeFileId := db.activeFile.FileID
+	// 参与Merge的文件中的无效数据量，Merge之后就被回收了
+	mergedReclaimSize := db.reclaimSize
 
 	//取出所有需要Merge的文件，并可以释放锁了
 	var mergeFiles []*data.DataFile
@@ -93,6 +105,11 @@ func (db *DB) Merge() error {
 		return mergeFiles[i].FileID < mergeFiles[j].FileID
 	})
 
+	//内存模式下没有 merge 目录，重写完成之后直接替换原来的数据文件
+	if db.option.InMemory {
+		return db.mergeInMemory(mergeFiles, nonMergeFileId, mergedReclaimSize)
+	}
+
 	mergePath := db.getMergePath()
 	// 如果merge文件还存在，说明之前发生过Merge,不需要再Merge一遍，直接删除
 	if _, err := os.Stat(mergePath); err == nil {
@@ -110,19 +127,75 @@ func (db *DB) Merge() error {
 	mergeOptions.DirPath = mergePath
 	// 这里不需要Sync，每次打开都Sync会降低很多性能
 	mergeOptions.SyncWrites = false
+	// 重写的都是之前写入的数据，不能带有新的时间点标记
+	mergeOptions.RestorePointInterval = 0
 
 	mergeDB, err := Open(mergeOptions)
 	if err != nil {
 		return err
 	}
+	// 关闭 merge 的数据文件（可写的内存映射在关闭的时候才会截断预分配的空间），并释放 merge 目录的文件锁
+	defer func() {
+		_ = mergeDB.Close()
+	}()
 
 	// 打开hint文件储存索引
 	hintFile, err := data.OpenHintFile(mergePath)
 	if err != nil {
 		return err
 	}
+	if err := db.wrapIOManager(hintFile); err != nil {
+		return err
+	}
 
 	// 遍历所有需要Merge的文件，重写有效数据
+	err = db.rewriteMergeFiles(mergeFiles, mergeDB, func(namespace uint32, realKey []byte, pos *data.LogRecordPos) error {
+		// 将当前位置的索引写入hint文件,创建一条新的LogRecord方法，但只储存索引和原始的Key
+		return hintFile.WriteNamespaceHintRecord(namespace, realKey, pos)
+	})
+	if err != nil {
+		return err
+	}
+
+	// 所有文件都重写完之后，才开始持久化操作（对最新的hintFile）
+	if err := hintFile.Sync(); err != nil {
+		return err
+	}
+	if err := mergeDB.Sync(); err != nil {
+		return err
+	}
+
+	//在末尾添加一个标识Merge完成的标识
+	mergeFinishdeFile, err := data.OpenMergeFinishedFile(mergePath)
+	if err != nil {
+		return err
+	}
+	if err := db.wrapIOManager(mergeFinishdeFile); err != nil {
+		return err
+	}
+
+	mergeFinishedRecord := &data.LogRecord{
+		Key:   []byte(mergeFinishedKey),
+		Value: []byte(strconv.Itoa(int(nonMergeFileId))),
+	}
+
+	//比最后这个merge文件小的，代表都经过了merge处理
+	encRecord, _ := data.EncodeLogRecord(mergeFinishedRecord)
+	if err := mergeFinishdeFile.Write(encRecord); err != nil {
+		return err
+	}
+
+	//写完之后，对最后一个标识文件进行持久化
+	if err := mergeFinishdeFile.Sync(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// rewriteMergeFiles 将 mergeFiles 中的有效数据重写到 mergeDB 中，每重写一条数据就调用一次 onRewrite
+// 已经被删除的命名空间中的数据不会被重写
+func (db *DB) rewriteMergeFiles(mergeFiles []*data.DataFile, mergeDB *DB, onRewrite func(namespace uint32, realKey []byte, pos *data.LogRecordPos) error) error {
 	for _, dataFile := range mergeFiles {
 		//从零开始遍历
 		var offset int64 = 0
@@ -140,19 +213,30 @@ func (db *DB) Merge() error {
 			//解析拿到的Key
 			realKey, _ := parseLogRecordKey(logRecord.Key)
 			//获取内存索引信息
-			logRecordPos := db.index.Get(realKey)
+			var logRecordPos *data.LogRecordPos
+			db.rwmu.RLock()
+			if idx := db.indexOf(logRecord.Namespace); idx != nil {
+				logRecordPos = idx.Get(realKey)
+			}
+			db.rwmu.RUnlock()
 
 			//和内存中的所有进行比较判断，如果是有效的数据则重写
 			if logRecordPos != nil && logRecordPos.Fid == dataFile.FileID && logRecordPos.Offset == offset {
-				//写进临时目录当中
+				//合并操作数和之前的记录合并成一条完整的数据之后再重写
+				if logRecord.Type == data.LogRecordMerge {
+					value, err := db.resolveMergeOperands(dataFile, logRecord)
+					if err != nil {
+						return err
+					}
+					logRecord.Value, logRecord.Type = value, data.LogRecordNormal
+				}
+				//写进临时的数据库当中
 				logRecord.Key = logRecordKeyWithSeqNum(realKey, nonTransactionSeqNum)
 				pos, err := mergeDB.appendLogRecord(logRecord)
 				if err != nil {
 					return err
 				}
-
-				// 将当前位置的索引写入hint文件,创建一条新的LogRecord方法，但只储存索引和原始的Key
-				if err := hintFile.WriteHintRecord(realKey, pos); err != nil {
+				if err := onRewrite(logRecord.Namespace, realKey, pos); err != nil {
 					return err
 				}
 			}
@@ -160,44 +244,79 @@ func (db *DB) Merge() error {
 			offset += logRecordSize
 		}
 	}
+	return nil
+}
 
-	// 所有文件都重写完之后，才开始持久化操作（对最新的hintFile）
-	if err := hintFile.Sync(); err != nil {
-		return err
-	}
-	if err := mergeDB.Sync(); err != nil {
+// mergeInMemory 内存模式下的 merge：将有效数据重写到新的内存数据文件中，然后直接替换参与 merge 的文件并更新索引
+func (db *DB) mergeInMemory(mergeFiles []*data.DataFile, nonMergeFileId uint32, mergedReclaimSize int64) error {
+	mergeOptions := db.option
+	mergeOptions.SyncWrites = false
+	mergeDB, err := Open(mergeOptions)
+	if err != nil {
 		return err
 	}
 
-	//在末尾添加一个标识Merge完成的标识
-	mergeFinishdeFile, err := data.OpenMergeFinishedFile(mergePath)
+	// 记录下重写之后每个 Key 的新位置
+	var mergedNamespaces []uint32
+	var mergedKeys [][]byte
+	var mergedPos []*data.LogRecordPos
+	err = db.rewriteMergeFiles(mergeFiles, mergeDB, func(namespace uint32, realKey []byte, pos *data.LogRecordPos) error {
+		mergedNamespaces = append(mergedNamespaces, namespace)
+		mergedKeys = append(mergedKeys, realKey)
+		mergedPos = append(mergedPos, pos)
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	mergeFinishedRecord := &data.LogRecord{
-		Key:   []byte(mergeFinishedKey),
-		Value: []byte(strconv.Itoa(int(nonMergeFileId))),
+	db.rwmu.Lock()
+	defer db.rwmu.Unlock()
+	db.waitPendingWrites()
+
+	//重写之后的文件 ID 从 0 开始，一定比 nonMergeFileId 小，不会和没有参与 merge 的文件冲突
+	for _, file := range mergeFiles {
+		delete(db.oldFiles, file.FileID)
+	}
+	for fileID, file := range mergeDB.oldFiles {
+		db.oldFiles[fileID] = file
+	}
+	if mergeDB.activeFile != nil {
+		db.oldFiles[mergeDB.activeFile.FileID] = mergeDB.activeFile
 	}
 
-	//比最后这个merge文件小的，代表都经过了merge处理
-	encRecord, _ := data.EncodeLogRecord(mergeFinishedRecord)
-	if err := mergeFinishdeFile.Write(encRecord); err != nil {
-		return err
+	//merge 过程中被重新写入的 Key 已经指向了更新的文件，只更新仍然指向参与 merge 的文件的 Key
+	for i, key := range mergedKeys {
+		idx := db.indexOf(mergedNamespaces[i])
+		if idx == nil {
+			continue
+		}
+		if pos := idx.Get(key); pos != nil && pos.Fid < nonMergeFileId {
+			idx.Put(key, mergedPos[i])
+		}
 	}
 
-	//写完之后，对最后一个标识文件进行持久化
-	if err := mergeFinishdeFile.Sync(); err != nil {
-		return err
+	//旧的文件已经没有被索引引用了，释放它们的内存
+	for _, file := range mergeFiles {
+		_ = file.Close()
 	}
 
-	return nil
+	db.reclaimSize -= mergedReclaimSize
+	if db.reclaimSize < 0 {
+		db.reclaimSize = 0
+	}
+	return mergeDB.index.Close()
 }
 
 // 获取merge文件目录的函数
 func (db *DB) getMergePath() string {
-	dir := path.Dir(path.Clean(db.option.DirPath)) // path.Clean:去掉末尾的 /
-	base := path.Base(db.option.DirPath)
+	return mergeDirPath(db.option.DirPath)
+}
+
+// mergeDirPath 数据目录对应的 merge 目录：和数据目录同级，名称加上 -merge 后缀
+func mergeDirPath(dirPath string) string {
+	dir := path.Dir(path.Clean(dirPath)) // path.Clean:去掉末尾的 /
+	base := path.Base(dirPath)
 	return filepath.Join(dir, base+mergeFileName)
 }
 
@@ -251,6 +370,10 @@ func (db *DB) loadMergeFiles() error {
 	//但是我们需要取到最后一个没有merge的文件（可以看作活跃文件）否则会导致数据不完整
 	nonMergeFileID, err := db.getNonMergeFileID(mergePath)
 	if err != nil {
+		//标识文件已经创建但是记录没有完整写入（写入的过程中崩溃了），说明这次Merge没有完成
+		if err == io.EOF || err == data.ErrIncompleteLogRecord || err == data.ErrInvalidCRC {
+			return nil
+		}
 		return err
 	}
 
@@ -287,10 +410,11 @@ func (db *DB) loadMergeFiles() error {
 
 // getNonMergeFileID 获取最新一个没有参与Merge操作的文件ID
 func (db *DB) getNonMergeFileID(dirPath string) (uint32, error) {
-	mergeFinishedFile, err := data.OpenMergeFinishedFile(dirPath)
+	mergeFinishedFile, err := data.OpenReadOnlyFile(filepath.Join(dirPath, data.MergeFinishedFilename), 0)
 	if err != nil {
 		return 0, err
 	}
+	defer mergeFinishedFile.Close()
 
 	record, _, err := mergeFinishedFile.ReadLogRecord(0) //因为之后一条数据，所有偏移量为0
 	if err != nil {
@@ -312,14 +436,27 @@ func (db *DB) loadIndexFromHintFiles() error {
 		return nil
 	}
 
-	//打开Hint文件
-	hintFile, err := data.OpenHintFile(db.option.DirPath)
+	//打开Hint文件，只需要读取，使用只读的方式打开
+	hintFile, err := data.OpenReadOnlyFile(hintFileName, 0)
 	if err != nil {
 		return err
 	}
-
-	//读取文件中的索引
-	var offset int64 = 0
+	defer hintFile.Close()
+
+	//读取文件中的索引，同一个命名空间中连续的 Key 攒成一批，批量更新索引
+	var (
+		offset    int64 = 0
+		namespace uint32
+		keys      = make([][]byte, 0, hintLoadBatchSize)
+		positions = make([]*data.LogRecordPos, 0, hintLoadBatchSize)
+	)
+	flush := func() {
+		//存放到索引当中（命名空间已经被删除的话直接丢弃）
+		if idx := db.indexOf(namespace); idx != nil {
+			index.PutBatch(idx, keys, positions)
+		}
+		keys, positions = keys[:0], positions[:0]
+	}
 	for {
 		logRecord, size, err := hintFile.ReadLogRecord(offset)
 		if err != nil {
@@ -331,14 +468,18 @@ func (db *DB) loadIndexFromHintFiles() error {
 			return err
 		}
 
-		//解码，拿到实际的索引信息
-		logRecordPos := data.DecodeLogRecordPos(logRecord.Value)
+		if len(keys) == hintLoadBatchSize || (len(keys) > 0 && logRecord.Namespace != namespace) {
+			flush()
+		}
 
-		//存放到索引当中
-		db.index.Put(logRecord.Key, logRecordPos)
+		//解码，拿到实际的索引信息
+		namespace = logRecord.Namespace
+		keys = append(keys, logRecord.Key)
+		positions = append(positions, data.DecodeLogRecordPos(logRecord.Value))
 
 		//别忘修改偏移量
 		offset += size
 	}
+	flush()
 	return nil
 }
@@ -0,0 +1,201 @@
+package bitcask
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"bitcask.go/data"
+)
+
+// MergeOperator 合并操作：DB.MergeValue 只追加写入操作数，读取时再把操作数依次合并到之前的值上
+// 类似 RocksDB 的 merge operator，计数器、追加列表之类的读-改-写操作不需要先读出旧值
+type MergeOperator interface {
+	// Name 合并操作的名称
+	Name() string
+
+	// FullMerge 将 operands 按照写入的顺序依次合并到 existing 上，返回合并之后的值
+	// Key 不存在（或者已经被删除）时 existing 为 nil
+	FullMerge(key, existing []byte, operands [][]byte) ([]byte, error)
+}
+
+// MergeValue 为 key 追加写入一个合并操作数，读取时由 Options.MergeOperator 合并出实际的值
+// 操作数会引用同一个数据文件中这个 Key 的前一条记录；前一条记录在更早的数据文件中时，
+// 会读出当前的值合并之后写入一条完整的记录，保证引用不会跨越数据文件（merge 时可以安全地重写旧文件）
+func (db *DB) MergeValue(key []byte, operand []byte) error {
+	if db.option.ReadOnly {
+		return ErrReadOnly
+	}
+	if db.option.MergeOperator == nil {
+		return ErrMergeOperatorNotSet
+	}
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+
+	db.rwmu.Lock()
+	defer db.rwmu.Unlock()
+	// 并发写入的 Put 提交之后才能读取到 Key 最新的位置，否则合并操作数会引用一条过期的记录
+	db.waitPendingWrites()
+
+	logRecord := &data.LogRecord{
+		Key:   logRecordKeyWithSeqNum(key, nonTransactionSeqNum),
+		Value: data.EncodeMergeOperand(-1, operand),
+		Type:  data.LogRecordMerge,
+	}
+
+	prevPos := db.index.Get(key)
+	if prevPos != nil {
+		logRecord.Value = data.EncodeMergeOperand(prevPos.Offset, operand)
+		if !db.canAppendToActiveFile(prevPos, logRecord) {
+			// 前一条记录不在活跃文件中，直接合并成完整的数据
+			existing, err := db.getValueByPosition(prevPos)
+			if err != nil {
+				return err
+			}
+			value, err := db.option.MergeOperator.FullMerge(key, existing, [][]byte{operand})
+			if err != nil {
+				return err
+			}
+			logRecord.Value, logRecord.Type = value, data.LogRecordNormal
+		}
+	}
+
+	pos, err := db.appendLogRecord(logRecord)
+	if err != nil {
+		return err
+	}
+
+	//合并操作数仍然引用着之前的记录，只有写入完整数据的时候之前的记录才失效
+	if oldPos := db.index.Put(key, pos); oldPos != nil && logRecord.Type == data.LogRecordNormal {
+		db.reclaimSize += int64(oldPos.Size)
+	}
+	return nil
+}
+
+// canAppendToActiveFile pos 是否在活跃文件中，并且写入 logRecord 之后不会切换活跃文件
+// 注意！！！使用这个 DB 方法的时候必须持有互斥锁
+func (db *DB) canAppendToActiveFile(pos *data.LogRecordPos, logRecord *data.LogRecord) bool {
+	if db.activeFile == nil || db.activeFile.FileID != pos.Fid {
+		return false
+	}
+	_, size := data.EncodeLogRecord(logRecord)
+	return db.activeFile.Offsetnow+size <= db.option.DataFileSize
+}
+
+// resolveMergeOperands 从合并操作数记录开始，沿着前一条记录的偏移量在 dataFile 中向前读取，
+// 直到遇到完整的数据或者没有前一条记录，再用 MergeOperator 合并出实际的值
+func (db *DB) resolveMergeOperands(dataFile *data.DataFile, logRecord *data.LogRecord) ([]byte, error) {
+	if db.option.MergeOperator == nil {
+		return nil, ErrMergeOperatorNotSet
+	}
+	if dataFile == nil {
+		return nil, ErrDataFileNotFound
+	}
+
+	realKey, _ := parseLogRecordKey(logRecord.Key)
+	var existing []byte
+	var operands [][]byte
+	for {
+		prevOffset, operand := data.DecodeMergeOperand(logRecord.Value)
+		operands = append(operands, operand)
+		if prevOffset < 0 {
+			break
+		}
+
+		var err error
+		if logRecord, _, err = dataFile.ReadLogRecord(prevOffset); err != nil {
+			return nil, err
+		}
+		if logRecord.Type == data.LogRecordNormal {
+			// 空值也是存在的值，和不存在的 Key 区分开
+			existing = append([]byte{}, logRecord.Value...)
+			break
+		}
+		if logRecord.Type != data.LogRecordMerge {
+			return nil, ErrDataFileCorrupted
+		}
+	}
+
+	// 操作数是从后向前读取的，合并时需要按照写入的顺序
+	for i, j := 0, len(operands)-1; i < j; i, j = i+1, j-1 {
+		operands[i], operands[j] = operands[j], operands[i]
+	}
+	return db.option.MergeOperator.FullMerge(realKey, existing, operands)
+}
+
+// NewInt64AddOperator 整数加法：值和操作数都是十进制的 int64 字符串，不存在的 Key 从 0 开始累加
+func NewInt64AddOperator() MergeOperator {
+	return int64AddOperator{}
+}
+
+type int64AddOperator struct{}
+
+func (int64AddOperator) Name() string {
+	return "int64add"
+}
+
+func (int64AddOperator) FullMerge(_, existing []byte, operands [][]byte) ([]byte, error) {
+	var sum int64
+	if len(existing) > 0 {
+		n, err := strconv.ParseInt(string(existing), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: existing value %q is not an integer", ErrInvalidMergeOperand, existing)
+		}
+		sum = n
+	}
+	for _, operand := range operands {
+		n, err := strconv.ParseInt(string(operand), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q is not an integer", ErrInvalidMergeOperand, operand)
+		}
+		sum += n
+	}
+	return []byte(strconv.FormatInt(sum, 10)), nil
+}
+
+// NewStringAppendOperator 字符串追加：将操作数依次追加到值的末尾，每两个元素之间插入 delimiter
+func NewStringAppendOperator(delimiter []byte) MergeOperator {
+	return stringAppendOperator{delimiter: delimiter}
+}
+
+type stringAppendOperator struct {
+	delimiter []byte
+}
+
+func (stringAppendOperator) Name() string {
+	return "stringappend"
+}
+
+func (op stringAppendOperator) FullMerge(_, existing []byte, operands [][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(existing)
+	for i, operand := range operands {
+		if existing != nil || i > 0 {
+			buf.Write(op.delimiter)
+		}
+		buf.Write(operand)
+	}
+	return buf.Bytes(), nil
+}
+
+// NewMaxOperator 最大值：按照字节序比较，保留值和所有操作数中最大的一个
+func NewMaxOperator() MergeOperator {
+	return maxOperator{}
+}
+
+type maxOperator struct{}
+
+func (maxOperator) Name() string {
+	return "max"
+}
+
+func (maxOperator) FullMerge(_, existing []byte, operands [][]byte) ([]byte, error) {
+	max := existing
+	for _, operand := range operands {
+		if max == nil || bytes.Compare(operand, max) > 0 {
+			max = operand
+		}
+	}
+	return max, nil
+}
@@ -0,0 +1,189 @@
+package bitcask
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"bitcask.go/data"
+	"bitcask.go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeOperators(t *testing.T) {
+	add := NewInt64AddOperator()
+	v, err := add.FullMerge(nil, nil, [][]byte{[]byte("1"), []byte("-3")})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("-2"), v)
+	v, err = add.FullMerge(nil, []byte("10"), [][]byte{[]byte("5")})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("15"), v)
+	_, err = add.FullMerge(nil, nil, [][]byte{[]byte("a")})
+	assert.ErrorIs(t, err, ErrInvalidMergeOperand)
+
+	appendOp := NewStringAppendOperator([]byte(","))
+	v, err = appendOp.FullMerge(nil, nil, [][]byte{[]byte("a"), []byte("b")})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a,b"), v)
+	v, err = appendOp.FullMerge(nil, []byte("x"), [][]byte{[]byte("y")})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("x,y"), v)
+
+	maxOp := NewMaxOperator()
+	v, err = maxOp.FullMerge(nil, []byte("b"), [][]byte{[]byte("a"), []byte("c"), []byte("bb")})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("c"), v)
+}
+
+func TestDB_MergeValue(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-value")
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.MergeOperator = NewInt64AddOperator()
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	// 空 Key
+	assert.Equal(t, ErrKeyIsEmpty, db.MergeValue(nil, []byte("1")))
+
+	// 操作数跨越多个数据文件
+	for i := 0; i < 2000; i++ {
+		assert.Nil(t, db.MergeValue(utils.GetTestKey(i%10), []byte(strconv.Itoa(i))))
+	}
+	assert.True(t, len(db.oldFiles) > 0)
+
+	expected := make(map[int]int)
+	for i := 0; i < 2000; i++ {
+		expected[i%10] += i
+	}
+	check := func() {
+		for k, sum := range expected {
+			v, err := db.Get(utils.GetTestKey(k))
+			assert.Nil(t, err)
+			assert.Equal(t, strconv.Itoa(sum), string(v))
+		}
+		values, errs := db.MultiGet([][]byte{utils.GetTestKey(0), utils.GetTestKey(9)})
+		assert.Nil(t, errs[0])
+		assert.Nil(t, errs[1])
+		assert.Equal(t, strconv.Itoa(expected[0]), string(values[0]))
+		assert.Equal(t, strconv.Itoa(expected[9]), string(values[1]))
+	}
+	check()
+
+	// 在已有的值上合并，删除之后从空值开始
+	assert.Nil(t, db.Put(utils.GetTestKey(0), []byte("100")))
+	assert.Nil(t, db.MergeValue(utils.GetTestKey(0), []byte("1")))
+	expected[0] = 101
+	assert.Nil(t, db.Delete(utils.GetTestKey(1)))
+	assert.Nil(t, db.MergeValue(utils.GetTestKey(1), []byte("7")))
+	expected[1] = 7
+	check()
+
+	// 操作数不是整数时读取返回错误
+	assert.Nil(t, db.MergeValue(utils.GetTestKey(20), []byte("x")))
+	_, err = db.Get(utils.GetTestKey(20))
+	assert.ErrorIs(t, err, ErrInvalidMergeOperand)
+	assert.Nil(t, db.Delete(utils.GetTestKey(20)))
+
+	// 重启之后从数据文件中重建索引
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	check()
+
+	// merge 之后操作数被合并成完整的数据
+	assert.Nil(t, db.Merge())
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.MergeValue(utils.GetTestKey(i), []byte("1")))
+		expected[i]++
+	}
+	check()
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	check()
+
+	// 没有设置合并操作时无法写入和读取操作数
+	assert.Nil(t, db.MergeValue(utils.GetTestKey(30), []byte("1")))
+	assert.Nil(t, db.Close())
+	opts.MergeOperator = nil
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrMergeOperatorNotSet, db.MergeValue(utils.GetTestKey(1), []byte("1")))
+	_, err = db.Get(utils.GetTestKey(30))
+	assert.Equal(t, ErrMergeOperatorNotSet, err)
+}
+
+func TestDB_MergeValue_InMemory(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = ""
+	opts.InMemory = true
+	opts.DataFileSize = 4 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.MergeOperator = NewStringAppendOperator([]byte(","))
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	expected := ""
+	for i := 0; i < 300; i++ {
+		assert.Nil(t, db.MergeValue([]byte("list"), []byte(strconv.Itoa(i))))
+		if i > 0 {
+			expected += ","
+		}
+		expected += strconv.Itoa(i)
+	}
+	v, err := db.Get([]byte("list"))
+	assert.Nil(t, err)
+	assert.Equal(t, expected, string(v))
+
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.MergeValue([]byte("list"), []byte("end")))
+	v, err = db.Get([]byte("list"))
+	assert.Nil(t, err)
+	assert.Equal(t, expected+",end", string(v))
+}
+
+func TestDB_MergeValue_PendingPut(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-value-pending")
+	opts.DirPath = dir
+	opts.IndexShards = 4
+	opts.MergeOperator = NewInt64AddOperator()
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	key := utils.GetTestKey(1)
+	assert.Nil(t, db.Put(key, []byte("1000000")))
+
+	// 模拟一个已经预留了位置、还没有提交的并发 Put
+	encRecord, size := data.EncodeLogRecord(&data.LogRecord{
+		Key:   logRecordKeyWithSeqNum(key, nonTransactionSeqNum),
+		Value: []byte("2000000"),
+		Type:  data.LogRecordNormal,
+	})
+	db.rwmu.Lock()
+	assert.Nil(t, db.prepareActiveFile(size))
+	w := db.reserveWrite(size)
+	db.rwmu.Unlock()
+
+	// 合并操作数需要等待 Put 提交之后再引用 Key 最新的记录
+	merged := make(chan error)
+	go func() {
+		merged <- db.MergeValue(key, []byte("1"))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, db.finishWrite(w, encRecord, func(pos *data.LogRecordPos) {
+		db.index.Put(key, pos)
+	}))
+	assert.Nil(t, <-merged)
+
+	value, err := db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("2000001"), value)
+}
@@ -0,0 +1,139 @@
+package bitcask
+
+import (
+	"os"
+	"path/filepath"
+
+	"bitcask.go/data"
+	"bitcask.go/index"
+	"bitcask.go/utils"
+)
+
+// MigrateLegacyDataFiles 早期的版本把数据文件写在进程的工作目录中，而不是 DirPath 中
+// 离线地将 legacyDir（旧版本进程的工作目录）中的数据文件移动到 dirPath 中，返回移动的文件个数
+// dirPath 中已经有数据文件时返回 ErrDirIsNotEmpty，执行期间两个目录都不能被其他进程使用
+func MigrateLegacyDataFiles(legacyDir, dirPath string) (int, error) {
+	fileIDs, err := getDataFileIDs(legacyDir)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+		return 0, err
+	}
+	existing, err := getDataFileIDs(dirPath)
+	if err != nil {
+		return 0, err
+	}
+	if len(existing) > 0 {
+		return 0, ErrDirIsNotEmpty
+	}
+
+	// 跨文件系统时拷贝文件，目标目录持久化之后再删除原来的文件
+	for _, fid := range fileIDs {
+		src, dest := data.GetDataFileName(legacyDir, uint32(fid)), data.GetDataFileName(dirPath, uint32(fid))
+		if err := utils.LinkOrCopyFile(src, dest); err != nil {
+			return 0, err
+		}
+	}
+	if err := utils.SyncDir(dirPath); err != nil {
+		return 0, err
+	}
+	for _, fid := range fileIDs {
+		if err := os.Remove(data.GetDataFileName(legacyDir, uint32(fid))); err != nil {
+			return 0, err
+		}
+	}
+	return len(fileIDs), utils.SyncDir(legacyDir)
+}
+
+// MigrateIndex 离线地将数据目录的索引类型从 from 切换为 to
+// 从数据文件和 hint 文件中重新构建索引，切换到 B+ 树时会生成 B+ 树的索引文件和事务序列号文件，
+// 切换到内存索引时删除 B+ 树的索引文件，最后将新的索引类型记录到 MANIFEST 文件中
+// 使用 MANIFEST 中记录的 DataFileSize 打开数据目录，并且不会截断损坏的尾部（RecoveryStrict）
+// 命名空间的索引类型记录在 NAMESPACES 文件中，和数据库的索引类型无关，每次打开时从数据文件重建，不需要迁移；
+// B+ 树不支持命名空间，有命名空间的数据目录不能切换到 B+ 树
+func MigrateIndex(dirPath string, from, to IndexerType) error {
+	if from == to {
+		return nil
+	}
+	for _, typ := range []IndexerType{from, to} {
+		if typ != BTree && typ != ART && typ != BPlusTree && typ != Hash && typ != Hybrid && typ != Compact {
+			return ErrInvalidIndexType
+		}
+	}
+
+	opts := DefaultOptions
+	opts.DirPath = dirPath
+	opts.IndexType = BTree
+	opts.RecoveryMode = RecoveryStrict
+
+	// 数据目录实际使用的索引类型需要和 from 一致，其他的配置项沿用 MANIFEST 中记录的
+	if manifest, err := ReadFormatManifest(dirPath); err == nil {
+		if manifest.IndexType != from {
+			return ErrIndexTypeMismatch
+		}
+		if manifest.DataFileSize > 0 {
+			opts.DataFileSize = manifest.DataFileSize
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	db, err := Open(opts)
+	if err != nil {
+		return err
+	}
+	// 打开时 MANIFEST 中的索引类型被改成了内存索引，迁移失败时改回 from
+	abort := func(err error) error {
+		db.option.IndexType = from
+		_ = db.writeFormatManifest()
+		_ = db.Close()
+		return err
+	}
+
+	if to == BPlusTree && len(db.namespaces) > 0 {
+		return abort(ErrNamespaceNotSupported)
+	}
+	if to == BPlusTree {
+		if err := db.buildBPlusTreeIndex(); err != nil {
+			return abort(err)
+		}
+	}
+
+	// B+ 树的索引文件可能和数据文件不一致，统一从数据文件在内存中构建索引
+	if from == BPlusTree {
+		bptFileName := filepath.Join(dirPath, index.BPlusTreeIndexFileName)
+		if err := os.Remove(bptFileName); err != nil && !os.IsNotExist(err) {
+			return abort(err)
+		}
+	}
+
+	// 记录新的索引类型，关闭的时候会写入事务序列号文件，B+ 树打开之后可以直接使用 WriteBatch
+	db.option.IndexType = to
+	if err := db.writeFormatManifest(); err != nil {
+		_ = db.Close()
+		return err
+	}
+	return db.Close()
+}
+
+// buildBPlusTreeIndex 将内存索引中的数据写入新的 B+ 树索引文件
+func (db *DB) buildBPlusTreeIndex() error {
+	bptFileName := filepath.Join(db.option.DirPath, index.BPlusTreeIndexFileName)
+	if err := os.Remove(bptFileName); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	bpt := index.NewBPlusTree(db.option.DirPath, false)
+	iterator := db.index.Iterator(false)
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		bpt.Put(iterator.Key(), iterator.Value())
+	}
+	iterator.Close()
+
+	if err := bpt.Sync(); err != nil {
+		_ = bpt.Close()
+		return err
+	}
+	return bpt.Close()
+}
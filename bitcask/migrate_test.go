@@ -0,0 +1,149 @@
+package bitcask
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bitcask.go/data"
+	"bitcask.go/index"
+	"bitcask.go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateIndex(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-migrate")
+	defer os.RemoveAll(dir)
+	opts.DirPath = dir
+	opts.DataFileSize = 4 * 1024
+	opts.DataFileMergeRatio = 0
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	for i := 0; i < 200; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, db.Delete(utils.GetTestKey(i)))
+	}
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put(utils.GetTestKey(1000), utils.RandomValue(24)))
+	assert.Nil(t, wb.Commit())
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+
+	// 和数据目录实际的索引类型不一致
+	assert.Equal(t, ErrIndexTypeMismatch, MigrateIndex(dir, ART, BPlusTree))
+
+	// 切换到 B+ 树
+	assert.Nil(t, MigrateIndex(dir, BTree, BPlusTree))
+	manifest, err := ReadFormatManifest(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, BPlusTree, manifest.IndexType)
+
+	bptOpts := opts
+	bptOpts.IndexType = BPlusTree
+	db, err = Open(bptOpts)
+	assert.Nil(t, err)
+	assert.Equal(t, 151, len(db.ListKeys()))
+	_, err = db.Get(utils.GetTestKey(10))
+	assert.Equal(t, ErrKeyNotFound, err)
+	val, err := db.Get(utils.GetTestKey(100))
+	assert.Nil(t, err)
+	assert.NotNil(t, val)
+
+	// 事务序列号文件存在，可以继续使用 WriteBatch
+	wb = db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put(utils.GetTestKey(1001), utils.RandomValue(24)))
+	assert.Nil(t, wb.Commit())
+	assert.Nil(t, db.Close())
+
+	// 切换回内存索引
+	assert.Nil(t, MigrateIndex(dir, BPlusTree, ART))
+	_, err = os.Stat(filepath.Join(dir, index.BPlusTreeIndexFileName))
+	assert.True(t, os.IsNotExist(err))
+
+	artOpts := opts
+	artOpts.IndexType = ART
+	db, err = Open(artOpts)
+	assert.Nil(t, err)
+	assert.Equal(t, 152, len(db.ListKeys()))
+	assert.Nil(t, db.Close())
+
+	// 切换到哈希表索引，遍历时仍然是有序的
+	assert.Nil(t, MigrateIndex(dir, ART, Hash))
+	hashOpts := opts
+	hashOpts.IndexType = Hash
+	db, err = Open(hashOpts)
+	assert.Nil(t, err)
+	keys := db.ListKeys()
+	assert.Equal(t, 152, len(keys))
+	for i := 1; i < len(keys); i++ {
+		assert.Less(t, string(keys[i-1]), string(keys[i]))
+	}
+	_, err = db.Get(utils.GetTestKey(100))
+	assert.Nil(t, err)
+	assert.Nil(t, db.Delete(utils.GetTestKey(100)))
+	assert.Nil(t, db.Merge())
+	_, err = db.Get(utils.GetTestKey(100))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, 151, len(db.ListKeys()))
+	assert.Nil(t, db.Close())
+}
+
+func TestMigrateIndex_KeepOptions(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-migrate-options")
+	defer os.RemoveAll(dir)
+	opts.DirPath = dir
+	opts.DataFileSize = 4 * 1024
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	validSize := db.activeFile.Offsetnow
+	activeFileID := db.activeFile.FileID
+	assert.Nil(t, db.Close())
+
+	// 不会截断写了一半的尾部
+	appendToDataFile(t, dir, activeFileID, []byte("torn record"))
+	assert.Equal(t, ErrDataFileCorrupted, MigrateIndex(dir, BTree, ART))
+	manifest, err := ReadFormatManifest(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, BTree, manifest.IndexType)
+	assert.Nil(t, os.Truncate(data.GetDataFileName(dir, activeFileID), validSize))
+
+	// 沿用 MANIFEST 中记录的 DataFileSize
+	assert.Nil(t, MigrateIndex(dir, BTree, ART))
+	manifest, err = ReadFormatManifest(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, ART, manifest.IndexType)
+	assert.Equal(t, int64(4*1024), manifest.DataFileSize)
+
+	// 命名空间的索引类型不受影响，但是 B+ 树不支持命名空间
+	opts.IndexType = ART
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	ns, err := db.CreateNamespace("ns", Hash)
+	assert.Nil(t, err)
+	assert.Nil(t, ns.Put(utils.GetTestKey(0), utils.RandomValue(24)))
+	assert.Nil(t, db.Close())
+
+	assert.Equal(t, ErrNamespaceNotSupported, MigrateIndex(dir, ART, BPlusTree))
+	manifest, err = ReadFormatManifest(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, ART, manifest.IndexType)
+
+	assert.Nil(t, MigrateIndex(dir, ART, BTree))
+	opts.IndexType = BTree
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, len(db.ListKeys()))
+	ns, err = db.Namespace("ns")
+	assert.Nil(t, err)
+	_, err = ns.Get(utils.GetTestKey(0))
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+}
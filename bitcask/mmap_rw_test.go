@@ -0,0 +1,57 @@
+//go:build unix
+
+package bitcask
+
+import (
+	"os"
+	"testing"
+
+	"bitcask.go/data"
+	"bitcask.go/fio"
+	"bitcask.go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_WritableMemoryMap(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-mmap-rw")
+	opts.DirPath = dir
+	opts.DataFileSize = 4 * 1024 * 1024
+	opts.IOType = fio.WritableMemoryMap
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+	}
+	assert.Nil(t, db.Sync())
+
+	// 活跃文件预分配了 DataFileSize 的空间
+	stat, err := os.Stat(data.GetDataFileName(dir, 0))
+	assert.Nil(t, err)
+	assert.Equal(t, opts.DataFileSize, stat.Size())
+
+	// 不关闭数据库（模拟崩溃），文件末尾留下一段 0
+	_ = db.fileLock.Unlock()
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, len(db2.ListKeys()))
+	assert.Nil(t, db2.Put([]byte("after-crash"), []byte("value")))
+	assert.Nil(t, db2.Close())
+
+	// 正常关闭之后截断到实际的长度，重新打开可以读到崩溃之后写入的数据
+	stat, err = os.Stat(data.GetDataFileName(dir, 0))
+	assert.Nil(t, err)
+	assert.True(t, stat.Size() < opts.DataFileSize)
+	db3, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db3)
+	val, err := db3.Get([]byte("after-crash"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), val)
+	assert.Equal(t, 1001, len(db3.ListKeys()))
+
+	opts.IOType = fio.MemoryMap
+	_, err = Open(opts)
+	assert.Equal(t, ErrInvalidIOType, err)
+}
@@ -0,0 +1,92 @@
+package bitcask
+
+import (
+	"os"
+	"testing"
+
+	"bitcask.go/fio"
+	"bitcask.go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_MultiGet(t *testing.T) {
+	for _, ioType := range []fio.FileIOType{fio.StandardFIO, fio.URing} {
+		opts := DefaultOptions
+		dir, _ := os.MkdirTemp("", "bitcask-go-multiget")
+		opts.DirPath = dir
+		opts.DataFileSize = 64 * 1024
+		opts.IOType = ioType
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		for i := 0; i < 1000; i++ {
+			assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(100)))
+		}
+		assert.Nil(t, db.Delete(utils.GetTestKey(5)))
+
+		// 重新打开之后从数据文件中加载的位置信息也可以批量读取
+		assert.Nil(t, db.Close())
+		db, err = Open(opts)
+		assert.Nil(t, err)
+
+		keys := [][]byte{utils.GetTestKey(999), utils.GetTestKey(5), nil, []byte("not-exist")}
+		for i := 0; i < 500; i += 7 {
+			keys = append(keys, utils.GetTestKey(i))
+		}
+		keys[len(keys)-1] = utils.GetTestKey(0)
+
+		values, errs := db.MultiGet(keys)
+		assert.Equal(t, len(keys), len(values))
+		assert.Equal(t, ErrKeyNotFound, errs[1])
+		assert.Equal(t, ErrKeyIsEmpty, errs[2])
+		assert.Equal(t, ErrKeyNotFound, errs[3])
+		for i, key := range keys {
+			if errs[i] != nil {
+				continue
+			}
+			expected, err := db.Get(key)
+			assert.Nil(t, err)
+			assert.Equal(t, expected, values[i])
+		}
+		destroyDB(db)
+	}
+}
+
+func TestDB_MultiPut(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-multiput")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	keys := make([][]byte, 0, 500)
+	values := make([][]byte, 0, 500)
+	for i := 0; i < 500; i++ {
+		keys = append(keys, utils.GetTestKey(i))
+		values = append(values, utils.RandomValue(100))
+	}
+	assert.Nil(t, db.MultiPut(keys, values))
+
+	// 数量不一致和空 Key 都不会写入任何数据
+	assert.Equal(t, ErrKeyValueCountMismatch, db.MultiPut(keys[:2], values[:1]))
+	assert.Equal(t, ErrKeyIsEmpty, db.MultiPut([][]byte{[]byte("a"), nil}, values[:2]))
+	_, err = db.Get([]byte("a"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// 覆盖已有的 Key
+	assert.Nil(t, db.MultiPut(keys[:1], [][]byte{[]byte("new")}))
+
+	// 重启之后数据仍然存在
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+
+	got, errs := db.MultiGet(keys)
+	assert.Equal(t, []byte("new"), got[0])
+	for i := 1; i < len(keys); i++ {
+		assert.Nil(t, errs[i])
+		assert.Equal(t, values[i], got[i])
+	}
+}
@@ -0,0 +1,392 @@
+package bitcask
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"bitcask.go/data"
+	"bitcask.go/index"
+)
+
+// NamespacesFileName 记录数据目录中所有命名空间的文件
+const NamespacesFileName = "NAMESPACES"
+
+// Namespace 同一个数据库中的命名空间（类似 RocksDB 的 column family）
+// 所有命名空间共享同一组数据文件，记录的 header 中带有命名空间 ID，每个命名空间有自己的索引
+type Namespace struct {
+	db        *DB
+	name      string
+	id        uint32
+	indexType IndexerType
+	index     index.Indexer
+	dropped   bool // 已经被删除，之后的所有操作都返回 ErrNamespaceNotFound
+}
+
+// namespaceMeta 命名空间在 NAMESPACES 文件中的信息
+type namespaceMeta struct {
+	Name      string      `json:"name"`
+	ID        uint32      `json:"id"`
+	IndexType IndexerType `json:"index_type"`
+}
+
+// namespaceRegistry NAMESPACES 文件的内容，ID 递增分配，被删除的命名空间的 ID 不会再被使用
+type namespaceRegistry struct {
+	NextID     uint32          `json:"next_id"`
+	Namespaces []namespaceMeta `json:"namespaces"`
+}
+
+// CreateNamespace 创建一个新的命名空间，indexType 可以和数据库使用的索引类型不同（目前只支持内存索引）
+func (db *DB) CreateNamespace(name string, indexType IndexerType) (*Namespace, error) {
+	if db.option.ReadOnly {
+		return nil, ErrReadOnly
+	}
+	if name == "" {
+		return nil, ErrInvalidNamespaceName
+	}
+	if indexType != BTree && indexType != ART && indexType != Hash && indexType != Compact {
+		return nil, ErrInvalidIndexType
+	}
+	// B+ 树的索引保存在磁盘上，打开时不会遍历数据文件，无法重建命名空间的索引
+	if db.option.IndexType == BPlusTree {
+		return nil, ErrNamespaceNotSupported
+	}
+
+	db.rwmu.Lock()
+	defer db.rwmu.Unlock()
+
+	if _, ok := db.namespaces[name]; ok {
+		return nil, ErrNamespaceExists
+	}
+
+	indexer, err := newIndexer(db.option, indexType)
+	if err != nil {
+		return nil, err
+	}
+	ns := &Namespace{
+		db:        db,
+		name:      name,
+		id:        db.nextNamespaceID,
+		indexType: indexType,
+		index:     indexer,
+	}
+	db.namespaces[name] = ns
+	db.namespaceIDs[ns.id] = ns
+	db.nextNamespaceID++
+
+	if err := db.saveNamespaces(); err != nil {
+		delete(db.namespaces, name)
+		delete(db.namespaceIDs, ns.id)
+		db.nextNamespaceID--
+		return nil, err
+	}
+	return ns, nil
+}
+
+// Namespace 获取已经存在的命名空间
+func (db *DB) Namespace(name string) (*Namespace, error) {
+	db.rwmu.RLock()
+	defer db.rwmu.RUnlock()
+
+	ns, ok := db.namespaces[name]
+	if !ok {
+		return nil, ErrNamespaceNotFound
+	}
+	return ns, nil
+}
+
+// ListNamespaces 返回所有命名空间的名称（不包括默认命名空间）
+func (db *DB) ListNamespaces() []string {
+	db.rwmu.RLock()
+	defer db.rwmu.RUnlock()
+
+	names := make([]string, 0, len(db.namespaces))
+	for name := range db.namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DropNamespace 删除命名空间：只需要从 NAMESPACES 文件中移除并丢弃它的索引，
+// 数据文件中属于它的记录全部变成无效数据，在下一次 merge 的时候被清理
+func (db *DB) DropNamespace(name string) error {
+	if db.option.ReadOnly {
+		return ErrReadOnly
+	}
+
+	db.rwmu.Lock()
+	defer db.rwmu.Unlock()
+	db.waitPendingWrites()
+
+	ns, ok := db.namespaces[name]
+	if !ok {
+		return ErrNamespaceNotFound
+	}
+
+	delete(db.namespaces, name)
+	delete(db.namespaceIDs, ns.id)
+	if err := db.saveNamespaces(); err != nil {
+		db.namespaces[name] = ns
+		db.namespaceIDs[ns.id] = ns
+		return err
+	}
+
+	// 命名空间中所有的数据都可以被回收了
+	it := ns.index.Iterator(false)
+	for it.Rewind(); it.Valid(); it.Next() {
+		db.reclaimSize += int64(it.Value().Size)
+	}
+	it.Close()
+
+	ns.dropped = true
+	return ns.index.Close()
+}
+
+// indexOf 获取命名空间 ID 对应的索引，命名空间不存在（已经被删除）时返回 nil
+func (db *DB) indexOf(namespace uint32) index.Indexer {
+	if namespace == 0 {
+		return db.index
+	}
+	if ns, ok := db.namespaceIDs[namespace]; ok {
+		return ns.index
+	}
+	return nil
+}
+
+// loadNamespaces 打开数据库时从 NAMESPACES 文件中加载所有命名空间，需要在加载索引之前调用
+func (db *DB) loadNamespaces() error {
+	db.namespaces = make(map[string]*Namespace)
+	db.namespaceIDs = make(map[uint32]*Namespace)
+	db.nextNamespaceID = 1
+	return db.refreshNamespaces()
+}
+
+// refreshNamespaces 根据 NAMESPACES 文件更新命名空间：添加新的命名空间，移除已经被删除的命名空间
+// 只读模式下 Refresh 时用来获取写入进程新建或者删除的命名空间
+func (db *DB) refreshNamespaces() error {
+	if db.option.InMemory {
+		return nil
+	}
+
+	registry := &namespaceRegistry{}
+	buf, err := os.ReadFile(filepath.Join(db.option.DirPath, NamespacesFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(buf, registry); err != nil {
+			return fmt.Errorf("%w: %v", ErrDataDirectoryCorrupted, err)
+		}
+	}
+	if registry.NextID > db.nextNamespaceID {
+		db.nextNamespaceID = registry.NextID
+	}
+
+	alive := make(map[uint32]bool)
+	for _, meta := range registry.Namespaces {
+		alive[meta.ID] = true
+		if _, ok := db.namespaceIDs[meta.ID]; ok {
+			continue
+		}
+		indexer, err := newIndexer(db.option, meta.IndexType)
+		if err != nil {
+			return err
+		}
+		ns := &Namespace{
+			db:        db,
+			name:      meta.Name,
+			id:        meta.ID,
+			indexType: meta.IndexType,
+			index:     indexer,
+		}
+		db.namespaces[ns.name] = ns
+		db.namespaceIDs[ns.id] = ns
+	}
+	for id, ns := range db.namespaceIDs {
+		if !alive[id] {
+			delete(db.namespaces, ns.name)
+			delete(db.namespaceIDs, id)
+			ns.dropped = true
+		}
+	}
+	return nil
+}
+
+// saveNamespaces 将当前的命名空间写入 NAMESPACES 文件，先写入临时文件再重命名
+// 注意！！！使用这个 DB 方法的时候必须持有互斥锁
+func (db *DB) saveNamespaces() error {
+	if db.option.InMemory {
+		return nil
+	}
+
+	registry := &namespaceRegistry{NextID: db.nextNamespaceID}
+	for _, ns := range db.namespaces {
+		registry.Namespaces = append(registry.Namespaces, namespaceMeta{Name: ns.name, ID: ns.id, IndexType: ns.indexType})
+	}
+	sort.Slice(registry.Namespaces, func(i, j int) bool {
+		return registry.Namespaces[i].ID < registry.Namespaces[j].ID
+	})
+
+	buf, err := json.MarshalIndent(registry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fileName := filepath.Join(db.option.DirPath, NamespacesFileName)
+	tmpFile, err := os.OpenFile(fileName+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer tmpFile.Close()
+
+	if _, err := tmpFile.Write(buf); err != nil {
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(fileName+".tmp", fileName)
+}
+
+// Name 命名空间的名称
+func (ns *Namespace) Name() string {
+	return ns.name
+}
+
+// Put 在命名空间中写入 Key(非空) 和 Value
+func (ns *Namespace) Put(key []byte, value []byte) error {
+	db := ns.db
+	if db.option.ReadOnly {
+		return ErrReadOnly
+	}
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+
+	db.rwmu.Lock()
+	defer db.rwmu.Unlock()
+
+	if ns.dropped {
+		return ErrNamespaceNotFound
+	}
+
+	pos, err := db.appendLogRecord(&data.LogRecord{
+		Key:       logRecordKeyWithSeqNum(key, nonTransactionSeqNum),
+		Value:     value,
+		Type:      data.LogRecordNormal,
+		Namespace: ns.id,
+	})
+	if err != nil {
+		return err
+	}
+
+	if oldPos := ns.index.Put(key, pos); oldPos != nil {
+		db.reclaimSize += int64(oldPos.Size)
+	}
+	return nil
+}
+
+// Get 读取命名空间中 Key 对应的 Value
+func (ns *Namespace) Get(key []byte) ([]byte, error) {
+	db := ns.db
+	db.rwmu.RLock()
+	defer db.rwmu.RUnlock()
+
+	if ns.dropped {
+		return nil, ErrNamespaceNotFound
+	}
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+
+	logRecordPos := ns.index.Get(key)
+	if logRecordPos == nil {
+		return nil, ErrKeyNotFound
+	}
+	return db.getValueByPosition(logRecordPos)
+}
+
+// Delete 删除命名空间中的 Key
+func (ns *Namespace) Delete(key []byte) error {
+	db := ns.db
+	if db.option.ReadOnly {
+		return ErrReadOnly
+	}
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+
+	db.rwmu.Lock()
+	defer db.rwmu.Unlock()
+
+	if ns.dropped {
+		return ErrNamespaceNotFound
+	}
+	if ns.index.Get(key) == nil {
+		return nil
+	}
+
+	pos, err := db.appendLogRecord(&data.LogRecord{
+		Key:       logRecordKeyWithSeqNum(key, nonTransactionSeqNum),
+		Type:      data.LogRecordDeleted,
+		Namespace: ns.id,
+	})
+	if err != nil {
+		return err
+	}
+	db.reclaimSize += int64(pos.Size)
+
+	if oldPos, _ := ns.index.Delete(key); oldPos != nil {
+		db.reclaimSize += int64(oldPos.Size)
+	}
+	return nil
+}
+
+// ListKeys 获取命名空间中所有的 Key
+func (ns *Namespace) ListKeys() ([][]byte, error) {
+	db := ns.db
+	db.rwmu.RLock()
+	defer db.rwmu.RUnlock()
+
+	if ns.dropped {
+		return nil, ErrNamespaceNotFound
+	}
+
+	keys := make([][]byte, 0, ns.index.Size())
+	it := ns.index.Iterator(false)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		keys = append(keys, it.Key())
+	}
+	return keys, nil
+}
+
+// Fold 遍历命名空间中所有的数据，函数返回 false 时终止遍历
+func (ns *Namespace) Fold(f func(key []byte, value []byte) bool) error {
+	db := ns.db
+	db.rwmu.RLock()
+	defer db.rwmu.RUnlock()
+
+	if ns.dropped {
+		return ErrNamespaceNotFound
+	}
+
+	it := ns.index.Iterator(false)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		value, err := db.getValueByPosition(it.Value())
+		if err != nil {
+			return err
+		}
+		if !f(it.Key(), value) {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package bitcask
+
+import (
+	"os"
+	"testing"
+
+	"bitcask.go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Namespace(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-namespace")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	users, err := db.CreateNamespace("users", BTree)
+	assert.Nil(t, err)
+	orders, err := db.CreateNamespace("orders", ART)
+	assert.Nil(t, err)
+
+	_, err = db.CreateNamespace("users", BTree)
+	assert.Equal(t, ErrNamespaceExists, err)
+	_, err = db.CreateNamespace("", BTree)
+	assert.Equal(t, ErrInvalidNamespaceName, err)
+	_, err = db.CreateNamespace("bpt", BPlusTree)
+	assert.Equal(t, ErrInvalidIndexType, err)
+
+	// 不同命名空间中相同的 Key 互不影响
+	key := utils.GetTestKey(1)
+	assert.Nil(t, db.Put(key, []byte("default")))
+	assert.Nil(t, users.Put(key, []byte("user")))
+	assert.Nil(t, orders.Put(key, []byte("order")))
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, users.Put(utils.GetTestKey(i+10), utils.RandomValue(64)))
+	}
+	assert.Nil(t, orders.Delete(key))
+
+	check := func() {
+		v, err := db.Get(key)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("default"), v)
+		v, err = users.Get(key)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("user"), v)
+		_, err = orders.Get(key)
+		assert.Equal(t, ErrKeyNotFound, err)
+
+		keys, err := users.ListKeys()
+		assert.Nil(t, err)
+		assert.Equal(t, 1001, len(keys))
+		assert.Equal(t, 1, len(db.ListKeys()))
+	}
+	check()
+
+	// 重启之后命名空间和其中的数据都还在
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"orders", "users"}, db.ListNamespaces())
+	users, err = db.Namespace("users")
+	assert.Nil(t, err)
+	orders, err = db.Namespace("orders")
+	assert.Nil(t, err)
+	check()
+
+	// merge 之后从 hint 文件中加载命名空间的索引
+	opts.DataFileMergeRatio = 0
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	users, _ = db.Namespace("users")
+	orders, _ = db.Namespace("orders")
+	check()
+
+	// 修复之后的目录中保留了命名空间
+	assert.Nil(t, db.Close())
+	report, err := Fsck(dir)
+	assert.Nil(t, err)
+	assert.True(t, report.OK(), report.Issues)
+	repairDir, _ := os.MkdirTemp("", "bitcask-go-namespace-repair")
+	defer os.RemoveAll(repairDir)
+	_, err = Repair(dir, repairDir)
+	assert.Nil(t, err)
+
+	repairOpts := opts
+	repairOpts.DirPath = repairDir
+	repaired, err := Open(repairOpts)
+	assert.Nil(t, err)
+	defer repaired.Close()
+	repairedUsers, err := repaired.Namespace("users")
+	assert.Nil(t, err)
+	v, err := repairedUsers.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("user"), v)
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+}
+
+func TestDB_DropNamespace(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-drop-namespace")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	opts.DataFileMergeRatio = 0
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	tmp, err := db.CreateNamespace("tmp", BTree)
+	assert.Nil(t, err)
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, tmp.Put(utils.GetTestKey(i), utils.RandomValue(64)))
+	}
+	assert.Nil(t, db.Put(utils.GetTestKey(0), []byte("keep")))
+
+	assert.Nil(t, db.DropNamespace("tmp"))
+	assert.Equal(t, ErrNamespaceNotFound, db.DropNamespace("tmp"))
+	_, err = tmp.Get(utils.GetTestKey(0))
+	assert.Equal(t, ErrNamespaceNotFound, err)
+	assert.Equal(t, ErrNamespaceNotFound, tmp.Put(utils.GetTestKey(0), []byte("v")))
+	assert.True(t, db.Stat().reclaimSize > 0)
+
+	// 同名的命名空间重新创建之后是空的
+	tmp, err = db.CreateNamespace("tmp", BTree)
+	assert.Nil(t, err)
+	_, err = tmp.Get(utils.GetTestKey(0))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// merge 之后被删除的命名空间的数据被清理掉
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	tmp, err = db.Namespace("tmp")
+	assert.Nil(t, err)
+	keys, err := tmp.ListKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(keys))
+	v, err := db.Get(utils.GetTestKey(0))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("keep"), v)
+
+	stat := db.Stat()
+	assert.True(t, stat.DiskSize < 64*1024)
+}
+
+func TestWriteBatch_Namespace(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-batch-namespace")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	a, err := db.CreateNamespace("a", BTree)
+	assert.Nil(t, err)
+	b, err := db.CreateNamespace("b", ART)
+	assert.Nil(t, err)
+	assert.Nil(t, b.Put([]byte("k"), []byte("old")))
+
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put([]byte("k"), []byte("default")))
+	assert.Nil(t, wb.PutInNamespace(a, []byte("k"), []byte("a")))
+	assert.Nil(t, wb.DeleteInNamespace(b, []byte("k")))
+	assert.Nil(t, wb.Commit())
+
+	check := func() {
+		v, err := db.Get([]byte("k"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("default"), v)
+		v, err = a.Get([]byte("k"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("a"), v)
+		_, err = b.Get([]byte("k"))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+	check()
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	a, _ = db.Namespace("a")
+	b, _ = db.Namespace("b")
+	check()
+
+	// 批次中的命名空间被删除之后，整个批次都不会提交
+	wb = db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.PutInNamespace(a, []byte("k"), []byte("a2")))
+	assert.Nil(t, wb.PutInNamespace(b, []byte("k"), []byte("b2")))
+	assert.Nil(t, db.DropNamespace("b"))
+	assert.Equal(t, ErrNamespaceNotFound, wb.Commit())
+	v, err := a.Get([]byte("k"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), v)
+}
+
+func TestDB_Namespace_ReadOnly(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-namespace-readonly")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put([]byte("k"), []byte("v")))
+	assert.Nil(t, db.Sync())
+
+	roOpts := opts
+	roOpts.ReadOnly = true
+	roDB, err := Open(roOpts)
+	assert.Nil(t, err)
+	defer roDB.Close()
+
+	_, err = roDB.CreateNamespace("ns", BTree)
+	assert.Equal(t, ErrReadOnly, err)
+
+	// Refresh 之后可以看到写入进程新建的命名空间
+	ns, err := db.CreateNamespace("ns", BTree)
+	assert.Nil(t, err)
+	assert.Nil(t, ns.Put([]byte("k"), []byte("ns")))
+	assert.Nil(t, db.Sync())
+
+	assert.Nil(t, roDB.Refresh())
+	roNS, err := roDB.Namespace("ns")
+	assert.Nil(t, err)
+	v, err := roNS.Get([]byte("k"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("ns"), v)
+}
+
+func TestDB_Namespace_BPlusTree(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-namespace-bptree")
+	opts.DirPath = dir
+	opts.IndexType = BPlusTree
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	_, err = db.CreateNamespace("ns", BTree)
+	assert.Equal(t, ErrNamespaceNotSupported, err)
+}
@@ -1,9 +1,17 @@
 package bitcask
 
-import "os"
+import (
+	"os"
+	"time"
+
+	"bitcask.go/fio"
+	"bitcask.go/index"
+)
 
 type Options struct {
-	// 数据库数据目录
+	// 数据库数据目录，所有的数据文件都保存在这个目录中
+	// 注意：早期的版本把数据文件（*.data）写在了进程的工作目录中，升级之后需要先使用 MigrateLegacyDataFiles
+	// （或者 bitcask-migrate-index -legacy-dir）把它们移动到 DirPath 中，否则打开的是一个空的数据库
 	DirPath string
 
 	// 数据文件的大小
@@ -21,8 +29,49 @@ type Options struct {
 	// 启动时是否使用 MMap 加载数据
 	MMapAtStartup bool
 
+	// 启动之后读写数据文件使用的 IO 类型，可以是 fio.StandardFIO、fio.WritableMemoryMap、fio.DirectIO 或者 fio.URing
+	// 使用可写的内存映射或者 Direct IO 时，新的数据文件会预先分配 DataFileSize 大小的空间
+	IOType fio.FileIOType
+
 	//	数据文件合并的阈值(Merge操作)
 	DataFileMergeRatio float32
+
+	// 启动时数据文件损坏的恢复策略
+	RecoveryMode RecoveryMode
+
+	// 以只读的方式打开数据库：不获取文件锁，不创建任何文件，可以和写入的进程同时打开同一个目录
+	// 使用 B+ 树索引或者混合索引时会改为在内存中构建 BTree 索引
+	ReadOnly bool
+
+	// 数据只保存在内存中，不会创建目录、获取文件锁或者读写任何文件，关闭之后数据全部丢失
+	// 此时 DirPath 可以为空，使用 B+ 树索引或者混合索引时会改为 BTree 索引
+	InMemory bool
+
+	// Key 的比较函数，决定迭代器遍历 Key 的顺序和 Seek 的位置，为空时按照字节序
+	// 例如 index.ReverseComparator、index.NaturalComparator，B+ 树索引不支持自定义的比较函数
+	Comparator index.Comparator
+
+	// 合并操作，使用 DB.MergeValue 之前必须设置，读取数据时用它将合并操作数合并到之前的值上
+	// 同一个数据目录每次打开时都需要使用相同的合并操作
+	MergeOperator MergeOperator
+
+	// 内存索引的分片数量，大于 1 时按照 Key 的哈希值把索引分成多个分片，每个分片有自己的锁
+	// 此时 Put、Delete 只在预留活跃文件中的位置时持有数据库的锁，写入文件和更新索引都可以并发进行
+	// （SyncWrites 或者达到 BytesPerSync 需要持久化时仍然在锁内写入），B+ 树索引不支持分片
+	IndexShards int
+
+	// 混合索引（Hybrid）中热数据可以占用的内存上限，以字节为单位
+	IndexMemoryBudget int64
+
+	// 紧凑索引（Compact）是否对相邻的 Key 使用前缀压缩，Key 有较长的公共前缀时可以节省很多内存
+	IndexPrefixCompression bool
+
+	// 时间点标记的间隔，大于 0 时每进入一个新的时间段，在这段时间的第一条记录之前写入一条时间点标记，
+	// Restore 按照时间恢复时可以精确到这个间隔；为 0 时不写入标记，按照时间恢复只能精确到备份的粒度
+	RestorePointInterval time.Duration
+
+	// 不为空时包装数据库打开的可写文件的 IOManager，只在测试中用来注入故障（merge 时会传递给 merge 的数据库）
+	wrapIOManager func(ioManager fio.IOManager) (fio.IOManager, error)
 }
 
 // IteratorOptions 索引迭代器配置项（供用户自行选择传递）
@@ -42,6 +91,29 @@ type WriteBatchOptions struct {
 	SyncWrites bool
 }
 
+// ImportOptions 导入数据的配置项
+type ImportOptions struct {
+	// 是否覆盖数据库中已经存在的 Key，为 false 时跳过这些 Key
+	Overwrite bool
+
+	// 每个 WriteBatch 中原子提交的数据量
+	BatchSize uint
+}
+
+// ExportFormat 导入导出数据的格式
+type ExportFormat = int8
+
+const (
+	// ExportJSONL 每行一个 JSON 对象，Key 和 Value 使用 base64 编码
+	ExportJSONL ExportFormat = iota + 1
+
+	// ExportCSV 第一行为表头 key,value，Key 和 Value 使用 base64 编码
+	ExportCSV
+
+	// ExportBinary 二进制格式，每条数据为变长编码的长度加上原始的 Key 和 Value
+	ExportBinary
+)
+
 type IndexerType = int8
 
 const (
@@ -53,6 +125,30 @@ const (
 
 	// BPlusTree B+ 树索引，将索引存储到磁盘上
 	BPlusTree
+
+	// Hash 哈希表索引，每个 Key 占用的内存最少，适合只有点查的场景（遍历时需要先排序）
+	Hash
+
+	// Hybrid 混合索引，内存中的热数据受 IndexMemoryBudget 限制，超过之后按照 LRU 降级到磁盘上的 B+ 树
+	// 适合 Key 的数量多到内存放不下的场景，冷数据每次打开时重新构建，不需要 B+ 树索引那样每次写入都开启事务
+	Hybrid
+
+	// Compact 紧凑编码的索引，Key 和位置信息连续保存在有序的块中，每个 Key 的额外开销和 GC 压力都很小
+	// 代价是每次读写都需要解码一个块（最多 64 个 Key），比 BTree 稍慢
+	Compact
+)
+
+type RecoveryMode = int8
+
+const (
+	// RecoveryTruncateTail 截断最后一个数据文件中写了一半的尾部记录，其他位置的损坏拒绝打开（默认）
+	RecoveryTruncateTail RecoveryMode = iota
+
+	// RecoveryStrict 任何位置的损坏都拒绝打开数据库
+	RecoveryStrict
+
+	// RecoverySkipCorrupted 跳过所有损坏的记录，尽可能多地恢复数据
+	RecoverySkipCorrupted
 )
 
 var DefaultOptions = Options{
@@ -62,7 +158,12 @@ var DefaultOptions = Options{
 	BytesPerSync:       0,
 	IndexType:          BTree, //默认使用B树，可以根据实际情况调整
 	MMapAtStartup:      true,
+	IOType:             fio.StandardFIO,
 	DataFileMergeRatio: 0.5,    //无效数据占总数据的一半就merge
+	RecoveryMode:       RecoveryTruncateTail,
+	IndexMemoryBudget:  index.DefaultHybridMemoryBudget,
+
+	IndexPrefixCompression: true,
 }
 
 // DefaultIteratorOptions 默认的索引迭代器的配置
@@ -75,3 +176,8 @@ var DefaultWriteBatchOptions = WriteBatchOptions{
 	MaxBatchNum: 10000,
 	SyncWrites:  true,
 }
+
+var DefaultImportOptions = ImportOptions{
+	Overwrite: true,
+	BatchSize: 1000,
+}
@@ -0,0 +1,108 @@
+package bitcask
+
+import (
+	"io"
+	"log"
+
+	"bitcask.go/data"
+)
+
+// loadLogRecords 从 offset 开始遍历一个数据文件中的所有有效记录，对每一条记录执行 fn
+// 遇到损坏的记录时根据用户配置的 RecoveryMode 进行处理，返回有效数据的末尾位置
+// isLastFile 标识是否是最后一个数据文件（活跃文件），只有它的尾部可能是写了一半的记录
+func (db *DB) loadLogRecords(dataFile *data.DataFile, offset int64, isLastFile bool,
+	fn func(logRecord *data.LogRecord, offset int64, size int64)) (int64, error) {
+	fileSize, err := dataFile.IOManager.Size()
+	if err != nil {
+		return 0, err
+	}
+
+	mode := db.option.RecoveryMode
+	for {
+		logRecord, size, err := dataFile.ReadLogRecord(offset)
+		if err == nil {
+			fn(logRecord, offset, size)
+			offset += size
+			continue
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != data.ErrInvalidCRC && err != data.ErrIncompleteLogRecord {
+			return 0, err
+		}
+
+		// 走到这里说明记录已经损坏，判断损坏的记录是否在文件的末尾
+		// 长度字段损坏的记录也会超出文件的末尾，后面还能找到有效的记录时说明损坏发生在文件的中间
+		isTail := err == data.ErrIncompleteLogRecord || offset+size >= fileSize
+		if err == data.ErrIncompleteLogRecord {
+			next, err := findNextLogRecord(dataFile, offset+1)
+			if err != nil {
+				return 0, err
+			}
+			if next >= 0 {
+				isTail = false
+				size = next - offset
+			}
+		}
+
+		// 最后一个文件的尾部损坏：进程在写入的过程中崩溃了，后面会截断
+		if isTail && isLastFile && mode != RecoveryStrict {
+			break
+		}
+
+		if mode == RecoverySkipCorrupted {
+			// 记录本身不完整，无法知道下一条记录的位置，只能丢弃这个文件剩余的数据
+			if isTail {
+				log.Printf("bitcask: skip corrupted tail of data file %d, %d bytes dropped at offset %d\n",
+					dataFile.FileID, fileSize-offset, offset)
+				break
+			}
+			log.Printf("bitcask: skip corrupted log record in data file %d, %d bytes dropped at offset %d\n",
+				dataFile.FileID, size, offset)
+			offset += size
+			continue
+		}
+
+		log.Printf("bitcask: data file %d is corrupted at offset %d,err:%v\n", dataFile.FileID, offset, err)
+		return 0, ErrDataFileCorrupted
+	}
+
+	// 最后一个文件的尾部还有无法解析的数据，需要截断，否则后续追加写入的位置会和偏移量对不上
+	if isLastFile && offset < fileSize {
+		if mode == RecoveryStrict {
+			log.Printf("bitcask: data file %d has %d invalid bytes at offset %d\n",
+				dataFile.FileID, fileSize-offset, offset)
+			return 0, ErrDataFileCorrupted
+		}
+		//只读模式下不能修改文件，尾部可能是其他进程正在写入的记录，下次 Refresh 时再读取
+		if db.option.ReadOnly {
+			return offset, nil
+		}
+		if err := dataFile.Truncate(offset); err != nil {
+			return 0, err
+		}
+		log.Printf("bitcask: truncate torn tail of data file %d, %d bytes dropped at offset %d\n",
+			dataFile.FileID, fileSize-offset, offset)
+	}
+
+	return offset, nil
+}
+
+// findNextLogRecord 从 offset 开始逐个字节查找下一条能通过校验的记录，找不到时返回 -1
+func findNextLogRecord(dataFile *data.DataFile, offset int64) (int64, error) {
+	fileSize, err := dataFile.IOManager.Size()
+	if err != nil {
+		return 0, err
+	}
+	for ; offset < fileSize; offset++ {
+		_, _, err := dataFile.ReadLogRecord(offset)
+		if err == nil {
+			return offset, nil
+		}
+		if err != io.EOF && err != data.ErrInvalidCRC && err != data.ErrIncompleteLogRecord {
+			return 0, err
+		}
+	}
+	return -1, nil
+}
@@ -0,0 +1,198 @@
+package bitcask
+
+import (
+	"os"
+	"testing"
+
+	"bitcask.go/data"
+	"bitcask.go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// appendToDataFile 直接在数据文件末尾追加一段数据，模拟写入过程中进程崩溃
+func appendToDataFile(t *testing.T, dirPath string, fileID uint32, buf []byte) {
+	f, err := os.OpenFile(data.GetDataFileName(dirPath, fileID), os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	_, err = f.Write(buf)
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+}
+
+func TestDB_Recovery_TruncateTornTail(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-recovery-tail")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	validSize := db.activeFile.Offsetnow
+	assert.Nil(t, db.Close())
+
+	// 写了一半的记录
+	encRecord, _ := data.EncodeLogRecord(&data.LogRecord{
+		Key:   logRecordKeyWithSeqNum(utils.GetTestKey(100), nonTransactionSeqNum),
+		Value: utils.RandomValue(24),
+	})
+	appendToDataFile(t, dir, 0, encRecord[:len(encRecord)/2])
+
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, len(db2.ListKeys()))
+	assert.Equal(t, validSize, db2.activeFile.Offsetnow)
+
+	stat, err := os.Stat(data.GetDataFileName(dir, 0))
+	assert.Nil(t, err)
+	assert.Equal(t, validSize, stat.Size())
+
+	// 截断之后可以继续正常写入
+	assert.Nil(t, db2.Put(utils.GetTestKey(100), []byte("value")))
+	val, err := db2.Get(utils.GetTestKey(100))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), val)
+}
+
+func TestDB_Recovery_Strict(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-recovery-strict")
+	defer os.RemoveAll(dir)
+	opts.DirPath = dir
+	opts.RecoveryMode = RecoveryStrict
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.Put(utils.GetTestKey(1), utils.RandomValue(24)))
+	assert.Nil(t, db.Close())
+
+	appendToDataFile(t, dir, 0, []byte("torn record"))
+
+	_, err = Open(opts)
+	assert.Equal(t, ErrDataFileCorrupted, err)
+}
+
+func TestDB_Recovery_CorruptedInTheMiddle(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-recovery-middle")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	assert.Nil(t, db.Close())
+
+	// 破坏第一条记录的 value，后面的记录都是完整的
+	fileName := data.GetDataFileName(dir, 0)
+	buf, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	buf[len(buf)/20] ^= 0xff
+	assert.Nil(t, os.WriteFile(fileName, buf, 0644))
+
+	// 默认只截断尾部，中间的损坏拒绝打开
+	_, err = Open(opts)
+	assert.Equal(t, ErrDataFileCorrupted, err)
+
+	// 跳过损坏的记录
+	opts.RecoveryMode = RecoverySkipCorrupted
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, 9, len(db2.ListKeys()))
+	_, err = db2.Get(utils.GetTestKey(0))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db2.Get(utils.GetTestKey(9))
+	assert.Nil(t, err)
+}
+
+func TestDB_Recovery_CorruptedLengthInTheMiddle(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-recovery-length")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	pos := db.index.Get(utils.GetTestKey(5))
+	validSize := db.activeFile.Offsetnow
+	assert.Nil(t, db.Close())
+
+	// 破坏最后一个文件中间一条记录的 value 长度，这条记录看起来超出了文件的末尾
+	fileName := data.GetDataFileName(dir, 0)
+	buf, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	buf[pos.Offset+6] = 0xff
+	assert.Nil(t, os.WriteFile(fileName, buf, 0644))
+
+	// 后面还有完整的记录，不是写了一半的尾部，默认拒绝打开，也不会截断文件
+	_, err = Open(opts)
+	assert.Equal(t, ErrDataFileCorrupted, err)
+	stat, err := os.Stat(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, validSize, stat.Size())
+
+	// 跳过损坏的记录之后继续加载后面的记录
+	opts.RecoveryMode = RecoverySkipCorrupted
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, 9, len(db2.ListKeys()))
+	_, err = db2.Get(utils.GetTestKey(5))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db2.Get(utils.GetTestKey(9))
+	assert.Nil(t, err)
+}
+
+func TestDB_InvalidRecoveryMode(t *testing.T) {
+	opts := DefaultOptions
+	opts.RecoveryMode = 10
+	_, err := Open(opts)
+	assert.Equal(t, ErrInvalidRecoveryMode, err)
+}
+
+func TestMigrateLegacyDataFiles(t *testing.T) {
+	// 旧版本把数据文件写在了进程的工作目录中
+	legacyDir, _ := os.MkdirTemp("", "bitcask-go-legacy-wd")
+	defer os.RemoveAll(legacyDir)
+	opts := DefaultOptions
+	opts.DirPath = legacyDir
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	assert.Nil(t, db.Close())
+
+	// 工作目录中的数据文件不影响打开其他的数据目录
+	wd, _ := os.Getwd()
+	assert.Nil(t, os.Chdir(legacyDir))
+	defer os.Chdir(wd)
+	dir, _ := os.MkdirTemp("", "bitcask-go-legacy")
+	opts.DirPath = dir
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(db.ListKeys()))
+	assert.Nil(t, db.Put(utils.GetTestKey(0), utils.RandomValue(24)))
+	assert.Nil(t, db.Close())
+
+	// 数据目录中已经有数据文件时不能移动
+	_, err = MigrateLegacyDataFiles(legacyDir, dir)
+	assert.Equal(t, ErrDirIsNotEmpty, err)
+
+	assert.Nil(t, os.RemoveAll(dir))
+	n, err := MigrateLegacyDataFiles(legacyDir, dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	_, err = os.Stat(data.GetDataFileName(legacyDir, 0))
+	assert.True(t, os.IsNotExist(err))
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(db.ListKeys()))
+	destroyDB(db)
+}
@@ -21,6 +21,8 @@ type cmdHandler func(cli *BitcaskClient, args [][]byte) (interface{}, error)
 var supportedCommands = map[string]cmdHandler{
 	"set":       set,
 	"get":       get,
+	"mset":      mset,
+	"mget":      mget,
 	"hset":      hset,
 	"sadd":      sadd,
 	"lpush":     lpush,
@@ -115,6 +117,45 @@ func get(cli *BitcaskClient, args [][]byte) (interface{}, error) {
 	return value, nil
 }
 
+func mset(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	// mset key value [key value ...]
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, newWrongNumberOfArgsError("MSET")
+	}
+
+	keys := make([][]byte, 0, len(args)/2)
+	values := make([][]byte, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		keys = append(keys, args[i])
+		values = append(values, args[i+1])
+	}
+	if err := cli.db.MSet(keys, values); err != nil {
+		return nil, err
+	}
+
+	return redcon.SimpleString("OK"), nil
+}
+
+func mget(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, newWrongNumberOfArgsError("MGET")
+	}
+
+	values, err := cli.db.MGet(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// 不存在的 Key 返回 nil
+	res := make([]interface{}, len(values))
+	for i, value := range values {
+		if value != nil {
+			res[i] = value
+		}
+	}
+	return res, nil
+}
+
 ////////// Hash 表
 
 func hset(cli *BitcaskClient, args [][]byte) (interface{}, error) {
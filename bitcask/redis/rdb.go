@@ -0,0 +1,1016 @@
+package redis
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"bitcask.go"
+	"bitcask.go/utils"
+)
+
+// RDB 文件中的操作码
+const (
+	rdbOpcodeSlotInfo     = 244
+	rdbOpcodeFunction2    = 245
+	rdbOpcodeModuleAux    = 247
+	rdbOpcodeIdle         = 248
+	rdbOpcodeFreq         = 249
+	rdbOpcodeAux          = 250
+	rdbOpcodeResizeDB     = 251
+	rdbOpcodeExpireTimeMs = 252
+	rdbOpcodeExpireTime   = 253
+	rdbOpcodeSelectDB     = 254
+	rdbOpcodeEOF          = 255
+)
+
+// RDB 文件中数据的类型
+const (
+	rdbTypeString          = 0
+	rdbTypeList            = 1
+	rdbTypeSet             = 2
+	rdbTypeZSet            = 3
+	rdbTypeHash            = 4
+	rdbTypeZSet2           = 5
+	rdbTypeListZiplist     = 10
+	rdbTypeSetIntset       = 11
+	rdbTypeZSetZiplist     = 12
+	rdbTypeHashZiplist     = 13
+	rdbTypeListQuicklist   = 14
+	rdbTypeHashListpack    = 16
+	rdbTypeZSetListpack    = 17
+	rdbTypeListQuicklist2  = 18
+	rdbTypeSetListpack     = 20
+	rdbQuicklistNodePlain  = 1
+	rdbMaxSupportedVersion = 12
+
+	// rdbSaveVersion 导出的 RDB 文件的版本，Redis 5.0 及之后的版本都可以加载
+	rdbSaveVersion = 9
+)
+
+// 长度编码中的特殊编码
+const (
+	rdbEncInt8  = 0
+	rdbEncInt16 = 1
+	rdbEncInt32 = 2
+	rdbEncLZF   = 3
+)
+
+var (
+	ErrInvalidRDB          = errors.New("invalid rdb file")
+	ErrUnsupportedRDBType  = errors.New("unsupported data type in rdb file")
+	ErrRDBChecksumMismatch = errors.New("rdb file checksum mismatch")
+)
+
+// rdbObject RDB 文件中的一个 Key 对应的数据
+type rdbObject struct {
+	dataType RedisDataType
+	value    []byte    // String 的值
+	elements [][]byte  // List、Set 的元素，ZSet 的 member，Hash 为 field 和 value 交替排列
+	scores   []float64 // ZSet 中 member 对应的 score
+}
+
+// LoadRDB 加载 Redis 的 RDB 文件，支持 String、Hash、Set、List、ZSet 以及过期时间，返回加载的 Key 的数量
+// RDB 文件中多个数据库的数据都会加载到同一个数据库中，已经过期的 Key 会被跳过
+func (r *RedisDataStructureType) LoadRDB(reader io.Reader) (int, error) {
+	d := &rdbReader{reader: bufio.NewReader(reader)}
+	header, err := d.read(9)
+	if err != nil {
+		return 0, ErrInvalidRDB
+	}
+	version, err := strconv.Atoi(string(header[5:]))
+	if string(header[:5]) != "REDIS" || err != nil || version < 1 {
+		return 0, ErrInvalidRDB
+	}
+	if version > rdbMaxSupportedVersion {
+		return 0, ErrUnsupportedRDBType
+	}
+
+	var loaded int
+	var expireAt int64 // 下一个 Key 的过期时间（毫秒）
+	for {
+		opcode, err := d.readByte()
+		if err != nil {
+			return loaded, err
+		}
+
+		switch opcode {
+		case rdbOpcodeExpireTimeMs:
+			buf, err := d.read(8)
+			if err != nil {
+				return loaded, err
+			}
+			expireAt = int64(binary.LittleEndian.Uint64(buf))
+		case rdbOpcodeExpireTime:
+			buf, err := d.read(4)
+			if err != nil {
+				return loaded, err
+			}
+			expireAt = int64(binary.LittleEndian.Uint32(buf)) * 1000
+		case rdbOpcodeFreq:
+			if _, err := d.readByte(); err != nil {
+				return loaded, err
+			}
+		case rdbOpcodeIdle, rdbOpcodeSelectDB:
+			if _, err := d.readLength(); err != nil {
+				return loaded, err
+			}
+		case rdbOpcodeResizeDB, rdbOpcodeSlotInfo:
+			n := 2
+			if opcode == rdbOpcodeSlotInfo {
+				n = 3
+			}
+			for i := 0; i < n; i++ {
+				if _, err := d.readLength(); err != nil {
+					return loaded, err
+				}
+			}
+		case rdbOpcodeAux:
+			if _, err := d.readString(); err != nil {
+				return loaded, err
+			}
+			if _, err := d.readString(); err != nil {
+				return loaded, err
+			}
+		case rdbOpcodeFunction2:
+			// Redis Functions 的代码，这里用不到
+			if _, err := d.readString(); err != nil {
+				return loaded, err
+			}
+		case rdbOpcodeModuleAux:
+			return loaded, ErrUnsupportedRDBType
+		case rdbOpcodeEOF:
+			// 版本 5 之后文件的末尾有 8 字节的 CRC64 校验值，为 0 时表示没有计算校验值
+			if version < 5 {
+				return loaded, nil
+			}
+			crc := d.crc
+			buf, err := d.read(8)
+			if err != nil {
+				return loaded, err
+			}
+			if checksum := binary.LittleEndian.Uint64(buf); checksum != 0 && checksum != crc {
+				return loaded, ErrRDBChecksumMismatch
+			}
+			return loaded, nil
+		default:
+			key, err := d.readString()
+			if err != nil {
+				return loaded, err
+			}
+			obj, err := d.readObject(opcode)
+			if err != nil {
+				return loaded, err
+			}
+			if expireAt == 0 || expireAt > time.Now().UnixMilli() {
+				if err := r.storeRDBObject(key, obj, expireAt); err != nil {
+					return loaded, err
+				}
+				loaded++
+			}
+			expireAt = 0
+		}
+	}
+}
+
+// storeRDBObject 使用元数据和内部 Key 的编码写入一个 Key 的数据，expireAt 为过期时间（毫秒）
+func (r *RedisDataStructureType) storeRDBObject(key []byte, obj *rdbObject, expireAt int64) error {
+	var expireTime int64
+	if expireAt > 0 {
+		expireTime = expireAt * int64(time.Millisecond)
+	}
+
+	if obj.dataType == String {
+		buf := make([]byte, 1+binary.MaxVarintLen64+len(obj.value))
+		buf[0] = String
+		index := 1 + binary.PutVarint(buf[1:], expireTime)
+		index += copy(buf[index:], obj.value)
+		return r.db.Put(key, buf[:index])
+	}
+
+	md := &metadata{
+		dataType:   obj.dataType,
+		expireTime: expireTime,
+		version:    time.Now().UnixNano(),
+		size:       uint32(len(obj.elements)),
+	}
+
+	// 一个 Key 的所有数据原子地写入
+	wbOptions := bitcask.DefaultWriteBatchOptions
+	wbOptions.MaxBatchNum = uint(2*len(obj.elements) + 1)
+	wb := r.db.NewWriteBatch(wbOptions)
+
+	switch obj.dataType {
+	case Hash:
+		md.size = uint32(len(obj.elements) / 2)
+		for i := 0; i+1 < len(obj.elements); i += 2 {
+			hk := &hashInternalKey{key: key, version: md.version, field: obj.elements[i]}
+			_ = wb.Put(hk.encode(), obj.elements[i+1])
+		}
+	case Set:
+		for _, member := range obj.elements {
+			sk := &setInternalKey{key: key, version: md.version, member: member}
+			_ = wb.Put(sk.encode(), nil)
+		}
+	case List:
+		md.head = initialListMark
+		md.tail = initialListMark + uint64(len(obj.elements))
+		for i, element := range obj.elements {
+			lk := &listInternalKey{key: key, version: md.version, index: md.head + uint64(i)}
+			_ = wb.Put(lk.encode(), element)
+		}
+	case ZSet:
+		for i, member := range obj.elements {
+			zk := &zsetInternalKey{key: key, version: md.version, member: member, score: obj.scores[i]}
+			_ = wb.Put(zk.encodeMember(), utils.Float64ToBytes(obj.scores[i]))
+			_ = wb.Put(zk.encodeScore(), nil)
+		}
+	}
+
+	if err := wb.Put(key, md.encodeMetaData()); err != nil {
+		return err
+	}
+	return wb.Commit()
+}
+
+// SaveRDB 将所有的数据导出为 RDB 文件，返回导出的 Key 的数量，已经过期的 Key 会被跳过
+// 注意：被删除的集合类型的 Key 残留的内部数据无法和普通的 Key 区分，可能会被当作 String 导出
+func (r *RedisDataStructureType) SaveRDB(writer io.Writer) (int, error) {
+	keys := r.db.ListKeys()
+	now := time.Now().UnixNano()
+
+	// 首先找到所有集合类型的元数据，它们的内部数据都以 key+version 作为前缀
+	internalKeys := make(map[string]bool)
+	objects := make(map[string]*rdbObject)
+	expireTimes := make(map[string]int64)
+	for _, key := range keys {
+		value, err := r.db.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		if len(value) == 0 || value[0] == String || value[0] > ZSet {
+			continue
+		}
+
+		md := decodeMetaData(value)
+		obj, err := r.readCollection(key, md, internalKeys)
+		if err != nil {
+			return 0, err
+		}
+		if md.size > 0 && (md.expireTime == 0 || md.expireTime > now) {
+			objects[string(key)] = obj
+			expireTimes[string(key)] = md.expireTime
+		}
+	}
+
+	w := &rdbWriter{writer: bufio.NewWriter(writer)}
+	w.write([]byte("REDIS" + strconv.Itoa(10000 + rdbSaveVersion)[1:]))
+	w.writeByte(rdbOpcodeSelectDB)
+	w.writeLength(0)
+
+	var saved int
+	for _, key := range keys {
+		if internalKeys[string(key)] {
+			continue
+		}
+
+		obj, ok := objects[string(key)]
+		expireTime := expireTimes[string(key)]
+		if !ok {
+			value, err := r.db.Get(key)
+			if err != nil {
+				return saved, err
+			}
+			if len(value) == 0 || value[0] != String {
+				continue
+			}
+			var n int
+			expireTime, n = binary.Varint(value[1:])
+			if n <= 0 || (expireTime > 0 && expireTime <= now) {
+				continue
+			}
+			obj = &rdbObject{dataType: String, value: value[1+n:]}
+		}
+
+		if expireTime > 0 {
+			w.writeByte(rdbOpcodeExpireTimeMs)
+			buf := make([]byte, 8)
+			binary.LittleEndian.PutUint64(buf, uint64(expireTime/int64(time.Millisecond)))
+			w.write(buf)
+		}
+		w.writeObject(key, obj)
+		saved++
+	}
+
+	w.writeByte(rdbOpcodeEOF)
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, w.crc)
+	w.write(buf)
+	if w.err != nil {
+		return saved, w.err
+	}
+	return saved, w.writer.Flush()
+}
+
+// readCollection 读取一个集合类型的 Key 的所有数据，并将它的内部 Key 记录到 internalKeys 中
+func (r *RedisDataStructureType) readCollection(key []byte, md *metadata, internalKeys map[string]bool) (*rdbObject, error) {
+	prefix := make([]byte, len(key)+8)
+	copy(prefix, key)
+	binary.LittleEndian.PutUint64(prefix[len(key):], uint64(md.version))
+
+	obj := &rdbObject{dataType: md.dataType}
+	listElements := make(map[uint64][]byte)
+
+	iterator := r.db.NewIterator(bitcask.IteratorOptions{Prefix: prefix})
+	defer iterator.Close()
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		internalKey := iterator.Key()
+		internalKeys[string(internalKey)] = true
+		rest := internalKey[len(prefix):]
+
+		value, err := iterator.Value()
+		if err != nil {
+			return nil, err
+		}
+
+		switch md.dataType {
+		case Hash:
+			obj.elements = append(obj.elements, rest, value)
+		case Set:
+			if len(rest) < 4 || int(binary.LittleEndian.Uint32(rest[len(rest)-4:])) != len(rest)-4 {
+				continue
+			}
+			obj.elements = append(obj.elements, rest[:len(rest)-4])
+		case List:
+			if len(rest) == 8 {
+				listElements[binary.LittleEndian.Uint64(rest)] = value
+			}
+		case ZSet:
+			// member 对应的数据中保存着 score，score 部分的 Key 对应的数据为空
+			if len(value) > 0 {
+				obj.elements = append(obj.elements, rest)
+				obj.scores = append(obj.scores, utils.FloatFromBytes(value))
+			}
+		}
+	}
+
+	if md.dataType == List {
+		for i := md.head; i < md.tail; i++ {
+			if element, ok := listElements[i]; ok {
+				obj.elements = append(obj.elements, element)
+			}
+		}
+	}
+	return obj, nil
+}
+
+// rdbReader 读取 RDB 文件，同时计算 CRC64 校验值
+type rdbReader struct {
+	reader *bufio.Reader
+	crc    uint64
+}
+
+func (d *rdbReader) read(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.reader, buf); err != nil {
+		return nil, ErrInvalidRDB
+	}
+	d.crc = crc64Update(d.crc, buf)
+	return buf, nil
+}
+
+func (d *rdbReader) readByte() (byte, error) {
+	buf, err := d.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return buf[0], nil
+}
+
+// readLengthOrEncoding 读取长度编码，isEncoded 为 true 时返回的是字符串的特殊编码方式
+func (d *rdbReader) readLengthOrEncoding() (uint64, bool, error) {
+	b, err := d.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3f), false, nil
+	case 1:
+		next, err := d.readByte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(b&0x3f)<<8 | uint64(next), false, nil
+	case 2:
+		if b == 0x80 {
+			buf, err := d.read(4)
+			if err != nil {
+				return 0, false, err
+			}
+			return uint64(binary.BigEndian.Uint32(buf)), false, nil
+		}
+		if b == 0x81 {
+			buf, err := d.read(8)
+			if err != nil {
+				return 0, false, err
+			}
+			return binary.BigEndian.Uint64(buf), false, nil
+		}
+		return 0, false, ErrInvalidRDB
+	default:
+		return uint64(b & 0x3f), true, nil
+	}
+}
+
+func (d *rdbReader) readLength() (uint64, error) {
+	length, isEncoded, err := d.readLengthOrEncoding()
+	if err == nil && isEncoded {
+		err = ErrInvalidRDB
+	}
+	return length, err
+}
+
+// readString 读取字符串，整数编码的字符串转换为十进制的字符串，LZF 压缩的字符串会被解压
+func (d *rdbReader) readString() ([]byte, error) {
+	length, isEncoded, err := d.readLengthOrEncoding()
+	if err != nil {
+		return nil, err
+	}
+	if !isEncoded {
+		if length > math.MaxInt32 {
+			return nil, ErrInvalidRDB
+		}
+		return d.read(int(length))
+	}
+
+	switch length {
+	case rdbEncInt8:
+		b, err := d.readByte()
+		return []byte(strconv.Itoa(int(int8(b)))), err
+	case rdbEncInt16:
+		buf, err := d.read(2)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.Itoa(int(int16(binary.LittleEndian.Uint16(buf))))), nil
+	case rdbEncInt32:
+		buf, err := d.read(4)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.Itoa(int(int32(binary.LittleEndian.Uint32(buf))))), nil
+	case rdbEncLZF:
+		compressedLen, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		rawLen, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		if compressedLen > math.MaxInt32 || rawLen > math.MaxInt32 {
+			return nil, ErrInvalidRDB
+		}
+		compressed, err := d.read(int(compressedLen))
+		if err != nil {
+			return nil, err
+		}
+		return lzfDecompress(compressed, int(rawLen))
+	}
+	return nil, ErrInvalidRDB
+}
+
+// readStrings 读取 n 个字符串
+func (d *rdbReader) readStrings(n uint64) ([][]byte, error) {
+	var elements [][]byte
+	for i := uint64(0); i < n; i++ {
+		element, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+	return elements, nil
+}
+
+// readObject 根据 RDB 中的数据类型读取一个 Key 对应的数据
+func (d *rdbReader) readObject(rdbType byte) (*rdbObject, error) {
+	switch rdbType {
+	case rdbTypeString:
+		value, err := d.readString()
+		return &rdbObject{dataType: String, value: value}, err
+
+	case rdbTypeList, rdbTypeSet, rdbTypeHash:
+		n, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		obj := &rdbObject{dataType: List}
+		if rdbType == rdbTypeSet {
+			obj.dataType = Set
+		}
+		if rdbType == rdbTypeHash {
+			obj.dataType = Hash
+			n *= 2
+		}
+		obj.elements, err = d.readStrings(n)
+		return obj, err
+
+	case rdbTypeZSet, rdbTypeZSet2:
+		n, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		obj := &rdbObject{dataType: ZSet}
+		for i := uint64(0); i < n; i++ {
+			member, err := d.readString()
+			if err != nil {
+				return nil, err
+			}
+			score, err := d.readScore(rdbType == rdbTypeZSet2)
+			if err != nil {
+				return nil, err
+			}
+			obj.elements = append(obj.elements, member)
+			obj.scores = append(obj.scores, score)
+		}
+		return obj, nil
+
+	case rdbTypeListZiplist, rdbTypeHashZiplist, rdbTypeZSetZiplist:
+		buf, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		elements, err := parseZiplist(buf)
+		if err != nil {
+			return nil, err
+		}
+		return newPackedObject(rdbType, elements)
+
+	case rdbTypeHashListpack, rdbTypeZSetListpack, rdbTypeSetListpack:
+		buf, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		elements, err := parseListpack(buf)
+		if err != nil {
+			return nil, err
+		}
+		return newPackedObject(rdbType, elements)
+
+	case rdbTypeSetIntset:
+		buf, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		elements, err := parseIntset(buf)
+		return &rdbObject{dataType: Set, elements: elements}, err
+
+	case rdbTypeListQuicklist, rdbTypeListQuicklist2:
+		n, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		obj := &rdbObject{dataType: List}
+		for i := uint64(0); i < n; i++ {
+			container := uint64(0)
+			if rdbType == rdbTypeListQuicklist2 {
+				if container, err = d.readLength(); err != nil {
+					return nil, err
+				}
+			}
+			buf, err := d.readString()
+			if err != nil {
+				return nil, err
+			}
+			// 大的元素单独保存在一个节点中
+			if container == rdbQuicklistNodePlain {
+				obj.elements = append(obj.elements, buf)
+				continue
+			}
+
+			var elements [][]byte
+			if rdbType == rdbTypeListQuicklist {
+				elements, err = parseZiplist(buf)
+			} else {
+				elements, err = parseListpack(buf)
+			}
+			if err != nil {
+				return nil, err
+			}
+			obj.elements = append(obj.elements, elements...)
+		}
+		return obj, nil
+	}
+	return nil, ErrUnsupportedRDBType
+}
+
+// readScore 读取 ZSet 的 score，binary 为 true 时是 8 字节的浮点数，否则为字符串
+func (d *rdbReader) readScore(binaryScore bool) (float64, error) {
+	if binaryScore {
+		buf, err := d.read(8)
+		if err != nil {
+			return 0, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(buf)), nil
+	}
+
+	length, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch length {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	buf, err := d.read(int(length))
+	if err != nil {
+		return 0, err
+	}
+	score, err := strconv.ParseFloat(string(buf), 64)
+	if err != nil {
+		return 0, ErrInvalidRDB
+	}
+	return score, nil
+}
+
+// newPackedObject 将 ziplist 或 listpack 中的元素转换为对应的数据类型
+func newPackedObject(rdbType byte, elements [][]byte) (*rdbObject, error) {
+	switch rdbType {
+	case rdbTypeListZiplist:
+		return &rdbObject{dataType: List, elements: elements}, nil
+	case rdbTypeSetListpack:
+		return &rdbObject{dataType: Set, elements: elements}, nil
+	case rdbTypeHashZiplist, rdbTypeHashListpack:
+		if len(elements)%2 != 0 {
+			return nil, ErrInvalidRDB
+		}
+		return &rdbObject{dataType: Hash, elements: elements}, nil
+	}
+
+	// ZSet 中 member 和 score 交替排列
+	if len(elements)%2 != 0 {
+		return nil, ErrInvalidRDB
+	}
+	obj := &rdbObject{dataType: ZSet}
+	for i := 0; i < len(elements); i += 2 {
+		score, err := strconv.ParseFloat(string(elements[i+1]), 64)
+		if err != nil {
+			return nil, ErrInvalidRDB
+		}
+		obj.elements = append(obj.elements, elements[i])
+		obj.scores = append(obj.scores, score)
+	}
+	return obj, nil
+}
+
+// parseZiplist 解析 ziplist：zlbytes(4) zltail(4) zllen(2) entries... 0xff
+func parseZiplist(buf []byte) ([][]byte, error) {
+	if len(buf) < 11 || int(binary.LittleEndian.Uint32(buf)) != len(buf) {
+		return nil, ErrInvalidRDB
+	}
+
+	var elements [][]byte
+	pos := 10
+	for pos < len(buf) && buf[pos] != 0xff {
+		// 前一个元素的长度
+		if buf[pos] == 0xfe {
+			pos += 5
+		} else {
+			pos++
+		}
+		if pos >= len(buf) {
+			return nil, ErrInvalidRDB
+		}
+
+		enc := buf[pos]
+		var strLen, headerLen int
+		var intLen int
+		switch {
+		case enc>>6 == 0:
+			strLen, headerLen = int(enc&0x3f), 1
+		case enc>>6 == 1:
+			if pos+1 >= len(buf) {
+				return nil, ErrInvalidRDB
+			}
+			strLen, headerLen = int(enc&0x3f)<<8|int(buf[pos+1]), 2
+		case enc == 0x80:
+			if pos+5 > len(buf) {
+				return nil, ErrInvalidRDB
+			}
+			strLen, headerLen = int(binary.BigEndian.Uint32(buf[pos+1:])), 5
+		case enc == 0xc0:
+			intLen = 2
+		case enc == 0xd0:
+			intLen = 4
+		case enc == 0xe0:
+			intLen = 8
+		case enc == 0xf0:
+			intLen = 3
+		case enc == 0xfe:
+			intLen = 1
+		case enc >= 0xf1 && enc <= 0xfd:
+			// 4 位的立即数，表示 0 到 12
+			elements = append(elements, []byte(strconv.Itoa(int(enc&0x0f)-1)))
+			pos++
+			continue
+		default:
+			return nil, ErrInvalidRDB
+		}
+
+		if intLen > 0 {
+			if pos+1+intLen > len(buf) {
+				return nil, ErrInvalidRDB
+			}
+			elements = append(elements, []byte(strconv.FormatInt(readLittleEndianInt(buf[pos+1:pos+1+intLen]), 10)))
+			pos += 1 + intLen
+			continue
+		}
+		start := pos + headerLen
+		if strLen < 0 || start+strLen > len(buf) {
+			return nil, ErrInvalidRDB
+		}
+		elements = append(elements, buf[start:start+strLen])
+		pos = start + strLen
+	}
+	return elements, nil
+}
+
+// parseListpack 解析 listpack：total bytes(4) num elements(2) entries... 0xff
+// 每个元素为 encoding + data + backlen
+func parseListpack(buf []byte) ([][]byte, error) {
+	if len(buf) < 7 || int(binary.LittleEndian.Uint32(buf)) != len(buf) {
+		return nil, ErrInvalidRDB
+	}
+
+	var elements [][]byte
+	pos := 6
+	for pos < len(buf) && buf[pos] != 0xff {
+		enc := buf[pos]
+		var entryLen int
+		var element []byte
+		switch {
+		case enc&0x80 == 0:
+			// 7 位无符号整数
+			element, entryLen = []byte(strconv.Itoa(int(enc&0x7f))), 1
+		case enc&0xc0 == 0x80:
+			// 6 位长度的字符串
+			strLen := int(enc & 0x3f)
+			entryLen = 1 + strLen
+			if pos+entryLen > len(buf) {
+				return nil, ErrInvalidRDB
+			}
+			element = buf[pos+1 : pos+entryLen]
+		case enc&0xe0 == 0xc0:
+			// 13 位有符号整数
+			if pos+2 > len(buf) {
+				return nil, ErrInvalidRDB
+			}
+			v := int(enc&0x1f)<<8 | int(buf[pos+1])
+			if v >= 1<<12 {
+				v -= 1 << 13
+			}
+			element, entryLen = []byte(strconv.Itoa(v)), 2
+		case enc&0xf0 == 0xe0:
+			// 12 位长度的字符串
+			if pos+2 > len(buf) {
+				return nil, ErrInvalidRDB
+			}
+			strLen := int(enc&0x0f)<<8 | int(buf[pos+1])
+			entryLen = 2 + strLen
+			if pos+entryLen > len(buf) {
+				return nil, ErrInvalidRDB
+			}
+			element = buf[pos+2 : pos+entryLen]
+		case enc == 0xf0:
+			// 32 位长度的字符串
+			if pos+5 > len(buf) {
+				return nil, ErrInvalidRDB
+			}
+			strLen := int(binary.LittleEndian.Uint32(buf[pos+1:]))
+			entryLen = 5 + strLen
+			if strLen < 0 || pos+entryLen > len(buf) {
+				return nil, ErrInvalidRDB
+			}
+			element = buf[pos+5 : pos+entryLen]
+		case enc >= 0xf1 && enc <= 0xf4:
+			intLen := map[byte]int{0xf1: 2, 0xf2: 3, 0xf3: 4, 0xf4: 8}[enc]
+			entryLen = 1 + intLen
+			if pos+entryLen > len(buf) {
+				return nil, ErrInvalidRDB
+			}
+			element = []byte(strconv.FormatInt(readLittleEndianInt(buf[pos+1:pos+entryLen]), 10))
+		default:
+			return nil, ErrInvalidRDB
+		}
+
+		elements = append(elements, element)
+		pos += entryLen + listpackBacklenSize(entryLen)
+	}
+	return elements, nil
+}
+
+// listpackBacklenSize 元素末尾保存元素长度的字节数
+func listpackBacklenSize(entryLen int) int {
+	switch {
+	case entryLen < 1<<7:
+		return 1
+	case entryLen < 1<<14:
+		return 2
+	case entryLen < 1<<21:
+		return 3
+	case entryLen < 1<<28:
+		return 4
+	}
+	return 5
+}
+
+// parseIntset 解析 intset：encoding(4) length(4) contents
+func parseIntset(buf []byte) ([][]byte, error) {
+	if len(buf) < 8 {
+		return nil, ErrInvalidRDB
+	}
+	width := int(binary.LittleEndian.Uint32(buf))
+	length := int(binary.LittleEndian.Uint32(buf[4:]))
+	if (width != 2 && width != 4 && width != 8) || length < 0 || 8+width*length != len(buf) {
+		return nil, ErrInvalidRDB
+	}
+
+	var elements [][]byte
+	for i := 0; i < length; i++ {
+		v := readLittleEndianInt(buf[8+i*width : 8+(i+1)*width])
+		elements = append(elements, []byte(strconv.FormatInt(v, 10)))
+	}
+	return elements, nil
+}
+
+// readLittleEndianInt 读取小端序的有符号整数，支持 1 到 8 个字节
+func readLittleEndianInt(buf []byte) int64 {
+	var v uint64
+	for i := len(buf) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(buf[i])
+	}
+	// 符号扩展
+	shift := uint(64 - 8*len(buf))
+	return int64(v<<shift) >> shift
+}
+
+// lzfDecompress 解压 LZF 压缩的数据
+func lzfDecompress(in []byte, rawLen int) ([]byte, error) {
+	out := make([]byte, 0, rawLen)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 32 {
+			// 字面量
+			n := ctrl + 1
+			if i+n > len(in) {
+				return nil, ErrInvalidRDB
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+
+		// 引用之前的数据
+		length := ctrl >> 5
+		if length == 7 {
+			if i >= len(in) {
+				return nil, ErrInvalidRDB
+			}
+			length += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, ErrInvalidRDB
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 {
+			return nil, ErrInvalidRDB
+		}
+		for j := 0; j < length+2; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != rawLen {
+		return nil, ErrInvalidRDB
+	}
+	return out, nil
+}
+
+// rdbWriter 写入 RDB 文件，同时计算 CRC64 校验值，出错之后不再写入
+type rdbWriter struct {
+	writer *bufio.Writer
+	crc    uint64
+	err    error
+}
+
+func (w *rdbWriter) write(buf []byte) {
+	if w.err != nil {
+		return
+	}
+	w.crc = crc64Update(w.crc, buf)
+	_, w.err = w.writer.Write(buf)
+}
+
+func (w *rdbWriter) writeByte(b byte) {
+	w.write([]byte{b})
+}
+
+func (w *rdbWriter) writeLength(length uint64) {
+	switch {
+	case length < 1<<6:
+		w.writeByte(byte(length))
+	case length < 1<<14:
+		w.write([]byte{0x40 | byte(length>>8), byte(length)})
+	case length <= math.MaxUint32:
+		buf := make([]byte, 5)
+		buf[0] = 0x80
+		binary.BigEndian.PutUint32(buf[1:], uint32(length))
+		w.write(buf)
+	default:
+		buf := make([]byte, 9)
+		buf[0] = 0x81
+		binary.BigEndian.PutUint64(buf[1:], length)
+		w.write(buf)
+	}
+}
+
+func (w *rdbWriter) writeString(s []byte) {
+	w.writeLength(uint64(len(s)))
+	w.write(s)
+}
+
+// writeObject 写入一个 Key 的数据，集合类型使用最简单的编码，由 Redis 在加载时自行转换
+func (w *rdbWriter) writeObject(key []byte, obj *rdbObject) {
+	switch obj.dataType {
+	case String:
+		w.writeByte(rdbTypeString)
+		w.writeString(key)
+		w.writeString(obj.value)
+	case Hash:
+		w.writeByte(rdbTypeHash)
+		w.writeString(key)
+		w.writeLength(uint64(len(obj.elements) / 2))
+		for _, element := range obj.elements {
+			w.writeString(element)
+		}
+	case Set, List:
+		if obj.dataType == Set {
+			w.writeByte(rdbTypeSet)
+		} else {
+			w.writeByte(rdbTypeList)
+		}
+		w.writeString(key)
+		w.writeLength(uint64(len(obj.elements)))
+		for _, element := range obj.elements {
+			w.writeString(element)
+		}
+	case ZSet:
+		w.writeByte(rdbTypeZSet2)
+		w.writeString(key)
+		w.writeLength(uint64(len(obj.elements)))
+		buf := make([]byte, 8)
+		for i, member := range obj.elements {
+			w.writeString(member)
+			binary.LittleEndian.PutUint64(buf, math.Float64bits(obj.scores[i]))
+			w.write(buf)
+		}
+	}
+}
+
+// crc64Table Redis 使用的 CRC64（Jones 多项式，输入输出反转）
+var crc64Table = func() [256]uint64 {
+	const poly = 0x95ac9329ac4bc9b5
+	var table [256]uint64
+	for i := range table {
+		crc := uint64(i)
+		for j := 0; j < 8; j++ {
+			if crc&1 == 1 {
+				crc = crc>>1 ^ poly
+			} else {
+				crc >>= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+func crc64Update(crc uint64, buf []byte) uint64 {
+	for _, b := range buf {
+		crc = crc64Table[byte(crc)^b] ^ crc>>8
+	}
+	return crc
+}
@@ -0,0 +1,164 @@
+package redis
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"bitcask.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func openTestRedis(t *testing.T, name string) (*RedisDataStructureType, func()) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-rdb-"+name)
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructureType(opts)
+	assert.Nil(t, err)
+	return rds, func() {
+		_ = rds.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func popAll(t *testing.T, rds *RedisDataStructureType, key string) []string {
+	var elements []string
+	for {
+		element, err := rds.LPop([]byte(key))
+		assert.Nil(t, err)
+		if element == nil {
+			return elements
+		}
+		elements = append(elements, string(element))
+	}
+}
+
+func assertRedis62Data(t *testing.T, rds *RedisDataStructureType) {
+	val, err := rds.Get([]byte("str"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(val))
+	val, err = rds.Get([]byte("int"))
+	assert.Nil(t, err)
+	assert.Equal(t, "12345", string(val))
+	val, err = rds.Get([]byte("lzf"))
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Repeat("a", 20), string(val))
+	val, err = rds.Get([]byte("ttl"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(val))
+	_, err = rds.Get([]byte("expired"))
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+
+	val, err = rds.HGet([]byte("hash"), []byte("f2"))
+	assert.Nil(t, err)
+	assert.Equal(t, "100", string(val))
+	val, err = rds.HGet([]byte("hash2"), []byte("k"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(val))
+
+	for _, member := range []string{"1", "2", "300"} {
+		ok, err := rds.SIsMenber([]byte("intset"), []byte(member))
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}
+	ok, err := rds.SIsMenber([]byte("set"), []byte("m2"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	score, err := rds.ZScore([]byte("zset"), []byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, "2.5", score)
+	score, err = rds.ZScore([]byte("zset2"), []byte("y"))
+	assert.Nil(t, err)
+	assert.Equal(t, "-3", score)
+	score, err = rds.ZScore([]byte("zset-old"), []byte("m"))
+	assert.Nil(t, err)
+	assert.Equal(t, "0.25", score)
+
+	assert.Equal(t, []string{"a", "b", "7", "-70000", strings.Repeat("c", 70)}, popAll(t, rds, "list"))
+	assert.Equal(t, []string{"x", "y"}, popAll(t, rds, "list-db1"))
+}
+
+func TestRedisDataStructure_LoadRDB(t *testing.T) {
+	rds, cleanup := openTestRedis(t, "load")
+	defer cleanup()
+
+	file, err := os.Open("testdata/redis-6.2-v9.rdb")
+	assert.Nil(t, err)
+	defer file.Close()
+	loaded, err := rds.LoadRDB(file)
+	assert.Nil(t, err)
+	assert.Equal(t, 13, loaded)
+	assertRedis62Data(t, rds)
+
+	rds2, cleanup2 := openTestRedis(t, "load-v11")
+	defer cleanup2()
+	file2, err := os.Open("testdata/redis-7.2-v11.rdb")
+	assert.Nil(t, err)
+	defer file2.Close()
+	loaded, err = rds2.LoadRDB(file2)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, loaded)
+
+	val, err := rds2.HGet([]byte("hash"), []byte("f2"))
+	assert.Nil(t, err)
+	assert.Equal(t, "-5", string(val))
+	val, err = rds2.HGet([]byte("hash"), []byte("f3"))
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Repeat("x", 100), string(val))
+	score, err := rds2.ZScore([]byte("zset"), []byte("c"))
+	assert.Nil(t, err)
+	assert.Equal(t, "100000", score)
+	ok, err := rds2.SIsMenber([]byte("set"), []byte("42"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = rds2.SIsMenber([]byte("intset"), []byte("-1"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a", "1000", "-70000", "plain-element"}, popAll(t, rds2, "list"))
+}
+
+func TestRedisDataStructure_SaveRDB(t *testing.T) {
+	rds, cleanup := openTestRedis(t, "save")
+	defer cleanup()
+
+	buf, err := os.ReadFile("testdata/redis-6.2-v9.rdb")
+	assert.Nil(t, err)
+	_, err = rds.LoadRDB(bytes.NewReader(buf))
+	assert.Nil(t, err)
+
+	// 导出之后重新加载，数据保持一致
+	out := new(bytes.Buffer)
+	saved, err := rds.SaveRDB(out)
+	assert.Nil(t, err)
+	assert.Equal(t, 13, saved)
+	assert.True(t, bytes.HasPrefix(out.Bytes(), []byte("REDIS0009")))
+
+	rds2, cleanup2 := openTestRedis(t, "save-reload")
+	defer cleanup2()
+	loaded, err := rds2.LoadRDB(bytes.NewReader(out.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, 13, loaded)
+	assertRedis62Data(t, rds2)
+}
+
+func TestRedisDataStructure_LoadRDB_Invalid(t *testing.T) {
+	rds, cleanup := openTestRedis(t, "invalid")
+	defer cleanup()
+
+	buf, err := os.ReadFile("testdata/redis-6.2-v9.rdb")
+	assert.Nil(t, err)
+
+	// 修改 "hello" 中的一个字节，校验值不匹配
+	corrupted := bytes.Replace(buf, []byte("hello"), []byte("hellO"), 1)
+	_, err = rds.LoadRDB(bytes.NewReader(corrupted))
+	assert.Equal(t, ErrRDBChecksumMismatch, err)
+
+	_, err = rds.LoadRDB(bytes.NewReader(buf[:len(buf)/2]))
+	assert.Equal(t, ErrInvalidRDB, err)
+	_, err = rds.LoadRDB(strings.NewReader("not a rdb file"))
+	assert.Equal(t, ErrInvalidRDB, err)
+
+	assert.Equal(t, uint64(0xe9c6d914c4b8d9ca), crc64Update(0, []byte("123456789")))
+}
@@ -56,6 +56,21 @@ func (r *RedisDataStructureType) Set(key []byte, ttl time.Duration, value []byte
 		return nil
 	}
 
+	//编码后写入
+	return r.db.Put(key, encodeStringValue(ttl, value))
+}
+
+// MSet 批量设置多个 String 类型的数据（没有过期时间），在一次加锁中完成写入
+func (r *RedisDataStructureType) MSet(keys, values [][]byte) error {
+	encValues := make([][]byte, len(values))
+	for i, value := range values {
+		encValues[i] = encodeStringValue(0, value)
+	}
+	return r.db.MultiPut(keys, encValues)
+}
+
+// encodeStringValue 编码 String 类型的 value
+func encodeStringValue(ttl time.Duration, value []byte) []byte {
 	// 编码方式： value = type +expireTime+payload(原始的value)
 
 	buf := make([]byte, binary.MaxVarintLen64+1) //存储编码后的数据(+1保证可以容纳最大长度的变长整数编码)
@@ -73,9 +88,7 @@ func (r *RedisDataStructureType) Set(key []byte, ttl time.Duration, value []byte
 	encValue := make([]byte, index+len(value))
 	copy(encValue[:index], buf[:index])
 	copy(encValue[index:], value)
-
-	//编码后写入
-	return r.db.Put(key, encValue)
+	return encValue
 }
 
 // Get
@@ -84,7 +97,31 @@ func (r *RedisDataStructureType) Get(key []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	return decodeStringValue(encvalue)
+}
+
+// MGet 批量获取多个 String 类型的数据，不存在、已经过期或者不是 String 类型的 Key 返回 nil（和 Redis 的 MGET 一致）
+func (r *RedisDataStructureType) MGet(keys [][]byte) ([][]byte, error) {
+	encValues, errs := r.db.MultiGet(keys)
+	values := make([][]byte, len(keys))
+	for i, encValue := range encValues {
+		if errs[i] == bitcask.ErrKeyNotFound {
+			continue
+		}
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		value, err := decodeStringValue(encValue)
+		if err != nil && err != ErrWrongTypeOperation {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
 
+// decodeStringValue 解码 String 类型的 value，已经过期时返回 nil
+func decodeStringValue(encvalue []byte) ([]byte, error) {
 	// 解码
 	dataType := encvalue[0]
 	if dataType != String {
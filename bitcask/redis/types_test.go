@@ -273,3 +273,26 @@ func TestRedisDataStructure_ZScore(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, string("333"), score)
 }
+
+func TestRedisDataStructure_MSet_MGet(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-mset")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructureType(opts)
+	assert.Nil(t, err)
+
+	keys := [][]byte{utils.GetTestKey(1), utils.GetTestKey(2)}
+	values := [][]byte{utils.RandomValue(100), utils.RandomValue(100)}
+	err = rds.MSet(keys, values)
+	assert.Nil(t, err)
+
+	err = rds.Set(utils.GetTestKey(3), time.Millisecond, utils.RandomValue(100))
+	assert.Nil(t, err)
+	_, err = rds.HSet(utils.GetTestKey(4), []byte("field"), []byte("value"))
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 5)
+
+	got, err := rds.MGet([][]byte{utils.GetTestKey(1), utils.GetTestKey(3), utils.GetTestKey(4), utils.GetTestKey(33), utils.GetTestKey(2)})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{values[0], nil, nil, nil, values[1]}, got)
+}
@@ -0,0 +1,73 @@
+package bitcask
+
+import (
+	"encoding/binary"
+	"time"
+
+	"bitcask.go/data"
+)
+
+// restorePointValueSize 时间点标记的 Value：时间段的开始和结束（UnixNano，各 8 字节）
+const restorePointValueSize = 16
+
+// encodeRestorePoint 编码时间点标记：Key 为空的删除记录，加载时不会修改索引，Merge 时被丢弃
+// 标记之后、下一个标记之前的记录都是在 [start, end) 这段时间内写入的
+func encodeRestorePoint(start, end time.Time) *data.LogRecord {
+	value := make([]byte, restorePointValueSize)
+	binary.BigEndian.PutUint64(value[:8], uint64(start.UnixNano()))
+	binary.BigEndian.PutUint64(value[8:], uint64(end.UnixNano()))
+	return &data.LogRecord{
+		Key:   logRecordKeyWithSeqNum(nil, nonTransactionSeqNum),
+		Value: value,
+		Type:  data.LogRecordDeleted,
+	}
+}
+
+// parseRestorePoint 解析时间点标记，返回标记的时间段；不是时间点标记时返回 false
+// 并发写入失败时的填充记录也是 Key 为空的删除记录，它的 Value 全部为 0，不会被当作时间点标记
+func parseRestorePoint(record *DumpRecord) (time.Time, time.Time, bool) {
+	if record.Type != data.LogRecordDeleted || record.SeqNum != nonTransactionSeqNum ||
+		len(record.Key) != 0 || len(record.Value) != restorePointValueSize {
+		return time.Time{}, time.Time{}, false
+	}
+	start := int64(binary.BigEndian.Uint64(record.Value[:8]))
+	end := int64(binary.BigEndian.Uint64(record.Value[8:]))
+	if end <= start {
+		return time.Time{}, time.Time{}, false
+	}
+	return time.Unix(0, start), time.Unix(0, end), true
+}
+
+// writeRestorePoint 写入的时间进入了新的 RestorePointInterval 时间段时，在下一条记录之前写入时间点标记
+// 注意！！！使用这个 DB 方法的时候必须持有互斥锁
+func (db *DB) writeRestorePoint() error {
+	interval := db.option.RestorePointInterval
+	if interval <= 0 || db.option.InMemory {
+		return nil
+	}
+	start := time.Now().Truncate(interval)
+	if start.Equal(db.restorePoint) {
+		return nil
+	}
+
+	// 先记录当前的时间段，writeLogRecord 写入标记时不会再次写入
+	db.restorePoint = start
+	if _, err := db.writeLogRecord(encodeRestorePoint(start, start.Add(interval))); err != nil {
+		db.restorePoint = time.Time{}
+		return err
+	}
+	return nil
+}
+
+// truncateToTime 截断数据文件，只保留在 t 之前写入的数据：
+// 从第一个结束时间晚于 t 的时间点标记开始截断，t 所在的时间段内写入的数据也会被丢弃
+// 没有时间点标记的数据（RestorePointInterval 为 0 时写入的）无法判断写入时间，全部保留
+func truncateToTime(dirPath string, t time.Time) error {
+	_, err := truncateDataFiles(dirPath, func(record *DumpRecord) (int64, bool) {
+		if _, end, ok := parseRestorePoint(record); ok && end.After(t) {
+			return record.Offset, true
+		}
+		return 0, false
+	})
+	return err
+}
@@ -0,0 +1,205 @@
+package bitcask
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"bitcask.go/data"
+	"bitcask.go/fio"
+	"bitcask.go/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_IndexShards(t *testing.T) {
+	for _, ioType := range []fio.FileIOType{fio.StandardFIO, fio.WritableMemoryMap} {
+		opts := DefaultOptions
+		dir, _ := os.MkdirTemp("", "bitcask-go-sharded")
+		opts.DirPath = dir
+		opts.DataFileSize = 64 * 1024
+		opts.IndexShards = 8
+		opts.IOType = ioType
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		// 多个 goroutine 同时写入各自的 Key 和同一个 Key，中间会切换多次活跃文件
+		// utils.RandomValue 不能并发调用，所有的 goroutine 使用同一个 Value
+		value := utils.RandomValue(64)
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 500; i++ {
+					assert.Nil(t, db.Put(utils.GetTestKey(g*1000+i), value))
+					assert.Nil(t, db.Put([]byte("shared"), []byte(fmt.Sprintf("%d-%d", g, i))))
+					if i%10 == 0 {
+						assert.Nil(t, db.Delete(utils.GetTestKey(g*1000+i)))
+					}
+					_, _ = db.Get(utils.GetTestKey(((g + 1) % 8) * 1000))
+				}
+			}(g)
+		}
+		wg.Wait()
+		assert.Greater(t, db.Stat().DataFileNum, uint(1))
+
+		shared, err := db.Get([]byte("shared"))
+		assert.Nil(t, err)
+		keys := db.ListKeys()
+		assert.Equal(t, 8*450+1, len(keys))
+		for i := 1; i < len(keys); i++ {
+			assert.Less(t, string(keys[i-1]), string(keys[i]))
+		}
+
+		// 重新打开之后，按照数据文件重建的索引和之前内存中的索引一致
+		assert.Nil(t, db.Close())
+		db, err = Open(opts)
+		assert.Nil(t, err)
+		reopened, err := db.Get([]byte("shared"))
+		assert.Nil(t, err)
+		assert.Equal(t, shared, reopened)
+		assert.Equal(t, keys, db.ListKeys())
+		destroyDB(db)
+	}
+}
+
+func TestDB_IndexShardsOptions(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-sharded")
+	defer os.RemoveAll(dir)
+	opts.DirPath = dir
+
+	opts.IndexShards = -1
+	_, err := Open(opts)
+	assert.Equal(t, ErrInvalidIndexShards, err)
+
+	opts.IndexShards = 4
+	opts.IndexType = BPlusTree
+	_, err = Open(opts)
+	assert.Equal(t, ErrInvalidIndexShards, err)
+}
+
+func TestDB_ConcurrentWriteFault(t *testing.T) {
+	// failures 次写入失败：1 次时失败的位置被填充，2 次时填充也失败，文件在下一次写入之前被截断
+	for _, failures := range []int{1, 2} {
+		opts := DefaultOptions
+		dir, _ := os.MkdirTemp("", "bitcask-go-sharded")
+		opts.DirPath = dir
+		opts.IndexShards = 4
+		injector := fio.NewFaultInjector(1)
+		faultOpts := opts
+		faultOpts.wrapIOManager = injector.Wrap
+		db, err := Open(faultOpts)
+		assert.Nil(t, err)
+
+		for i := 0; i < 10; i++ {
+			assert.Nil(t, db.Put(utils.GetTestKey(i), []byte("old")))
+		}
+		injector.AddRule(fio.FaultRule{Op: fio.FaultWrite, Kind: fio.FaultError, Count: failures})
+		assert.NotNil(t, db.Put(utils.GetTestKey(5), []byte("new")))
+		assert.Equal(t, failures, injector.Triggered())
+		for i := 10; i < 20; i++ {
+			assert.Nil(t, db.Put(utils.GetTestKey(i), []byte("old")))
+		}
+		assert.Nil(t, db.Close())
+
+		// 重新打开之后，失败的写入之后返回成功的记录都还在
+		db, err = Open(opts)
+		assert.Nil(t, err)
+		for i := 0; i < 20; i++ {
+			value, err := db.Get(utils.GetTestKey(i))
+			assert.Nil(t, err)
+			assert.Equal(t, []byte("old"), value)
+		}
+		destroyDB(db)
+	}
+}
+
+func TestDB_ConcurrentWriteHole(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-sharded")
+	opts.DirPath = dir
+	opts.IndexShards = 4
+	injector := fio.NewFaultInjector(1)
+	opts.wrapIOManager = injector.Wrap
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put(utils.GetTestKey(0), []byte("old")))
+
+	// 预留两个位置，第一个写入和填充都失败，第二个写入成功之后也不能提交
+	reserve := func(key []byte) (*pendingWrite, []byte) {
+		encRecord, size := data.EncodeLogRecord(&data.LogRecord{
+			Key:   logRecordKeyWithSeqNum(key, nonTransactionSeqNum),
+			Value: []byte("new"),
+			Type:  data.LogRecordNormal,
+		})
+		db.rwmu.Lock()
+		defer db.rwmu.Unlock()
+		assert.Nil(t, db.prepareActiveFile(size))
+		return db.reserveWrite(size), encRecord
+	}
+	w1, rec1 := reserve(utils.GetTestKey(1))
+	w2, rec2 := reserve(utils.GetTestKey(2))
+	apply := func(pos *data.LogRecordPos) {
+		t.Error("a write after the hole must not be applied")
+	}
+	injector.AddRule(fio.FaultRule{Op: fio.FaultWrite, Kind: fio.FaultError, Count: 2})
+	assert.NotNil(t, db.finishWrite(w1, rec1, apply))
+	assert.Equal(t, ErrDataFileHole, db.finishWrite(w2, rec2, apply))
+
+	// 下一次写入之前截断空洞，之后的写入重新打开之后都能读到
+	assert.Nil(t, db.Put(utils.GetTestKey(3), []byte("new")))
+	assert.Nil(t, db.writeHole.Load())
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	value, err := db.Get(utils.GetTestKey(0))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("old"), value)
+	value, err = db.Get(utils.GetTestKey(3))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new"), value)
+	for _, i := range []int{1, 2} {
+		_, err = db.Get(utils.GetTestKey(i))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+	destroyDB(db)
+}
+
+func TestEncodePadding(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-padding")
+	defer os.RemoveAll(dir)
+	dataFile, err := data.OpenDataFile(dir, 0, fio.StandardFIO)
+	assert.Nil(t, err)
+	defer dataFile.Close()
+
+	// Value 长度的编码在 64、8192 和 1<<20 附近变长
+	var sizes []int64
+	for size := paddingRecordMinSize; size < 300; size++ {
+		sizes = append(sizes, size)
+	}
+	for _, boundary := range []int64{8192, 1 << 20} {
+		for size := boundary - 16; size < boundary+16; size++ {
+			sizes = append(sizes, size)
+		}
+	}
+	for _, size := range sizes {
+		buf := encodePadding(size)
+		assert.Equal(t, size, int64(len(buf)), "size %d", size)
+		assert.Nil(t, dataFile.Write(buf))
+	}
+
+	// 填充记录都是 Key 为空的删除记录
+	var offset int64
+	for offset < dataFile.Offsetnow {
+		logRecord, size, err := dataFile.ReadLogRecord(offset)
+		assert.Nil(t, err)
+		assert.Equal(t, data.LogRecordDeleted, logRecord.Type)
+		key, _ := parseLogRecordKey(logRecord.Key)
+		assert.Empty(t, key)
+		offset += size
+	}
+	assert.Equal(t, dataFile.Offsetnow, offset)
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"errors"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -36,6 +38,45 @@ func AvailableDiskSize() (uint64, error) {
 	return stat.Bavail * uint64(stat.Bsize), nil
 }
 
+// LinkOrCopyFile 创建文件的硬链接，跨文件系统无法创建硬链接的时候直接拷贝文件
+func LinkOrCopyFile(src, dest string) error {
+	err := os.Link(src, dest)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	info, err := srcFile.Stat()
+	if err != nil {
+		return err
+	}
+	destFile, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_EXCL, info.Mode())
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	if _, err := io.Copy(destFile, srcFile); err != nil {
+		return err
+	}
+	return destFile.Sync()
+}
+
+// SyncDir 持久化目录本身，保证目录中新建、重命名或者删除的文件在崩溃之后仍然有效
+func SyncDir(dirPath string) error {
+	dir, err := os.Open(dirPath)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
 // CopyDir 拷贝数据目录
 func CopyDir(src, dest string, exclude []string) error { //原路径 目标路径 被排除的路径
 	// 目标目标不存在则创建